@@ -0,0 +1,432 @@
+package broker
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClosed       = errors.New("subscription closed")
+	ErrSlowConsumer = errors.New("subscription closed: queue full (slow consumer)")
+)
+
+// Broker is a publish-subscribe message broker with a bounded queue per subscriber.
+// Publishing never blocks: messages with the same key replace older queued messages
+// (the latest state wins) and subscribers whose queue is full anyway are disconnected,
+// so a stalled subscriber cannot block the publisher or other subscribers.
+// Every published message gets a monotonically increasing event id and the latest events
+// are retained in a log, so reconnecting subscribers can resume where they left off.
+type Broker[T any] struct {
+	queueSize int
+	logSize   int
+	key       func(T) string // messages with the same key are coalesced, no coalescing if nil
+
+	lock        sync.Mutex
+	subscribers map[string]map[*Subscription[T]]struct{} // topic -> subscriptions
+	all         map[*Subscription[T]]struct{}            // subscriptions to all topics
+	log         []Event[T]                               // retained events, oldest first
+	lastID      uint64                                   // id of the last published event
+
+	published    atomic.Uint64
+	coalesced    atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+// Event is a published message with its id
+type Event[T any] struct {
+	ID      uint64
+	Topic   string
+	Message T
+	Closed  bool // the topic was closed (only delivered to subscriptions to all topics, Message is empty)
+}
+
+// Stats contains metrics about a broker and the queues of its subscribers
+type Stats struct {
+	Topics         int    `json:"topics"`          // number of topics with at least one subscriber
+	Subscribers    int    `json:"subscribers"`     // number of open subscriptions
+	QueuedMessages int    `json:"queued_messages"` // number of messages waiting in all queues
+	MaxQueueDepth  int    `json:"max_queue_depth"` // number of messages in the fullest queue
+	QueueSize      int    `json:"queue_size"`      // capacity of each queue
+	Published      uint64 `json:"published"`       // number of published messages
+	Coalesced      uint64 `json:"coalesced"`       // number of queued messages that were replaced by a newer one
+	Disconnected   uint64 `json:"disconnected"`    // number of subscribers disconnected because their queue was full
+	LastEventID    uint64 `json:"last_event_id"`   // id of the last published event
+	RetainedEvents int    `json:"retained_events"` // number of events in the log available for replay
+} //@name BrokerStats
+
+// New creates a broker with the given queue size per subscriber retaining the last logSize events
+// key is used to coalesce messages (e.g. the username for auth updates) and may be nil
+func New[T any](queueSize, logSize int, key func(T) string) *Broker[T] {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &Broker[T]{
+		queueSize:   queueSize,
+		logSize:     max(logSize, 0),
+		key:         key,
+		subscribers: make(map[string]map[*Subscription[T]]struct{}),
+		all:         make(map[*Subscription[T]]struct{}),
+		// start with the current time so that event ids keep increasing after a restart
+		lastID: uint64(time.Now().UnixMicro()),
+	}
+}
+
+// Subscribe creates a new subscription to a topic
+// Subscription.StartID returns the id of the last event before the subscription
+// which should be used as the event id of an initial state sent to the subscriber
+func (b *Broker[T]) Subscribe(topic string) *Subscription[T] {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.subscribe(topic)
+}
+
+// SubscribeFrom creates a new subscription to a topic and queues all events after lastEventID
+// Returns false if the events cannot be replayed because they are no longer retained
+// (or the id is unknown), the subscriber then has to fetch the current state instead.
+func (b *Broker[T]) SubscribeFrom(topic string, lastEventID uint64) (*Subscription[T], bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.subscribe(topic)
+	// a closed topic is not replayed, the subscriber already had to authenticate again to resume
+	return s, b.replay(s, lastEventID, func(event Event[T]) bool { return event.Topic == topic && !event.Closed })
+}
+
+// SubscribeAll creates a new subscription to all topics with its own queue size (e.g. for a multiplexed stream)
+// The subscription also receives an event with Closed set when a topic is closed.
+func (b *Broker[T]) SubscribeAll(queueSize int) *Subscription[T] {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.subscribeAll(queueSize)
+}
+
+// SubscribeAllFrom creates a new subscription to all topics and queues all events after lastEventID (see SubscribeFrom)
+func (b *Broker[T]) SubscribeAllFrom(lastEventID uint64, queueSize int) (*Subscription[T], bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.subscribeAll(queueSize)
+	return s, b.replay(s, lastEventID, func(Event[T]) bool { return true })
+}
+
+// replay queues the retained events after lastEventID that match and returns false if they are no longer retained
+func (b *Broker[T]) replay(s *Subscription[T], lastEventID uint64, match func(Event[T]) bool) bool {
+	firstRetainedID := b.lastID + 1
+	if len(b.log) > 0 {
+		firstRetainedID = b.log[0].ID
+	}
+	if lastEventID+1 < firstRetainedID || lastEventID > b.lastID {
+		return false
+	}
+	for _, event := range b.log {
+		if event.ID > lastEventID && match(event) {
+			s.replay(event)
+		}
+	}
+	return true
+}
+
+func (b *Broker[T]) newSubscription(topic string, queueSize int) *Subscription[T] {
+	return &Subscription[T]{
+		broker:    b,
+		topic:     topic,
+		queueSize: max(queueSize, 1),
+		startID:   b.lastID,
+		ready:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (b *Broker[T]) subscribeAll(queueSize int) *Subscription[T] {
+	s := b.newSubscription("", queueSize)
+	s.all = true
+	b.all[s] = struct{}{}
+	return s
+}
+
+func (b *Broker[T]) subscribe(topic string) *Subscription[T] {
+	s := b.newSubscription(topic, b.queueSize)
+	subs, ok := b.subscribers[topic]
+	if !ok {
+		subs = make(map[*Subscription[T]]struct{})
+		b.subscribers[topic] = subs
+	}
+	subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes and closes a subscription, it is safe to call multiple times
+func (b *Broker[T]) Unsubscribe(s *Subscription[T]) {
+	b.remove(s)
+	s.close(ErrClosed)
+}
+
+// Publish enqueues a message for all subscribers of a topic without blocking and returns its event id
+func (b *Broker[T]) Publish(topic string, msg T) uint64 {
+	b.lock.Lock()
+	event := Event[T]{ID: b.lastID + 1, Topic: topic, Message: msg}
+	slowConsumers := b.publishLocked(event)
+	b.lock.Unlock()
+	b.disconnect(slowConsumers)
+	return event.ID
+}
+
+// PublishEvent enqueues an event with an id that was assigned elsewhere (e.g. by an event bus)
+// Events with an id that is not greater than the id of the last event are ignored.
+// Events with Closed set close the topic (see CloseTopic).
+func (b *Broker[T]) PublishEvent(event Event[T]) {
+	b.lock.Lock()
+	if event.ID <= b.lastID {
+		b.lock.Unlock()
+		return
+	}
+	if event.Closed {
+		subs, slowConsumers := b.closeTopicLocked(event)
+		b.lock.Unlock()
+		b.closeAll(subs)
+		b.disconnect(slowConsumers)
+		return
+	}
+	slowConsumers := b.publishLocked(event)
+	b.lock.Unlock()
+	b.disconnect(slowConsumers)
+}
+
+// publishLocked logs and enqueues an event and returns the subscribers whose queue is full
+// enqueueing while holding the lock ensures that subscribers receive the events in order of their ids
+func (b *Broker[T]) publishLocked(event Event[T]) []*Subscription[T] {
+	b.published.Add(1)
+	b.lastID = event.ID
+	if b.logSize > 0 {
+		if len(b.log) >= b.logSize {
+			b.log = b.log[1:] // append reallocates when the capacity is exhausted, so the memory stays bounded
+		}
+		b.log = append(b.log, event)
+	}
+	var slowConsumers []*Subscription[T]
+	if !event.Closed {
+		for s := range b.subscribers[event.Topic] {
+			if !s.enqueue(event) {
+				slowConsumers = append(slowConsumers, s)
+			}
+		}
+	}
+	for s := range b.all {
+		if !s.enqueue(event) {
+			slowConsumers = append(slowConsumers, s)
+		}
+	}
+	return slowConsumers
+}
+
+func (b *Broker[T]) disconnect(slowConsumers []*Subscription[T]) {
+	for _, s := range slowConsumers {
+		b.disconnected.Add(1)
+		b.remove(s)
+		s.close(ErrSlowConsumer)
+	}
+}
+
+// LastEventID returns the id of the last published event
+func (b *Broker[T]) LastEventID() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.lastID
+}
+
+// CloseTopic closes all subscriptions of a topic
+// and publishes an event with Closed set to the subscriptions to all topics
+func (b *Broker[T]) CloseTopic(topic string) {
+	b.lock.Lock()
+	event := Event[T]{ID: b.lastID + 1, Topic: topic, Closed: true}
+	subs, slowConsumers := b.closeTopicLocked(event)
+	b.lock.Unlock()
+	b.closeAll(subs)
+	b.disconnect(slowConsumers)
+}
+
+// closeTopicLocked publishes a close event and returns the removed subscriptions of the topic and the slow consumers
+func (b *Broker[T]) closeTopicLocked(event Event[T]) (map[*Subscription[T]]struct{}, []*Subscription[T]) {
+	subs := b.subscribers[event.Topic]
+	delete(b.subscribers, event.Topic)
+	return subs, b.publishLocked(event)
+}
+
+func (b *Broker[T]) closeAll(subs map[*Subscription[T]]struct{}) {
+	for s := range subs {
+		s.close(ErrClosed)
+	}
+}
+
+// HasSubscribers reports whether a topic has at least one subscriber
+func (b *Broker[T]) HasSubscribers(topic string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.subscribers[topic]) > 0
+}
+
+func (b *Broker[T]) Stats() Stats {
+	b.lock.Lock()
+	stats := Stats{
+		Topics:         len(b.subscribers),
+		QueueSize:      b.queueSize,
+		LastEventID:    b.lastID,
+		RetainedEvents: len(b.log),
+	}
+	var subs []*Subscription[T]
+	for _, topicSubs := range b.subscribers {
+		for s := range topicSubs {
+			subs = append(subs, s)
+		}
+	}
+	for s := range b.all {
+		subs = append(subs, s)
+	}
+	b.lock.Unlock()
+
+	stats.Subscribers = len(subs)
+	for _, s := range subs {
+		depth := s.Len()
+		stats.QueuedMessages += depth
+		stats.MaxQueueDepth = max(stats.MaxQueueDepth, depth)
+	}
+	stats.Published = b.published.Load()
+	stats.Coalesced = b.coalesced.Load()
+	stats.Disconnected = b.disconnected.Load()
+	return stats
+}
+
+func (b *Broker[T]) remove(s *Subscription[T]) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if s.all {
+		delete(b.all, s)
+		return
+	}
+	subs, ok := b.subscribers[s.topic]
+	if !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(b.subscribers, s.topic)
+	}
+}
+
+// Subscription is a bounded queue of messages for one subscriber
+type Subscription[T any] struct {
+	broker    *Broker[T]
+	topic     string // empty for subscriptions to all topics
+	all       bool
+	queueSize int
+	startID   uint64
+
+	lock   sync.Mutex
+	queue  []Event[T]
+	ready  chan struct{} // signaled when the queue is not empty
+	done   chan struct{} // closed when the subscription is closed
+	closed bool
+	err    error
+}
+
+// StartID returns the id of the last event published before this subscription was created
+func (s *Subscription[T]) StartID() uint64 {
+	return s.startID
+}
+
+// Ready is signaled when messages can be received with Drain
+func (s *Subscription[T]) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed when the subscription was closed (see Err for the reason)
+func (s *Subscription[T]) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription was closed or nil if it is still open
+func (s *Subscription[T]) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Drain removes and returns all queued events
+func (s *Subscription[T]) Drain() []Event[T] {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msgs := s.queue
+	s.queue = nil
+	return msgs
+}
+
+// Len returns the number of queued messages
+func (s *Subscription[T]) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.queue)
+}
+
+// enqueue adds an event to the queue and returns false if the queue is full
+func (s *Subscription[T]) enqueue(event Event[T]) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return true
+	}
+	if s.coalesce(event) {
+		return true
+	}
+	if len(s.queue) >= s.queueSize {
+		return false
+	}
+	s.queue = append(s.queue, event)
+	s.signal()
+	return true
+}
+
+// replay adds a retained event to the queue of a new subscription ignoring the queue size
+func (s *Subscription[T]) replay(event Event[T]) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.coalesce(event) {
+		s.queue = append(s.queue, event)
+	}
+	s.signal()
+}
+
+// coalesce replaces a queued event with the same key and returns true if one was replaced
+func (s *Subscription[T]) coalesce(event Event[T]) bool {
+	if s.broker.key == nil || event.Closed {
+		return false
+	}
+	key := s.broker.key(event.Message)
+	for i, queued := range s.queue {
+		if !queued.Closed && queued.Topic == event.Topic && s.broker.key(queued.Message) == key {
+			// the latest state wins, move it to the end to keep the events ordered by id
+			s.queue = append(slices.Delete(s.queue, i, i+1), event)
+			s.broker.coalesced.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription[T]) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+func (s *Subscription[T]) close(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.done)
+}
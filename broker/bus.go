@@ -0,0 +1,36 @@
+package broker
+
+// Bus distributes published messages to the brokers of all instances of the service
+type Bus[T any] interface {
+	// Publish sends a message to the subscribers of a topic on all instances
+	Publish(topic string, msg T)
+	// CloseTopic closes all subscriptions of a topic on all instances
+	CloseTopic(topic string)
+	// Broker returns the local broker to subscribe to
+	Broker() *Broker[T]
+	// Close stops receiving the messages of other instances
+	Close()
+}
+
+// LocalBus only delivers messages to the subscribers of this instance
+type LocalBus[T any] struct {
+	broker *Broker[T]
+}
+
+func NewLocalBus[T any](broker *Broker[T]) *LocalBus[T] {
+	return &LocalBus[T]{broker}
+}
+
+func (l *LocalBus[T]) Publish(topic string, msg T) {
+	l.broker.Publish(topic, msg)
+}
+
+func (l *LocalBus[T]) CloseTopic(topic string) {
+	l.broker.CloseTopic(topic)
+}
+
+func (l *LocalBus[T]) Broker() *Broker[T] {
+	return l.broker
+}
+
+func (l *LocalBus[T]) Close() {}
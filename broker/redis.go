@@ -0,0 +1,180 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBus distributes messages to all instances using a Redis stream.
+// Every instance reads the whole stream and publishes the entries to its local broker
+// with an event id derived from the stream entry id, so the event ids are the same on all instances
+// and a subscriber can resume its stream (Last-Event-ID) on any instance.
+type RedisBus[T any] struct {
+	client redis.UniversalClient
+	stream string
+	maxLen int64
+	broker *Broker[T]
+
+	ctx    context.Context // canceled by Close
+	cancel context.CancelFunc
+	done   chan struct{} // closed when run returned
+}
+
+// NewRedisBus creates a bus on the given Redis stream, loads the latest maxLen entries into the broker's log
+// and starts reading new entries in the background until the bus is closed
+func NewRedisBus[T any](client redis.UniversalClient, stream string, maxLen int, broker *Broker[T]) *RedisBus[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &RedisBus[T]{
+		client: client,
+		stream: stream,
+		maxLen: int64(max(maxLen, 1)),
+		broker: broker,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *RedisBus[T]) Publish(topic string, msg T) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("RedisBus: could not marshal message for stream", r.stream, ":", err)
+		return
+	}
+	if err := r.add(map[string]any{"topic": topic, "data": data}); err != nil {
+		// deliver at least to the subscribers of this instance
+		log.Println("RedisBus: could not publish to stream", r.stream, "(delivering locally only):", err)
+		r.broker.Publish(topic, msg)
+	}
+}
+
+func (r *RedisBus[T]) CloseTopic(topic string) {
+	if err := r.add(map[string]any{"topic": topic, "close": "1"}); err != nil {
+		log.Println("RedisBus: could not publish close of topic", topic, "to stream", r.stream, "(closing locally only):", err)
+		r.broker.CloseTopic(topic)
+	}
+}
+
+func (r *RedisBus[T]) add(values map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.stream,
+		MaxLen: r.maxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+func (r *RedisBus[T]) Broker() *Broker[T] {
+	return r.broker
+}
+
+// Close stops reading the stream and waits until the reader returned (the client is not closed)
+func (r *RedisBus[T]) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// run reads the stream and publishes all entries to the local broker until the bus is closed
+func (r *RedisBus[T]) run() {
+	defer close(r.done)
+	ctx := r.ctx
+	lastStreamID := "$" // only new entries if the backlog could not be loaded
+	backlog, err := r.client.XRevRangeN(ctx, r.stream, "+", "-", r.maxLen).Result()
+	if ctx.Err() != nil { // closed
+		return
+	}
+	if err != nil {
+		log.Println("RedisBus: could not load backlog of stream", r.stream, ":", err)
+	} else {
+		if len(backlog) > 0 {
+			lastStreamID = backlog[0].ID
+		} else {
+			lastStreamID = "0"
+		}
+		for i := len(backlog) - 1; i >= 0; i-- {
+			r.deliver(backlog[i], true)
+		}
+	}
+	for {
+		streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{r.stream, lastStreamID},
+			Block:   5 * time.Second,
+		}).Result()
+		if ctx.Err() != nil { // closed
+			return
+		}
+		if errors.Is(err, redis.Nil) { // timeout without new entries
+			continue
+		}
+		if err != nil {
+			log.Println("RedisBus: could not read stream", r.stream, ":", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				r.deliver(entry, false)
+				lastStreamID = entry.ID
+			}
+		}
+	}
+}
+
+func (r *RedisBus[T]) deliver(entry redis.XMessage, replay bool) {
+	topic, _ := entry.Values["topic"].(string)
+	id, err := EventIDFromStreamID(entry.ID)
+	if err != nil {
+		log.Println("RedisBus: invalid entry id in stream", r.stream, ":", err)
+		return
+	}
+	if _, ok := entry.Values["close"]; ok {
+		if !replay { // subscriptions that were created after the close must not be closed
+			r.broker.PublishEvent(Event[T]{ID: id, Topic: topic, Closed: true})
+		}
+		return
+	}
+	data, _ := entry.Values["data"].(string)
+	var msg T
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		log.Println("RedisBus: could not unmarshal entry", entry.ID, "of stream", r.stream, ":", err)
+		return
+	}
+	r.broker.PublishEvent(Event[T]{ID: id, Topic: topic, Message: msg})
+}
+
+// EventIDFromStreamID converts a stream entry id "<milliseconds>-<sequence>" into an increasing event id
+// (the milliseconds are shifted to leave 20 bits for the sequence number)
+func EventIDFromStreamID(streamID string) (uint64, error) {
+	msStr, seqStr, ok := strings.Cut(streamID, "-")
+	if !ok {
+		return 0, fmt.Errorf("malformed stream id %q", streamID)
+	}
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if seq >= 1<<20 {
+		return 0, fmt.Errorf("sequence number of stream id %q too large", streamID)
+	}
+	return ms<<20 | seq, nil
+}
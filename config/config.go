@@ -1,8 +1,12 @@
 package config
 
 import (
-	"log"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -10,18 +14,28 @@ import (
 )
 
 var (
+	DatabaseDriver string = getString("DB_DRIVER", "postgres") // "postgres", "sqlite" (single file, without Redis) or "memory" (runs in-process without PostgreSQL and Redis, nothing is persisted)
+
+	DatabaseAutoMigrate bool = getBool("DB_AUTO_MIGRATE", true) // apply pending schema migrations on startup, otherwise refuse to start until "heimdall migrate up" was run
+
+	// SQLite Database
+	DatabaseFile string = getString("DB_FILE", "heimdall.db") // path of the database file if DB_DRIVER=sqlite
+
 	// PostgreSQL Database
 	DatabaseHost     string = getString("DB_HOST", "localhost")
 	DatabasePort     int    = getInt("DB_PORT", 5432)
 	DatabaseUser     string = getString("DB_USER", "postgres")
-	DatabasePassword string = getString("DB_PASS", "postgres")
+	DatabasePassword string = getSecret("DB_PASS", "postgres")
 	DatabaseName     string = getString("DB_NAME", "heimdall")
 
+	// Session storage
+	SessionStorage string = getString("SESSION_STORAGE", "") // "redis", "database" (the SQL database of DB_DRIVER), "memory" (lost on restart, not shared between instances) or "" (redis with DB_DRIVER=postgres, otherwise memory)
+
 	// Redis Database
 	RedisHost     string = getString("REDIS_HOST", "127.0.0.1")
 	RedisPort     int    = getInt("REDIS_PORT", 6379)
 	RedisUser     string = getString("REDIS_USER", "")
-	RedisPassword string = getString("REDIS_PASSWORD", "")
+	RedisPassword string = getSecret("REDIS_PASSWORD", "")
 
 	// Crypto hashing
 	HashBCryptCostFactor int = getInt("BCRYPT_COST_FACTOR", 0) // if <12 or >31 the cost factor will be calculated based on HASHING_TIME_MS
@@ -33,38 +47,100 @@ var (
 
 	ProxyHeader string = getString("PROXY_HEADER", "X-Real-Ip") // "X-Real-Ip" behind a reverse proxy and "" for hosting without a proxy
 
-	// Cross-Origin-Resource-Sharing
-	CorsAllowOrigins     string = getString("CORS_ALLOW_ORIGINS", ApiHost) // by default only allow the API host, add allowed origins by appending them separated with commas
-	CorsAllowCredentials bool   = getBool("CORS_ALLOW_CREDENTIALS", false)
+	// Cross-Origin-Resource-Sharing (reloadable)
+	CorsAllowCredentials bool                = getBool("CORS_ALLOW_CREDENTIALS", false)
+	CorsAllowOrigins     *Reloadable[string] = newReloadable(loadCorsAllowOrigins) // by default only allow the API host, add allowed origins by appending them separated with commas
 
-	// Rate limiter
-	DisableRateLimiter bool = getBool("DISABLE_RATE_LIMITER", false)
+	// Rate limiter (reloadable)
+	DisableRateLimiter     *Reloadable[bool] = newReloadable(func() bool { return getBool("DISABLE_RATE_LIMITER", false) })
+	RateLimit              *Reloadable[int]  = newReloadable(func() int { return getInt("RATE_LIMIT", 300) })               // requests per minute and client
+	UnauthorizedRateLimit  *Reloadable[int]  = newReloadable(func() int { return getInt("RATE_LIMIT_UNAUTHORIZED", 6) })    // login, register, reauthenticate and bootstrap requests per minute and client
+	PasswordCheckRateLimit *Reloadable[int]  = newReloadable(func() int { return getInt("RATE_LIMIT_PASSWORD_CHECK", 30) }) // password-check requests per minute and client (checked while typing a new password)
 
 	// Domain specific config
-	AdminRoleName                    string        = getString("ADMIN_ROLENAME", "admin")
-	DeployRoleName                   string        = getString("DEPLOY_ROLENAME", "deploy")
-	RegistrationKeyLength            int           = getInt("REGISTRATION_KEY_LENGTH", 20)
-	ApiTokenExpirationTime           time.Duration = getDuration("API_TOKEN_EXPIRATION_TIME", 3*24*time.Hour)
-	ApiTokenGarbageCollectorInterval time.Duration = getDuration("API_TOKEN_GARBAGE_COLLECTOR_INTERVAL", 1*time.Hour)
-	MinPasswordLength                int           = getInt("MIN_PASSWORD_LENGTH", 12)
-	InternalIPs                      []net.IP      = parseIPs(getString("INTERNAL_IPS", ""))
-	RestrictLoginToAdmins            bool          = getBool("RESTRICT_LOGIN_TO_ADMINS", false)
-
-	UseTestDatabase bool = getBool("USE_TEST_DATABASE", false) // TODO: remove in prod - this function deletes the whole database
+	AdminRoleName                    string                = getString("ADMIN_ROLENAME", "admin")
+	DeployRoleName                   string                = getString("DEPLOY_ROLENAME", "deploy")
+	RegistrationKeyLength            int                   = getInt("REGISTRATION_KEY_LENGTH", 20)
+	ApiTokenExpirationTime           time.Duration         = getDuration("API_TOKEN_EXPIRATION_TIME", 3*24*time.Hour)
+	ApiTokenGarbageCollectorInterval time.Duration         = getDuration("API_TOKEN_GARBAGE_COLLECTOR_INTERVAL", 1*time.Hour)
+	ApiTokenExpiryWarning            time.Duration         = getDuration("API_TOKEN_EXPIRY_WARNING", 1*time.Hour) // how long before a non-permanent API token expires its subscribers are warned ("expiring" event), 0 disables the warning
+	MinPasswordLength                int                   = getInt("MIN_PASSWORD_LENGTH", 12)
+	PasswordHistoryLength            int                   = getInt("PASSWORD_HISTORY_LENGTH", 5)                                              // number of previous passwords per user that cannot be reused (0 disables the password history)
+	PasswordMinStrengthScore         int                   = getInt("PASSWORD_MIN_STRENGTH_SCORE", 0)                                          // estimated password strength from 0 (too guessable) to 4 (very unguessable)
+	PasswordMinCharacterClasses      int                   = getInt("PASSWORD_MIN_CHARACTER_CLASSES", 0)                                       // number of required character classes (lowercase, uppercase, digits, symbols)
+	PasswordDisallowUserInfo         bool                  = getBool("PASSWORD_DISALLOW_USER_INFO", true)                                      // reject passwords containing the username or email
+	BreachedPasswordsFile            string                = getString("BREACHED_PASSWORDS_FILE", "")                                          // file with SHA-1 hashes of breached passwords ("HASH:COUNT" per line as in the HIBP corpus), disabled if empty. Kept in memory with 8 bytes per hash: the full corpus (~900M hashes) needs ~7 GB
+	BreachedPasswordsMinCount        int                   = getInt("BREACHED_PASSWORDS_MIN_COUNT", 1)                                         // only load hashes that appeared in at least this many breaches (reduces memory usage)
+	InternalIPs                      *Reloadable[[]net.IP] = newReloadable(func() []net.IP { return parseIPs(getString("INTERNAL_IPS", "")) }) // IPs that can access the internal API in addition to loopback and private IPs (reloadable)
+	RestrictLoginToAdmins            bool                  = getBool("RESTRICT_LOGIN_TO_ADMINS", false)
+	EventQueueSize                   int                   = getInt("EVENT_QUEUE_SIZE", 64)                               // messages queued per subscriber of the internal API before it is disconnected as a slow consumer
+	EventLogSize                     int                   = getInt("EVENT_LOG_SIZE", 1000)                               // number of retained events per stream that can be replayed when a subscriber reconnects with Last-Event-ID
+	WatchQueueSize                   int                   = getInt("WATCH_QUEUE_SIZE", 4096)                             // messages queued per subscriber of the multiplexed watch streams (all users) before it is disconnected as a slow consumer
+	EventBus                         string                = getString("EVENT_BUS", "")                                   // "redis" propagates events to the subscribers of all instances via Redis Streams, "local" only to subscribers of this instance, "" (redis with DB_DRIVER=postgres, otherwise local)
+	WebSocketPingInterval            time.Duration         = getDuration("WEBSOCKET_PING_INTERVAL", 15*time.Second)       // how often clients of the internal WebSocket API are pinged, the connection is closed if no pong arrives within two intervals
+	RecentAuthenticationMaxAge       time.Duration         = getDuration("RECENT_AUTHENTICATION_MAX_AGE", 15*time.Minute) // how long after (re-)authenticating admins can change or delete other users
+	WebhookTimeout                   time.Duration         = getDuration("WEBHOOK_TIMEOUT", 10*time.Second)               // timeout of a single webhook request
+	WebhookMaxAttempts               int                   = getInt("WEBHOOK_MAX_ATTEMPTS", 8)                            // attempts before a delivery is moved to the dead-letter list
+	WebhookInitialBackoff            time.Duration         = getDuration("WEBHOOK_INITIAL_BACKOFF", 30*time.Second)       // delay before the first retry, doubled for each further retry
+	WebhookMaxBackoff                time.Duration         = getDuration("WEBHOOK_MAX_BACKOFF", 6*time.Hour)              // upper bound of the delay between retries
+	WebhookWorkerInterval            time.Duration         = getDuration("WEBHOOK_WORKER_INTERVAL", 10*time.Second)       // how often due retries are looked up
+	WebhookDeliveryRetention         time.Duration         = getDuration("WEBHOOK_DELIVERY_RETENTION", 30*24*time.Hour)   // how long finished deliveries (including dead letters) are kept in the delivery log
+	OutboxPollInterval               time.Duration         = getDuration("OUTBOX_POLL_INTERVAL", 5*time.Second)           // how often undispatched change notifications are looked up (e.g. after a crash of another instance)
+	OutboxRetryInterval              time.Duration         = getDuration("OUTBOX_RETRY_INTERVAL", 30*time.Second)         // delay before dispatching a change notification again after it failed
+	OutboxRetention                  time.Duration         = getDuration("OUTBOX_RETENTION", 24*time.Hour)                // how long dispatched change notifications are kept in the outbox table
+	AuditRetention                   time.Duration         = getDuration("AUDIT_RETENTION", 365*24*time.Hour)             // how long entries of the audit log are kept, 0 keeps them forever
+	AuditSigningKey                  string                = getSecret("AUDIT_SIGNING_KEY", "")                           // base64 encoded Ed25519 seed (32 bytes) for signing checkpoints of the audit log, no checkpoints are written if empty
+	AuditCheckpointInterval          time.Duration         = getDuration("AUDIT_CHECKPOINT_INTERVAL", time.Hour)          // how often a signed checkpoint of the audit log is written (if there are new entries)
+	AuditTrustedPublicKeys           []string              = parsePublicKeys(getString("AUDIT_TRUSTED_PUBLIC_KEYS", ""))  // base64 encoded Ed25519 public keys of previous AUDIT_SIGNING_KEYs separated with commas, their checkpoints stay valid after a key rotation
+
+	// Bootstrap of the first admin on startup (if there is no admin yet)
+	// Without credentials a one-time setup token for POST /bootstrap is printed to the log instead.
+	BootstrapAdminUsername string = getString("BOOTSTRAP_ADMIN_USERNAME", "")
+	BootstrapAdminPassword string = getSecret("BOOTSTRAP_ADMIN_PASSWORD", "")
+	BootstrapAdminEmail    string = getString("BOOTSTRAP_ADMIN_EMAIL", "")
+	SeedFile               string = getString("SEED_FILE", "") // YAML or JSON file with roles, registration keys and users that are created on startup if they do not exist (see setup/test_seed.yaml)
 )
 
 func getString(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	value, _ := lookup(key, defaultValue, false)
+	return value
+}
+
+// getSecret reads the value from the file named by <key>_FILE (e.g. a Docker or Kubernetes secret) if it is set
+// and from the variable itself otherwise. Every secret (passwords, signing keys, ...) must be read with getSecret,
+// its value is redacted in "heimdall config print" and its file is read again on reload.
+func getSecret(key, defaultValue string) string {
+	lookup(key+"_FILE", "", false)
+	value, source, err := readSecret(key, defaultValue)
+	if err != nil {
+		addError(err)
 	}
-	return defaultValue
+	register(key, value, defaultValue, source, true)
+	return value
+}
+
+// readSecret returns the value of a secret and its source without registering it
+func readSecret(key, defaultValue string) (string, string, error) {
+	value, source := lookupValue(key, defaultValue)
+	file, _ := lookupValue(key+"_FILE", "")
+	if file == "" {
+		return value, source, nil
+	}
+	if source != SourceDefault {
+		return defaultValue, SourceDefault, fmt.Errorf("%s and %s_FILE: only one of them can be set", key, key)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return defaultValue, SourceDefault, fmt.Errorf("%s_FILE=%s: could not read it: %w", key, file, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), SourceSecretFile, nil
 }
 
 func getInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookup(key, strconv.Itoa(defaultValue), false); exists {
 		s, err := strconv.Atoi(value)
 		if err != nil {
-			log.Printf("Found Config %s=%s, but could not parse it (int required)", key, value)
+			addError(fmt.Errorf("%s=%s: could not parse it (int required)", key, value))
 			return defaultValue
 		}
 		return s
@@ -73,10 +149,10 @@ func getInt(key string, defaultValue int) int {
 }
 
 func getBool(key string, defaultValue bool) bool {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookup(key, strconv.FormatBool(defaultValue), false); exists {
 		s, err := strconv.ParseBool(value)
 		if err != nil {
-			log.Printf("Found Config %s=%s, but could not parse it (bool required)", key, value)
+			addError(fmt.Errorf("%s=%s: could not parse it (bool required)", key, value))
 			return defaultValue
 		}
 		return s
@@ -85,10 +161,10 @@ func getBool(key string, defaultValue bool) bool {
 }
 
 func getDuration(key string, defaultValue time.Duration) time.Duration {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookup(key, defaultValue.String(), false); exists {
 		d, err := time.ParseDuration(value)
 		if err != nil {
-			log.Printf("Found Config %s=%s, but could not parse it (duration required, e.g. \"1s\")", key, value)
+			addError(fmt.Errorf("%s=%s: could not parse it (duration required, e.g. \"1s\")", key, value))
 			return defaultValue
 		}
 		return d
@@ -103,11 +179,47 @@ func parseIPs(ipsString string) []net.IP {
 	}
 	ipStrings := strings.Split(ipsString, ",")
 	for _, ipString := range ipStrings {
-		ip := net.ParseIP(ipString)
+		ip := net.ParseIP(strings.TrimSpace(ipString))
 		if ip == nil {
-			panic("Error: could not parse IP from INTERNAL_IPS: " + ipString)
+			addError(fmt.Errorf("INTERNAL_IPS: could not parse IP %q", ipString))
+			continue
 		}
 		ips = append(ips, ip)
 	}
 	return ips
 }
+
+func parsePublicKeys(keysString string) []string {
+	var keys []string
+	if keysString == "" {
+		return keys
+	}
+	for _, key := range strings.Split(keysString, ",") {
+		key = strings.TrimSpace(key)
+		if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != ed25519.PublicKeySize {
+			addError(fmt.Errorf("AUDIT_TRUSTED_PUBLIC_KEYS: invalid Ed25519 public key %q", key))
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// loadCorsAllowOrigins validates the origins like the CORS middleware which panics on invalid origins
+func loadCorsAllowOrigins() string {
+	origins := getString("CORS_ALLOW_ORIGINS", ApiHost)
+	if origins == "*" {
+		if CorsAllowCredentials {
+			addError(errors.New("CORS_ALLOW_ORIGINS=*: not allowed with CORS_ALLOW_CREDENTIALS=true"))
+		}
+		return origins
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimSpace(strings.Replace(origin, "://*.", "://", 1)) // subdomain wildcard
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" || strings.Contains(u.Host, "*") || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			addError(fmt.Errorf("CORS_ALLOW_ORIGINS: invalid origin %q (scheme://host[:port] required)", origin))
+		}
+	}
+	return origins
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the optional YAML (or JSON) file with settings, set by the environment variable CONFIG_FILE
+// Its keys are the names of the environment variables (case-insensitive), the environment variables take precedence.
+var ConfigFile string = os.Getenv("CONFIG_FILE")
+
+// fileValues are the settings of the config file
+var fileValues map[string]string = loadFileValues()
+
+func loadFileValues() map[string]string {
+	values, err := readConfigFile(ConfigFile)
+	if err != nil {
+		addError(err)
+	}
+	return values
+}
+
+// readConfigFile reads the settings of a config file (none if the path is empty)
+// Lists are joined with commas (e.g. the origins of CORS_ALLOW_ORIGINS).
+func readConfigFile(path string) (map[string]string, error) {
+	values := make(map[string]string)
+	if path == "" {
+		return values, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return values, fmt.Errorf("could not read CONFIG_FILE: %w", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return values, fmt.Errorf("could not parse CONFIG_FILE %s: %w", path, err)
+	}
+	for key, value := range raw {
+		key = strings.ToUpper(key)
+		switch v := value.(type) {
+		case nil:
+			values[key] = ""
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]any:
+			return values, fmt.Errorf("%s in CONFIG_FILE %s: nested settings are not supported", key, path)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
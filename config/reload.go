@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Reloadable is a setting that is reloaded from the environment and the config file by Reload (on SIGHUP)
+// Its value must be read with Get every time it is used.
+type Reloadable[T any] struct {
+	value     atomic.Pointer[T]
+	candidate *T // value loaded by Reload that is validated before it is applied (guarded by reloadLock)
+	load      func() T
+}
+
+// reloader loads the new value of a Reloadable as its candidate and applies or discards it
+type reloader interface {
+	reload()
+	finishReload(apply bool)
+}
+
+var (
+	reloadLock  sync.Mutex
+	reloadables []reloader
+)
+
+func newReloadable[T any](load func() T) *Reloadable[T] {
+	r := &Reloadable[T]{load: load}
+	r.value.Store(r.loadValue())
+	reloadables = append(reloadables, r)
+	return r
+}
+
+// NewReloadable returns a Reloadable with a fixed value (e.g. for tests), it is not changed by Reload
+func NewReloadable[T any](value T) *Reloadable[T] {
+	r := &Reloadable[T]{}
+	r.value.Store(&value)
+	return r
+}
+
+func (r *Reloadable[T]) Get() T {
+	return *r.value.Load()
+}
+
+// Set overrides the value until the next reload (e.g. in tests)
+func (r *Reloadable[T]) Set(value T) {
+	r.value.Store(&value)
+}
+
+func (r *Reloadable[T]) loadValue() *T {
+	loadingReloadable = true
+	defer func() { loadingReloadable = false }()
+	value := r.load()
+	return &value
+}
+
+// next returns the candidate during a reload and the current value otherwise (used by validate)
+func (r *Reloadable[T]) next() T {
+	if r.candidate != nil {
+		return *r.candidate
+	}
+	return r.Get()
+}
+
+func (r *Reloadable[T]) reload() {
+	r.candidate = r.loadValue()
+}
+
+func (r *Reloadable[T]) finishReload(apply bool) {
+	if apply {
+		r.value.Store(r.candidate)
+	}
+	r.candidate = nil
+}
+
+// Reload reads the config file and the environment again and applies the new values of the reloadable settings
+// if all of them are valid (otherwise nothing is changed).
+// It returns the names of the changed settings that only take effect after a restart (including rotated secrets).
+func Reload() (restartRequired []string, err error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	values, err := readConfigFile(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if unknown := unknownFileSettings(values); len(unknown) > 0 {
+		return nil, errors.Join(unknown...)
+	}
+	previous := snapshotSettings()
+	previousValues, previousErrs := fileValues, swapErrors(nil)
+	defer swapErrors(previousErrs)
+
+	fileValues = values
+	for _, r := range reloadables {
+		r.reload()
+	}
+	for _, err := range validate() { // validates the candidates of the reloadable settings
+		addError(err)
+	}
+	// changes of the other settings require a restart (the files of secrets are read again to detect rotated secrets)
+	for _, setting := range previous {
+		if setting.Reloadable {
+			continue
+		}
+		value, _ := lookupValue(setting.Name, setting.defaultValue)
+		if setting.Secret {
+			var err error
+			if value, _, err = readSecret(setting.Name, setting.defaultValue); err != nil {
+				addError(err)
+			}
+		}
+		if value != setting.raw {
+			restartRequired = append(restartRequired, setting.Name)
+		}
+	}
+	reloadErrs := swapErrors(nil)
+	valid := len(reloadErrs) == 0
+	for _, r := range reloadables {
+		r.finishReload(valid)
+	}
+	if !valid {
+		fileValues = previousValues
+		restoreSettings(previous)
+		return nil, errors.Join(reloadErrs...)
+	}
+	slices.Sort(restartRequired)
+	return restartRequired, nil
+}
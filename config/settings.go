@@ -0,0 +1,140 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Sources of the values of settings
+const (
+	SourceDefault    = "default"
+	SourceFile       = "file" // CONFIG_FILE
+	SourceEnv        = "env"
+	SourceSecretFile = "secret_file" // <KEY>_FILE of secrets
+)
+
+const redacted = "[REDACTED]"
+
+// Setting is the effective value of a setting (see "heimdall config print")
+type Setting struct {
+	Name         string `json:"name"`
+	Value        string `json:"value"` // redacted for secrets
+	Source       string `json:"source"`
+	Reloadable   bool   `json:"reloadable"` // reloaded on SIGHUP
+	Secret       bool   `json:"-"`
+	raw          string // unredacted value
+	defaultValue string
+}
+
+var (
+	settingsLock      sync.Mutex
+	settings          = make(map[string]*Setting) // by name
+	errs              []error                     // errors of parsing the settings
+	loadingReloadable bool                        // the settings registered now are reloadable
+)
+
+// lookup returns the value of a setting from the environment or the config file and registers the setting
+func lookup(key, defaultValue string, secret bool) (string, bool) {
+	value, source := lookupValue(key, defaultValue)
+	register(key, value, defaultValue, source, secret)
+	return value, source != SourceDefault
+}
+
+// lookupValue returns the value of a setting and its source
+func lookupValue(key, defaultValue string) (string, string) {
+	if envValue, exists := os.LookupEnv(key); exists {
+		return envValue, SourceEnv
+	}
+	if fileValue, exists := fileValues[key]; exists {
+		return fileValue, SourceFile
+	}
+	return defaultValue, SourceDefault
+}
+
+func register(key, value, defaultValue, source string, secret bool) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	setting := &Setting{Name: key, Value: value, Source: source, Reloadable: loadingReloadable, Secret: secret, raw: value, defaultValue: defaultValue}
+	if secret && value != "" {
+		setting.Value = redacted
+	}
+	settings[key] = setting
+}
+
+func addError(err error) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	errs = append(errs, err)
+}
+
+// swapErrors replaces the errors of parsing the settings and returns the previous ones
+func swapErrors(newErrs []error) []error {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	previous := errs
+	errs = newErrs
+	return previous
+}
+
+// snapshotSettings returns a copy of the registered settings by name
+func snapshotSettings() map[string]Setting {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	snapshot := make(map[string]Setting, len(settings))
+	for name, setting := range settings {
+		snapshot[name] = *setting
+	}
+	return snapshot
+}
+
+// restoreSettings registers the settings of a snapshot again (e.g. after a failed reload)
+func restoreSettings(snapshot map[string]Setting) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	clear(settings)
+	for name, setting := range snapshot {
+		settings[name] = &setting
+	}
+}
+
+// Settings returns the effective settings ordered by name
+func Settings() []Setting {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	result := make([]Setting, 0, len(settings))
+	for _, setting := range settings {
+		result = append(result, *setting)
+	}
+	slices.SortFunc(result, func(a, b Setting) int { return cmp.Compare(a.Name, b.Name) })
+	return result
+}
+
+// Validate returns the errors of the configuration: values that could not be parsed, invalid values
+// and unknown settings in the config file
+// Heimdall refuses to start with an invalid configuration.
+func Validate() error {
+	settingsLock.Lock()
+	all := slices.Clone(errs)
+	settingsLock.Unlock()
+	all = append(all, unknownFileSettings(fileValues)...)
+	all = append(all, validate()...)
+	return errors.Join(all...)
+}
+
+// unknownFileSettings returns an error for every setting of the config file that is not known (e.g. a typo)
+func unknownFileSettings(values map[string]string) []error {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	var unknown []error
+	for key := range values {
+		if _, known := settings[key]; !known {
+			unknown = append(unknown, fmt.Errorf("unknown setting %s in CONFIG_FILE %s", key, ConfigFile))
+		}
+	}
+	slices.SortFunc(unknown, func(a, b error) int { return cmp.Compare(a.Error(), b.Error()) })
+	return unknown
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// validate returns the errors of settings that could be parsed but have invalid values
+// Reloadable settings must be read with next, so Reload can validate their new values before applying them.
+func validate() []error {
+	var errs []error
+	oneOf := func(key, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			errs = append(errs, fmt.Errorf("%s=%s: must be one of %q", key, value, allowed))
+		}
+	}
+	between := func(key string, value, min, max int) {
+		if value < min || value > max {
+			errs = append(errs, fmt.Errorf("%s=%d: must be between %d and %d", key, value, min, max))
+		}
+	}
+	atLeast := func(key string, value, min int) {
+		if value < min {
+			errs = append(errs, fmt.Errorf("%s=%d: must be at least %d", key, value, min))
+		}
+	}
+	positive := func(key string, value time.Duration) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s=%s: must be positive", key, value))
+		}
+	}
+	nonNegative := func(key string, value time.Duration) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s=%s: must not be negative", key, value))
+		}
+	}
+
+	oneOf("DB_DRIVER", DatabaseDriver, "postgres", "sqlite", "memory")
+	oneOf("SESSION_STORAGE", SessionStorage, "", "redis", "database", "memory")
+	oneOf("EVENT_BUS", EventBus, "", "redis", "local")
+	between("DB_PORT", DatabasePort, 1, 65535)
+	between("REDIS_PORT", RedisPort, 1, 65535)
+	atLeast("HASHING_TIME_MS", HashingTimeMs, 1)
+
+	// the candidates of the reloadable settings during Reload
+	atLeast("RATE_LIMIT", RateLimit.next(), 1)
+	atLeast("RATE_LIMIT_UNAUTHORIZED", UnauthorizedRateLimit.next(), 1)
+	atLeast("RATE_LIMIT_PASSWORD_CHECK", PasswordCheckRateLimit.next(), 1)
+
+	atLeast("REGISTRATION_KEY_LENGTH", RegistrationKeyLength, 1)
+	positive("API_TOKEN_EXPIRATION_TIME", ApiTokenExpirationTime)
+	positive("API_TOKEN_GARBAGE_COLLECTOR_INTERVAL", ApiTokenGarbageCollectorInterval)
+	nonNegative("API_TOKEN_EXPIRY_WARNING", ApiTokenExpiryWarning)
+	atLeast("MIN_PASSWORD_LENGTH", MinPasswordLength, 1)
+	atLeast("PASSWORD_HISTORY_LENGTH", PasswordHistoryLength, 0)
+	between("PASSWORD_MIN_STRENGTH_SCORE", PasswordMinStrengthScore, 0, 4)
+	between("PASSWORD_MIN_CHARACTER_CLASSES", PasswordMinCharacterClasses, 0, 4)
+	atLeast("BREACHED_PASSWORDS_MIN_COUNT", BreachedPasswordsMinCount, 1)
+	atLeast("EVENT_QUEUE_SIZE", EventQueueSize, 1)
+	atLeast("EVENT_LOG_SIZE", EventLogSize, 0)
+	atLeast("WATCH_QUEUE_SIZE", WatchQueueSize, 1)
+	positive("WEBSOCKET_PING_INTERVAL", WebSocketPingInterval)
+	positive("RECENT_AUTHENTICATION_MAX_AGE", RecentAuthenticationMaxAge)
+	positive("WEBHOOK_TIMEOUT", WebhookTimeout)
+	atLeast("WEBHOOK_MAX_ATTEMPTS", WebhookMaxAttempts, 1)
+	positive("WEBHOOK_INITIAL_BACKOFF", WebhookInitialBackoff)
+	positive("WEBHOOK_MAX_BACKOFF", WebhookMaxBackoff)
+	positive("WEBHOOK_WORKER_INTERVAL", WebhookWorkerInterval)
+	nonNegative("WEBHOOK_DELIVERY_RETENTION", WebhookDeliveryRetention)
+	positive("OUTBOX_POLL_INTERVAL", OutboxPollInterval)
+	positive("OUTBOX_RETRY_INTERVAL", OutboxRetryInterval)
+	nonNegative("OUTBOX_RETENTION", OutboxRetention)
+	nonNegative("AUDIT_RETENTION", AuditRetention)
+	positive("AUDIT_CHECKPOINT_INTERVAL", AuditCheckpointInterval)
+
+	if BootstrapAdminUsername != "" && BootstrapAdminPassword == "" {
+		errs = append(errs, fmt.Errorf("BOOTSTRAP_ADMIN_USERNAME=%s: BOOTSTRAP_ADMIN_PASSWORD (or BOOTSTRAP_ADMIN_PASSWORD_FILE) required", BootstrapAdminUsername))
+	}
+	return errs
+}
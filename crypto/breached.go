@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswordSet is a compact in-memory set of breached passwords
+// Only the first 8 bytes of each SHA-1 hash are kept in a sorted slice,
+// so a lookup is a binary search without any allocations or network access.
+// The probability of a false positive is negligible (about n/2^64 for n hashes).
+// The set needs 8 bytes per hash, about 7 GB for the full HIBP corpus of ~900M hashes.
+type BreachedPasswordSet struct {
+	prefixes []uint64
+}
+
+// LoadBreachedPasswordSet reads a file of SHA-1 hashes as provided by Have I Been Pwned
+// (one "HASH:COUNT" per line, e.g. downloaded with the official PwnedPasswordsDownloader),
+// lines without a count are accepted as well.
+// Hashes with a count lower than minCount are skipped to reduce memory usage.
+func LoadBreachedPasswordSet(path string, minCount int) (*BreachedPasswordSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the slice is allocated once for the most hashes the file can contain, growing it by appending
+	// would copy it repeatedly and briefly need up to twice the memory of the full corpus
+	prefixes := make([]uint64, 0, maxBreachedHashCount(file))
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, countStr, hasCount := strings.Cut(line, ":")
+		if hasCount && minCount > 1 {
+			count, err := strconv.Atoi(countStr)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid count %q", path, lineNumber, countStr)
+			}
+			if count < minCount {
+				continue
+			}
+		}
+		if len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("%s:%d: expected a SHA-1 hash in hex, got %q", path, lineNumber, hash)
+		}
+		prefix, err := hex.DecodeString(hash[:16])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		prefixes = append(prefixes, binary.BigEndian.Uint64(prefix))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(prefixes)
+	prefixes = slices.Compact(prefixes)
+	if cap(prefixes) > 2*len(prefixes) {
+		prefixes = slices.Clone(prefixes) // releases the unused capacity if most hashes were skipped by minCount
+	}
+	return &BreachedPasswordSet{slices.Clip(prefixes)}, nil
+}
+
+// maxBreachedHashCount returns the most hashes a file can contain (every line has at least a hash and a newline)
+func maxBreachedHashCount(file *os.File) int {
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	return int(info.Size()/(2*sha1.Size+1)) + 1
+}
+
+// Contains reports whether the password is in the set of breached passwords
+func (b *BreachedPasswordSet) Contains(password string) bool {
+	if b == nil {
+		return false
+	}
+	hash := sha1.Sum([]byte(password))
+	_, found := slices.BinarySearch(b.prefixes, binary.BigEndian.Uint64(hash[:8]))
+	return found
+}
+
+// Len returns the number of hashes in the set
+func (b *BreachedPasswordSet) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.prefixes)
+}
@@ -0,0 +1,42 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+)
+
+// ParseEd25519Seed decodes a base64 encoded Ed25519 seed (32 bytes) into a private key
+func ParseEd25519Seed(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("expected an Ed25519 seed of %d bytes, got %d bytes", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// SignEd25519 returns the base64 encoded Ed25519 signature of message
+func SignEd25519(key ed25519.PrivateKey, message []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, message))
+}
+
+// Ed25519PublicKey returns the base64 encoded public key of a private key
+func Ed25519PublicKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// VerifyEd25519 reports whether signature is the base64 encoded Ed25519 signature of message by the base64 encoded public key
+func VerifyEd25519(publicKey string, message []byte, signature string) bool {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, message, sig)
+}
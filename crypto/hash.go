@@ -31,6 +31,12 @@ func PasswordMatchesHash(password, hash string) bool {
 	return err == nil
 }
 
+// IsPasswordHash returns true if hash is a well-formed bcrypt hash (e.g. of an imported user)
+func IsPasswordHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
 // Estimates the bcrypt hashing cost factor using a microbenchmark
 // Tries to set the cost such that hashing takes ~250ms on the current machine
 func calculateOptimalBCryptCost() int {
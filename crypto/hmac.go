@@ -0,0 +1,25 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SignHMACSHA256 returns the hex encoded HMAC-SHA256 of message using secret as key
+func SignHMACSHA256(secret, message []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHMACSHA256 reports whether signature is the hex encoded HMAC-SHA256 of message (constant time)
+func VerifyHMACSHA256(secret, message []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(message)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -15,93 +15,159 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/internal/authenticate/{username}": {
+        "/archive": {
             "get": {
-                "description": "If the initial request was successful, the connection is kept alive and updates are sent using server sent events (SSE).",
+                "description": "Exports all users (with password hashes), roles, memberships, registration keys and API tokens as a versioned JSON archive (e.g. to migrate to another server or for offline backups). The archive contains secrets, keep it safe! Requires a recent authentication (see /reauthenticate).",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Internal"
+                    "Archive"
                 ],
-                "summary": "Get and subscribe to updates of a user's api token and roles",
+                "summary": "Export all data",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/AuthUpdateMessage"
+                            "$ref": "#/definitions/Archive"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request"
-                    },
                     "401": {
                         "description": "Unauthorized"
                     },
+                    "403": {
+                        "description": "Forbidden"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
-            }
-        },
-        "/internal/users": {
-            "get": {
-                "description": "Returns a list of all users names",
+            },
+            "post": {
+                "description": "Imports an archive of GET /archive in a single transaction after validating the references between its entries. With mode=merge (default) the entries of the archive are created or replace the existing entries with the same name (including the roles and the API token of a user) and other entries are kept. With mode=replace all users, roles, registration keys and API tokens are deleted first (the archive must contain an admin). Every change of a user and its roles is recorded in the audit log. Requires a recent authentication (see /reauthenticate).",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Internal"
+                    "Archive"
+                ],
+                "summary": "Import an archive",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "merge (default) or replace",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Archive",
+                        "name": "archive",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/Archive"
+                        }
+                    }
                 ],
-                "summary": "Get a list of all usernames",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/UserUpdateMessage"
-                            }
+                            "$ref": "#/definitions/ArchiveImportResult"
                         }
                     },
+                    "400": {
+                        "description": "Bad Request"
+                    },
                     "401": {
                         "description": "Unauthorized"
                     },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/login": {
-            "post": {
-                "description": "Log in with username and password (sets a cookie with the session id). Returns the full user information if the login was successful or the user is already logged in.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/audit": {
+            "get": {
+                "description": "Get a page of the audit log of administrative and security-relevant actions (logins, changes of users, roles, registration keys, API tokens and webhooks), newest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Audit"
                 ],
-                "summary": "Login",
+                "summary": "Get audit log",
                 "parameters": [
                     {
-                        "description": "Username and Password",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/LoginPayload"
-                        }
+                        "type": "integer",
+                        "description": "ID of the acting user",
+                        "name": "actor_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the acting user",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action (e.g. login.failed, user.updated, role.assigned)",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Type of the target (user, role, registration_key, token, webhook or archive)",
+                        "name": "target_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the target",
+                        "name": "target_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries created at or after this ISO 8601 datetime",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries created before this ISO 8601 datetime",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/User"
+                            "$ref": "#/definitions/AuditPage"
                         }
                     },
                     "400": {
@@ -110,41 +176,79 @@ const docTemplate = `{
                     "401": {
                         "description": "Unauthorized"
                     },
+                    "403": {
+                        "description": "Forbidden"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/logout": {
-            "post": {
-                "description": "Log out of the current session",
-                "consumes": [
+        "/audit/checkpoints": {
+            "get": {
+                "description": "Get the signed checkpoints of the audit log, oldest first. They can be archived outside of Heimdall to prove later that the log was not rewritten.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "Audit"
+                ],
+                "summary": "Get audit checkpoints",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/AuditCheckpoint"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/audit/verify": {
+            "get": {
+                "description": "Verifies the hash chain of the retained audit entries (every entry contains the hash of the previous entry) and the signed checkpoints (if AUDIT_SIGNING_KEY is configured). Reports the first broken link if the log was altered.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Audit"
                 ],
-                "summary": "Logout",
+                "summary": "Verify audit log",
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/AuditVerification"
+                        }
                     },
                     "401": {
                         "description": "Unauthorized"
                     },
+                    "403": {
+                        "description": "Forbidden"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/register": {
+        "/bootstrap": {
             "post": {
-                "description": "Registers a new user using a registration key",
+                "description": "Creates the first admin of a fresh installation with the one-time setup token that is printed to the log on startup if there is no admin (and no BOOTSTRAP_ADMIN_USERNAME is configured). The token becomes invalid once an admin exists.",
                 "consumes": [
                     "application/json"
                 ],
@@ -154,15 +258,15 @@ const docTemplate = `{
                 "tags": [
                     "Users"
                 ],
-                "summary": "Register user",
+                "summary": "Create the first admin",
                 "parameters": [
                     {
-                        "description": "Username, Password, Email, RegistrationKey",
+                        "description": "SetupToken, Username, Password, Email",
                         "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/RegisterPayload"
+                            "$ref": "#/definitions/BootstrapPayload"
                         }
                     }
                 ],
@@ -188,123 +292,116 @@ const docTemplate = `{
                 }
             }
         },
-        "/registration-keys": {
+        "/internal/authenticate/{username}": {
             "get": {
-                "description": "Get a list of all registration keys or query a single registration key by key (returns single object instead of list)",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "If the initial request was successful, the connection is kept alive and updates are sent using server sent events (SSE) of type \"auth\" with an event id.\nA non-permanent token is announced with an event of type \"expiring\" API_TOKEN_EXPIRY_WARNING before it expires and with an event of type \"expired\" when it expired, after which the connection is closed.\nWhen reconnecting with the Last-Event-ID header, missed events are replayed instead of sending the current state (if they are still retained).",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
                 "tags": [
-                    "RegistrationKeys"
+                    "Internal"
                 ],
-                "summary": "Get all registration keys or query by key",
+                "summary": "Get and subscribe to updates of a user's api token and roles",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Registration Key",
-                        "name": "key",
-                        "in": "query"
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Id of the last received event to resume the stream",
+                        "name": "Last-Event-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/RegistrationKey"
-                            }
+                            "$ref": "#/definitions/AuthUpdateMessage"
                         }
                     },
+                    "400": {
+                        "description": "Bad Request"
+                    },
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
-            },
-            "post": {
-                "description": "Create a new registration key",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/internal/users": {
+            "get": {
+                "description": "Returns a list of all users names and keeps the connection alive to send updates when users are created or removed using server sent events (SSE) of type \"user\" with an event id.\nWhen reconnecting with the Last-Event-ID header, missed events are replayed instead of sending the full list (if they are still retained).",
                 "produces": [
-                    "text/plain"
+                    "text/event-stream"
                 ],
                 "tags": [
-                    "RegistrationKeys"
+                    "Internal"
                 ],
-                "summary": "Create registration key",
+                "summary": "Get a list of all usernames",
                 "parameters": [
                     {
-                        "description": "key, description, permament, expires_at",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/CreateRegistrationKeyPayload"
-                        }
+                        "type": "string",
+                        "description": "Id of the last received event to resume the stream",
+                        "name": "Last-Event-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created"
-                    },
-                    "400": {
-                        "description": "Bad Request"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/UserUpdateMessage"
+                            }
+                        }
                     },
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "409": {
-                        "description": "Conflict"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/registration-keys/{id}": {
+        "/internal/watch": {
             "get": {
-                "description": "Get a registration key by its id",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Multiplexed variant of /internal/authenticate/{username} for the deploy role. First the current state of all (or the given) users is sent as snapshot using SSE of type \"auth\", followed by the updates of these users.\nAn invalidated API token is sent as SSE of type \"closed\" with an AuthClosedMessage (instead of closing the connection). Disabled users and users without an API token are not part of the snapshot.\nThe expiry of a non-permanent token is announced with events of type \"expiring\" and \"expired\" (followed by \"closed\").\nWhen reconnecting with the Last-Event-ID header, missed events are replayed instead of sending the snapshot (if they are still retained).\nThe connection is closed when the API token of the watcher is invalidated, the watcher is disabled or deleted or loses the deploy role.",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
                 "tags": [
-                    "RegistrationKeys"
+                    "Internal"
                 ],
-                "summary": "Get registration key by id",
+                "summary": "Subscribe to updates of the API tokens and roles of many users",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Registration Key ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "Comma separated usernames to watch (all users if empty)",
+                        "name": "usernames",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Id of the last received event to resume the stream",
+                        "name": "Last-Event-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/RegistrationKey"
+                            "$ref": "#/definitions/AuthUpdateMessage"
                         }
                     },
                     "400": {
@@ -316,83 +413,67 @@ const docTemplate = `{
                     "403": {
                         "description": "Forbidden"
                     },
-                    "404": {
-                        "description": "Not Found"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
-            },
-            "put": {
-                "description": "Upadte a registration key by its id",
-                "consumes": [
-                    "application/json"
+            }
+        },
+        "/internal/ws/authenticate": {
+            "get": {
+                "description": "WebSocket variant of /internal/authenticate/{username}. After the upgrade the client sends WebSocketRequests to subscribe to (or unsubscribe from) usernames, watching other users than the own user requires the deploy role.\nFor every subscribed username the current state (or the missed events after last_event_id) is sent as WebSocketMessage of type \"auth\", followed by all updates. A message of type \"closed\" indicates an invalidated token (as the closed connection for SSE).\nThe expiry of a non-permanent token is announced with messages of type \"expiring\" and \"expired\" (followed by \"closed\").\nThe server sends a ping every WEBSOCKET_PING_INTERVAL and closes the connection if no pong is received. The connection is closed after a message of type \"closed\" with the own username when the API token of the connecting user is invalidated or expires, it is disabled or deleted or loses the deploy role it connected with.",
+                "tags": [
+                    "Internal"
                 ],
-                "produces": [
-                    "text/plain"
-                ],
-                "tags": [
-                    "RegistrationKeys"
-                ],
-                "summary": "Update registration key",
+                "summary": "Subscribe to updates of the API tokens and roles of users over WebSocket",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Registration Key ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "description, permament, expires_at",
+                        "description": "sent as WebSocket text message after the upgrade",
                         "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/UpdateRegistrationKeyPayload"
+                            "$ref": "#/definitions/WebSocketRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Bad Request"
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/WebSocketMessage"
+                        }
                     },
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "500": {
-                        "description": "Internal Server Error"
+                    "426": {
+                        "description": "Upgrade Required"
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete a registration key by its id",
-                "produces": [
-                    "text/plain"
-                ],
+            }
+        },
+        "/internal/ws/users": {
+            "get": {
+                "description": "WebSocket variant of /internal/users. After the upgrade all usernames are sent as WebSocketMessages of type \"user\" (or the missed events after the last_event_id query parameter), followed by all creations and removals.\nThe server sends a ping every WEBSOCKET_PING_INTERVAL and closes the connection if no pong is received.",
                 "tags": [
-                    "RegistrationKeys"
+                    "Internal"
                 ],
-                "summary": "Delete registration key",
+                "summary": "Get a list of all usernames and subscribe to updates over WebSocket",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Registration Key ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Id of the last received event to resume the stream",
+                        "name": "last_event_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/WebSocketMessage"
+                        }
                     },
                     "400": {
                         "description": "Bad Request"
@@ -400,45 +481,41 @@ const docTemplate = `{
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
-                    "500": {
-                        "description": "Internal Server Error"
+                    "426": {
+                        "description": "Upgrade Required"
                     }
                 }
             }
         },
-        "/registration-keys/{id}/users": {
+        "/internal/ws/watch": {
             "get": {
-                "description": "Get a list of users that registered using this registration key by its id. NOTE: registration_key is not included for users",
-                "produces": [
-                    "application/json"
-                ],
+                "description": "WebSocket variant of /internal/watch for the deploy role. After the upgrade the client sends WebSocketRequests to add usernames to (or remove them from) the watched set, \"*\" watches all users.\nThe current state of newly watched users is sent as WebSocketMessage of type \"auth\", followed by their updates. A message of type \"closed\" indicates an invalidated API token of a watched user.\nWhen connecting with last_event_id, the missed events of the usernames of the first subscribe request are replayed instead of sending their current state (if they are still retained).\nThe server sends a ping every WEBSOCKET_PING_INTERVAL and closes the connection if no pong is received. The connection is closed after a message of type \"closed\" with the username of the watcher when its API token is invalidated, it is disabled or deleted or loses the deploy role.",
                 "tags": [
-                    "RegistrationKeys"
+                    "Internal"
                 ],
-                "summary": "Get users of registration key",
+                "summary": "Subscribe to updates of the API tokens and roles of many users over WebSocket",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Registration Key ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Id of the last received event to resume the stream",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "description": "sent as WebSocket text message after the upgrade",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/WebSocketRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "101": {
+                        "description": "Switching Protocols",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/User"
-                            }
+                            "$ref": "#/definitions/WebSocketMessage"
                         }
                     },
                     "400": {
@@ -450,56 +527,58 @@ const docTemplate = `{
                     "403": {
                         "description": "Forbidden"
                     },
-                    "404": {
-                        "description": "Not Found"
-                    },
-                    "500": {
-                        "description": "Internal Server Error"
+                    "426": {
+                        "description": "Upgrade Required"
                     }
                 }
             }
         },
-        "/roles": {
-            "get": {
-                "description": "Get a list of all roles or query a single role by name (returns single object instead of list)",
+        "/login": {
+            "post": {
+                "description": "Log in with username and password (sets a cookie with the session id). Returns the full user information if the login was successful or the user is already logged in.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Roles"
+                    "Users"
                 ],
-                "summary": "Get all roles or query by name",
+                "summary": "Login",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Role name",
-                        "name": "name",
-                        "in": "query"
+                        "description": "Username and Password",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/LoginPayload"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/Role"
+                            "$ref": "#/definitions/User"
                         }
                     },
+                    "400": {
+                        "description": "Bad Request"
+                    },
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
-            },
+            }
+        },
+        "/logout": {
             "post": {
-                "description": "Create a new role",
+                "description": "Log out of the current session",
                 "consumes": [
                     "application/json"
                 ],
@@ -507,152 +586,110 @@ const docTemplate = `{
                     "text/plain"
                 ],
                 "tags": [
-                    "Roles"
-                ],
-                "summary": "Create role",
-                "parameters": [
-                    {
-                        "description": "Name",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/CreateOrUpdateRolePayload"
-                        }
-                    }
+                    "Users"
                 ],
+                "summary": "Logout",
                 "responses": {
-                    "201": {
-                        "description": "Created"
-                    },
-                    "400": {
-                        "description": "Bad Request"
+                    "200": {
+                        "description": "OK"
                     },
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "409": {
-                        "description": "Conflict"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/roles/{id}": {
+        "/metrics/events": {
             "get": {
-                "description": "Get a role by its role id",
+                "description": "Returns the number of subscribers, queue depths and the number of coalesced messages and disconnected slow consumers",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Roles"
-                ],
-                "summary": "Get role by id",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Role ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "Internal"
                 ],
+                "summary": "Get metrics of the internal API event queues",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/Role"
+                            "$ref": "#/definitions/EventStats"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request"
-                    },
                     "401": {
                         "description": "Unauthorized"
                     },
                     "403": {
                         "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
-                    "500": {
-                        "description": "Internal Server Error"
                     }
                 }
-            },
-            "put": {
-                "description": "Update a new role by its user id",
+            }
+        },
+        "/password-check": {
+            "post": {
+                "description": "Checks a password against the password policy and returns structured feedback (e.g. to show why a password is rejected before registering). Username and email are optional and used to reject passwords containing personal information.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "Roles"
+                    "Users"
                 ],
-                "summary": "Update role",
+                "summary": "Check password",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Role ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Name",
+                        "description": "Password, Username, Email",
                         "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CreateOrUpdateRolePayload"
+                            "$ref": "#/definitions/CheckPasswordPayload"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/PasswordCheckResult"
+                        }
                     },
                     "400": {
                         "description": "Bad Request"
                     },
-                    "401": {
-                        "description": "Unauthorized"
-                    },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "409": {
-                        "description": "Conflict"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete a role by its role id",
+            }
+        },
+        "/reauthenticate": {
+            "post": {
+                "description": "Confirms the password of the logged in user. Admins must have authenticated recently to change or delete other users.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
-                    "Roles"
+                    "Users"
                 ],
-                "summary": "Delete role",
+                "summary": "Re-authenticate",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Role ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Password",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/ReauthenticatePayload"
+                        }
                     }
                 ],
                 "responses": {
@@ -665,140 +702,42 @@ const docTemplate = `{
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/roles/{id}/users": {
-            "get": {
-                "description": "Get a list of users that have a role by its role id. NOTE: registration_key is not included for users",
+        "/register": {
+            "post": {
+                "description": "Registers a new user using a registration key",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Roles"
+                    "Users"
                 ],
-                "summary": "Get users of role",
+                "summary": "Register user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Role ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                        "description": "Username, Password, Email, RegistrationKey",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/User"
-                            }
+                            "$ref": "#/definitions/RegisterPayload"
                         }
-                    },
-                    "400": {
-                        "description": "Bad Request"
-                    },
-                    "401": {
-                        "description": "Unauthorized"
-                    },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
-                    "500": {
-                        "description": "Internal Server Error"
-                    }
-                }
-            }
-        },
-        "/roles/{roleid}/users/{userid}": {
-            "put": {
-                "description": "Add a user (by its user id) to a role (by its role id)",
-                "produces": [
-                    "text/plain"
-                ],
-                "tags": [
-                    "Roles"
-                ],
-                "summary": "Add user to role",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Role ID",
-                        "name": "roleid",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "userid",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Bad Request"
-                    },
-                    "401": {
-                        "description": "Unauthorized"
-                    },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
-                    "500": {
-                        "description": "Internal Server Error"
-                    }
-                }
-            },
-            "delete": {
-                "description": "Remove a user (by its user id) from a role (by its role id)",
-                "produces": [
-                    "text/plain"
-                ],
-                "tags": [
-                    "Roles"
-                ],
-                "summary": "Remove user from role",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Role ID",
-                        "name": "roleid",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "userid",
-                        "in": "path",
-                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/User"
+                        }
                     },
                     "400": {
                         "description": "Bad Request"
@@ -806,11 +745,8 @@ const docTemplate = `{
                     "401": {
                         "description": "Unauthorized"
                     },
-                    "403": {
-                        "description": "Forbidden"
-                    },
-                    "404": {
-                        "description": "Not Found"
+                    "409": {
+                        "description": "Conflict"
                     },
                     "500": {
                         "description": "Internal Server Error"
@@ -818,21 +754,24 @@ const docTemplate = `{
                 }
             }
         },
-        "/users": {
+        "/registration-keys": {
             "get": {
-                "description": "Get a list of all users or query a single user by name (returns single object instead of list). NOTE: registration_key is only included when querying a single user",
+                "description": "Get a list of all registration keys or query a single registration key by key (returns single object instead of list)",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "RegistrationKeys"
                 ],
-                "summary": "Get all users or query by name",
+                "summary": "Get all registration keys or query by key",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Username",
-                        "name": "name",
+                        "description": "Registration Key",
+                        "name": "key",
                         "in": "query"
                     }
                 ],
@@ -842,7 +781,7 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/User"
+                                "$ref": "#/definitions/RegistrationKey"
                             }
                         }
                     },
@@ -861,7 +800,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Creates a new user",
+                "description": "Create a new registration key",
                 "consumes": [
                     "application/json"
                 ],
@@ -869,17 +808,17 @@ const docTemplate = `{
                     "text/plain"
                 ],
                 "tags": [
-                    "Users"
+                    "RegistrationKeys"
                 ],
-                "summary": "Create user",
+                "summary": "Create registration key",
                 "parameters": [
                     {
-                        "description": "Username, Password, Email",
+                        "description": "key, description, permament, expires_at",
                         "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CreateOrUpdateUserPayload"
+                            "$ref": "#/definitions/CreateRegistrationKeyPayload"
                         }
                     }
                 ],
@@ -905,21 +844,23 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}": {
+        "/registration-keys/{id}": {
             "get": {
-                "description": "Get a user by its user id",
+                "description": "Get a registration key by its id",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "RegistrationKeys"
                 ],
-                "summary": "Get user by id",
-                "operationId": "GetUserByName",
+                "summary": "Get registration key by id",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Registration Key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -929,7 +870,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/User"
+                            "$ref": "#/definitions/RegistrationKey"
                         }
                     },
                     "400": {
@@ -950,7 +891,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates a user (always updates all fields, partial updates currently not supported)",
+                "description": "Upadte a registration key by its id",
                 "consumes": [
                     "application/json"
                 ],
@@ -958,24 +899,24 @@ const docTemplate = `{
                     "text/plain"
                 ],
                 "tags": [
-                    "Users"
+                    "RegistrationKeys"
                 ],
-                "summary": "Update user",
+                "summary": "Update registration key",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Registration Key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Username, Password, Email",
+                        "description": "description, permament, expires_at",
                         "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CreateOrUpdateUserPayload"
+                            "$ref": "#/definitions/UpdateRegistrationKeyPayload"
                         }
                     }
                 ],
@@ -992,30 +933,24 @@ const docTemplate = `{
                     "403": {
                         "description": "Forbidden"
                     },
-                    "404": {
-                        "description": "Not Found"
-                    },
-                    "409": {
-                        "description": "Conflict"
-                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             },
             "delete": {
-                "description": "Deletes a user given a user id",
+                "description": "Delete a registration key by its id",
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
-                    "Users"
+                    "RegistrationKeys"
                 ],
-                "summary": "Delete user",
+                "summary": "Delete registration key",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Registration Key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -1043,20 +978,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/api-token": {
+        "/registration-keys/{id}/users": {
             "get": {
-                "description": "Given a valid user id, returns the username, API token, associated roles and expiration date",
+                "description": "Get a list of users that registered using this registration key by its id. NOTE: registration_key is not included for users",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "RegistrationKeys"
                 ],
-                "summary": "Get a user's API token",
+                "summary": "Get users of registration key",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Registration Key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -1066,7 +1001,10 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/Token"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/User"
+                            }
                         }
                     },
                     "400": {
@@ -1085,40 +1023,32 @@ const docTemplate = `{
                         "description": "Internal Server Error"
                     }
                 }
-            },
-            "put": {
-                "description": "Given a valid user id and new permanent status, sets the permanent status for the users current token",
+            }
+        },
+        "/roles": {
+            "get": {
+                "description": "Get a list of all roles or query a single role by name (returns single object instead of list)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Roles"
                 ],
-                "summary": "Update a user's API token (set permanent)",
+                "summary": "Get all roles or query by name",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Set whether this token is permanent (does not expire)",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.UpdateTokenPayload"
-                        }
+                        "type": "string",
+                        "description": "Role name",
+                        "name": "name",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Bad Request"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Role"
+                        }
                     },
                     "401": {
                         "description": "Unauthorized"
@@ -1134,23 +1064,162 @@ const docTemplate = `{
                     }
                 }
             },
-            "delete": {
-                "description": "Given a valid user id, invalidates the current API token and generates a new one",
+            "post": {
+                "description": "Create a new role",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
-                    "Users"
+                    "Roles"
                 ],
-                "summary": "Renew a user's API token",
+                "summary": "Create role",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                        "description": "Name",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateOrUpdateRolePayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/roles/{id}": {
+            "get": {
+                "description": "Get a role by its role id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Roles"
+                ],
+                "summary": "Get role by id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Role ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Role"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Update a new role by its user id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Roles"
+                ],
+                "summary": "Update role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Role ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Name",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateOrUpdateRolePayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a role by its role id",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Roles"
+                ],
+                "summary": "Delete role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Role ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
@@ -1174,20 +1243,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/roles": {
+        "/roles/{id}/users": {
             "get": {
-                "description": "Get a list of roles that a user posesses",
+                "description": "Get a list of users that have a role by its role id. NOTE: registration_key is not included for users",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Roles"
                 ],
-                "summary": "Get roles of user",
+                "summary": "Get users of role",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Role ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -1199,7 +1268,7 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/Role"
+                                "$ref": "#/definitions/User"
                             }
                         }
                     },
@@ -1220,34 +1289,1397 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "AuthUpdateMessage": {
-            "description": "Message that is sent to notify subscribers (e.g. Beacon) on changes to one of these authentication related values",
-            "type": "object",
-            "properties": {
-                "api_token": {
-                    "description": "the actual API token",
+        },
+        "/roles/{roleid}/users/{userid}": {
+            "put": {
+                "description": "Add a user (by its user id) to a role (by its role id), requires a recent authentication",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Roles"
+                ],
+                "summary": "Add user to role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Role ID",
+                        "name": "roleid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a user (by its user id) from a role (by its role id), requires a recent authentication",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Roles"
+                ],
+                "summary": "Remove user from role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Role ID",
+                        "name": "roleid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "description": "Get a list of all users or query a single user by name (returns single object instead of list). NOTE: registration_key is only included when querying a single user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get all users or query by name",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "name",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/User"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Create user",
+                "parameters": [
+                    {
+                        "description": "Username, Password, Email",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateOrUpdateUserPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "description": "Get a user by its user id",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user by id",
+                "operationId": "GetUserByName",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates a user (always updates all fields, partial updates currently not supported). Users updating their own account must provide their current password, admins updating other users must have authenticated recently (see /reauthenticate).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Update user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Username, Password, Email, CurrentPassword",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/UpdateUserPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a user given a user id. Users deleting their own account must provide their current password, admins deleting other users must have authenticated recently (see /reauthenticate).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "CurrentPassword",
+                        "name": "payload",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/DeleteUserPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{id}/api-token": {
+            "get": {
+                "description": "Given a valid user id, returns the username, API token, associated roles and expiration date",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get a user's API token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Token"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Given a valid user id and new permanent status, sets the permanent status for the users current token",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Update a user's API token (set permanent)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Set whether this token is permanent (does not expire)",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UpdateTokenPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Given a valid user id, invalidates the current API token and generates a new one",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Renew a user's API token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{id}/disable": {
+            "put": {
+                "description": "Disables a user (optionally until a given date, then the system enables the user again) without deleting any data. Disabled users cannot log in or use their API token and their open auth connections are closed. Requires recent authentication (see /reauthenticate).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Disable user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Reason, Until",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/DisableUserPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Re-enables a disabled user (requires a recent authentication)",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Enable user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{id}/roles": {
+            "get": {
+                "description": "Get a list of roles that a user posesses",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get roles of user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/Role"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "Get a list of all webhooks (without their secrets)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get all webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/Webhook"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new webhook. Events are sent as POST requests with a WebhookEvent as body. The header X-Heimdall-Signature contains \"sha256=\" followed by the hex encoded HMAC-SHA256 of \"\u003cX-Heimdall-Timestamp\u003e.\u003cbody\u003e\" using the secret as key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Create webhook",
+                "parameters": [
+                    {
+                        "description": "url, description, events, secret, enabled",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateWebhookPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/CreateWebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/dead-letters": {
+            "get": {
+                "description": "Get the latest deliveries of all webhooks that failed after all retries, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get dead letters",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of deliveries (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/WebhookDelivery"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/deliveries/{id}/redeliver": {
+            "post": {
+                "description": "Send a dead (or already delivered) delivery again with a fresh set of retries",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Redeliver",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "description": "Get a webhook by its id (without its secret)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get webhook by id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Update a webhook by its id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Update webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "url, description, events, secret, enabled",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/UpdateWebhookPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a webhook by its id including its delivery log",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Get the latest deliveries of a webhook by its id including the result of the last attempt, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get delivery log of webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of deliveries (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "401": {
+                        "description": "Unauthorized"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "Archive": {
+            "description": "Export of the users (with password hashes), roles, memberships, registration keys and API tokens. Entries reference each other by name, the ids are not preserved by an import. Keep it secret!",
+            "type": "object",
+            "properties": {
+                "exported_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "registration_keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ArchiveRegistrationKey"
+                    }
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ArchiveRole"
+                    }
+                },
+                "tokens": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ArchiveToken"
+                    }
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ArchiveUser"
+                    }
+                },
+                "version": {
+                    "description": "version of the format",
+                    "type": "integer"
+                }
+            }
+        },
+        "ArchiveImportResult": {
+            "description": "Numbers of the entries of an imported archive",
+            "type": "object",
+            "properties": {
+                "deleted_users": {
+                    "description": "users deleted by replace",
+                    "type": "integer"
+                },
+                "mode": {
+                    "description": "merge or replace",
+                    "type": "string"
+                },
+                "registration_keys": {
+                    "description": "imported registration keys",
+                    "type": "integer"
+                },
+                "roles": {
+                    "description": "imported roles",
+                    "type": "integer"
+                },
+                "tokens": {
+                    "description": "imported API tokens",
+                    "type": "integer"
+                },
+                "users": {
+                    "description": "imported users",
+                    "type": "integer"
+                }
+            }
+        },
+        "ArchiveRegistrationKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "permanent": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "ArchiveRole": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "ArchiveToken": {
+            "type": "object",
+            "properties": {
+                "api_token": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "permanent": {
+                    "type": "boolean"
+                },
+                "username": {
+                    "description": "owner of the token",
+                    "type": "string"
+                }
+            }
+        },
+        "ArchiveUser": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "disabled_by": {
+                    "description": "username of the admin that disabled the user",
+                    "type": "string"
+                },
+                "disabled_reason": {
+                    "type": "string"
+                },
+                "disabled_until": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "last_login": {
+                    "type": "string"
+                },
+                "password_hash": {
+                    "description": "bcrypt hash of the password",
+                    "type": "string"
+                },
+                "registration_key": {
+                    "description": "key the user registered with",
+                    "type": "string"
+                },
+                "roles": {
+                    "description": "names of the roles of the user",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "AuditChange": {
+            "description": "Value of a field before and after an audited action (null if the field did not exist)",
+            "type": "object",
+            "properties": {
+                "after": {},
+                "before": {}
+            }
+        },
+        "AuditCheckpoint": {
+            "description": "A signed checkpoint of the audit log that proves the state of the chain up to an entry",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "entry_id": {
+                    "description": "id of the latest entry at the time of the checkpoint",
+                    "type": "integer"
+                },
+                "hash": {
+                    "description": "hash of this entry",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "prev_checkpoint_id": {
+                    "description": "id of the previous checkpoint (0 for the first checkpoint and checkpoints written before they were chained)",
+                    "type": "integer"
+                },
+                "public_key": {
+                    "description": "Ed25519 public key of the signer (base64)",
+                    "type": "string"
+                },
+                "signature": {
+                    "description": "Ed25519 signature of the SignedMessage (base64)",
+                    "type": "string"
+                }
+            }
+        },
+        "AuditEntry": {
+            "description": "An entry of the append-only audit log: who did what to which target, when and from where",
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "e.g. login.failed, user.updated, role.assigned",
+                    "type": "string"
+                },
+                "actor_id": {
+                    "description": "id of the acting user, null if not logged in (or the system)",
+                    "type": "integer"
+                },
+                "actor_name": {
+                    "description": "name of the acting user at the time of the action (\"system\" for the system)",
+                    "type": "string"
+                },
+                "changes": {
+                    "description": "changed fields with the values before and after the action",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/AuditChange"
+                    }
+                },
+                "created_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "details": {
+                    "description": "additional information (e.g. the reason of a failed login)",
+                    "type": "string"
+                },
+                "hash": {
+                    "description": "SHA-256 (hex) of PrevHash and the content of this entry",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "id (increasing)",
+                    "type": "integer"
+                },
+                "ip": {
+                    "description": "IP address of the client",
+                    "type": "string"
+                },
+                "prev_hash": {
+                    "description": "hash of the previous entry (empty for the first entry)",
+                    "type": "string"
+                },
+                "target_id": {
+                    "description": "id of the target (null if unknown, e.g. failed login of an unknown user)",
+                    "type": "integer"
+                },
+                "target_name": {
+                    "description": "name of the target at the time of the action",
+                    "type": "string"
+                },
+                "target_type": {
+                    "description": "user, role, registration_key, token, webhook or archive",
+                    "type": "string"
+                },
+                "user_agent": {
+                    "description": "User-Agent header of the client",
+                    "type": "string"
+                }
+            }
+        },
+        "AuditPage": {
+            "description": "A page of audit entries, newest first",
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/AuditEntry"
+                    }
+                },
+                "limit": {
+                    "description": "maximum number of entries per page",
+                    "type": "integer"
+                },
+                "offset": {
+                    "description": "number of skipped entries",
+                    "type": "integer"
+                },
+                "total": {
+                    "description": "number of entries matching the filter",
+                    "type": "integer"
+                }
+            }
+        },
+        "AuditVerification": {
+            "description": "Result of verifying the hash chain and the checkpoints of the audit log",
+            "type": "object",
+            "properties": {
+                "broken_checkpoint_id": {
+                    "description": "first checkpoint with an invalid signature or hash",
+                    "type": "integer"
+                },
+                "broken_entry_id": {
+                    "description": "first entry whose hash or link to the previous entry does not match",
+                    "type": "integer"
+                },
+                "checkpoints_checked": {
+                    "description": "checkpoints whose signature and entry hash were verified",
+                    "type": "integer"
+                },
+                "entries_checked": {
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "why the verification failed",
+                    "type": "string"
+                },
+                "first_entry_id": {
+                    "description": "oldest retained entry (older entries are deleted after AUDIT_RETENTION), 0 if the log is empty",
+                    "type": "integer"
+                },
+                "last_entry_id": {
+                    "description": "latest entry",
+                    "type": "integer"
+                },
+                "last_hash": {
+                    "description": "hash of the latest entry",
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "AuthUpdateMessage": {
+            "description": "Message that is sent to notify subscribers (e.g. Beacon) on changes to one of these authentication related values",
+            "type": "object",
+            "properties": {
+                "api_token": {
+                    "description": "the actual API token",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "expiration date of this token",
+                    "type": "string"
+                },
+                "expiry_event": {
+                    "description": "\"expiring\" or \"expired\" if the message announces the expiry of the token, empty for other updates",
+                    "type": "string"
+                },
+                "permanent": {
+                    "description": "no expiration (ignore ExpiresAt)",
+                    "type": "boolean"
+                },
+                "roles": {
+                    "description": "roles associated with this token",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "username": {
+                    "description": "unique username associated with this token",
+                    "type": "string"
+                }
+            }
+        },
+        "BootstrapPayload": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "setup_token": {
+                    "description": "snake case naming for decoding of x-www-form-urlencoded bodies",
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "BrokerStats": {
+            "type": "object",
+            "properties": {
+                "coalesced": {
+                    "description": "number of queued messages that were replaced by a newer one",
+                    "type": "integer"
+                },
+                "disconnected": {
+                    "description": "number of subscribers disconnected because their queue was full",
+                    "type": "integer"
+                },
+                "last_event_id": {
+                    "description": "id of the last published event",
+                    "type": "integer"
+                },
+                "max_queue_depth": {
+                    "description": "number of messages in the fullest queue",
+                    "type": "integer"
+                },
+                "published": {
+                    "description": "number of published messages",
+                    "type": "integer"
+                },
+                "queue_size": {
+                    "description": "capacity of each queue",
+                    "type": "integer"
+                },
+                "queued_messages": {
+                    "description": "number of messages waiting in all queues",
+                    "type": "integer"
+                },
+                "retained_events": {
+                    "description": "number of events in the log available for replay",
+                    "type": "integer"
+                },
+                "subscribers": {
+                    "description": "number of open subscriptions",
+                    "type": "integer"
+                },
+                "topics": {
+                    "description": "number of topics with at least one subscriber",
+                    "type": "integer"
+                }
+            }
+        },
+        "CheckPasswordPayload": {
+            "type": "object",
+            "properties": {
+                "email": {
                     "type": "string"
                 },
-                "expires_at": {
-                    "description": "expiration date of this token",
+                "password": {
                     "type": "string"
                 },
-                "permanent": {
-                    "description": "no expiration (ignore ExpiresAt)",
-                    "type": "boolean"
-                },
-                "roles": {
-                    "description": "roles associated with this token",
-                    "type": "array",
-                    "items": {
-                        "type": "string"
-                    }
-                },
                 "username": {
-                    "description": "unique username associated with this token",
                     "type": "string"
                 }
             }
@@ -1291,6 +2723,117 @@ const docTemplate = `{
                 }
             }
         },
+        "CreateWebhookPayload": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "only enabled webhooks receive events",
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "user.created, user.deleted, user.disabled, user.enabled, user.roles_updated, token.regenerated, token.expiring, token.expired",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "generated if empty",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "CreateWebhookResponse": {
+            "description": "The created webhook including its secret (which is not returned anywhere else)",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "a description for this webhook",
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "disabled webhooks do not receive new events",
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "subscribed event types",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "id (primary key)",
+                    "type": "integer"
+                },
+                "secret": {
+                    "description": "key for the HMAC-SHA256 signature in the X-Heimdall-Signature header",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "receiver of the HTTP POST requests",
+                    "type": "string"
+                }
+            }
+        },
+        "DeleteUserPayload": {
+            "type": "object",
+            "properties": {
+                "current_password": {
+                    "description": "required when deleting your own account",
+                    "type": "string"
+                }
+            }
+        },
+        "DisableUserPayload": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "description": "shown to the user when trying to log in",
+                    "type": "string"
+                },
+                "until": {
+                    "description": "ISO 8601 datetime, optional (disabled indefinitely if omitted)",
+                    "type": "string"
+                }
+            }
+        },
+        "EventStats": {
+            "description": "Metrics about the queues of the subscribers of the internal API",
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "description": "subscribers of /internal/authenticate and /internal/watch",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/BrokerStats"
+                        }
+                    ]
+                },
+                "user_create_delete": {
+                    "description": "subscribers of /internal/users",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/BrokerStats"
+                        }
+                    ]
+                }
+            }
+        },
         "LoginPayload": {
             "type": "object",
             "properties": {
@@ -1302,6 +2845,50 @@ const docTemplate = `{
                 }
             }
         },
+        "PasswordCheckResult": {
+            "description": "Result of checking a password against the password policy including the reasons why it was rejected",
+            "type": "object",
+            "properties": {
+                "crack_time": {
+                    "description": "human readable estimate of the time needed to guess the password",
+                    "type": "string"
+                },
+                "min_score": {
+                    "description": "minimum strength score required by the policy",
+                    "type": "integer"
+                },
+                "score": {
+                    "description": "estimated strength from 0 (very weak) to 4 (very strong)",
+                    "type": "integer"
+                },
+                "suggestions": {
+                    "description": "hints on how to make the password stronger",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "valid": {
+                    "description": "true if the password satisfies the password policy",
+                    "type": "boolean"
+                },
+                "violations": {
+                    "description": "rules of the password policy that are violated (empty if valid)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "ReauthenticatePayload": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
         "RegisterPayload": {
             "type": "object",
             "properties": {
@@ -1415,6 +3002,48 @@ const docTemplate = `{
                 }
             }
         },
+        "UpdateUserPayload": {
+            "type": "object",
+            "properties": {
+                "current_password": {
+                    "description": "required when updating your own account",
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "UpdateWebhookPayload": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "keeps the current secret if empty",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
         "User": {
             "description": "User account information including username, email, last login date and time, permanent API token flag, registration key (if user registered with a key) and roles",
             "type": "object",
@@ -1431,6 +3060,22 @@ const docTemplate = `{
                     "description": "ISO 8601 datetime",
                     "type": "string"
                 },
+                "disabled": {
+                    "description": "disabled users cannot log in or use their API token",
+                    "type": "boolean"
+                },
+                "disabled_by_id": {
+                    "description": "id of the admin that disabled this user",
+                    "type": "integer"
+                },
+                "disabled_reason": {
+                    "description": "reason shown to the user when trying to log in",
+                    "type": "string"
+                },
+                "disabled_until": {
+                    "description": "ISO 8601 datetime, disabled indefinitely if null",
+                    "type": "string"
+                },
                 "email": {
                     "description": "can be empty",
                     "type": "string"
@@ -1468,9 +3113,13 @@ const docTemplate = `{
             }
         },
         "UserUpdateMessage": {
-            "description": "Message that is sent to notify subscribers (e.g. Beacon) when a new user is created or a user is removed",
+            "description": "Message that is sent to notify subscribers (e.g. Beacon) when a new user is created or a user is removed (disabling and enabling a user is announced like a removal and creation)",
             "type": "object",
             "properties": {
+                "disabled": {
+                    "description": "the user was not deleted but disabled",
+                    "type": "boolean"
+                },
                 "removed": {
                     "type": "boolean"
                 },
@@ -1479,6 +3128,147 @@ const docTemplate = `{
                 }
             }
         },
+        "WebSocketMessage": {
+            "description": "Message sent to clients of the internal WebSocket API",
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "AuthUpdateMessage (auth) or UserUpdateMessage (user)"
+                },
+                "error": {
+                    "description": "reason of an error or closed subscription",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "event id (auth and user messages)",
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "auth, expiring, expired, user, closed or error",
+                    "type": "string"
+                },
+                "username": {
+                    "description": "username of a closed subscription or failed request",
+                    "type": "string"
+                }
+            }
+        },
+        "WebSocketRequest": {
+            "description": "Request sent by clients of the internal WebSocket API to change the subscribed usernames",
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "subscribe or unsubscribe",
+                    "type": "string"
+                },
+                "last_event_id": {
+                    "description": "id of the last received event to replay missed events instead of sending the current state",
+                    "type": "integer"
+                },
+                "usernames": {
+                    "description": "users to (un)subscribe, other users than the own user require the deploy role (\"*\" for all users on /internal/ws/watch)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "Webhook": {
+            "description": "A subscription of an external tool to user, role and token events. The payloads are signed with HMAC-SHA256 using the secret.",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "a description for this webhook",
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "disabled webhooks do not receive new events",
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "subscribed event types",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "id (primary key)",
+                    "type": "integer"
+                },
+                "updated_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "receiver of the HTTP POST requests",
+                    "type": "string"
+                }
+            }
+        },
+        "WebhookDelivery": {
+            "description": "A single event delivered (or to be delivered) to a webhook including the result of the last attempt",
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "number of attempts so far",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "description": "ISO 8601 datetime of the successful attempt",
+                    "type": "string"
+                },
+                "event_id": {
+                    "description": "unique id of the event (same for all webhooks)",
+                    "type": "string"
+                },
+                "event_type": {
+                    "description": "type of the event (e.g. user.created)",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "id (primary key)",
+                    "type": "integer"
+                },
+                "last_error": {
+                    "description": "error of the last attempt",
+                    "type": "string"
+                },
+                "last_status_code": {
+                    "description": "HTTP status code of the last attempt (0 if no response)",
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "description": "ISO 8601 datetime of the next attempt (if pending)",
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "signed JSON request body",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "pending, delivered or dead",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "ISO 8601 datetime",
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "description": "id of the receiving webhook",
+                    "type": "integer"
+                }
+            }
+        },
         "handler.UpdateTokenPayload": {
             "type": "object",
             "properties": {
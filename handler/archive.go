@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+type ArchiveHandler struct {
+	archiveService service.ArchiveService
+	userService    service.UserService
+	sessionStore   *session.Store
+}
+
+func NewArchiveHandler(archiveService service.ArchiveService,
+	userService service.UserService,
+	sessionStore *session.Store) ArchiveHandler {
+	return ArchiveHandler{archiveService, userService, sessionStore}
+}
+
+// @Summary      Export all data
+// @Description  Exports all users (with password hashes), roles, memberships, registration keys and API tokens as a versioned JSON archive (e.g. to migrate to another server or for offline backups). The archive contains secrets, keep it safe! Requires a recent authentication (see /reauthenticate).
+// @Tags         Archive
+// @Produce      json
+// @Success      200  {object}  model.Archive
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /archive [get]
+func (ah *ArchiveHandler) Export(c *fiber.Ctx) error {
+	if err := verifyRecentAuthentication(c, &ah.userService, ah.sessionStore); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	archive, err := ah.archiveService.Export(auditActor(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	c.Attachment(fmt.Sprintf("heimdall-%s.json", archive.ExportedAt.UTC().Format(time.DateOnly)))
+	return c.JSON(archive)
+}
+
+// @Summary      Import an archive
+// @Description  Imports an archive of GET /archive in a single transaction after validating the references between its entries. With mode=merge (default) the entries of the archive are created or replace the existing entries with the same name (including the roles and the API token of a user) and other entries are kept. With mode=replace all users, roles, registration keys and API tokens are deleted first (the archive must contain an admin). Every change of a user and its roles is recorded in the audit log. Requires a recent authentication (see /reauthenticate).
+// @Tags         Archive
+// @Accept       json
+// @Produce      json
+// @Param        mode     query  string         false  "merge (default) or replace"
+// @Param        archive  body   model.Archive  true   "Archive"
+// @Success      200  {object}  model.ArchiveImportResult
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      409  "Conflict"
+// @Failure      500  "Internal Server Error"
+// @Router       /archive [post]
+func (ah *ArchiveHandler) Import(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	var archive model.Archive
+	if err := c.BodyParser(&archive); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	if err := verifyRecentAuthentication(c, &ah.userService, ah.sessionStore); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	result, err := ah.archiveService.Import(&archive, c.Query("mode", model.ArchiveMerge), auditActor(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(result)
+}
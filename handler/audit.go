@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditHandler struct {
+	auditService service.AuditService
+}
+
+func NewAuditHandler(auditService service.AuditService) AuditHandler {
+	return AuditHandler{auditService}
+}
+
+// @Summary      Get audit log
+// @Description  Get a page of the audit log of administrative and security-relevant actions (logins, changes of users, roles, registration keys, API tokens and webhooks), newest first
+// @Tags         Audit
+// @Produce      json
+// @Param        actor_id     query  int     false  "ID of the acting user"
+// @Param        actor        query  string  false  "Name of the acting user"
+// @Param        action       query  string  false  "Action (e.g. login.failed, user.updated, role.assigned)"
+// @Param        target_type  query  string  false  "Type of the target (user, role, registration_key, token, webhook or archive)"
+// @Param        target_id    query  int     false  "ID of the target"
+// @Param        since        query  string  false  "Only entries created at or after this ISO 8601 datetime"
+// @Param        until        query  string  false  "Only entries created before this ISO 8601 datetime"
+// @Param        limit        query  int     false  "Maximum number of entries (default 100, max 1000)"
+// @Param        offset       query  int     false  "Number of entries to skip"
+// @Success      200  {object}  AuditPage
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /audit [get]
+func (ah *AuditHandler) Get(c *fiber.Ctx) error {
+	var filter model.AuditFilter
+	var err error
+	if filter.ActorID, err = queryID(c, "actor_id"); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	if filter.TargetID, err = queryID(c, "target_id"); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	if filter.Since, err = queryTime(c, "since"); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	if filter.Until, err = queryTime(c, "until"); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	filter.ActorName = c.Query("actor")
+	filter.Action = c.Query("action")
+	filter.TargetType = c.Query("target_type")
+
+	limit := c.QueryInt("limit", defaultAuditLimit)
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	limit = min(limit, maxAuditLimit)
+	offset := max(c.QueryInt("offset", 0), 0)
+
+	page, err := ah.auditService.Find(filter, limit, offset)
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(page)
+}
+
+// @Summary      Verify audit log
+// @Description  Verifies the hash chain of the retained audit entries (every entry contains the hash of the previous entry) and the signed checkpoints (if AUDIT_SIGNING_KEY is configured). Reports the first broken link if the log was altered.
+// @Tags         Audit
+// @Produce      json
+// @Success      200  {object}  AuditVerification
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /audit/verify [get]
+func (ah *AuditHandler) Verify(c *fiber.Ctx) error {
+	verification, err := ah.auditService.Verify()
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(verification)
+}
+
+// @Summary      Get audit checkpoints
+// @Description  Get the signed checkpoints of the audit log, oldest first. They can be archived outside of Heimdall to prove later that the log was not rewritten.
+// @Tags         Audit
+// @Produce      json
+// @Success      200  {object}  []AuditCheckpoint
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /audit/checkpoints [get]
+func (ah *AuditHandler) GetCheckpoints(c *fiber.Ctx) error {
+	checkpoints, err := ah.auditService.Checkpoints()
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(checkpoints)
+}
+
+// auditActor returns the actor of the request for the audit log
+func auditActor(c *fiber.Ctx) model.AuditActor {
+	actor := model.AuditActor{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+	if user, ok := c.Locals("user").(*model.User); ok {
+		actor.UserID = &user.ID
+		actor.Username = user.Username
+	}
+	return actor
+}
+
+// queryID parses an optional id query parameter (nil if missing)
+func queryID(c *fiber.Ctx, key string) (*uint, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return nil, model.BadRequestError{Message: "Invalid " + key, Err: err}
+	}
+	result := uint(id)
+	return &result, nil
+}
+
+// queryTime parses an optional ISO 8601 datetime query parameter (nil if missing)
+func queryTime(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, model.BadRequestError{Message: "Invalid " + key + " (expected ISO 8601 datetime)", Err: err}
+	}
+	return &t, nil
+}
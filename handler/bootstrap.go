@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+type BootstrapHandler struct {
+	bootstrapService service.BootstrapService
+}
+
+func NewBootstrapHandler(bootstrapService service.BootstrapService) BootstrapHandler {
+	return BootstrapHandler{bootstrapService}
+}
+
+type BootstrapPayload struct {
+	SetupToken string `json:"setup_token"` // snake case naming for decoding of x-www-form-urlencoded bodies
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Email      string `json:"email"`
+} //@name BootstrapPayload
+
+// @Summary      Create the first admin
+// @Description  Creates the first admin of a fresh installation with the one-time setup token that is printed to the log on startup if there is no admin (and no BOOTSTRAP_ADMIN_USERNAME is configured). The token becomes invalid once an admin exists.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  BootstrapPayload  true  "SetupToken, Username, Password, Email"
+// @Success      201  {object}  model.User
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      409  "Conflict"
+// @Failure      500  "Internal Server Error"
+// @Router       /bootstrap [post]
+func (bh *BootstrapHandler) CompleteSetup(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	var payload BootstrapPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	user, err := bh.bootstrapService.CompleteSetup(payload.SetupToken, payload.Username, payload.Password, payload.Email, auditActor(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
@@ -97,7 +97,7 @@ func (rkc *RegistrationKeyHandler) Create(c *fiber.Ctx) error {
 	if err := c.BodyParser(&payload); err != nil {
 		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
 	}
-	err := rkc.registrationKeyService.Create(payload.Key, payload.Description, payload.Permanent, payload.ExpiresAt)
+	err := rkc.registrationKeyService.Create(payload.Key, payload.Description, payload.Permanent, payload.ExpiresAt, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -133,7 +133,7 @@ func (rkc *RegistrationKeyHandler) Update(c *fiber.Ctx) error {
 	if err := c.BodyParser(&payload); err != nil {
 		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
 	}
-	err := rkc.registrationKeyService.Update(uint(id), payload.Description, payload.Permanent, payload.ExpiresAt)
+	err := rkc.registrationKeyService.Update(uint(id), payload.Description, payload.Permanent, payload.ExpiresAt, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -157,7 +157,7 @@ func (rkc *RegistrationKeyHandler) Delete(c *fiber.Ctx) error {
 	if id < 0 {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	err := rkc.registrationKeyService.DeleteByID(uint(id))
+	err := rkc.registrationKeyService.DeleteByID(uint(id), auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
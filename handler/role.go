@@ -4,14 +4,19 @@ import (
 	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"github.com/ProjectLighthouseCAU/heimdall/service"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
 )
 
 type RoleHandler struct {
-	roleService service.RoleService
+	roleService  service.RoleService
+	userService  service.UserService
+	sessionStore *session.Store
 }
 
-func NewRoleHandler(roleService service.RoleService) RoleHandler {
-	return RoleHandler{roleService}
+func NewRoleHandler(roleService service.RoleService,
+	userService service.UserService,
+	sessionStore *session.Store) RoleHandler {
+	return RoleHandler{roleService, userService, sessionStore}
 }
 
 // @Summary      Get all roles or query by name
@@ -90,7 +95,7 @@ func (rc *RoleHandler) Create(c *fiber.Ctx) error {
 	if err := c.BodyParser(&payload); err != nil {
 		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
 	}
-	err := rc.roleService.Create(payload.Name)
+	err := rc.roleService.Create(payload.Name, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -121,7 +126,7 @@ func (rc *RoleHandler) Update(c *fiber.Ctx) error {
 	if err := c.BodyParser(&payload); err != nil {
 		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
 	}
-	err := rc.roleService.Update(uint(id), payload.Name)
+	err := rc.roleService.Update(uint(id), payload.Name, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -145,7 +150,7 @@ func (rc *RoleHandler) Delete(c *fiber.Ctx) error {
 	if id < 0 {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	err := rc.roleService.DeleteByID(uint(id))
+	err := rc.roleService.DeleteByID(uint(id), auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -177,7 +182,7 @@ func (rc *RoleHandler) GetUsersOfRole(c *fiber.Ctx) error {
 }
 
 // @Summary      Add user to role
-// @Description  Add a user (by its user id) to a role (by its role id)
+// @Description  Add a user (by its user id) to a role (by its role id), requires a recent authentication
 // @Tags         Roles
 // @Produce      plain
 // @Param        roleid  path  int  true  "Role ID"
@@ -195,7 +200,10 @@ func (rc *RoleHandler) AddUserToRole(c *fiber.Ctx) error {
 	if roleid < 0 || userid < 0 {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	err := rc.roleService.AddUserToRole(uint(roleid), uint(userid))
+	if err := verifyRecentAuthentication(c, &rc.userService, rc.sessionStore); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	err := rc.roleService.AddUserToRole(uint(roleid), uint(userid), auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -203,7 +211,7 @@ func (rc *RoleHandler) AddUserToRole(c *fiber.Ctx) error {
 }
 
 // @Summary      Remove user from role
-// @Description  Remove a user (by its user id) from a role (by its role id)
+// @Description  Remove a user (by its user id) from a role (by its role id), requires a recent authentication
 // @Tags         Roles
 // @Produce      plain
 // @Param        roleid  path  int  true  "Role ID"
@@ -221,7 +229,10 @@ func (rc *RoleHandler) RemoveUserFromRole(c *fiber.Ctx) error {
 	if roleid < 0 || userid < 0 {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	err := rc.roleService.RemoveUserFromRole(uint(roleid), uint(userid))
+	if err := verifyRecentAuthentication(c, &rc.userService, rc.sessionStore); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	err := rc.roleService.RemoveUserFromRole(uint(roleid), uint(userid), auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
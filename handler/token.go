@@ -3,8 +3,11 @@ package handler
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
 	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"github.com/ProjectLighthouseCAU/heimdall/service"
 	"github.com/gofiber/fiber/v2"
@@ -76,7 +79,7 @@ func (tc *TokenHandler) Update(c *fiber.Ctx) error {
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
-	err = tc.tokenService.SetPermanent(user, payload.Permanent)
+	err = tc.tokenService.SetPermanent(user, payload.Permanent, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -104,7 +107,7 @@ func (tc *TokenHandler) Delete(c *fiber.Ctx) error {
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
-	if err = tc.tokenService.RegenerateApiToken(user); err != nil {
+	if err = tc.tokenService.RegenerateApiToken(user, auditActor(c)); err != nil {
 		return UnwrapAndSendError(c, err)
 	}
 	return c.SendStatus(fiber.StatusOK)
@@ -117,22 +120,29 @@ type AuthRequest struct {
 	Token    string `json:"api_token"`
 }
 
-var keepalive = []byte{'\r', '\n'} // keepalive message (just newline without content)
+// SSE event types
+const (
+	authEvent = "auth"
+	userEvent = "user"
+)
+
+var keepalive = []byte(": keepalive\n\n") // keepalive message (SSE comment that is ignored by clients)
 
 // @Summary      Get and subscribe to updates of a user's api token and roles
-// @Description  If the initial request was successful, the connection is kept alive and updates are sent using server sent events (SSE).
+// @Description  If the initial request was successful, the connection is kept alive and updates are sent using server sent events (SSE) of type "auth" with an event id.
+// @Description  A non-permanent token is announced with an event of type "expiring" API_TOKEN_EXPIRY_WARNING before it expires and with an event of type "expired" when it expired, after which the connection is closed.
+// @Description  When reconnecting with the Last-Event-ID header, missed events are replayed instead of sending the current state (if they are still retained).
 // @Tags         Internal
-// @Produce      json
+// @Produce      text/event-stream
+// @Param        username       path    string  true   "Username"
+// @Param        Last-Event-ID  header  string  false  "Id of the last received event to resume the stream"
 // @Success      200  {object} AuthUpdateMessage
 // @Failure      400  "Bad Request"
 // @Failure      401  "Unauthorized"
 // @Failure      500  "Internal Server Error"
 // @Router       /internal/authenticate/{username} [get]
 func (tc *TokenHandler) WatchAuthChanges(c *fiber.Ctx) error {
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
+	setEventStreamHeaders(c)
 
 	user, ok := c.Locals("user").(*model.User)
 	if !ok {
@@ -147,84 +157,151 @@ func (tc *TokenHandler) WatchAuthChanges(c *fiber.Ctx) error {
 	if !user.ApiToken.Permanent && time.Now().After(user.ApiToken.ExpiresAt) {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
+	lastEventID, resume, err := parseLastEventID(c)
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
 
 	// prepare first response
-	var roles []string
-	for _, role := range user.Roles {
-		roles = append(roles, role.Name)
-	}
-	resp := model.AuthUpdateMessage{
-		Username:  user.Username,
-		Token:     user.ApiToken.Token,
-		ExpiresAt: user.ApiToken.ExpiresAt,
-		Permanent: user.ApiToken.Permanent,
-		Roles:     roles,
+	resp, err := tc.tokenService.AuthState(user)
+	if err != nil {
+		return UnwrapAndSendError(c, err)
 	}
 
 	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-		// send first response
-		err := writeAndFlushJson(w, resp)
-		if err != nil {
-			return
+		// subscribe to changes for this user (and unsubscribe on return)
+		var sub *broker.Subscription[*model.AuthUpdateMessage]
+		replayed := false
+		if resume {
+			sub, replayed = tc.tokenService.ResumeChanges(user.Username, lastEventID)
+		} else {
+			sub = tc.tokenService.SubscribeToChanges(user.Username)
 		}
+		defer tc.tokenService.UnsubscribeFromChanges(sub)
 
-		// subscribe to changes for this user (and unsubscribe on return)
-		ch := tc.tokenService.SubscribeToChanges(user.Username)
-		defer tc.tokenService.UnsubscribeFromChanges(user.Username, ch)
-		forwardMessagesToClient(ch, w)
+		// send current state if the missed events could not be replayed
+		if !replayed {
+			err := writeAndFlushEvent(w, sub.StartID(), authEvent, resp)
+			if err != nil {
+				return
+			}
+		}
+		forwardEventsToClient(sub, authEvent, w)
 	}))
 	return nil
 }
 
 // @Summary      Get a list of all usernames
-// @Description  Returns a list of all users names
+// @Description  Returns a list of all users names and keeps the connection alive to send updates when users are created or removed using server sent events (SSE) of type "user" with an event id.
+// @Description  When reconnecting with the Last-Event-ID header, missed events are replayed instead of sending the full list (if they are still retained).
 // @Tags         Internal
-// @Produce      json
+// @Produce      text/event-stream
+// @Param        Last-Event-ID  header  string  false  "Id of the last received event to resume the stream"
 // @Success      200  {object}  []model.UserUpdateMessage
 // @Failure      401  "Unauthorized"
 // @Failure      500  "Internal Server Error"
 // @Router       /internal/users [get]
 func (tc *TokenHandler) GetUsernames(c *fiber.Ctx) error {
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
+	setEventStreamHeaders(c)
 
-	users, err := tc.userService.GetAll()
+	lastEventID, resume, err := parseLastEventID(c)
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
-	var messages []model.UserUpdateMessage
-	for _, user := range users {
-		messages = append(messages, model.UserUpdateMessage{Username: user.Username, Removed: false})
-	}
+
 	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-		// send first response
-		err := writeAndFlushMultipleJson(w, messages)
-		if err != nil {
-			return
+		var sub *broker.Subscription[*model.UserUpdateMessage]
+		replayed := false
+		if resume {
+			sub, replayed = tc.tokenService.ResumeUserCreateDeleteEvents(lastEventID)
+		} else {
+			sub = tc.tokenService.SubscribeToUserCreateDeleteEvents()
+		}
+		defer tc.tokenService.UnsubscribeFromUserCreateDeleteEvents(sub)
+
+		// send the list of all users if the missed events could not be replayed
+		// (queried after subscribing, so no creation or deletion is missed)
+		if !replayed {
+			users, err := tc.userService.GetAll()
+			if err != nil {
+				return
+			}
+			var output []byte
+			for _, user := range users {
+				if user.IsDisabled() { // disabled users are announced as removed
+					continue
+				}
+				event, err := formatEvent(sub.StartID(), userEvent, model.UserUpdateMessage{Username: user.Username, Removed: false})
+				if err != nil {
+					return
+				}
+				output = append(output, event...)
+			}
+			if err := writeAndFlushBytes(w, output); err != nil {
+				return
+			}
 		}
-		ch := tc.tokenService.SubscribeToUserCreateDeleteEvents()
-		defer tc.tokenService.UnsubscribeFromUserCreateDeleteEvents(ch)
-		forwardMessagesToClient(ch, w)
+		forwardEventsToClient(sub, userEvent, w)
 	}))
 
 	return nil
 }
 
-func forwardMessagesToClient[T any](ch chan T, w *bufio.Writer) {
+func setEventStreamHeaders(c *fiber.Ctx) {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+}
+
+// parseLastEventID returns the id from the Last-Event-ID header and whether the header was set
+func parseLastEventID(c *fiber.Ctx) (uint64, bool, error) {
+	header := c.Get("Last-Event-ID")
+	if header == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseUint(header, 10, 64)
+	if err != nil {
+		return 0, false, model.BadRequestError{Message: "Invalid Last-Event-ID", Err: err}
+	}
+	return id, true, nil
+}
+
+// eventTypeOf returns the event type of a message (expiry events of auth updates have their own type)
+func eventTypeOf(eventType string, message any) string {
+	if msg, ok := message.(*model.AuthUpdateMessage); ok && msg.ExpiryEvent != "" {
+		return msg.ExpiryEvent
+	}
+	return eventType
+}
+
+// forwards events until the subscription or the connection is closed
+func forwardEventsToClient[T any](sub *broker.Subscription[T], eventType string, w *bufio.Writer) {
+	sendQueued := func() error {
+		var output []byte
+		for _, event := range sub.Drain() {
+			bs, err := formatEvent(event.ID, eventTypeOf(eventType, event.Message), event.Message)
+			if err != nil {
+				return err
+			}
+			output = append(output, bs...)
+		}
+		return writeAndFlushBytes(w, output)
+	}
 	for {
 		select {
-		case m, ok := <-ch:
-			if !ok {
-				return
+		case <-sub.Done(): // closed subscription indicates invalidated token or slow consumer
+			if sub.Err() == broker.ErrClosed {
+				_ = sendQueued() // e.g. the expired event before the stream is closed
 			}
-			err := writeAndFlushJson(w, m) // send update
+			return
+		case <-sub.Ready():
+			err := sendQueued() // send updates
 			if err != nil {
 				return
 			}
 		case <-time.After(time.Second): // detect closed connection
-			err := writeAndFlushBytes(w, keepalive) // send keepalive message (just newline without content)
+			err := writeAndFlushBytes(w, keepalive) // send keepalive message (comment without content)
 			if err != nil {
 				return
 			}
@@ -232,26 +309,21 @@ func forwardMessagesToClient[T any](ch chan T, w *bufio.Writer) {
 	}
 }
 
-func writeAndFlushJson(w *bufio.Writer, value any) error {
-	respJson, err := json.Marshal(value)
+// formatEvent formats a server sent event with id, type and JSON data
+func formatEvent(id uint64, eventType string, value any) ([]byte, error) {
+	data, err := json.Marshal(value)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	respJson = append(respJson, '\r', '\n')
-	return writeAndFlushBytes(w, respJson)
+	return fmt.Appendf(nil, "id: %d\nevent: %s\ndata: %s\n\n", id, eventType, data), nil
 }
 
-func writeAndFlushMultipleJson[T any](w *bufio.Writer, values []T) error {
-	var output []byte
-	for _, v := range values {
-		respJson, err := json.Marshal(v)
-		if err != nil {
-			return err
-		}
-		respJson = append(respJson, '\r', '\n')
-		output = append(output, respJson...)
+func writeAndFlushEvent(w *bufio.Writer, id uint64, eventType string, value any) error {
+	event, err := formatEvent(id, eventType, value)
+	if err != nil {
+		return err
 	}
-	return writeAndFlushBytes(w, output)
+	return writeAndFlushBytes(w, event)
 }
 
 func writeAndFlushBytes(w *bufio.Writer, bs []byte) error {
@@ -265,3 +337,15 @@ func writeAndFlushBytes(w *bufio.Writer, bs []byte) error {
 	}
 	return nil
 }
+
+// @Summary      Get metrics of the internal API event queues
+// @Description  Returns the number of subscribers, queue depths and the number of coalesced messages and disconnected slow consumers
+// @Tags         Internal
+// @Produce      json
+// @Success      200  {object}  service.EventStats
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Router       /metrics/events [get]
+func (tc *TokenHandler) GetEventStats(c *fiber.Ctx) error {
+	return c.JSON(tc.tokenService.EventStats())
+}
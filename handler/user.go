@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"time"
+
 	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"github.com/ProjectLighthouseCAU/heimdall/service"
 	"github.com/gofiber/fiber/v2"
@@ -109,7 +111,7 @@ func (uc *UserHandler) Login(c *fiber.Ctx) error {
 	if err != nil {
 		return UnwrapAndSendError(c, model.InternalServerError{Message: "Could not get session", Err: err})
 	}
-	user, err := uc.userService.Login(payload.Username, payload.Password, session)
+	user, err := uc.userService.Login(payload.Username, payload.Password, session, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
@@ -166,13 +168,38 @@ func (uc *UserHandler) Register(c *fiber.Ctx) error {
 	if err != nil {
 		return UnwrapAndSendError(c, model.InternalServerError{Message: "Could not get session", Err: err})
 	}
-	user, err := uc.userService.Register(payload.Username, payload.Password, payload.Email, payload.RegistrationKey, session)
+	user, err := uc.userService.Register(payload.Username, payload.Password, payload.Email, payload.RegistrationKey, session, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
 	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
+type CheckPasswordPayload struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+} //@name CheckPasswordPayload
+
+// @Summary      Check password
+// @Description  Checks a password against the password policy and returns structured feedback (e.g. to show why a password is rejected before registering). Username and email are optional and used to reject passwords containing personal information.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  CheckPasswordPayload  true  "Password, Username, Email"
+// @Success      200  {object}  model.PasswordCheckResult
+// @Failure      400  "Bad Request"
+// @Failure      500  "Internal Server Error"
+// @Router       /password-check [post]
+func (uc *UserHandler) CheckPassword(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	var payload CheckPasswordPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	return c.JSON(uc.userService.CheckPassword(payload.Password, payload.Username, payload.Email))
+}
+
 type CreateOrUpdateUserPayload struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -199,20 +226,27 @@ func (uc *UserHandler) Create(c *fiber.Ctx) error {
 		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
 	}
 
-	err := uc.userService.Create(payload.Username, payload.Password, payload.Email)
+	err := uc.userService.Create(payload.Username, payload.Password, payload.Email, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
 	return c.SendStatus(fiber.StatusCreated)
 }
 
+type UpdateUserPayload struct {
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"` // required when updating your own account
+} //@name UpdateUserPayload
+
 // @Summary      Update user
-// @Description  Updates a user (always updates all fields, partial updates currently not supported)
+// @Description  Updates a user (always updates all fields, partial updates currently not supported). Users updating their own account must provide their current password, admins updating other users must have authenticated recently (see /reauthenticate).
 // @Tags         Users
 // @Accept       json
 // @Produce      plain
 // @Param        id  path  int  true  "User ID"
-// @Param        payload  body  CreateOrUpdateUserPayload  true  "Username, Password, Email"
+// @Param        payload  body  UpdateUserPayload  true  "Username, Password, Email, CurrentPassword"
 // @Success      200  "OK"
 // @Failure      400  "Bad Request"
 // @Failure      401  "Unauthorized"
@@ -227,23 +261,32 @@ func (uc *UserHandler) Update(c *fiber.Ctx) error {
 	if id < 0 {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	var payload CreateOrUpdateUserPayload
+	var payload UpdateUserPayload
 	if err := c.BodyParser(&payload); err != nil {
 		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
 	}
+	if err := uc.verifySensitiveAction(c, uint(id), payload.CurrentPassword); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
 
-	err := uc.userService.Update(uint(id), payload.Username, payload.Password, payload.Email)
+	err := uc.userService.Update(uint(id), payload.Username, payload.Password, payload.Email, auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
+type DeleteUserPayload struct {
+	CurrentPassword string `json:"current_password"` // required when deleting your own account
+} //@name DeleteUserPayload
+
 // @Summary      Delete user
-// @Description  Deletes a user given a user id
+// @Description  Deletes a user given a user id. Users deleting their own account must provide their current password, admins deleting other users must have authenticated recently (see /reauthenticate).
 // @Tags         Users
+// @Accept       json
 // @Produce      plain
 // @Param        id  path  int  true  "User ID"
+// @Param        payload  body  DeleteUserPayload  false  "CurrentPassword"
 // @Success      200  "OK"
 // @Failure      400  "Bad Request"
 // @Failure      401  "Unauthorized"
@@ -256,13 +299,87 @@ func (uc *UserHandler) Delete(c *fiber.Ctx) error {
 	if id < 0 {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	err := uc.userService.DeleteByID(uint(id))
+	var payload DeleteUserPayload
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+		}
+	}
+	if err := uc.verifySensitiveAction(c, uint(id), payload.CurrentPassword); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	err := uc.userService.DeleteByID(uint(id), auditActor(c))
 	if err != nil {
 		return UnwrapAndSendError(c, err)
 	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
+type DisableUserPayload struct {
+	Reason string     `json:"reason"` // shown to the user when trying to log in
+	Until  *time.Time `json:"until"`  // ISO 8601 datetime, optional (disabled indefinitely if omitted)
+} //@name DisableUserPayload
+
+// @Summary      Disable user
+// @Description  Disables a user (optionally until a given date, then the system enables the user again) without deleting any data. Disabled users cannot log in or use their API token and their open auth connections are closed. Requires recent authentication (see /reauthenticate).
+// @Tags         Users
+// @Accept       json
+// @Produce      plain
+// @Param        id  path  int  true  "User ID"
+// @Param        payload  body  DisableUserPayload  true  "Reason, Until"
+// @Success      200  "OK"
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      404  "Not Found"
+// @Failure      409  "Conflict"
+// @Failure      500  "Internal Server Error"
+// @Router       /users/{id}/disable [put]
+func (uc *UserHandler) Disable(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var payload DisableUserPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	if err := uc.verifySensitiveAction(c, uint(id), ""); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	if err := uc.userService.Disable(uint(id), payload.Reason, payload.Until, auditActor(c)); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// @Summary      Enable user
+// @Description  Re-enables a disabled user (requires a recent authentication)
+// @Tags         Users
+// @Produce      plain
+// @Param        id  path  int  true  "User ID"
+// @Success      200  "OK"
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      404  "Not Found"
+// @Failure      500  "Internal Server Error"
+// @Router       /users/{id}/disable [delete]
+func (uc *UserHandler) Enable(c *fiber.Ctx) error {
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := uc.verifySensitiveAction(c, uint(id), ""); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	if err := uc.userService.Enable(uint(id), auditActor(c)); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
 // @Summary      Get roles of user
 // @Description  Get a list of roles that a user posesses
 // @Tags         Users
@@ -286,3 +403,60 @@ func (uc *UserHandler) GetRolesOfUser(c *fiber.Ctx) error {
 	}
 	return c.JSON(roles)
 }
+
+type ReauthenticatePayload struct {
+	Password string `json:"password"`
+} //@name ReauthenticatePayload
+
+// @Summary      Re-authenticate
+// @Description  Confirms the password of the logged in user. Admins must have authenticated recently to change or delete other users.
+// @Tags         Users
+// @Accept       json
+// @Produce      plain
+// @Param        payload  body  ReauthenticatePayload  true  "Password"
+// @Success      200  "OK"
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      500  "Internal Server Error"
+// @Router       /reauthenticate [post]
+func (uc *UserHandler) Reauthenticate(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	var payload ReauthenticatePayload
+	if err := c.BodyParser(&payload); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	user, ok := c.Locals("user").(*model.User)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	session, err := uc.sessionStore.Get(c)
+	if err != nil {
+		return UnwrapAndSendError(c, model.InternalServerError{Message: "Could not get session", Err: err})
+	}
+	if err := uc.userService.Reauthenticate(user, payload.Password, session); err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// verifySensitiveAction checks that the logged in user may change or delete the user with the given id
+func (uc *UserHandler) verifySensitiveAction(c *fiber.Ctx, targetID uint, currentPassword string) error {
+	actor, ok := c.Locals("user").(*model.User)
+	if !ok {
+		return model.InternalServerError{Message: "No user in request context"}
+	}
+	session, err := uc.sessionStore.Get(c)
+	if err != nil {
+		return model.InternalServerError{Message: "Could not get session", Err: err}
+	}
+	return uc.userService.VerifySensitiveAction(actor, targetID, currentPassword, session)
+}
+
+// verifyRecentAuthentication checks that the session of the logged in user was (re-)authenticated recently
+func verifyRecentAuthentication(c *fiber.Ctx, userService *service.UserService, sessionStore *session.Store) error {
+	session, err := sessionStore.Get(c)
+	if err != nil {
+		return model.InternalServerError{Message: "Could not get session", Err: err}
+	}
+	return userService.VerifyRecentAuthentication(session)
+}
@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"bufio"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// MULTIPLEXED WATCH STREAMS
+// A single connection receives the auth updates of many (or all) users,
+// so services like Beacon do not need one connection per user.
+
+const (
+	closedEvent      = "closed" // SSE event type of an invalidated API token on the multiplexed stream
+	watchAllUsername = "*"      // subscribes to all users
+)
+
+// @Summary      Subscribe to updates of the API tokens and roles of many users
+// @Description  Multiplexed variant of /internal/authenticate/{username} for the deploy role. First the current state of all (or the given) users is sent as snapshot using SSE of type "auth", followed by the updates of these users.
+// @Description  An invalidated API token is sent as SSE of type "closed" with an AuthClosedMessage (instead of closing the connection). Disabled users and users without an API token are not part of the snapshot.
+// @Description  The expiry of a non-permanent token is announced with events of type "expiring" and "expired" (followed by "closed").
+// @Description  When reconnecting with the Last-Event-ID header, missed events are replayed instead of sending the snapshot (if they are still retained).
+// @Description  The connection is closed when the API token of the watcher is invalidated, the watcher is disabled or deleted or loses the deploy role.
+// @Tags         Internal
+// @Produce      text/event-stream
+// @Param        usernames      query   string  false  "Comma separated usernames to watch (all users if empty)"
+// @Param        Last-Event-ID  header  string  false  "Id of the last received event to resume the stream"
+// @Success      200  {object}  AuthUpdateMessage
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /internal/watch [get]
+func (tc *TokenHandler) WatchAllAuthChanges(c *fiber.Ctx) error {
+	setEventStreamHeaders(c)
+
+	watcher, ok := c.Locals("user").(*model.User)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	lastEventID, resume, err := parseLastEventID(c)
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	var usernames []string // nil watches all users
+	if query := c.Query("usernames"); query != "" {
+		usernames = strings.Split(query, ",")
+	}
+	filter := newWatchFilter()
+	filter.add(usernames)
+	if usernames == nil {
+		filter.add([]string{watchAllUsername})
+	}
+
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		revoked, stopWatching := tc.watchWatcher(watcher, config.DeployRoleName)
+		defer stopWatching()
+
+		var sub *broker.Subscription[*model.AuthUpdateMessage]
+		replayed := false
+		if resume {
+			sub, replayed = tc.tokenService.ResumeAllChanges(lastEventID)
+		} else {
+			sub = tc.tokenService.SubscribeToAllChanges()
+		}
+		defer tc.tokenService.UnsubscribeFromChanges(sub)
+		if isRevoked(revoked) {
+			return
+		}
+
+		// send the snapshot if the missed events could not be replayed
+		// (queried after subscribing, so no update is missed)
+		if !replayed {
+			states, err := tc.tokenService.AuthStates(usernames)
+			if err != nil {
+				return
+			}
+			var output []byte
+			for _, state := range states {
+				event, err := formatEvent(sub.StartID(), authEvent, state)
+				if err != nil {
+					return
+				}
+				output = append(output, event...)
+			}
+			if err := writeAndFlushBytes(w, output); err != nil {
+				return
+			}
+		}
+		forwardWatchEventsToClient(sub, filter, revoked, w)
+	}))
+	return nil
+}
+
+// forwards the events of the watched users until the subscription or the connection is closed
+// or the credentials of the watcher are revoked
+func forwardWatchEventsToClient(sub *broker.Subscription[*model.AuthUpdateMessage], filter *watchFilter, revoked <-chan struct{}, w *bufio.Writer) {
+	for {
+		select {
+		case <-sub.Done(): // slow consumer
+			return
+		case <-revoked:
+			return
+		case <-sub.Ready():
+			var output []byte
+			for _, event := range sub.Drain() {
+				if !filter.matches(event.Topic) {
+					continue
+				}
+				var bs []byte
+				var err error
+				if event.Closed {
+					bs, err = formatEvent(event.ID, closedEvent, model.AuthClosedMessage{Username: event.Topic})
+				} else {
+					bs, err = formatEvent(event.ID, eventTypeOf(authEvent, event.Message), event.Message)
+				}
+				if err != nil {
+					return
+				}
+				output = append(output, bs...)
+			}
+			if len(output) == 0 {
+				continue
+			}
+			err := writeAndFlushBytes(w, output) // send updates
+			if err != nil {
+				return
+			}
+		case <-time.After(time.Second): // detect closed connection
+			err := writeAndFlushBytes(w, keepalive)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// @Summary      Subscribe to updates of the API tokens and roles of many users over WebSocket
+// @Description  WebSocket variant of /internal/watch for the deploy role. After the upgrade the client sends WebSocketRequests to add usernames to (or remove them from) the watched set, "*" watches all users.
+// @Description  The current state of newly watched users is sent as WebSocketMessage of type "auth", followed by their updates. A message of type "closed" indicates an invalidated API token of a watched user.
+// @Description  When connecting with last_event_id, the missed events of the usernames of the first subscribe request are replayed instead of sending their current state (if they are still retained).
+// @Description  The server sends a ping every WEBSOCKET_PING_INTERVAL and closes the connection if no pong is received. The connection is closed after a message of type "closed" with the username of the watcher when its API token is invalidated, it is disabled or deleted or loses the deploy role.
+// @Tags         Internal
+// @Param        last_event_id  query  int               false  "Id of the last received event to resume the stream"
+// @Param        payload        body   WebSocketRequest  true   "sent as WebSocket text message after the upgrade"
+// @Success      101  {object}  WebSocketMessage
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      426  "Upgrade Required"
+// @Router       /internal/ws/watch [get]
+func (tc *TokenHandler) WatchAllAuthChangesWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.SendStatus(fiber.StatusUpgradeRequired)
+	}
+	lastEventID, resume, err := parseWebSocketLastEventID(c)
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	watcher, ok := c.Locals("user").(*model.User)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return websocket.New(func(conn *websocket.Conn) {
+		ws := newWebSocketSession(conn)
+		defer ws.close()
+
+		revoked, stopWatching := tc.watchWatcher(watcher, config.DeployRoleName)
+		defer stopWatching()
+		go func() {
+			select {
+			case <-ws.done:
+			case <-revoked:
+				ws.write(model.WebSocketMessage{Type: model.WebSocketClosedMessage, Username: watcher.Username, Error: "API token of the watcher invalidated"})
+				ws.close()
+			}
+		}()
+
+		var sub *broker.Subscription[*model.AuthUpdateMessage]
+		replayed := false
+		if resume {
+			sub, replayed = tc.tokenService.ResumeAllChanges(lastEventID)
+		} else {
+			sub = tc.tokenService.SubscribeToAllChanges()
+		}
+		defer tc.tokenService.UnsubscribeFromChanges(sub)
+
+		w := &webSocketWatch{ws: ws, sub: sub, filter: newWatchFilter()}
+		forwarding := false
+		for {
+			var req model.WebSocketRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return // closed connection or missing pong
+			}
+			switch req.Action {
+			case model.WebSocketSubscribe:
+				// the replayed events of a resumed stream replace the states of the first subscribe request
+				sendStates := forwarding || !replayed
+				if err := tc.watchWebSocket(w, req.Usernames, sendStates); err != nil {
+					ws.writeError("", err)
+				}
+				if !forwarding { // the queued (or replayed) events are kept until the first usernames are known
+					go w.forward()
+					forwarding = true
+				}
+			case model.WebSocketUnsubscribe:
+				w.filter.remove(req.Usernames)
+			default:
+				ws.writeError("", model.BadRequestError{Message: "Unknown action " + strconv.Quote(req.Action)})
+			}
+		}
+	})(c)
+}
+
+// watchWebSocket adds usernames to the watched set and sends the current states of the added users
+func (tc *TokenHandler) watchWebSocket(w *webSocketWatch, usernames []string, sendStates bool) error {
+	// no events are forwarded while the states are sent, so the states are always followed by the later updates
+	w.forwardMu.Lock()
+	defer w.forwardMu.Unlock()
+	added := w.filter.add(usernames)
+	if !sendStates || len(added) == 0 {
+		return nil
+	}
+	if slices.Contains(added, watchAllUsername) {
+		added = nil // all users
+	}
+	states, err := tc.tokenService.AuthStates(added)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		w.ws.write(model.WebSocketMessage{Type: model.WebSocketAuthMessage, ID: w.sub.StartID(), Data: state})
+	}
+	return nil
+}
+
+// watchWatcher subscribes to the auth changes of the user of a stream and returns a channel that is closed when its
+// API token is invalidated (regenerated or expired), the user is disabled or deleted or loses requiredRole (if not empty)
+// (the credentials are only checked by the middleware when connecting). stop ends watching.
+func (tc *TokenHandler) watchWatcher(watcher *model.User, requiredRole string) (revoked <-chan struct{}, stop func()) {
+	sub := tc.tokenService.SubscribeToChanges(watcher.Username)
+	revokedCh, stopped := make(chan struct{}), make(chan struct{})
+	allowed := func(msg *model.AuthUpdateMessage) bool {
+		return msg.ExpiryEvent != model.AuthExpired && msg.Token == watcher.ApiToken.Token &&
+			(requiredRole == "" || slices.Contains(msg.Roles, requiredRole))
+	}
+	// checked again after subscribing, the credentials may have changed since the middleware loaded them
+	if current, err := tc.reloadWatcher(watcher); err != nil {
+		close(revokedCh)
+	} else if state, err := tc.tokenService.AuthState(current); err != nil || !allowed(state) {
+		close(revokedCh)
+	}
+	if isRevoked(revokedCh) {
+		tc.tokenService.UnsubscribeFromChanges(sub)
+		return revokedCh, func() {}
+	}
+
+	go func() {
+		defer tc.tokenService.UnsubscribeFromChanges(sub)
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-sub.Done(): // token invalidated, user disabled or deleted (or slow consumer)
+				close(revokedCh)
+				return
+			case <-sub.Ready():
+				for _, event := range sub.Drain() {
+					if event.Closed || !allowed(event.Message) {
+						close(revokedCh)
+						return
+					}
+				}
+			}
+		}
+	}()
+	return revokedCh, sync.OnceFunc(func() { close(stopped) })
+}
+
+// reloadWatcher loads the current state of the user of a stream and returns an UnauthorizedError if its API token
+// was invalidated since connecting or the user was disabled or deleted
+func (tc *TokenHandler) reloadWatcher(watcher *model.User) (*model.User, error) {
+	current, err := tc.userService.GetByID(watcher.ID)
+	if err != nil || current.IsDisabled() || current.ApiToken == nil || current.ApiToken.Token != watcher.ApiToken.Token ||
+		(!current.ApiToken.Permanent && time.Now().After(current.ApiToken.ExpiresAt)) {
+		return nil, model.UnauthorizedError{Message: "API token of " + watcher.Username + " invalidated"}
+	}
+	return current, nil
+}
+
+func isRevoked(revoked <-chan struct{}) bool {
+	select {
+	case <-revoked:
+		return true
+	default:
+		return false
+	}
+}
+
+// webSocketWatch forwards the events of the watched users of a multiplexed subscription to a WebSocket session
+type webSocketWatch struct {
+	ws        *webSocketSession
+	sub       *broker.Subscription[*model.AuthUpdateMessage]
+	filter    *watchFilter
+	forwardMu sync.Mutex // held while forwarding events or sending states
+}
+
+// forward forwards events until the subscription or the connection ends it
+func (w *webSocketWatch) forward() {
+	for {
+		select {
+		case <-w.ws.done:
+			return
+		case <-w.sub.Done():
+			w.ws.close() // slow consumer, the client has to reconnect and resume with the last received event id
+			return
+		case <-w.sub.Ready():
+			w.forwardMu.Lock()
+			for _, event := range w.sub.Drain() {
+				if !w.filter.matches(event.Topic) {
+					continue
+				}
+				if event.Closed {
+					w.ws.write(model.WebSocketMessage{Type: model.WebSocketClosedMessage, ID: event.ID, Username: event.Topic, Error: "API token invalidated"})
+				} else {
+					w.ws.write(model.WebSocketMessage{Type: eventTypeOf(model.WebSocketAuthMessage, event.Message), ID: event.ID, Data: event.Message})
+				}
+			}
+			w.forwardMu.Unlock()
+		}
+	}
+}
+
+// watchFilter is the set of watched usernames of a multiplexed stream
+type watchFilter struct {
+	lock      sync.RWMutex
+	all       bool
+	usernames map[string]struct{}
+}
+
+func newWatchFilter() *watchFilter {
+	return &watchFilter{usernames: make(map[string]struct{})}
+}
+
+// add adds usernames ("*" for all users) and returns the ones that were not watched before
+func (f *watchFilter) add(usernames []string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var added []string
+	for _, username := range usernames {
+		if username == watchAllUsername {
+			if !f.all {
+				f.all = true
+				added = append(added, username)
+			}
+			continue
+		}
+		if _, ok := f.usernames[username]; ok || f.all {
+			continue
+		}
+		f.usernames[username] = struct{}{}
+		added = append(added, username)
+	}
+	return added
+}
+
+// remove removes usernames ("*" removes all users)
+func (f *watchFilter) remove(usernames []string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, username := range usernames {
+		if username == watchAllUsername {
+			f.all = false
+			clear(f.usernames)
+			continue
+		}
+		delete(f.usernames, username)
+	}
+}
+
+func (f *watchFilter) matches(username string) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if f.all {
+		return true
+	}
+	_, ok := f.usernames[username]
+	return ok
+}
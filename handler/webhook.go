@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+)
+
+type WebhookHandler struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookHandler(webhookService service.WebhookService) WebhookHandler {
+	return WebhookHandler{webhookService}
+}
+
+// @Summary      Get all webhooks
+// @Description  Get a list of all webhooks (without their secrets)
+// @Tags         Webhooks
+// @Produce      json
+// @Success      200  {object}  []Webhook
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks [get]
+func (wh *WebhookHandler) GetAll(c *fiber.Ctx) error {
+	webhooks, err := wh.webhookService.GetAll()
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(webhooks)
+}
+
+// @Summary      Get webhook by id
+// @Description  Get a webhook by its id (without its secret)
+// @Tags         Webhooks
+// @Produce      json
+// @Param        id  path  int  true  "Webhook ID"
+// @Success      200  {object}  Webhook
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      404  "Not Found"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks/{id} [get]
+func (wh *WebhookHandler) GetByID(c *fiber.Ctx) error {
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	webhook, err := wh.webhookService.GetByID(uint(id))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(webhook)
+}
+
+type CreateWebhookPayload struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`  // user.created, user.deleted, user.disabled, user.enabled, user.roles_updated, token.regenerated, token.expiring, token.expired
+	Secret      string   `json:"secret"`  // generated if empty
+	Enabled     bool     `json:"enabled"` // only enabled webhooks receive events
+} //@name CreateWebhookPayload
+
+// @Description The created webhook including its secret (which is not returned anywhere else)
+type CreateWebhookResponse struct {
+	model.Webhook
+	Secret string `json:"secret"` // key for the HMAC-SHA256 signature in the X-Heimdall-Signature header
+} //@name CreateWebhookResponse
+
+// @Summary		 Create webhook
+// @Description  Create a new webhook. Events are sent as POST requests with a WebhookEvent as body. The header X-Heimdall-Signature contains "sha256=" followed by the hex encoded HMAC-SHA256 of "<X-Heimdall-Timestamp>.<body>" using the secret as key.
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  CreateWebhookPayload  true  "url, description, events, secret, enabled"
+// @Success      201  {object}  CreateWebhookResponse
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks [post]
+func (wh *WebhookHandler) Create(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	var payload CreateWebhookPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	webhook, secret, err := wh.webhookService.Create(payload.URL, payload.Description, payload.Events, payload.Secret, payload.Enabled, auditActor(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(CreateWebhookResponse{*webhook, secret})
+}
+
+type UpdateWebhookPayload struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret"` // keeps the current secret if empty
+	Enabled     bool     `json:"enabled"`
+} //@name UpdateWebhookPayload
+
+// @Summary		 Update webhook
+// @Description  Update a webhook by its id
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      plain
+// @Param        id  path  int  true  "Webhook ID"
+// @Param        payload  body  UpdateWebhookPayload  true  "url, description, events, secret, enabled"
+// @Success      200  "OK"
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      404  "Not Found"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks/{id} [put]
+func (wh *WebhookHandler) Update(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var payload UpdateWebhookPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return UnwrapAndSendError(c, model.BadRequestError{Message: "Could not parse request body", Err: err})
+	}
+	err := wh.webhookService.Update(uint(id), payload.URL, payload.Description, payload.Events, payload.Secret, payload.Enabled, auditActor(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// @Summary      Delete webhook
+// @Description  Delete a webhook by its id including its delivery log
+// @Tags         Webhooks
+// @Produce      plain
+// @Param        id  path  int  true  "Webhook ID"
+// @Success      200  "OK"
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks/{id} [delete]
+func (wh *WebhookHandler) Delete(c *fiber.Ctx) error {
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	err := wh.webhookService.DeleteByID(uint(id), auditActor(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// @Summary      Get delivery log of webhook
+// @Description  Get the latest deliveries of a webhook by its id including the result of the last attempt, newest first
+// @Tags         Webhooks
+// @Produce      json
+// @Param        id  path  int  true  "Webhook ID"
+// @Param        limit  query  int  false  "Maximum number of deliveries (default 100, max 1000)"
+// @Success      200  {object}  []WebhookDelivery
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      404  "Not Found"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks/{id}/deliveries [get]
+func (wh *WebhookHandler) GetDeliveries(c *fiber.Ctx) error {
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	deliveries, err := wh.webhookService.GetDeliveries(uint(id), deliveryLimit(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(deliveries)
+}
+
+// @Summary      Get dead letters
+// @Description  Get the latest deliveries of all webhooks that failed after all retries, newest first
+// @Tags         Webhooks
+// @Produce      json
+// @Param        limit  query  int  false  "Maximum number of deliveries (default 100, max 1000)"
+// @Success      200  {object}  []WebhookDelivery
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks/dead-letters [get]
+func (wh *WebhookHandler) GetDeadLetters(c *fiber.Ctx) error {
+	deliveries, err := wh.webhookService.GetDeadLetters(deliveryLimit(c))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.JSON(deliveries)
+}
+
+// @Summary      Redeliver
+// @Description  Send a dead (or already delivered) delivery again with a fresh set of retries
+// @Tags         Webhooks
+// @Produce      plain
+// @Param        id  path  int  true  "Delivery ID"
+// @Success      200  "OK"
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      403  "Forbidden"
+// @Failure      404  "Not Found"
+// @Failure      409  "Conflict"
+// @Failure      500  "Internal Server Error"
+// @Router       /webhooks/deliveries/{id}/redeliver [post]
+func (wh *WebhookHandler) Redeliver(c *fiber.Ctx) error {
+	id, _ := c.ParamsInt("id", -1)
+	if id < 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	err := wh.webhookService.Redeliver(uint(id))
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func deliveryLimit(c *fiber.Ctx) int {
+	limit := c.QueryInt("limit", defaultDeliveryLimit)
+	if limit <= 0 {
+		return defaultDeliveryLimit
+	}
+	return min(limit, maxDeliveryLimit)
+}
@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// INTERNAL WEBSOCKET API
+// Same payloads as the SSE endpoints, but liveness is checked with ping/pong control frames
+// instead of keepalive comments, which works behind proxies that buffer chunked responses.
+
+// @Summary      Subscribe to updates of the API tokens and roles of users over WebSocket
+// @Description  WebSocket variant of /internal/authenticate/{username}. After the upgrade the client sends WebSocketRequests to subscribe to (or unsubscribe from) usernames, watching other users than the own user requires the deploy role.
+// @Description  For every subscribed username the current state (or the missed events after last_event_id) is sent as WebSocketMessage of type "auth", followed by all updates. A message of type "closed" indicates an invalidated token (as the closed connection for SSE).
+// @Description  The expiry of a non-permanent token is announced with messages of type "expiring" and "expired" (followed by "closed").
+// @Description  The server sends a ping every WEBSOCKET_PING_INTERVAL and closes the connection if no pong is received. The connection is closed after a message of type "closed" with the own username when the API token of the connecting user is invalidated or expires, it is disabled or deleted or loses the deploy role it connected with.
+// @Tags         Internal
+// @Param        payload  body  WebSocketRequest  true  "sent as WebSocket text message after the upgrade"
+// @Success      101  {object}  WebSocketMessage
+// @Failure      401  "Unauthorized"
+// @Failure      426  "Upgrade Required"
+// @Router       /internal/ws/authenticate [get]
+func (tc *TokenHandler) WatchAuthChangesWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.SendStatus(fiber.StatusUpgradeRequired)
+	}
+	user, ok := c.Locals("user").(*model.User)
+	if !ok {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	// token is not permanent and expired
+	if !user.ApiToken.Permanent && time.Now().After(user.ApiToken.ExpiresAt) {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	return websocket.New(func(conn *websocket.Conn) {
+		ws := newWebSocketSession(conn)
+		defer ws.close()
+
+		// users with the deploy role may watch other users, so losing it ends the connection like an invalidated token
+		requiredRole := ""
+		if user.HasRole(config.DeployRoleName) {
+			requiredRole = config.DeployRoleName
+		}
+		revoked, stopWatching := tc.watchWatcher(user, requiredRole)
+		defer stopWatching()
+		go func() {
+			select {
+			case <-ws.done:
+			case <-revoked:
+				ws.write(model.WebSocketMessage{Type: model.WebSocketClosedMessage, Username: user.Username, Error: "API token invalidated"})
+				ws.close()
+			}
+		}()
+
+		subs := make(map[string]*webSocketSubscription[*model.AuthUpdateMessage])
+		defer func() {
+			for _, sub := range subs {
+				tc.tokenService.UnsubscribeFromChanges(sub.stop())
+			}
+		}()
+
+		for {
+			var req model.WebSocketRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return // closed connection or missing pong
+			}
+			switch req.Action {
+			case model.WebSocketSubscribe:
+				for _, username := range req.Usernames {
+					if sub, ok := subs[username]; ok {
+						if !isClosed(sub.sub) {
+							continue // already subscribed
+						}
+						tc.tokenService.UnsubscribeFromChanges(sub.stop()) // resubscribe after invalidated token
+					}
+					sub, err := tc.subscribeWebSocket(ws, user, username, req.LastEventID)
+					if err != nil {
+						ws.writeError(username, err)
+						continue
+					}
+					subs[username] = newWebSocketSubscription(sub)
+					if username == user.Username { // the new token must not be sent to a holder of the old one
+						subs[username].revokes = func(msg *model.AuthUpdateMessage) bool { return msg.Token != user.ApiToken.Token }
+					}
+					go subs[username].forward(ws, model.WebSocketAuthMessage, username)
+				}
+			case model.WebSocketUnsubscribe:
+				for _, username := range req.Usernames {
+					if sub, ok := subs[username]; ok {
+						tc.tokenService.UnsubscribeFromChanges(sub.stop())
+						delete(subs, username)
+					}
+				}
+			default:
+				ws.writeError("", model.BadRequestError{Message: "Unknown action " + strconv.Quote(req.Action)})
+			}
+		}
+	})(c)
+}
+
+// subscribeWebSocket subscribes to the changes of a user and sends the current state or the missed events
+// The connecting user is reloaded first, its token or roles may have changed since the upgrade.
+func (tc *TokenHandler) subscribeWebSocket(ws *webSocketSession, user *model.User, username string, lastEventID uint64) (*broker.Subscription[*model.AuthUpdateMessage], error) {
+	current, err := tc.reloadWatcher(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := tc.tokenService.CheckCanWatch(current, username); err != nil {
+		return nil, err
+	}
+	var sub *broker.Subscription[*model.AuthUpdateMessage]
+	replayed := false
+	if lastEventID > 0 {
+		sub, replayed = tc.tokenService.ResumeChanges(username, lastEventID)
+	} else {
+		sub = tc.tokenService.SubscribeToChanges(username)
+	}
+	// the state is queried after subscribing, so no update is missed
+	watchedUser, err := tc.userService.GetByName(username)
+	if err == nil && watchedUser.IsDisabled() {
+		err = model.NotFoundError{Message: "User " + username + " is disabled"}
+	}
+	var state *model.AuthUpdateMessage
+	if err == nil {
+		state, err = tc.tokenService.AuthState(watchedUser)
+	}
+	if err != nil {
+		tc.tokenService.UnsubscribeFromChanges(sub)
+		return nil, err
+	}
+	// send current state if the missed events could not be replayed
+	if !replayed {
+		ws.write(model.WebSocketMessage{Type: model.WebSocketAuthMessage, ID: sub.StartID(), Data: state})
+	}
+	return sub, nil
+}
+
+// @Summary      Get a list of all usernames and subscribe to updates over WebSocket
+// @Description  WebSocket variant of /internal/users. After the upgrade all usernames are sent as WebSocketMessages of type "user" (or the missed events after the last_event_id query parameter), followed by all creations and removals.
+// @Description  The server sends a ping every WEBSOCKET_PING_INTERVAL and closes the connection if no pong is received.
+// @Tags         Internal
+// @Param        last_event_id  query  int  false  "Id of the last received event to resume the stream"
+// @Success      101  {object}  WebSocketMessage
+// @Failure      400  "Bad Request"
+// @Failure      401  "Unauthorized"
+// @Failure      426  "Upgrade Required"
+// @Router       /internal/ws/users [get]
+func (tc *TokenHandler) GetUsernamesWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.SendStatus(fiber.StatusUpgradeRequired)
+	}
+	lastEventID, resume, err := parseWebSocketLastEventID(c)
+	if err != nil {
+		return UnwrapAndSendError(c, err)
+	}
+	return websocket.New(func(conn *websocket.Conn) {
+		ws := newWebSocketSession(conn)
+		defer ws.close()
+
+		var sub *broker.Subscription[*model.UserUpdateMessage]
+		replayed := false
+		if resume {
+			sub, replayed = tc.tokenService.ResumeUserCreateDeleteEvents(lastEventID)
+		} else {
+			sub = tc.tokenService.SubscribeToUserCreateDeleteEvents()
+		}
+		defer tc.tokenService.UnsubscribeFromUserCreateDeleteEvents(sub)
+
+		// send the list of all users if the missed events could not be replayed
+		// (queried after subscribing, so no creation or deletion is missed)
+		if !replayed {
+			users, err := tc.userService.GetAll()
+			if err != nil {
+				return
+			}
+			for _, user := range users {
+				if user.IsDisabled() { // disabled users are announced as removed
+					continue
+				}
+				ws.write(model.WebSocketMessage{
+					Type: model.WebSocketUserMessage,
+					ID:   sub.StartID(),
+					Data: model.UserUpdateMessage{Username: user.Username, Removed: false},
+				})
+			}
+		}
+		go newWebSocketSubscription(sub).forward(ws, model.WebSocketUserMessage, "")
+
+		// clients do not send requests, but reading is required to process pongs and close frames
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})(c)
+}
+
+// parseWebSocketLastEventID returns the id from the Last-Event-ID header or the last_event_id query parameter
+// (browsers cannot set headers for WebSocket requests) and whether one of them was set
+func parseWebSocketLastEventID(c *fiber.Ctx) (uint64, bool, error) {
+	lastEventID, resume, err := parseLastEventID(c)
+	if err != nil || resume {
+		return lastEventID, resume, err
+	}
+	query := c.Query("last_event_id")
+	if query == "" {
+		return 0, false, nil
+	}
+	lastEventID, err = strconv.ParseUint(query, 10, 64)
+	if err != nil {
+		return 0, false, model.BadRequestError{Message: "Invalid last_event_id", Err: err}
+	}
+	return lastEventID, true, nil
+}
+
+// webSocketSession serializes the writes of multiple subscriptions to one connection and pings the client
+type webSocketSession struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	done    chan struct{} // closed when the connection is closed
+	once    sync.Once
+}
+
+func newWebSocketSession(conn *websocket.Conn) *webSocketSession {
+	ws := &webSocketSession{conn: conn, done: make(chan struct{})}
+	// the read deadline is extended by every pong, so a read fails if the client stops responding
+	_ = conn.SetReadDeadline(time.Now().Add(2 * config.WebSocketPingInterval))
+	conn.SetPongHandler(func(string) error {
+		if isRevoked(ws.done) { // the deadline was expired by close
+			return websocket.ErrCloseSent
+		}
+		return conn.SetReadDeadline(time.Now().Add(2 * config.WebSocketPingInterval))
+	})
+	go ws.ping()
+	return ws
+}
+
+func (ws *webSocketSession) ping() {
+	ticker := time.NewTicker(config.WebSocketPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-ticker.C:
+			err := ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.WebSocketPingInterval))
+			if err != nil {
+				ws.close()
+				return
+			}
+		}
+	}
+}
+
+// write sends a message and closes the connection if it cannot be written
+func (ws *webSocketSession) write(msg model.WebSocketMessage) {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(config.WebSocketPingInterval))
+	if err := ws.conn.WriteJSON(msg); err != nil {
+		ws.close()
+	}
+}
+
+func (ws *webSocketSession) writeError(username string, err error) {
+	message := "Internal Server Error"
+	if httpErr, ok := err.(model.HTTPError); ok {
+		message = httpErr.Error()
+	} else {
+		log.Printf("Could not unwrap error into HTTPError: %v\n", err)
+	}
+	ws.write(model.WebSocketMessage{Type: model.WebSocketErrorMessage, Username: username, Error: message})
+}
+
+// close closes the connection (which also ends the read loop of the handler)
+// Closing a hijacked fasthttp connection only takes effect when the handler returns, so the pending read is ended
+// by an expired deadline and the client is told with a close frame.
+func (ws *webSocketSession) close() {
+	ws.once.Do(func() {
+		close(ws.done)
+		deadline := time.Now().Add(config.WebSocketPingInterval)
+		_ = ws.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		_ = ws.conn.SetReadDeadline(time.Now())
+		_ = ws.conn.Close()
+	})
+}
+
+// webSocketSubscription forwards the events of a subscription to a WebSocket session
+type webSocketSubscription[T any] struct {
+	sub     *broker.Subscription[T]
+	stopped chan struct{} // closed when the client unsubscribed
+	revokes func(T) bool  // optional, an event it returns true for closes the connection instead of being sent
+}
+
+func newWebSocketSubscription[T any](sub *broker.Subscription[T]) *webSocketSubscription[T] {
+	return &webSocketSubscription[T]{sub: sub, stopped: make(chan struct{})}
+}
+
+// stop ends forwarding without notifying the client and returns the subscription to unsubscribe from
+func (s *webSocketSubscription[T]) stop() *broker.Subscription[T] {
+	close(s.stopped)
+	return s.sub
+}
+
+// forward forwards events until the subscription, the client or the connection ends it
+func (s *webSocketSubscription[T]) forward(ws *webSocketSession, messageType, username string) {
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-s.stopped:
+			return
+		case <-s.sub.Done():
+			select {
+			case <-s.stopped: // unsubscribed by the client
+				return
+			default:
+			}
+			if s.sub.Err() == broker.ErrSlowConsumer || username == "" {
+				ws.close() // the client has to reconnect and resume with the last received event id
+				return
+			}
+			s.writeQueued(ws, messageType, username) // e.g. the expired event before the subscription was closed
+			// closed subscription indicates invalidated token
+			ws.write(model.WebSocketMessage{Type: model.WebSocketClosedMessage, Username: username, Error: "API token invalidated"})
+			return
+		case <-s.sub.Ready():
+			s.writeQueued(ws, messageType, username)
+		}
+	}
+}
+
+func (s *webSocketSubscription[T]) writeQueued(ws *webSocketSession, messageType, username string) {
+	for _, event := range s.sub.Drain() {
+		if s.revokes != nil && s.revokes(event.Message) {
+			ws.write(model.WebSocketMessage{Type: model.WebSocketClosedMessage, Username: username, Error: "API token invalidated"})
+			ws.close()
+			return
+		}
+		ws.write(model.WebSocketMessage{Type: eventTypeOf(messageType, event.Message), ID: event.ID, Data: event.Message})
+	}
+}
+
+func isClosed[T any](sub *broker.Subscription[T]) bool {
+	select {
+	case <-sub.Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"log"
+	"os"
 
+	"github.com/ProjectLighthouseCAU/heimdall/config"
 	"github.com/ProjectLighthouseCAU/heimdall/setup"
 )
 
@@ -13,7 +15,14 @@ import (
 // @Host		https://lighthouse.uni-kiel.de
 // @BasePath	/api
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(setup.RunCommand(os.Args[1:]))
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 	app := setup.Setup()
+	go setup.ReloadConfigOnSIGHUP()
 	log.Println("Setup done. Listening until Ragnarök...")
 	log.Fatal(app.Listen(":8080"))
 }
@@ -39,7 +39,8 @@ func AllowIPs(ips []net.IP) fiber.Handler {
 	}
 }
 
-func AllowLoopbackAndPrivateIPsAnd(ips []net.IP) fiber.Handler {
+// AllowLoopbackAndPrivateIPsAnd allows the IPs returned by ips for each request in addition to loopback and private IPs
+func AllowLoopbackAndPrivateIPsAnd(ips func() []net.IP) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		clientIp := net.ParseIP(c.IP())
 		if _, ok := c.GetReqHeaders()[config.ProxyHeader]; !ok {
@@ -48,7 +49,7 @@ func AllowLoopbackAndPrivateIPsAnd(ips []net.IP) fiber.Handler {
 		if clientIp.IsPrivate() || clientIp.IsLoopback() {
 			return c.Next()
 		}
-		if slices.ContainsFunc(ips, func(ip net.IP) bool {
+		if slices.ContainsFunc(ips(), func(ip net.IP) bool {
 			return slices.Equal(ip, clientIp)
 		}) {
 			return c.Next()
@@ -51,6 +51,14 @@ func NewSessionMiddleware(sessionStore *session.Store,
 			return handler.UnwrapAndSendError(c, model.UnauthorizedError{})
 		}
 
+		// check if user was disabled
+		if err := userService.CheckNotDisabled(user); err != nil {
+			if err := session.Destroy(); err != nil { // destroy this session of a disabled user
+				return handler.UnwrapAndSendError(c, model.InternalServerError{Message: "Could not destroy session", Err: err})
+			}
+			return handler.UnwrapAndSendError(c, err)
+		}
+
 		c.Locals("user", user)
 		tokenService.GenerateApiTokenIfNotExists(user)
 		return c.Next()
@@ -11,7 +11,7 @@ import (
 
 type TokenMiddleware fiber.Handler
 
-func NewTokenMiddleware(userService *service.UserService, tokenRepository *repository.TokenRepository) fiber.Handler {
+func NewTokenMiddleware(userService *service.UserService, tokenRepository repository.TokenRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		headers := c.GetReqHeaders()
 		authHeader := headers["Authorization"]
@@ -27,6 +27,9 @@ func NewTokenMiddleware(userService *service.UserService, tokenRepository *repos
 		if err != nil {
 			return fiber.ErrUnauthorized
 		}
+		if user.IsDisabled() {
+			return fiber.ErrUnauthorized
+		}
 		c.Locals("user", user)
 		return c.Next()
 	}
@@ -0,0 +1,68 @@
+package model
+
+import "time"
+
+// ArchiveVersion is the version of the format of the archives written by this version of Heimdall
+// Archives of newer versions are refused, archives of older versions must stay importable.
+const ArchiveVersion = 1
+
+// Modes of importing an archive
+const (
+	ArchiveMerge   = "merge"   // the entries of the archive replace the existing entries with the same name, other entries are kept
+	ArchiveReplace = "replace" // all users, roles, registration keys and API tokens are deleted before the entries of the archive are created
+)
+
+// @Description Export of the users (with password hashes), roles, memberships, registration keys and API tokens. Entries reference each other by name, the ids are not preserved by an import. Keep it secret!
+type Archive struct {
+	Version          int                      `json:"version"`     // version of the format
+	ExportedAt       time.Time                `json:"exported_at"` // ISO 8601 datetime
+	Roles            []ArchiveRole            `json:"roles"`
+	RegistrationKeys []ArchiveRegistrationKey `json:"registration_keys"`
+	Users            []ArchiveUser            `json:"users"`
+	Tokens           []ArchiveToken           `json:"tokens"`
+} //@name Archive
+
+type ArchiveRole struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+} //@name ArchiveRole
+
+type ArchiveRegistrationKey struct {
+	Key         string    `json:"key"`
+	Description string    `json:"description"`
+	Permanent   bool      `json:"permanent"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+} //@name ArchiveRegistrationKey
+
+type ArchiveUser struct {
+	Username        string     `json:"username"`
+	PasswordHash    string     `json:"password_hash"` // bcrypt hash of the password
+	Email           string     `json:"email"`
+	LastLogin       *time.Time `json:"last_login"`
+	Disabled        bool       `json:"disabled"`
+	DisabledReason  string     `json:"disabled_reason,omitempty"`
+	DisabledBy      string     `json:"disabled_by,omitempty"` // username of the admin that disabled the user
+	DisabledUntil   *time.Time `json:"disabled_until,omitempty"`
+	RegistrationKey string     `json:"registration_key,omitempty"` // key the user registered with
+	Roles           []string   `json:"roles"`                      // names of the roles of the user
+	CreatedAt       time.Time  `json:"created_at"`
+} //@name ArchiveUser
+
+type ArchiveToken struct {
+	Username  string    `json:"username"` // owner of the token
+	Token     string    `json:"api_token"`
+	Permanent bool      `json:"permanent"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+} //@name ArchiveToken
+
+// @Description Numbers of the entries of an imported archive
+type ArchiveImportResult struct {
+	Mode             string `json:"mode"`              // merge or replace
+	Roles            int    `json:"roles"`             // imported roles
+	RegistrationKeys int    `json:"registration_keys"` // imported registration keys
+	Users            int    `json:"users"`             // imported users
+	Tokens           int    `json:"tokens"`            // imported API tokens
+	DeletedUsers     int    `json:"deleted_users"`     // users deleted by replace
+} //@name ArchiveImportResult
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditLoginSucceeded         = "login.succeeded"
+	AuditLoginFailed            = "login.failed"
+	AuditUserCreated            = "user.created" // registered or created by an admin
+	AuditUserUpdated            = "user.updated"
+	AuditUserDeleted            = "user.deleted"
+	AuditUserDisabled           = "user.disabled"
+	AuditUserEnabled            = "user.enabled"
+	AuditRoleCreated            = "role.created"
+	AuditRoleUpdated            = "role.updated"
+	AuditRoleDeleted            = "role.deleted"
+	AuditRoleAssigned           = "role.assigned"   // a user was added to a role
+	AuditRoleUnassigned         = "role.unassigned" // a user was removed from a role
+	AuditRegistrationKeyCreated = "registration_key.created"
+	AuditRegistrationKeyUpdated = "registration_key.updated"
+	AuditRegistrationKeyDeleted = "registration_key.deleted"
+	AuditTokenUpdated           = "token.updated" // the permanent flag of an API token changed
+	AuditTokenRegenerated       = "token.regenerated"
+	AuditWebhookCreated         = "webhook.created"
+	AuditWebhookUpdated         = "webhook.updated"
+	AuditWebhookDeleted         = "webhook.deleted"
+	AuditArchiveExported        = "archive.exported" // all data was exported (including password hashes)
+	AuditArchiveImported        = "archive.imported"
+)
+
+// Types of audit targets
+const (
+	AuditTargetUser            = "user"
+	AuditTargetRole            = "role"
+	AuditTargetRegistrationKey = "registration_key"
+	AuditTargetToken           = "token"
+	AuditTargetWebhook         = "webhook"
+	AuditTargetArchive         = "archive" // export or import of all data (the target name is the import mode)
+)
+
+// AuditActor describes who triggered an action and from where (set by the handlers from the request)
+type AuditActor struct {
+	UserID    *uint  // nil if not logged in
+	Username  string // name of the logged in user
+	IP        string
+	UserAgent string
+}
+
+// SystemActor is the actor of actions that are not triggered by a request
+var SystemActor = AuditActor{Username: "system"}
+
+// CommandLineActor is the actor of actions of the command line interface (heimdall <command>)
+var CommandLineActor = AuditActor{Username: "cli"}
+
+// @Description An entry of the append-only audit log: who did what to which target, when and from where
+type AuditEntry struct {
+	ID         uint                   `gorm:"primarykey" json:"id"`                     // id (increasing)
+	CreatedAt  time.Time              `gorm:"index;not null" json:"created_at"`         // ISO 8601 datetime
+	ActorID    *uint                  `gorm:"index" json:"actor_id"`                    // id of the acting user, null if not logged in (or the system)
+	ActorName  string                 `gorm:"index" json:"actor_name"`                  // name of the acting user at the time of the action ("system" for the system)
+	Action     string                 `gorm:"index;not null" json:"action"`             // e.g. login.failed, user.updated, role.assigned
+	TargetType string                 `gorm:"index" json:"target_type"`                 // user, role, registration_key, token, webhook or archive
+	TargetID   *uint                  `gorm:"index" json:"target_id"`                   // id of the target (null if unknown, e.g. failed login of an unknown user)
+	TargetName string                 `json:"target_name"`                              // name of the target at the time of the action
+	Changes    map[string]AuditChange `gorm:"serializer:json" json:"changes,omitempty"` // changed fields with the values before and after the action
+	Details    string                 `json:"details,omitempty"`                        // additional information (e.g. the reason of a failed login)
+	IP         string                 `json:"ip"`                                       // IP address of the client
+	UserAgent  string                 `json:"user_agent"`                               // User-Agent header of the client
+	PrevHash   string                 `gorm:"not null;default:''" json:"prev_hash"`     // hash of the previous entry (empty for the first entry)
+	Hash       string                 `gorm:"index;not null;default:''" json:"hash"`    // SHA-256 (hex) of PrevHash and the content of this entry
+} //@name AuditEntry
+
+// auditHashContent is the content of an entry that is covered by its hash
+// (the id is not covered, the position of an entry is given by its link to the previous entry)
+type auditHashContent struct {
+	CreatedAt  string                 `json:"created_at"`
+	ActorID    *uint                  `json:"actor_id"`
+	ActorName  string                 `json:"actor_name"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   *uint                  `json:"target_id"`
+	TargetName string                 `json:"target_name"`
+	Changes    map[string]AuditChange `json:"changes"`
+	Details    string                 `json:"details"`
+	IP         string                 `json:"ip"`
+	UserAgent  string                 `json:"user_agent"`
+}
+
+// ChainHash computes the hash of the entry that links it to the entry with PrevHash
+// CreatedAt must already have the precision of the database (microseconds), so the hash survives storing the entry.
+func (e *AuditEntry) ChainHash() (string, error) {
+	content, err := json.Marshal(auditHashContent{
+		CreatedAt:  e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		TargetName: e.TargetName,
+		Changes:    e.Changes,
+		Details:    e.Details,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+	})
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(e.PrevHash))
+	hash.Write([]byte("\n"))
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// AuditChainHead is the single row that points to the latest entry of the chain.
+// It is locked while an entry is appended, so entries are chained in the order of their commits.
+type AuditChainHead struct {
+	ID      uint   `gorm:"primarykey"` // always 1
+	EntryID uint   // id of the latest entry (0 if the log is empty)
+	Hash    string // hash of the latest entry
+}
+
+// @Description A signed checkpoint of the audit log that proves the state of the chain up to an entry
+type AuditCheckpoint struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`     // ISO 8601 datetime
+	EntryID   uint      `gorm:"index;not null" json:"entry_id"` // id of the latest entry at the time of the checkpoint
+	Hash      string    `gorm:"not null" json:"hash"`           // hash of this entry
+	PublicKey string    `gorm:"not null" json:"public_key"`     // Ed25519 public key of the signer (base64)
+	Signature string    `gorm:"not null" json:"signature"`      // Ed25519 signature of the SignedMessage (base64)
+
+	PrevCheckpointID uint `gorm:"not null;default:0" json:"prev_checkpoint_id"` // id of the previous checkpoint (0 for the first checkpoint and checkpoints written before they were chained)
+} //@name AuditCheckpoint
+
+// SignedMessage returns the message that is signed by a checkpoint
+// (checkpoints without a previous checkpoint keep the message of the checkpoints that were written before they were chained)
+func (c *AuditCheckpoint) SignedMessage() []byte {
+	message := fmt.Appendf(nil, "heimdall-audit-checkpoint\n%d\n%s\n%s", c.EntryID, c.Hash, c.CreatedAt.UTC().Format(time.RFC3339Nano))
+	if c.PrevCheckpointID != 0 {
+		message = fmt.Appendf(message, "\n%d", c.PrevCheckpointID)
+	}
+	return message
+}
+
+// @Description Result of verifying the hash chain and the checkpoints of the audit log
+type AuditVerification struct {
+	Valid              bool   `json:"valid"`
+	EntriesChecked     int64  `json:"entries_checked"`
+	FirstEntryID       uint   `json:"first_entry_id"`                 // oldest retained entry (older entries are deleted after AUDIT_RETENTION), 0 if the log is empty
+	LastEntryID        uint   `json:"last_entry_id"`                  // latest entry
+	LastHash           string `json:"last_hash"`                      // hash of the latest entry
+	CheckpointsChecked int    `json:"checkpoints_checked"`            // checkpoints whose signature and entry hash were verified
+	BrokenEntryID      *uint  `json:"broken_entry_id,omitempty"`      // first entry whose hash or link to the previous entry does not match
+	BrokenCheckpointID *uint  `json:"broken_checkpoint_id,omitempty"` // first checkpoint with an invalid signature or hash
+	Error              string `json:"error,omitempty"`                // why the verification failed
+} //@name AuditVerification
+
+// @Description Value of a field before and after an audited action (null if the field did not exist)
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+} //@name AuditChange
+
+// AuditFilter restricts the queried audit entries, empty fields match all entries
+type AuditFilter struct {
+	ActorID    *uint
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetID   *uint
+	Since      *time.Time
+	Until      *time.Time
+}
+
+// @Description A page of audit entries, newest first
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int64        `json:"total"`  // number of entries matching the filter
+	Limit   int          `json:"limit"`  // maximum number of entries per page
+	Offset  int          `json:"offset"` // number of skipped entries
+} //@name AuditPage
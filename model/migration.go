@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// SchemaMigration records an applied migration of the database schema in the schema_migrations table
+type SchemaMigration struct {
+	Version   uint      `gorm:"primarykey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// MigrationStatus is the state of a migration of the database schema
+type MigrationStatus struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Unknown   bool       `json:"unknown,omitempty"` // applied by a newer version of Heimdall
+}
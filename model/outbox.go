@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// Types of the domain events recorded in the outbox
+const (
+	OutboxUserCreated        = "user.created"
+	OutboxUserDeleted        = "user.deleted"
+	OutboxUserDisabled       = "user.disabled"
+	OutboxUserEnabled        = "user.enabled"
+	OutboxUserRolesChanged   = "user.roles_changed"
+	OutboxCredentialsChanged = "user.credentials_changed" // username or password changed, the API token is invalidated
+)
+
+// A domain event that was recorded in the same transaction as the change
+// and is dispatched to the subscribers (SSE and webhooks) at least once
+// The events of a user are dispatched in the order they were recorded, an event is only due after all
+// previous events of its user were dispatched.
+type OutboxEvent struct {
+	ID            uint   `gorm:"primarykey"`
+	Type          string `gorm:"not null"`
+	Payload       string `gorm:"not null"` // JSON encoded OutboxPayload
+	CreatedAt     time.Time
+	Attempts      int        `gorm:"not null"`
+	NextAttemptAt time.Time  `gorm:"index"`
+	DispatchedAt  *time.Time `gorm:"index"` // null until the event was dispatched successfully
+	LastError     string
+
+	UserID      uint       `gorm:"index;not null;default:0"` // user of the event (OutboxPayload.UserID) whose events are dispatched in order
+	PublishedAt *time.Time // published to the subscribers of the internal API (not repeated by retries)
+	EnqueuedAt  *time.Time // stored as deliveries of the webhooks (not repeated by retries)
+}
+
+// Payload of the outbox events
+// The state of the user at dispatch time is loaded from the database,
+// the username is stored since it is needed after the user was deleted or renamed.
+type OutboxPayload struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"` // previous username for user.credentials_changed
+}
@@ -0,0 +1,11 @@
+package model
+
+// @Description Result of checking a password against the password policy including the reasons why it was rejected
+type PasswordCheckResult struct {
+	Valid       bool     `json:"valid"`       // true if the password satisfies the password policy
+	Score       int      `json:"score"`       // estimated strength from 0 (very weak) to 4 (very strong)
+	MinScore    int      `json:"min_score"`   // minimum strength score required by the policy
+	CrackTime   string   `json:"crack_time"`  // human readable estimate of the time needed to guess the password
+	Violations  []string `json:"violations"`  // rules of the password policy that are violated (empty if valid)
+	Suggestions []string `json:"suggestions"` // hints on how to make the password stronger
+} //@name PasswordCheckResult
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// A previous password hash of a user to prevent password reuse
+type PasswordHistoryEntry struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"index;not null"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE"` // history is deleted together with the user
+	Password  string    `gorm:"not null"`                    // hashed
+	CreatedAt time.Time // time when the password was replaced
+}
@@ -0,0 +1,39 @@
+package model
+
+// Seed describes roles, registration keys and users (with their roles and API tokens) that should exist
+// It is applied idempotently: missing entries are created and existing ones are left unchanged
+// (except for missing role memberships and API tokens, which are added).
+type Seed struct {
+	Roles            []string              `json:"roles" yaml:"roles"`
+	RegistrationKeys []SeedRegistrationKey `json:"registration_keys" yaml:"registration_keys"`
+	Users            []SeedUser            `json:"users" yaml:"users"` // created in this order
+}
+
+type SeedRegistrationKey struct {
+	Key         string `json:"key" yaml:"key"`
+	Description string `json:"description" yaml:"description"`
+	Permanent   bool   `json:"permanent" yaml:"permanent"`
+	ExpiresIn   string `json:"expires_in" yaml:"expires_in"` // duration from the creation of the key (e.g. "72h"), 7 days if empty
+}
+
+type SeedUser struct {
+	Username        string        `json:"username" yaml:"username"`
+	Password        string        `json:"password" yaml:"password"`
+	Email           string        `json:"email" yaml:"email"`
+	RegistrationKey string        `json:"registration_key" yaml:"registration_key"` // the user is registered with this key instead of being created
+	Roles           []string      `json:"roles" yaml:"roles"`
+	ApiToken        *SeedApiToken `json:"api_token" yaml:"api_token"` // the user gets an API token if set (registered users always get one)
+}
+
+type SeedApiToken struct {
+	Permanent bool `json:"permanent" yaml:"permanent"`
+}
+
+// SeedResult lists the entries that were created or added by applying a seed
+type SeedResult struct {
+	Roles            []string `json:"roles"`             // created roles
+	RegistrationKeys []string `json:"registration_keys"` // created registration keys
+	Users            []string `json:"users"`             // created users
+	Memberships      []string `json:"memberships"`       // added role memberships as "<username>:<rolename>"
+	ApiTokens        []string `json:"api_tokens"`        // usernames of the users that got a new API token
+}
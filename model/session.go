@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Session is a session of a user stored in the SQL database (SESSION_STORAGE=database)
+type Session struct {
+	Key       string     `gorm:"primarykey"`
+	Data      []byte     `gorm:"not null"`
+	ExpiresAt *time.Time `gorm:"index"` // nil if the session does not expire
+}
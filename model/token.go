@@ -10,8 +10,17 @@ type Token struct {
 	CreatedAt time.Time `json:"created_at"`                 // ISO 8601 datetime
 	UpdatedAt time.Time `json:"updated_at"`                 // ISO 8601 datetime
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"` // ISO 8601 datetime
+
+	ExpiryWarned   bool `gorm:"not null;default:false" json:"-"` // subscribers were warned that the token expires soon
+	ExpiryNotified bool `gorm:"not null;default:false" json:"-"` // subscribers were notified that the token expired
 } //@name Token
 
+// Expiry events of API tokens (see AuthUpdateMessage.ExpiryEvent)
+const (
+	AuthExpiring = "expiring" // the token expires within API_TOKEN_EXPIRY_WARNING
+	AuthExpired  = "expired"  // the token expired, the stream is closed afterwards
+)
+
 // @Description Message that is sent to notify subscribers (e.g. Beacon) on changes to one of these authentication related values
 type AuthUpdateMessage struct {
 	Username  string    `json:"username"`   // unique username associated with this token
@@ -19,10 +28,18 @@ type AuthUpdateMessage struct {
 	ExpiresAt time.Time `json:"expires_at"` // expiration date of this token
 	Permanent bool      `json:"permanent"`  // no expiration (ignore ExpiresAt)
 	Roles     []string  `json:"roles"`      // roles associated with this token
+
+	ExpiryEvent string `json:"expiry_event,omitempty"` // "expiring" or "expired" if the message announces the expiry of the token, empty for other updates
 } //@name AuthUpdateMessage
 
-// @Description Message that is sent to notify subscribers (e.g. Beacon) when a new user is created or a user is removed
+// @Description Message that is sent to subscribers of the multiplexed watch stream when the API token of a user was invalidated (the per-user stream is closed instead)
+type AuthClosedMessage struct {
+	Username string `json:"username"` // user whose API token was invalidated (e.g. regenerated, user disabled or deleted)
+} //@name AuthClosedMessage
+
+// @Description Message that is sent to notify subscribers (e.g. Beacon) when a new user is created or a user is removed (disabling and enabling a user is announced like a removal and creation)
 type UserUpdateMessage struct {
 	Username string `json:"username"`
 	Removed  bool   `json:"removed"`
+	Disabled bool   `json:"disabled"` // the user was not deleted but disabled
 } //@name UserUpdateMessage
@@ -11,8 +11,28 @@ type User struct {
 	Email     string     `json:"email"`                                // can be empty
 	LastLogin *time.Time `json:"last_login"`                           // ISO 8601 datetime
 
+	Disabled       bool       `gorm:"not null;default:false" json:"disabled"` // disabled users cannot log in or use their API token
+	DisabledReason string     `json:"disabled_reason,omitempty"`              // reason shown to the user when trying to log in
+	DisabledByID   *uint      `json:"disabled_by_id,omitempty"`               // id of the admin that disabled this user
+	DisabledUntil  *time.Time `json:"disabled_until,omitempty"`               // ISO 8601 datetime, disabled indefinitely if null
+
 	RegistrationKeyID *uint            `gorm:"constraint:OnDelete:SET NULL" json:"-"`
 	RegistrationKey   *RegistrationKey `gorm:"constraint:OnDelete:SET NULL" json:"registration_key,omitempty"` // omitted if null (when user was created and not registered or when list of users is queried to not leak other users keys)
 	Roles             []Role           `gorm:"many2many:user_roles;constraint:OnDelete:CASCADE;" json:"roles"`
 	ApiToken          *Token           `gorm:"constraint:OnDelete:CASCADE;not null" json:"api_token,omitempty"` // omitted if null (user doesn't have an API token)
 } //@name User
+
+// IsDisabled returns true if the user is disabled and the optional until-date has not passed yet
+func (u *User) IsDisabled() bool {
+	return u.Disabled && (u.DisabledUntil == nil || time.Now().Before(*u.DisabledUntil))
+}
+
+// HasRole returns true if the user has the role with the given name (roles must be pre-loaded)
+func (u *User) HasRole(name string) bool {
+	for _, role := range u.Roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package model
+
+import "time"
+
+// Event types that can be subscribed to by webhooks
+const (
+	WebhookEventUserCreated      = "user.created"       // a user registered or was created by an admin
+	WebhookEventUserDeleted      = "user.deleted"       // a user was deleted
+	WebhookEventUserDisabled     = "user.disabled"      // a user was disabled
+	WebhookEventUserEnabled      = "user.enabled"       // a disabled user was enabled again
+	WebhookEventUserRolesUpdated = "user.roles_updated" // the roles of a user (or the permanent flag of the API token) changed
+	WebhookEventTokenRegenerated = "token.regenerated"  // a new API token was generated for a user
+	WebhookEventTokenExpiring    = "token.expiring"     // the API token of a user expires within API_TOKEN_EXPIRY_WARNING
+	WebhookEventTokenExpired     = "token.expired"      // the API token of a user expired
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventUserCreated,
+	WebhookEventUserDeleted,
+	WebhookEventUserDisabled,
+	WebhookEventUserEnabled,
+	WebhookEventUserRolesUpdated,
+	WebhookEventTokenRegenerated,
+	WebhookEventTokenExpiring,
+	WebhookEventTokenExpired,
+}
+
+// Delivery states
+const (
+	WebhookDeliveryPending   = "pending"   // waiting for the next attempt
+	WebhookDeliveryDelivered = "delivered" // the receiver responded with 2xx
+	WebhookDeliveryDead      = "dead"      // all attempts failed (dead-letter list)
+)
+
+// @Description A subscription of an external tool to user, role and token events. The payloads are signed with HMAC-SHA256 using the secret.
+type Webhook struct {
+	Model
+
+	URL         string   `gorm:"not null" json:"url"`                    // receiver of the HTTP POST requests
+	Description string   `json:"description"`                            // a description for this webhook
+	Events      []string `gorm:"serializer:json;not null" json:"events"` // subscribed event types
+	Secret      string   `gorm:"not null" json:"-"`                      // key for the HMAC-SHA256 signature, not serialized
+	Enabled     bool     `gorm:"not null" json:"enabled"`                // disabled webhooks do not receive new events
+} //@name Webhook
+
+// Subscribes reports whether the webhook is enabled and subscribed to the event type
+func (w *Webhook) Subscribes(eventType string) bool {
+	if !w.Enabled {
+		return false
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// @Description A single event delivered (or to be delivered) to a webhook including the result of the last attempt
+type WebhookDelivery struct {
+	Model
+
+	WebhookID      uint       `gorm:"index;not null" json:"webhook_id"`     // id of the receiving webhook
+	Webhook        Webhook    `gorm:"constraint:OnDelete:CASCADE" json:"-"` // deliveries are deleted together with the webhook
+	EventID        string     `gorm:"not null" json:"event_id"`             // unique id of the event (same for all webhooks)
+	EventType      string     `gorm:"not null" json:"event_type"`           // type of the event (e.g. user.created)
+	Payload        string     `gorm:"not null" json:"payload"`              // signed JSON request body
+	Status         string     `gorm:"index;not null" json:"status"`         // pending, delivered or dead
+	Attempts       int        `gorm:"not null" json:"attempts"`             // number of attempts so far
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`         // ISO 8601 datetime of the next attempt (if pending)
+	LastStatusCode int        `json:"last_status_code"`                     // HTTP status code of the last attempt (0 if no response)
+	LastError      string     `json:"last_error"`                           // error of the last attempt
+	DeliveredAt    *time.Time `json:"delivered_at"`                         // ISO 8601 datetime of the successful attempt
+} //@name WebhookDelivery
+
+// @Description The JSON body sent to webhooks
+type WebhookEvent struct {
+	ID        string    `json:"id"`         // unique id of the event
+	Type      string    `json:"type"`       // event type (e.g. user.created)
+	CreatedAt time.Time `json:"created_at"` // ISO 8601 datetime of the event
+	Data      any       `json:"data"`       // event specific data (see WebhookUserEventData and WebhookTokenEventData)
+} //@name WebhookEvent
+
+// @Description Data of user events (user.created, user.deleted, user.disabled, user.enabled, user.roles_updated)
+type WebhookUserEventData struct {
+	UserID   uint     `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"` // roles of the user (only user.roles_updated)
+} //@name WebhookUserEventData
+
+// @Description Data of token events (token.regenerated, token.expiring, token.expired), the token itself is never sent
+type WebhookTokenEventData struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Permanent bool      `json:"permanent"`
+} //@name WebhookTokenEventData
@@ -0,0 +1,33 @@
+package model
+
+// WebSocket actions
+const (
+	WebSocketSubscribe   = "subscribe"
+	WebSocketUnsubscribe = "unsubscribe"
+)
+
+// WebSocket message types
+const (
+	WebSocketAuthMessage     = "auth"       // Data is an AuthUpdateMessage
+	WebSocketExpiringMessage = AuthExpiring // Data is an AuthUpdateMessage of a token that expires soon
+	WebSocketExpiredMessage  = AuthExpired  // Data is an AuthUpdateMessage of an expired token (followed by closed)
+	WebSocketUserMessage     = "user"       // Data is a UserUpdateMessage
+	WebSocketClosedMessage   = "closed"     // the subscription of Username was closed (e.g. invalidated token)
+	WebSocketErrorMessage    = "error"      // a request could not be handled
+)
+
+// @Description Request sent by clients of the internal WebSocket API to change the subscribed usernames
+type WebSocketRequest struct {
+	Action      string   `json:"action"`                  // subscribe or unsubscribe
+	Usernames   []string `json:"usernames"`               // users to (un)subscribe, other users than the own user require the deploy role ("*" for all users on /internal/ws/watch)
+	LastEventID uint64   `json:"last_event_id,omitempty"` // id of the last received event to replay missed events instead of sending the current state
+} //@name WebSocketRequest
+
+// @Description Message sent to clients of the internal WebSocket API
+type WebSocketMessage struct {
+	Type     string `json:"type"`               // auth, expiring, expired, user, closed or error
+	ID       uint64 `json:"id,omitempty"`       // event id (auth and user messages)
+	Data     any    `json:"data,omitempty"`     // AuthUpdateMessage (auth) or UserUpdateMessage (user)
+	Username string `json:"username,omitempty"` // username of a closed subscription or failed request
+	Error    string `json:"error,omitempty"`    // reason of an error or closed subscription
+} //@name WebSocketMessage
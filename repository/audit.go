@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// id of the single row of the audit_chain_heads table
+const auditChainHeadID = 1
+
+// AuditRepository stores the hash chained audit log and its checkpoints
+type AuditRepository interface {
+	WithTx(tx Tx) AuditRepository
+	Append(head *model.AuditChainHead, entry *model.AuditEntry) error
+	Find(filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, int64, error)
+	FindChain(afterID uint, limit int) ([]model.AuditEntry, error)
+	LockHead() (*model.AuditChainHead, error)
+	FindHead() (*model.AuditChainHead, error)
+	CreateCheckpoint(checkpoint *model.AuditCheckpoint) error
+	FindLatestCheckpoint() (*model.AuditCheckpoint, error)
+	FindCheckpoints() ([]model.AuditCheckpoint, error)
+	FindByID(id uint) (*model.AuditEntry, error)
+	DeleteBefore(t time.Time) (int64, error)
+}
+
+// gormAuditRepository implements AuditRepository with GORM
+type gormAuditRepository struct {
+	DB *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &gormAuditRepository{
+		DB: db,
+	}
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormAuditRepository) WithTx(tx Tx) AuditRepository {
+	return &gormAuditRepository{
+		DB: tx.db,
+	}
+}
+
+// Append links an entry to the locked head of the chain (see LockHead), stores it and moves the head to it
+// (entries are never updated)
+func (r *gormAuditRepository) Append(head *model.AuditChainHead, entry *model.AuditEntry) error {
+	entry.PrevHash = head.Hash
+	hash, err := entry.ChainHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	if err := r.DB.Create(entry).Error; err != nil {
+		return wrapError(err)
+	}
+	head.EntryID = entry.ID
+	head.Hash = entry.Hash
+	return wrapError(r.DB.Save(head).Error)
+}
+
+// Find returns up to limit entries matching the filter after skipping offset entries (newest first)
+// and the total number of matching entries
+func (r *gormAuditRepository) Find(filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, int64, error) {
+	query := r.DB.Model(&model.AuditEntry{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.ActorName != "" {
+		query = query.Where("actor_name = ?", filter.ActorName)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, wrapError(err)
+	}
+	var entries []model.AuditEntry
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&entries).Error
+	return entries, total, wrapError(err)
+}
+
+// FindChain returns up to limit entries with an id greater than afterID in the order of the chain
+func (r *gormAuditRepository) FindChain(afterID uint, limit int) ([]model.AuditEntry, error) {
+	var entries []model.AuditEntry
+	err := r.DB.Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&entries).Error
+	return entries, wrapError(err)
+}
+
+// LockHead returns the head of the chain and locks it until the end of the transaction
+// (only use within a transaction)
+func (r *gormAuditRepository) LockHead() (*model.AuditChainHead, error) {
+	var head model.AuditChainHead
+	err := r.DB.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, auditChainHeadID).Error
+	return &head, wrapError(err)
+}
+
+// FindHead returns the head of the chain without locking it
+func (r *gormAuditRepository) FindHead() (*model.AuditChainHead, error) {
+	var head model.AuditChainHead
+	err := r.DB.First(&head, auditChainHeadID).Error
+	return &head, wrapError(err)
+}
+
+func (r *gormAuditRepository) CreateCheckpoint(checkpoint *model.AuditCheckpoint) error {
+	return wrapError(r.DB.Create(checkpoint).Error)
+}
+
+// FindLatestCheckpoint returns the latest checkpoint (NotFoundError if there is none)
+func (r *gormAuditRepository) FindLatestCheckpoint() (*model.AuditCheckpoint, error) {
+	var checkpoint model.AuditCheckpoint
+	err := r.DB.Order("id DESC").First(&checkpoint).Error
+	return &checkpoint, wrapError(err)
+}
+
+// FindCheckpoints returns all checkpoints, oldest first
+func (r *gormAuditRepository) FindCheckpoints() ([]model.AuditCheckpoint, error) {
+	var checkpoints []model.AuditCheckpoint
+	err := r.DB.Order("id ASC").Find(&checkpoints).Error
+	return checkpoints, wrapError(err)
+}
+
+// FindByID returns an entry by its id
+func (r *gormAuditRepository) FindByID(id uint) (*model.AuditEntry, error) {
+	var entry model.AuditEntry
+	err := r.DB.First(&entry, id).Error
+	return &entry, wrapError(err)
+}
+
+// DeleteBefore deletes the entries and checkpoints that were created before t (retention)
+// The oldest retained entry becomes the start of the chain. The latest entry is kept, so the head always points to an entry.
+func (r *gormAuditRepository) DeleteBefore(t time.Time) (int64, error) {
+	var rowsAffected int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		headEntryID := tx.Model(&model.AuditChainHead{}).Select("entry_id").Where("id = ?", auditChainHeadID)
+		result := tx.Where("created_at < ? AND id < (?)", t, headEntryID).Delete(&model.AuditEntry{})
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		return tx.Where("created_at < ?", t).Delete(&model.AuditCheckpoint{}).Error
+	})
+	return rowsAffected, wrapError(err)
+}
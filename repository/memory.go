@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+)
+
+// MemoryStore holds the tables of the in-memory repositories.
+// It behaves like the database for the services (ids, unique keys, cascading deletes and transactions),
+// so the whole service can be run and tested in-process. Nothing is persisted.
+// Transactions write to the tables directly and undo their changes on rollback. They are isolated by running
+// one at a time and blocking all other operations until they end (see memoryRepository.lock).
+type MemoryStore struct {
+	mu   sync.Mutex // guards the tables, held during every single operation
+	txMu sync.Mutex // held by transactions and by single operations outside of them (in place of the isolation of a database)
+
+	users            *memoryTable[uint, model.User] // without associations
+	userRoles        *memoryTable[userRole, struct{}]
+	roles            *memoryTable[uint, model.Role] // without users
+	registrationKeys *memoryTable[uint, model.RegistrationKey]
+	tokens           *memoryTable[uint, model.Token] // by user id
+	passwordHistory  *memoryTable[uint, model.PasswordHistoryEntry]
+	webhooks         *memoryTable[uint, model.Webhook]
+	deliveries       *memoryTable[uint, model.WebhookDelivery]
+	outboxEvents     *memoryTable[uint, model.OutboxEvent]
+	auditEntries     *memoryTable[uint, model.AuditEntry]
+	auditCheckpoints *memoryTable[uint, model.AuditCheckpoint]
+	auditHead        model.AuditChainHead
+}
+
+// userRole is a row of the join table of users and roles
+type userRole struct {
+	UserID uint
+	RoleID uint
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:            newMemoryTable[uint, model.User](),
+		userRoles:        newMemoryTable[userRole, struct{}](),
+		roles:            newMemoryTable[uint, model.Role](),
+		registrationKeys: newMemoryTable[uint, model.RegistrationKey](),
+		tokens:           newMemoryTable[uint, model.Token](),
+		passwordHistory:  newMemoryTable[uint, model.PasswordHistoryEntry](),
+		webhooks:         newMemoryTable[uint, model.Webhook](),
+		deliveries:       newMemoryTable[uint, model.WebhookDelivery](),
+		outboxEvents:     newMemoryTable[uint, model.OutboxEvent](),
+		auditEntries:     newMemoryTable[uint, model.AuditEntry](),
+		auditCheckpoints: newMemoryTable[uint, model.AuditCheckpoint](),
+		auditHead:        model.AuditChainHead{ID: auditChainHeadID},
+	}
+}
+
+// memoryTx records how to undo the changes of a transaction of the in-memory repositories
+type memoryTx struct {
+	undo []func()
+}
+
+// onRollback registers a function that undoes a change (no-op outside of a transaction)
+func (tx *memoryTx) onRollback(undo func()) {
+	if tx != nil {
+		tx.undo = append(tx.undo, undo)
+	}
+}
+
+// memoryTable is a table of the MemoryStore (only used while holding MemoryStore.mu)
+type memoryTable[K comparable, V any] struct {
+	rows   map[K]V
+	lastID uint // like a sequence, ids are not reused after a rollback
+}
+
+func newMemoryTable[K comparable, V any]() *memoryTable[K, V] {
+	return &memoryTable[K, V]{rows: make(map[K]V)}
+}
+
+// assignID assigns the next id to a new row (id 0) like a sequence
+func (t *memoryTable[K, V]) assignID(id *uint) {
+	if *id == 0 {
+		t.lastID++
+		*id = t.lastID
+	} else if *id > t.lastID {
+		t.lastID = *id
+	}
+}
+
+func (t *memoryTable[K, V]) get(key K) (V, bool) {
+	value, ok := t.rows[key]
+	return value, ok
+}
+
+func (t *memoryTable[K, V]) put(tx *memoryTx, key K, value V) {
+	previous, existed := t.rows[key]
+	tx.onRollback(func() {
+		if existed {
+			t.rows[key] = previous
+		} else {
+			delete(t.rows, key)
+		}
+	})
+	t.rows[key] = value
+}
+
+func (t *memoryTable[K, V]) delete(tx *memoryTx, key K) bool {
+	previous, existed := t.rows[key]
+	if !existed {
+		return false
+	}
+	tx.onRollback(func() { t.rows[key] = previous })
+	delete(t.rows, key)
+	return true
+}
+
+// find returns the rows matching the filter sorted by compare
+func (t *memoryTable[K, V]) find(match func(V) bool, compare func(a, b V) int) []V {
+	var rows []V
+	for _, row := range t.rows {
+		if match(row) {
+			rows = append(rows, row)
+		}
+	}
+	slices.SortFunc(rows, compare)
+	return rows
+}
+
+// deleteWhere deletes the rows matching the filter and returns their number
+func (t *memoryTable[K, V]) deleteWhere(tx *memoryTx, match func(K, V) bool) int64 {
+	var deleted int64
+	for key, row := range t.rows {
+		if match(key, row) {
+			t.delete(tx, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// memoryRepository is embedded by the in-memory repositories
+type memoryRepository struct {
+	store *MemoryStore
+	tx    *memoryTx // nil outside of a transaction
+}
+
+// lock locks the tables of the store, the returned function unlocks them
+// Operations outside of a transaction also wait until the running transaction ends, so they neither read its
+// uncommitted changes nor are their own changes undone by its rollback.
+func (r *memoryRepository) lock() func() {
+	if r.tx != nil {
+		r.store.mu.Lock()
+		return r.store.mu.Unlock
+	}
+	r.store.txMu.Lock()
+	r.store.mu.Lock()
+	return func() {
+		r.store.mu.Unlock()
+		r.store.txMu.Unlock()
+	}
+}
+
+// bind returns a copy of the repository that operates within the transaction
+func (r *memoryRepository) bind(tx Tx) memoryRepository {
+	return memoryRepository{store: r.store, tx: tx.memory}
+}
+
+type memoryTransactor struct {
+	store *MemoryStore
+}
+
+func NewMemoryTransactor(store *MemoryStore) Transactor {
+	return &memoryTransactor{store}
+}
+
+func (t *memoryTransactor) Transaction(fn func(tx Tx) error) error {
+	t.store.txMu.Lock()
+	defer t.store.txMu.Unlock()
+	tx := &memoryTx{}
+	if err := fn(Tx{memory: tx}); err != nil {
+		t.store.mu.Lock()
+		defer t.store.mu.Unlock()
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+// errors of the in-memory repositories (the same as of the GORM repositories)
+var (
+	errMemoryNotFound           = wrapError(gorm.ErrRecordNotFound)
+	errMemoryDuplicate          = wrapError(gorm.ErrDuplicatedKey)
+	errMemoryForeignKeyViolated = wrapError(gorm.ErrForeignKeyViolated)
+)
+
+// byID sorts rows by their ids
+func byID[V any](id func(V) uint) func(a, b V) int {
+	return func(a, b V) int { return cmp.Compare(id(a), id(b)) }
+}
+
+// touch sets the timestamps of a saved row like GORM
+func touch(createdAt, updatedAt *time.Time) {
+	now := time.Now()
+	if createdAt.IsZero() {
+		*createdAt = now
+	}
+	*updatedAt = now
+}
+
+func sortByID[V any](rows []V, id func(V) uint) []V {
+	slices.SortFunc(rows, byID(id))
+	return rows
+}
+
+func limitRows[V any](rows []V, limit int) []V {
+	if limit >= 0 && len(rows) > limit {
+		return rows[:limit]
+	}
+	return rows
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryAuditRepository implements AuditRepository in a MemoryStore
+type memoryAuditRepository struct {
+	memoryRepository
+}
+
+func NewMemoryAuditRepository(store *MemoryStore) AuditRepository {
+	return &memoryAuditRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryAuditRepository) WithTx(tx Tx) AuditRepository {
+	return &memoryAuditRepository{r.bind(tx)}
+}
+
+func (r *memoryAuditRepository) Append(head *model.AuditChainHead, entry *model.AuditEntry) error {
+	defer r.lock()()
+	entry.PrevHash = head.Hash
+	hash, err := entry.ChainHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	r.store.auditEntries.assignID(&entry.ID)
+	r.store.auditEntries.put(r.tx, entry.ID, *entry)
+	head.EntryID = entry.ID
+	head.Hash = entry.Hash
+	previousHead := r.store.auditHead
+	r.tx.onRollback(func() { r.store.auditHead = previousHead })
+	r.store.auditHead = *head
+	return nil
+}
+
+func (r *memoryAuditRepository) Find(filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, int64, error) {
+	defer r.lock()()
+	entries := r.store.auditEntries.find(func(entry model.AuditEntry) bool {
+		return (filter.ActorID == nil || entry.ActorID != nil && *entry.ActorID == *filter.ActorID) &&
+			(filter.ActorName == "" || entry.ActorName == filter.ActorName) &&
+			(filter.Action == "" || entry.Action == filter.Action) &&
+			(filter.TargetType == "" || entry.TargetType == filter.TargetType) &&
+			(filter.TargetID == nil || entry.TargetID != nil && *entry.TargetID == *filter.TargetID) &&
+			(filter.Since == nil || !entry.CreatedAt.Before(*filter.Since)) &&
+			(filter.Until == nil || entry.CreatedAt.Before(*filter.Until))
+	}, func(a, b model.AuditEntry) int { return cmp.Compare(b.ID, a.ID) })
+	total := int64(len(entries))
+	return limitRows(entries[min(offset, len(entries)):], limit), total, nil
+}
+
+func (r *memoryAuditRepository) FindChain(afterID uint, limit int) ([]model.AuditEntry, error) {
+	defer r.lock()()
+	entries := r.store.auditEntries.find(func(entry model.AuditEntry) bool { return entry.ID > afterID },
+		byID(func(entry model.AuditEntry) uint { return entry.ID }))
+	return limitRows(entries, limit), nil
+}
+
+// LockHead returns the head of the chain (the head is locked by the transaction itself, see MemoryStore.txMu)
+func (r *memoryAuditRepository) LockHead() (*model.AuditChainHead, error) {
+	return r.FindHead()
+}
+
+func (r *memoryAuditRepository) FindHead() (*model.AuditChainHead, error) {
+	defer r.lock()()
+	head := r.store.auditHead
+	return &head, nil
+}
+
+func (r *memoryAuditRepository) CreateCheckpoint(checkpoint *model.AuditCheckpoint) error {
+	defer r.lock()()
+	r.store.auditCheckpoints.assignID(&checkpoint.ID)
+	if checkpoint.CreatedAt.IsZero() {
+		checkpoint.CreatedAt = time.Now()
+	}
+	r.store.auditCheckpoints.put(r.tx, checkpoint.ID, *checkpoint)
+	return nil
+}
+
+func (r *memoryAuditRepository) FindLatestCheckpoint() (*model.AuditCheckpoint, error) {
+	defer r.lock()()
+	checkpoints := r.store.auditCheckpoints.find(func(model.AuditCheckpoint) bool { return true },
+		func(a, b model.AuditCheckpoint) int { return cmp.Compare(b.ID, a.ID) })
+	if len(checkpoints) == 0 {
+		return nil, errMemoryNotFound
+	}
+	return &checkpoints[0], nil
+}
+
+func (r *memoryAuditRepository) FindCheckpoints() ([]model.AuditCheckpoint, error) {
+	defer r.lock()()
+	return r.store.auditCheckpoints.find(func(model.AuditCheckpoint) bool { return true },
+		byID(func(checkpoint model.AuditCheckpoint) uint { return checkpoint.ID })), nil
+}
+
+func (r *memoryAuditRepository) FindByID(id uint) (*model.AuditEntry, error) {
+	defer r.lock()()
+	entry, ok := r.store.auditEntries.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	return &entry, nil
+}
+
+func (r *memoryAuditRepository) DeleteBefore(t time.Time) (int64, error) {
+	defer r.lock()()
+	r.store.auditCheckpoints.deleteWhere(r.tx, func(_ uint, checkpoint model.AuditCheckpoint) bool { return checkpoint.CreatedAt.Before(t) })
+	head := r.store.auditHead // the latest entry is kept
+	return r.store.auditEntries.deleteWhere(r.tx, func(_ uint, entry model.AuditEntry) bool {
+		return entry.CreatedAt.Before(t) && entry.ID < head.EntryID
+	}), nil
+}
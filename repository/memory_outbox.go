@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryOutboxRepository implements OutboxRepository in a MemoryStore
+type memoryOutboxRepository struct {
+	memoryRepository
+}
+
+func NewMemoryOutboxRepository(store *MemoryStore) OutboxRepository {
+	return &memoryOutboxRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryOutboxRepository) WithTx(tx Tx) OutboxRepository {
+	return &memoryOutboxRepository{r.bind(tx)}
+}
+
+func (r *memoryOutboxRepository) Save(event *model.OutboxEvent) error {
+	defer r.lock()()
+	r.store.outboxEvents.assignID(&event.ID)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	r.store.outboxEvents.put(r.tx, event.ID, *event)
+	return nil
+}
+
+func (r *memoryOutboxRepository) FindDue(now time.Time, limit int) ([]model.OutboxEvent, error) {
+	defer r.lock()()
+	pending := r.store.outboxEvents.find(func(event model.OutboxEvent) bool {
+		return event.DispatchedAt == nil
+	}, byID(func(event model.OutboxEvent) uint { return event.ID }))
+	// only the first undispatched event of every user
+	var events []model.OutboxEvent
+	blocked := make(map[uint]bool)
+	for _, event := range pending {
+		if !blocked[event.UserID] && !event.NextAttemptAt.After(now) {
+			events = append(events, event)
+		}
+		blocked[event.UserID] = true
+	}
+	return limitRows(events, limit), nil
+}
+
+func (r *memoryOutboxRepository) Claim(event *model.OutboxEvent, until time.Time) (bool, error) {
+	defer r.lock()()
+	row, ok := r.store.outboxEvents.get(event.ID)
+	if !ok || row.DispatchedAt != nil || !row.NextAttemptAt.Equal(event.NextAttemptAt) {
+		return false, nil
+	}
+	row.NextAttemptAt = until
+	r.store.outboxEvents.put(r.tx, row.ID, row)
+	event.NextAttemptAt = until
+	return true, nil
+}
+
+func (r *memoryOutboxRepository) DeleteDispatchedBefore(t time.Time) (int64, error) {
+	defer r.lock()()
+	return r.store.outboxEvents.deleteWhere(r.tx, func(_ uint, event model.OutboxEvent) bool {
+		return event.DispatchedAt != nil && event.DispatchedAt.Before(t)
+	}), nil
+}
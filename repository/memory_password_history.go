@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryPasswordHistoryRepository implements PasswordHistoryRepository in a MemoryStore
+type memoryPasswordHistoryRepository struct {
+	memoryRepository
+}
+
+func NewMemoryPasswordHistoryRepository(store *MemoryStore) PasswordHistoryRepository {
+	return &memoryPasswordHistoryRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryPasswordHistoryRepository) WithTx(tx Tx) PasswordHistoryRepository {
+	return &memoryPasswordHistoryRepository{r.bind(tx)}
+}
+
+func (r *memoryPasswordHistoryRepository) Save(entry *model.PasswordHistoryEntry) error {
+	defer r.lock()()
+	if _, ok := r.store.users.get(entry.UserID); !ok {
+		return errMemoryForeignKeyViolated
+	}
+	r.store.passwordHistory.assignID(&entry.ID)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	row := *entry
+	row.User = model.User{}
+	r.store.passwordHistory.put(r.tx, entry.ID, row)
+	return nil
+}
+
+func (r *memoryPasswordHistoryRepository) FindLatestByUserID(userID uint, limit int) ([]model.PasswordHistoryEntry, error) {
+	defer r.lock()()
+	return limitRows(r.store.passwordHistory.find(func(entry model.PasswordHistoryEntry) bool { return entry.UserID == userID }, newestPasswordFirst), limit), nil
+}
+
+func (r *memoryPasswordHistoryRepository) DeleteAllButLatestByUserID(userID uint, keep int) error {
+	defer r.lock()()
+	entries := r.store.passwordHistory.find(func(entry model.PasswordHistoryEntry) bool { return entry.UserID == userID }, newestPasswordFirst)
+	for _, entry := range entries[min(max(keep, 0), len(entries)):] {
+		r.store.passwordHistory.delete(r.tx, entry.ID)
+	}
+	return nil
+}
+
+func newestPasswordFirst(a, b model.PasswordHistoryEntry) int {
+	return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+}
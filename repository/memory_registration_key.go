@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryRegistrationKeyRepository implements RegistrationKeyRepository in a MemoryStore
+type memoryRegistrationKeyRepository struct {
+	memoryRepository
+}
+
+func NewMemoryRegistrationKeyRepository(store *MemoryStore) RegistrationKeyRepository {
+	return &memoryRegistrationKeyRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryRegistrationKeyRepository) Save(key *model.RegistrationKey) error {
+	defer r.lock()()
+	for _, other := range r.store.registrationKeys.rows {
+		if other.ID != key.ID && other.Key == key.Key {
+			return errMemoryDuplicate
+		}
+	}
+	r.store.registrationKeys.assignID(&key.ID)
+	touch(&key.CreatedAt, &key.UpdatedAt)
+	row := *key
+	row.Users = nil
+	r.store.registrationKeys.put(r.tx, key.ID, row)
+	return nil
+}
+
+func (r *memoryRegistrationKeyRepository) FindAll() ([]model.RegistrationKey, error) {
+	defer r.lock()()
+	return r.store.registrationKeys.find(func(model.RegistrationKey) bool { return true },
+		byID(func(key model.RegistrationKey) uint { return key.ID })), nil
+}
+
+func (r *memoryRegistrationKeyRepository) FindByID(id uint) (*model.RegistrationKey, error) {
+	defer r.lock()()
+	key, ok := r.store.registrationKeys.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	key.Users = r.store.usersOfRegistrationKey(key.ID)
+	return &key, nil
+}
+
+func (r *memoryRegistrationKeyRepository) FindByKey(key string) (*model.RegistrationKey, error) {
+	defer r.lock()()
+	for _, rkey := range r.store.registrationKeys.rows {
+		if rkey.Key == key {
+			rkey.Users = r.store.usersOfRegistrationKey(rkey.ID)
+			return &rkey, nil
+		}
+	}
+	return nil, errMemoryNotFound
+}
+
+func (r *memoryRegistrationKeyRepository) ExistsByID(id uint) (bool, error) {
+	defer r.lock()()
+	_, ok := r.store.registrationKeys.get(id)
+	return ok, nil
+}
+
+func (r *memoryRegistrationKeyRepository) ExistsByKey(key string) (bool, error) {
+	defer r.lock()()
+	for _, rkey := range r.store.registrationKeys.rows {
+		if rkey.Key == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRegistrationKeyRepository) Delete(key *model.RegistrationKey) error {
+	return r.DeleteByID(key.ID)
+}
+
+// DeleteByID deletes a registration key, its users keep existing without a key
+func (r *memoryRegistrationKeyRepository) DeleteByID(id uint) error {
+	defer r.lock()()
+	if !r.store.registrationKeys.delete(r.tx, id) {
+		return nil
+	}
+	for _, user := range r.store.users.rows {
+		if user.RegistrationKeyID != nil && *user.RegistrationKeyID == id {
+			user.RegistrationKeyID = nil
+			r.store.users.put(r.tx, user.ID, user)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRegistrationKeyRepository) WithTx(tx Tx) RegistrationKeyRepository {
+	return &memoryRegistrationKeyRepository{r.bind(tx)}
+}
+
+func (s *MemoryStore) usersOfRegistrationKey(keyID uint) []model.User {
+	return s.users.find(func(user model.User) bool { return user.RegistrationKeyID != nil && *user.RegistrationKeyID == keyID },
+		byID(func(user model.User) uint { return user.ID }))
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"slices"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryRoleRepository implements RoleRepository in a MemoryStore
+type memoryRoleRepository struct {
+	memoryRepository
+}
+
+func NewMemoryRoleRepository(store *MemoryStore) RoleRepository {
+	return &memoryRoleRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryRoleRepository) Save(role *model.Role) error {
+	defer r.lock()()
+	for _, other := range r.store.roles.rows {
+		if other.ID != role.ID && other.Name == role.Name {
+			return errMemoryDuplicate
+		}
+	}
+	r.store.roles.assignID(&role.ID)
+	touch(&role.CreatedAt, &role.UpdatedAt)
+	for _, user := range role.Users { // associations are added like GORM does
+		r.store.userRoles.put(r.tx, userRole{UserID: user.ID, RoleID: role.ID}, struct{}{})
+	}
+	row := *role
+	row.Users = nil
+	r.store.roles.put(r.tx, role.ID, row)
+	return nil
+}
+
+func (r *memoryRoleRepository) FindAll() ([]model.Role, error) {
+	defer r.lock()()
+	return r.store.roles.find(func(model.Role) bool { return true }, byID(func(role model.Role) uint { return role.ID })), nil
+}
+
+func (r *memoryRoleRepository) FindByID(id uint) (*model.Role, error) {
+	defer r.lock()()
+	role, ok := r.store.roles.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	role.Users = r.store.usersOfRole(role.ID)
+	return &role, nil
+}
+
+func (r *memoryRoleRepository) FindByName(name string) (*model.Role, error) {
+	defer r.lock()()
+	for _, role := range r.store.roles.rows {
+		if role.Name == name {
+			role.Users = r.store.usersOfRole(role.ID)
+			return &role, nil
+		}
+	}
+	return nil, errMemoryNotFound
+}
+
+func (r *memoryRoleRepository) FindByNames(names []string) ([]model.Role, error) {
+	defer r.lock()()
+	roles := r.store.roles.find(func(role model.Role) bool { return slices.Contains(names, role.Name) },
+		byID(func(role model.Role) uint { return role.ID }))
+	for i := range roles {
+		roles[i].Users = r.store.usersOfRole(roles[i].ID)
+	}
+	return roles, nil
+}
+
+func (r *memoryRoleRepository) ExistsByID(id uint) (bool, error) {
+	defer r.lock()()
+	_, ok := r.store.roles.get(id)
+	return ok, nil
+}
+
+func (r *memoryRoleRepository) ExistsByName(name string) (bool, error) {
+	defer r.lock()()
+	for _, role := range r.store.roles.rows {
+		if role.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRoleRepository) Delete(role *model.Role) error {
+	return r.DeleteByID(role.ID)
+}
+
+// DeleteByID deletes a role and removes it from its users
+func (r *memoryRoleRepository) DeleteByID(id uint) error {
+	defer r.lock()()
+	r.store.roles.delete(r.tx, id)
+	r.store.userRoles.deleteWhere(r.tx, func(key userRole, _ struct{}) bool { return key.RoleID == id })
+	return nil
+}
+
+func (r *memoryRoleRepository) GetUsersOfRole(role *model.Role) ([]model.User, error) {
+	defer r.lock()()
+	return r.store.usersOfRole(role.ID), nil
+}
+
+func (r *memoryRoleRepository) AddUserToRole(role *model.Role, user *model.User) error {
+	defer r.lock()()
+	if _, ok := r.store.users.get(user.ID); !ok {
+		return errMemoryForeignKeyViolated
+	}
+	r.store.userRoles.put(r.tx, userRole{UserID: user.ID, RoleID: role.ID}, struct{}{})
+	return nil
+}
+
+func (r *memoryRoleRepository) RemoveUserFromRole(role *model.Role, user *model.User) error {
+	defer r.lock()()
+	r.store.userRoles.delete(r.tx, userRole{UserID: user.ID, RoleID: role.ID})
+	return nil
+}
+
+func (r *memoryRoleRepository) WithTx(tx Tx) RoleRepository {
+	return &memoryRoleRepository{r.bind(tx)}
+}
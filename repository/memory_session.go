@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memorySessionStorage implements SessionStorage in memory (sessions are lost on restart and not shared between instances)
+type memorySessionStorage struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	done     chan struct{}
+}
+
+type memorySession struct {
+	data      []byte
+	expiresAt time.Time // zero if the session does not expire
+}
+
+func (s memorySession) expired(now time.Time) bool {
+	return !s.expiresAt.IsZero() && !s.expiresAt.After(now)
+}
+
+// NewMemorySessionStorage stores the sessions in memory and deletes the expired ones every gcInterval
+func NewMemorySessionStorage(gcInterval time.Duration) SessionStorage {
+	s := &memorySessionStorage{
+		sessions: make(map[string]memorySession),
+		done:     make(chan struct{}),
+	}
+	go s.garbageCollector(gcInterval)
+	return s
+}
+
+func (s *memorySessionStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[key]
+	if !ok || session.expired(time.Now()) {
+		return nil, nil
+	}
+	return slices.Clone(session.data), nil
+}
+
+func (s *memorySessionStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	session := memorySession{data: slices.Clone(val)}
+	if exp > 0 {
+		session.expiresAt = time.Now().Add(exp)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[key] = session
+	return nil
+}
+
+func (s *memorySessionStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+	return nil
+}
+
+func (s *memorySessionStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sessions)
+	return nil
+}
+
+func (s *memorySessionStorage) Close() error {
+	close(s.done)
+	return nil
+}
+
+// Ping never fails, the sessions are in the memory of this instance
+func (s *memorySessionStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memorySessionStorage) garbageCollector(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, session := range s.sessions {
+				if session.expired(now) {
+					delete(s.sessions, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryTokenRepository implements TokenRepository in a MemoryStore
+type memoryTokenRepository struct {
+	memoryRepository
+}
+
+func NewMemoryTokenRepository(store *MemoryStore) TokenRepository {
+	return &memoryTokenRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryTokenRepository) Save(token *model.Token) error {
+	defer r.lock()()
+	for _, other := range r.store.tokens.rows {
+		if other.UserID != token.UserID && other.Token == token.Token {
+			return errMemoryDuplicate
+		}
+	}
+	touch(&token.CreatedAt, &token.UpdatedAt)
+	r.store.tokens.put(r.tx, token.UserID, *token)
+	return nil
+}
+
+func (r *memoryTokenRepository) FindAll() ([]model.Token, error) {
+	defer r.lock()()
+	return r.store.tokens.find(func(model.Token) bool { return true }, byID(func(token model.Token) uint { return token.UserID })), nil
+}
+
+func (r *memoryTokenRepository) FindByID(id uint) (*model.Token, error) {
+	defer r.lock()()
+	token, ok := r.store.tokens.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	return &token, nil
+}
+
+func (r *memoryTokenRepository) FindByToken(token string) (*model.Token, error) {
+	defer r.lock()()
+	for _, tokenModel := range r.store.tokens.rows {
+		if tokenModel.Token == token {
+			return &tokenModel, nil
+		}
+	}
+	return nil, errMemoryNotFound
+}
+
+func (r *memoryTokenRepository) ExistsByID(id uint) (bool, error) {
+	defer r.lock()()
+	_, ok := r.store.tokens.get(id)
+	return ok, nil
+}
+
+func (r *memoryTokenRepository) ExistsByToken(token string) (bool, error) {
+	defer r.lock()()
+	for _, tokenModel := range r.store.tokens.rows {
+		if tokenModel.Token == token {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryTokenRepository) DeleteByID(id uint) error {
+	defer r.lock()()
+	r.store.tokens.delete(r.tx, id)
+	return nil
+}
+
+func (r *memoryTokenRepository) DeleteAllExpiredNonPermanent() (int, error) {
+	defer r.lock()()
+	now := time.Now()
+	deleted := r.store.tokens.deleteWhere(r.tx, func(_ uint, token model.Token) bool {
+		return !token.Permanent && token.ExpiresAt.Before(now) && token.ExpiryNotified
+	})
+	return int(deleted), nil
+}
+
+func (r *memoryTokenRepository) FindDueForExpiryWarning(before time.Time) ([]model.Token, error) {
+	defer r.lock()()
+	return r.store.tokens.find(func(token model.Token) bool {
+		return dueForExpiryWarning(token) && !token.ExpiresAt.After(before)
+	}, byExpiry), nil
+}
+
+func (r *memoryTokenRepository) FindDueForExpiry(before time.Time) ([]model.Token, error) {
+	defer r.lock()()
+	return r.store.tokens.find(func(token model.Token) bool {
+		return dueForExpiry(token) && !token.ExpiresAt.After(before)
+	}, byExpiry), nil
+}
+
+func (r *memoryTokenRepository) FindNextExpiryWarning() (*model.Token, error) {
+	defer r.lock()()
+	tokens := r.store.tokens.find(dueForExpiryWarning, byExpiry)
+	if len(tokens) == 0 {
+		return nil, errMemoryNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (r *memoryTokenRepository) FindNextExpiry() (*model.Token, error) {
+	defer r.lock()()
+	tokens := r.store.tokens.find(dueForExpiry, byExpiry)
+	if len(tokens) == 0 {
+		return nil, errMemoryNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (r *memoryTokenRepository) ClaimExpiryWarning(token *model.Token) (bool, error) {
+	defer r.lock()()
+	row, ok := r.store.tokens.get(token.UserID)
+	if !ok || row.Token != token.Token || row.ExpiryWarned {
+		return false, nil
+	}
+	row.ExpiryWarned = true
+	row.UpdatedAt = time.Now()
+	r.store.tokens.put(r.tx, row.UserID, row)
+	return true, nil
+}
+
+func (r *memoryTokenRepository) ClaimExpiry(token *model.Token) (bool, error) {
+	defer r.lock()()
+	row, ok := r.store.tokens.get(token.UserID)
+	if !ok || row.Token != token.Token || row.ExpiryNotified {
+		return false, nil
+	}
+	row.ExpiryWarned = true
+	row.ExpiryNotified = true
+	row.UpdatedAt = time.Now()
+	r.store.tokens.put(r.tx, row.UserID, row)
+	return true, nil
+}
+
+func (r *memoryTokenRepository) WithTx(tx Tx) TokenRepository {
+	return &memoryTokenRepository{r.bind(tx)}
+}
+
+func dueForExpiryWarning(token model.Token) bool {
+	return !token.Permanent && !token.ExpiryWarned && !token.ExpiryNotified
+}
+
+func dueForExpiry(token model.Token) bool {
+	return !token.Permanent && !token.ExpiryNotified
+}
+
+func byExpiry(a, b model.Token) int {
+	return cmp.Or(a.ExpiresAt.Compare(b.ExpiresAt), cmp.Compare(a.UserID, b.UserID))
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryUserRepository implements UserRepository in a MemoryStore
+type memoryUserRepository struct {
+	memoryRepository
+}
+
+func NewMemoryUserRepository(store *MemoryStore) UserRepository {
+	return &memoryUserRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryUserRepository) Save(user *model.User) error {
+	defer r.lock()()
+	for _, other := range r.store.users.rows {
+		if other.ID != user.ID && other.Username == user.Username {
+			return errMemoryDuplicate
+		}
+	}
+	r.store.users.assignID(&user.ID)
+	touch(&user.CreatedAt, &user.UpdatedAt)
+	if user.RegistrationKey != nil {
+		user.RegistrationKeyID = &user.RegistrationKey.ID
+	}
+	for _, role := range user.Roles { // associations are added like GORM does
+		r.store.userRoles.put(r.tx, userRole{UserID: user.ID, RoleID: role.ID}, struct{}{})
+	}
+	row := *user
+	row.Roles, row.RegistrationKey, row.ApiToken = nil, nil, nil
+	r.store.users.put(r.tx, user.ID, row)
+	return nil
+}
+
+func (r *memoryUserRepository) FindAll() ([]model.User, error) {
+	defer r.lock()()
+	users := r.store.users.find(func(model.User) bool { return true }, byID(func(u model.User) uint { return u.ID }))
+	for i := range users {
+		users[i].Roles = r.store.rolesOfUser(users[i].ID)
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepository) FindByID(id uint) (*model.User, error) {
+	defer r.lock()()
+	user, ok := r.store.users.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	return r.store.withUserAssociations(user), nil
+}
+
+func (r *memoryUserRepository) FindByName(name string) (*model.User, error) {
+	defer r.lock()()
+	for _, user := range r.store.users.rows {
+		if user.Username == name {
+			return r.store.withUserAssociations(user), nil
+		}
+	}
+	return nil, errMemoryNotFound
+}
+
+func (r *memoryUserRepository) ExistsByID(id uint) (bool, error) {
+	defer r.lock()()
+	_, ok := r.store.users.get(id)
+	return ok, nil
+}
+
+func (r *memoryUserRepository) ExistsByName(name string) (bool, error) {
+	defer r.lock()()
+	for _, user := range r.store.users.rows {
+		if user.Username == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteByID deletes a user with its roles, API token and password history
+func (r *memoryUserRepository) DeleteByID(id uint) error {
+	defer r.lock()()
+	r.store.users.delete(r.tx, id)
+	r.store.userRoles.deleteWhere(r.tx, func(key userRole, _ struct{}) bool { return key.UserID == id })
+	r.store.tokens.delete(r.tx, id)
+	r.store.passwordHistory.deleteWhere(r.tx, func(_ uint, entry model.PasswordHistoryEntry) bool { return entry.UserID == id })
+	return nil
+}
+
+func (r *memoryUserRepository) GetRolesOfUser(user *model.User) ([]model.Role, error) {
+	defer r.lock()()
+	return r.store.rolesOfUser(user.ID), nil
+}
+
+func (r *memoryUserRepository) FindDueForDisableExpiry(before time.Time) ([]model.User, error) {
+	defer r.lock()()
+	return r.store.users.find(func(user model.User) bool {
+		return dueForDisableExpiry(user) && !user.DisabledUntil.After(before)
+	}, byDisabledUntil), nil
+}
+
+func (r *memoryUserRepository) FindNextDisableExpiry() (*model.User, error) {
+	defer r.lock()()
+	users := r.store.users.find(dueForDisableExpiry, byDisabledUntil)
+	if len(users) == 0 {
+		return nil, errMemoryNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *memoryUserRepository) ClaimDisableExpiry(user *model.User) (bool, error) {
+	defer r.lock()()
+	row, ok := r.store.users.get(user.ID)
+	if !ok || !dueForDisableExpiry(row) || row.DisabledUntil.After(time.Now()) {
+		return false, nil
+	}
+	row.Disabled = false
+	row.DisabledReason = ""
+	row.DisabledByID = nil
+	row.DisabledUntil = nil
+	row.UpdatedAt = time.Now()
+	r.store.users.put(r.tx, row.ID, row)
+	return true, nil
+}
+
+func dueForDisableExpiry(user model.User) bool {
+	return user.Disabled && user.DisabledUntil != nil
+}
+
+func byDisabledUntil(a, b model.User) int {
+	return cmp.Or(a.DisabledUntil.Compare(*b.DisabledUntil), cmp.Compare(a.ID, b.ID))
+}
+
+func (r *memoryUserRepository) WithTx(tx Tx) UserRepository {
+	return &memoryUserRepository{r.bind(tx)}
+}
+
+// withUserAssociations returns a copy of a user with its roles, registration key and API token
+func (s *MemoryStore) withUserAssociations(user model.User) *model.User {
+	user.Roles = s.rolesOfUser(user.ID)
+	if user.RegistrationKeyID != nil {
+		if key, ok := s.registrationKeys.get(*user.RegistrationKeyID); ok {
+			user.RegistrationKey = &key
+		}
+	}
+	if token, ok := s.tokens.get(user.ID); ok {
+		user.ApiToken = &token
+	}
+	return &user
+}
+
+func (s *MemoryStore) rolesOfUser(userID uint) []model.Role {
+	roles := []model.Role{}
+	for key := range s.userRoles.rows {
+		if role, ok := s.roles.get(key.RoleID); ok && key.UserID == userID {
+			roles = append(roles, role)
+		}
+	}
+	return sortByID(roles, func(role model.Role) uint { return role.ID })
+}
+
+func (s *MemoryStore) usersOfRole(roleID uint) []model.User {
+	users := []model.User{}
+	for key := range s.userRoles.rows {
+		if user, ok := s.users.get(key.UserID); ok && key.RoleID == roleID {
+			users = append(users, user)
+		}
+	}
+	return sortByID(users, func(user model.User) uint { return user.ID })
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"slices"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryWebhookRepository implements WebhookRepository in a MemoryStore
+type memoryWebhookRepository struct {
+	memoryRepository
+}
+
+func NewMemoryWebhookRepository(store *MemoryStore) WebhookRepository {
+	return &memoryWebhookRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryWebhookRepository) Save(webhook *model.Webhook) error {
+	defer r.lock()()
+	r.store.webhooks.assignID(&webhook.ID)
+	touch(&webhook.CreatedAt, &webhook.UpdatedAt)
+	row := *webhook
+	row.Events = slices.Clone(webhook.Events)
+	r.store.webhooks.put(r.tx, webhook.ID, row)
+	return nil
+}
+
+func (r *memoryWebhookRepository) FindAll() ([]model.Webhook, error) {
+	defer r.lock()()
+	return r.findWebhooks(func(model.Webhook) bool { return true }), nil
+}
+
+func (r *memoryWebhookRepository) FindAllEnabled() ([]model.Webhook, error) {
+	defer r.lock()()
+	return r.findWebhooks(func(webhook model.Webhook) bool { return webhook.Enabled }), nil
+}
+
+func (r *memoryWebhookRepository) FindByID(id uint) (*model.Webhook, error) {
+	defer r.lock()()
+	webhook, ok := r.store.webhooks.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	webhook.Events = slices.Clone(webhook.Events)
+	return &webhook, nil
+}
+
+// DeleteByID deletes a webhook with its deliveries
+func (r *memoryWebhookRepository) DeleteByID(id uint) error {
+	defer r.lock()()
+	r.store.webhooks.delete(r.tx, id)
+	r.store.deliveries.deleteWhere(r.tx, func(_ uint, delivery model.WebhookDelivery) bool { return delivery.WebhookID == id })
+	return nil
+}
+
+func (r *memoryWebhookRepository) WithTx(tx Tx) WebhookRepository {
+	return &memoryWebhookRepository{r.bind(tx)}
+}
+
+func (r *memoryWebhookRepository) findWebhooks(match func(model.Webhook) bool) []model.Webhook {
+	webhooks := r.store.webhooks.find(match, byID(func(webhook model.Webhook) uint { return webhook.ID }))
+	for i := range webhooks {
+		webhooks[i].Events = slices.Clone(webhooks[i].Events)
+	}
+	return webhooks
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// memoryWebhookDeliveryRepository implements WebhookDeliveryRepository in a MemoryStore
+type memoryWebhookDeliveryRepository struct {
+	memoryRepository
+}
+
+func NewMemoryWebhookDeliveryRepository(store *MemoryStore) WebhookDeliveryRepository {
+	return &memoryWebhookDeliveryRepository{memoryRepository{store: store}}
+}
+
+func (r *memoryWebhookDeliveryRepository) WithTx(tx Tx) WebhookDeliveryRepository {
+	return &memoryWebhookDeliveryRepository{r.bind(tx)}
+}
+
+func (r *memoryWebhookDeliveryRepository) Save(delivery *model.WebhookDelivery) error {
+	defer r.lock()()
+	if _, ok := r.store.webhooks.get(delivery.WebhookID); !ok {
+		return errMemoryForeignKeyViolated
+	}
+	r.store.deliveries.assignID(&delivery.ID)
+	touch(&delivery.CreatedAt, &delivery.UpdatedAt)
+	row := *delivery
+	row.Webhook = model.Webhook{}
+	r.store.deliveries.put(r.tx, delivery.ID, row)
+	return nil
+}
+
+func (r *memoryWebhookDeliveryRepository) FindByID(id uint) (*model.WebhookDelivery, error) {
+	defer r.lock()()
+	delivery, ok := r.store.deliveries.get(id)
+	if !ok {
+		return nil, errMemoryNotFound
+	}
+	return &delivery, nil
+}
+
+func (r *memoryWebhookDeliveryRepository) FindLatestByWebhookID(webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	defer r.lock()()
+	return limitRows(r.store.deliveries.find(func(delivery model.WebhookDelivery) bool { return delivery.WebhookID == webhookID }, newestDeliveryFirst), limit), nil
+}
+
+func (r *memoryWebhookDeliveryRepository) FindLatestByStatus(status string, limit int) ([]model.WebhookDelivery, error) {
+	defer r.lock()()
+	return limitRows(r.store.deliveries.find(func(delivery model.WebhookDelivery) bool { return delivery.Status == status }, newestDeliveryFirst), limit), nil
+}
+
+func (r *memoryWebhookDeliveryRepository) FindDue(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	defer r.lock()()
+	deliveries := r.store.deliveries.find(func(delivery model.WebhookDelivery) bool {
+		return delivery.Status == model.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now)
+	}, func(a, b model.WebhookDelivery) int {
+		return cmp.Or(a.NextAttemptAt.Compare(b.NextAttemptAt), cmp.Compare(a.ID, b.ID))
+	})
+	return limitRows(deliveries, limit), nil
+}
+
+func (r *memoryWebhookDeliveryRepository) Claim(delivery *model.WebhookDelivery, until time.Time) (bool, error) {
+	defer r.lock()()
+	row, ok := r.store.deliveries.get(delivery.ID)
+	if !ok || row.Status != model.WebhookDeliveryPending || !row.NextAttemptAt.Equal(delivery.NextAttemptAt) {
+		return false, nil
+	}
+	row.NextAttemptAt = until
+	row.UpdatedAt = time.Now()
+	r.store.deliveries.put(r.tx, row.ID, row)
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+func (r *memoryWebhookDeliveryRepository) DeleteFinishedBefore(t time.Time) (int64, error) {
+	defer r.lock()()
+	return r.store.deliveries.deleteWhere(r.tx, func(_ uint, delivery model.WebhookDelivery) bool {
+		return delivery.Status != model.WebhookDeliveryPending && delivery.UpdatedAt.Before(t)
+	}), nil
+}
+
+func newestDeliveryFirst(a, b model.WebhookDelivery) int {
+	return cmp.Compare(b.ID, a.ID)
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+)
+
+// key of the PostgreSQL advisory lock that serializes migrations of several instances
+const migrationLockKey = 0x6865696d64616c6c // "heimdall"
+
+// Migration is a versioned step of the database schema (or its data) with a step to revert it
+// Up and Down run in a transaction that also records the step in the schema_migrations table.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil if the step cannot be reverted
+}
+
+// Migrator applies and reverts the migrations of the GORM repositories in order of their versions
+type Migrator struct {
+	DB         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) Migrator {
+	return Migrator{
+		DB:         db,
+		migrations: migrations,
+	}
+}
+
+// LatestVersion returns the version of the latest migration known to this version of Heimdall
+func (m *Migrator) LatestVersion() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status returns the known migrations and the unknown applied ones ordered by version
+func (m *Migrator) Status() ([]model.MigrationStatus, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+	var status []model.MigrationStatus
+	for _, migration := range m.migrations {
+		s := model.MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = &row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		status = append(status, s)
+	}
+	for _, row := range applied {
+		status = append(status, model.MigrationStatus{Version: row.Version, Name: row.Name, Applied: true, AppliedAt: &row.AppliedAt, Unknown: true})
+	}
+	slices.SortFunc(status, func(a, b model.MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return status, nil
+}
+
+// Check returns an error if the database was migrated by a newer version of Heimdall
+// and the number of pending migrations otherwise
+func (m *Migrator) Check() (int, error) {
+	status, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, s := range status {
+		if s.Unknown {
+			return 0, model.ConflictError{Message: fmt.Sprintf("The database schema has the unknown migration %d (%s) of a newer version of Heimdall (latest known migration: %d)", s.Version, s.Name, m.LatestVersion())}
+		}
+		if !s.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations and returns them
+func (m *Migrator) Up() ([]model.MigrationStatus, error) {
+	return m.To(m.LatestVersion())
+}
+
+// Down reverts the latest applied migration and returns it (none if no migration is applied)
+func (m *Migrator) Down() ([]model.MigrationStatus, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	var target uint
+	for _, s := range slices.Backward(status) {
+		if s.Applied {
+			target = s.Version - 1
+			break
+		}
+	}
+	return m.To(target)
+}
+
+// To applies or reverts migrations until the schema has the given version and returns the migrations that were applied or reverted
+func (m *Migrator) To(version uint) ([]model.MigrationStatus, error) {
+	if version > m.LatestVersion() {
+		return nil, model.BadRequestError{Message: fmt.Sprintf("Unknown migration %d (latest known migration: %d)", version, m.LatestVersion())}
+	}
+	if _, err := m.Check(); err != nil {
+		return nil, err
+	}
+	var changed []model.MigrationStatus
+	// revert the applied migrations after the version, newest first
+	for _, migration := range slices.Backward(m.migrations) {
+		if migration.Version <= version {
+			break
+		}
+		done, err := m.run(migration, false)
+		if err != nil {
+			return changed, err
+		}
+		if done {
+			changed = append(changed, model.MigrationStatus{Version: migration.Version, Name: migration.Name})
+		}
+	}
+	// apply the pending migrations up to the version, oldest first
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		done, err := m.run(migration, true)
+		if err != nil {
+			return changed, err
+		}
+		if done {
+			now := time.Now()
+			changed = append(changed, model.MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: true, AppliedAt: &now})
+		}
+	}
+	return changed, nil
+}
+
+// run applies (up) or reverts (down) a migration in a transaction unless this was already done (e.g. by another instance)
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	done := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockMigrations(tx); err != nil {
+			return err
+		}
+		applied, err := m.applied(tx)
+		if err != nil {
+			return err
+		}
+		if _, ok := applied[migration.Version]; ok == up {
+			return nil
+		}
+		if up {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			done = true
+			return tx.Create(&model.SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		}
+		if migration.Down == nil {
+			return fmt.Errorf("migration %d cannot be reverted", migration.Version)
+		}
+		if err := migration.Down(tx); err != nil {
+			return err
+		}
+		done = true
+		return tx.Delete(&model.SchemaMigration{Version: migration.Version}).Error
+	})
+	if err != nil {
+		direction := "apply"
+		if !up {
+			direction = "revert"
+		}
+		return false, model.InternalServerError{Message: fmt.Sprintf("Could not %s migration %d (%s)", direction, migration.Version, migration.Name), Err: err}
+	}
+	return done, nil
+}
+
+// applied returns the applied migrations by their versions
+func (m *Migrator) applied(db *gorm.DB) (map[uint]model.SchemaMigration, error) {
+	// the table of the migrations is the only one that is not created by a migration
+	if err := db.AutoMigrate(&model.SchemaMigration{}); err != nil {
+		return nil, model.InternalServerError{Message: "Could not create the schema_migrations table", Err: err}
+	}
+	var rows []model.SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	applied := make(map[uint]model.SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// lockMigrations serializes the migrations of several instances until the end of the transaction
+func lockMigrations(tx *gorm.DB) error {
+	switch tx.Dialector.Name() {
+	case "postgres":
+		return tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error
+	default: // SQLite transactions lock the whole database when they begin
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"encoding/json"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrations of the database schema ordered by version
+// Append new migrations with the next version and never change applied ones. Migrations must not use the models
+// to change the schema (they change with later versions), but the frozen copies of migrations_schema.go or explicit DDL.
+// Migration 1 also adopts databases created with AutoMigrate before the migrations were versioned.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		Up:      createTables,
+		Down:    dropTables,
+	},
+	{
+		Version: 2,
+		Name:    "chain unchained audit entries",
+		Up:      chainUnchainedAuditEntries,
+		Down:    unchainAuditEntries,
+	},
+	{
+		Version: 3,
+		Name:    "create sessions table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&sessionV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&sessionV3{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "chain audit checkpoints",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&auditCheckpointV4{}, "PrevCheckpointID")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&auditCheckpointV4{}, "PrevCheckpointID")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "order and split outbox dispatches",
+		Up:      addOutboxDispatchSteps,
+		Down:    dropOutboxDispatchSteps,
+	},
+}
+
+// tables in the order of their dependencies
+var migratedTables = []any{
+	&registrationKeyV1{},
+	&roleV1{},
+	&userV1{},
+	&userRoleV1{},
+	&tokenV1{},
+	&passwordHistoryEntryV1{},
+	&webhookV1{},
+	&webhookDeliveryV1{},
+	&outboxEventV1{},
+	&auditEntryV1{},
+	&auditChainHeadV1{},
+	&auditCheckpointV1{},
+}
+
+func createTables(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(migratedTables...); err != nil {
+		return err
+	}
+	// the head row must exist before the first entry is appended
+	head := auditChainHeadV1{ID: auditChainHeadID}
+	return tx.Where(&head).FirstOrCreate(&head).Error
+}
+
+func dropTables(tx *gorm.DB) error {
+	for i := len(migratedTables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(migratedTables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chainUnchainedAuditEntries appends the entries that were written before the log was chained to the chain
+func chainUnchainedAuditEntries(tx *gorm.DB) error {
+	var head model.AuditChainHead
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, auditChainHeadID).Error; err != nil {
+		return err
+	}
+	var entries []model.AuditEntry
+	if err := tx.Where("hash = ''").Order("id ASC").Find(&entries).Error; err != nil {
+		return err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		entry.PrevHash = head.Hash
+		hash, err := entry.ChainHash()
+		if err != nil {
+			return err
+		}
+		entry.Hash = hash
+		if err := tx.Model(entry).Updates(map[string]any{"prev_hash": entry.PrevHash, "hash": entry.Hash}).Error; err != nil {
+			return err
+		}
+		head.EntryID = entry.ID
+		head.Hash = entry.Hash
+	}
+	return tx.Save(&head).Error
+}
+
+// unchainAuditEntries removes the hashes of all entries (the signed checkpoints become invalid)
+func unchainAuditEntries(tx *gorm.DB) error {
+	if err := tx.Model(&model.AuditEntry{}).Where("true").Updates(map[string]any{"prev_hash": "", "hash": ""}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("true").Delete(&model.AuditCheckpoint{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&model.AuditChainHead{}).Where("true").Updates(map[string]any{"entry_id": 0, "hash": ""}).Error
+}
+
+// addOutboxDispatchSteps adds the user of the events (dispatched in order) and the completed steps of the dispatch
+// The user of the pending events is taken from their payload, dispatched events keep user 0.
+func addOutboxDispatchSteps(tx *gorm.DB) error {
+	for _, column := range []string{"UserID", "PublishedAt", "EnqueuedAt"} {
+		if err := tx.Migrator().AddColumn(&outboxEventV5{}, column); err != nil {
+			return err
+		}
+	}
+	if err := tx.Migrator().CreateIndex(&outboxEventV5{}, "UserID"); err != nil {
+		return err
+	}
+	var events []outboxEventV5
+	if err := tx.Where("dispatched_at IS NULL").Find(&events).Error; err != nil {
+		return err
+	}
+	for _, event := range events {
+		var payload model.OutboxPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			continue // retried by the dispatcher until it fails for good
+		}
+		if err := tx.Model(&outboxEventV5{}).Where("id = ?", event.ID).Update("user_id", payload.UserID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropOutboxDispatchSteps(tx *gorm.DB) error {
+	if err := tx.Migrator().DropIndex(&outboxEventV5{}, "UserID"); err != nil {
+		return err
+	}
+	for _, column := range []string{"UserID", "PublishedAt", "EnqueuedAt"} {
+		if err := tx.Migrator().DropColumn(&outboxEventV5{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
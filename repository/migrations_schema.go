@@ -0,0 +1,214 @@
+package repository
+
+import "time"
+
+// Frozen copies of the models as they were when migration 1 (and the later migrations) was written.
+// They define the schema created by these migrations and must never be changed: changes of the models
+// require a new migration that changes the schema explicitly.
+
+type registrationKeyV1 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Key         string `gorm:"uniqueIndex;not null"`
+	Description string
+	Permanent   bool
+	ExpiresAt   time.Time
+
+	Users []userV1 `gorm:"foreignKey:RegistrationKeyID;constraint:OnDelete:SET NULL"`
+}
+
+func (registrationKeyV1) TableName() string { return "registration_keys" }
+
+type roleV1 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name string `gorm:"uniqueIndex;not null"`
+}
+
+func (roleV1) TableName() string { return "roles" }
+
+type userV1 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Username  string `gorm:"uniqueIndex;not null"`
+	Password  string `gorm:"not null"`
+	Email     string
+	LastLogin *time.Time
+
+	Disabled       bool `gorm:"not null;default:false"`
+	DisabledReason string
+	DisabledByID   *uint
+	DisabledUntil  *time.Time
+
+	RegistrationKeyID *uint              `gorm:"constraint:OnDelete:SET NULL"`
+	RegistrationKey   *registrationKeyV1 `gorm:"foreignKey:RegistrationKeyID;constraint:OnDelete:SET NULL"`
+	ApiToken          *tokenV1           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;not null"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+// userRoleV1 is the join table of the roles of the users
+type userRoleV1 struct {
+	UserID uint   `gorm:"primarykey;autoIncrement:false"`
+	RoleID uint   `gorm:"primarykey;autoIncrement:false"`
+	User   userV1 `gorm:"constraint:OnDelete:CASCADE"`
+	Role   roleV1 `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (userRoleV1) TableName() string { return "user_roles" }
+
+type tokenV1 struct {
+	UserID    uint   `gorm:"primarykey;constraint:OnDelete:SET NULL;not null"`
+	Token     string `gorm:"uniqueIndex;not null"`
+	Permanent bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null"`
+
+	ExpiryWarned   bool `gorm:"not null;default:false"`
+	ExpiryNotified bool `gorm:"not null;default:false"`
+}
+
+func (tokenV1) TableName() string { return "tokens" }
+
+type passwordHistoryEntryV1 struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index;not null"`
+	User      userV1 `gorm:"constraint:OnDelete:CASCADE"`
+	Password  string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (passwordHistoryEntryV1) TableName() string { return "password_history_entries" }
+
+type webhookV1 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	URL         string `gorm:"not null"`
+	Description string
+	Events      []string `gorm:"serializer:json;not null"`
+	Secret      string   `gorm:"not null"`
+	Enabled     bool     `gorm:"not null"`
+}
+
+func (webhookV1) TableName() string { return "webhooks" }
+
+type webhookDeliveryV1 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	WebhookID      uint      `gorm:"index;not null"`
+	Webhook        webhookV1 `gorm:"constraint:OnDelete:CASCADE"`
+	EventID        string    `gorm:"not null"`
+	EventType      string    `gorm:"not null"`
+	Payload        string    `gorm:"not null"`
+	Status         string    `gorm:"index;not null"`
+	Attempts       int       `gorm:"not null"`
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    *time.Time
+}
+
+func (webhookDeliveryV1) TableName() string { return "webhook_deliveries" }
+
+type outboxEventV1 struct {
+	ID            uint   `gorm:"primarykey"`
+	Type          string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	CreatedAt     time.Time
+	Attempts      int        `gorm:"not null"`
+	NextAttemptAt time.Time  `gorm:"index"`
+	DispatchedAt  *time.Time `gorm:"index"`
+	LastError     string
+}
+
+func (outboxEventV1) TableName() string { return "outbox_events" }
+
+type auditEntryV1 struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index;not null"`
+	ActorID    *uint     `gorm:"index"`
+	ActorName  string    `gorm:"index"`
+	Action     string    `gorm:"index;not null"`
+	TargetType string    `gorm:"index"`
+	TargetID   *uint     `gorm:"index"`
+	TargetName string
+	Changes    map[string]any `gorm:"serializer:json"`
+	Details    string
+	IP         string
+	UserAgent  string
+	PrevHash   string `gorm:"not null;default:''"`
+	Hash       string `gorm:"index;not null;default:''"`
+}
+
+func (auditEntryV1) TableName() string { return "audit_entries" }
+
+type auditChainHeadV1 struct {
+	ID      uint `gorm:"primarykey"`
+	EntryID uint
+	Hash    string
+}
+
+func (auditChainHeadV1) TableName() string { return "audit_chain_heads" }
+
+type auditCheckpointV1 struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	EntryID   uint      `gorm:"index;not null"`
+	Hash      string    `gorm:"not null"`
+	PublicKey string    `gorm:"not null"`
+	Signature string    `gorm:"not null"`
+}
+
+func (auditCheckpointV1) TableName() string { return "audit_checkpoints" }
+
+// sessionV3 is the frozen model of migration 3
+type sessionV3 struct {
+	Key       string     `gorm:"primarykey"`
+	Data      []byte     `gorm:"not null"`
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+func (sessionV3) TableName() string { return "sessions" }
+
+// auditCheckpointV4 is the frozen model of migration 4
+type auditCheckpointV4 struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	EntryID   uint      `gorm:"index;not null"`
+	Hash      string    `gorm:"not null"`
+	PublicKey string    `gorm:"not null"`
+	Signature string    `gorm:"not null"`
+
+	PrevCheckpointID uint `gorm:"not null;default:0"`
+}
+
+func (auditCheckpointV4) TableName() string { return "audit_checkpoints" }
+
+// outboxEventV5 is the frozen model of migration 5
+type outboxEventV5 struct {
+	ID            uint   `gorm:"primarykey"`
+	Type          string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	CreatedAt     time.Time
+	Attempts      int        `gorm:"not null"`
+	NextAttemptAt time.Time  `gorm:"index"`
+	DispatchedAt  *time.Time `gorm:"index"`
+	LastError     string
+
+	UserID      uint `gorm:"index;not null;default:0"`
+	PublishedAt *time.Time
+	EnqueuedAt  *time.Time
+}
+
+func (outboxEventV5) TableName() string { return "outbox_events" }
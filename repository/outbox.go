@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+)
+
+// OutboxRepository stores the change notifications of the transactional outbox
+type OutboxRepository interface {
+	WithTx(tx Tx) OutboxRepository
+	Save(event *model.OutboxEvent) error
+	FindDue(now time.Time, limit int) ([]model.OutboxEvent, error)
+	Claim(event *model.OutboxEvent, until time.Time) (bool, error)
+	DeleteDispatchedBefore(t time.Time) (int64, error)
+}
+
+// gormOutboxRepository implements OutboxRepository with GORM
+type gormOutboxRepository struct {
+	DB *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &gormOutboxRepository{
+		DB: db,
+	}
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormOutboxRepository) WithTx(tx Tx) OutboxRepository {
+	return &gormOutboxRepository{
+		DB: tx.db,
+	}
+}
+
+func (r *gormOutboxRepository) Save(event *model.OutboxEvent) error {
+	return wrapError(r.DB.Save(event).Error)
+}
+
+// FindDue returns up to limit undispatched events whose next attempt is due in the order they were recorded
+// Only the first undispatched event of every user is returned, the later ones wait until it was dispatched.
+func (r *gormOutboxRepository) FindDue(now time.Time, limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	err := r.DB.Where("dispatched_at IS NULL AND next_attempt_at <= ?", now).
+		Where("NOT EXISTS (?)", r.DB.Table("outbox_events AS earlier").Select("1").
+			Where("earlier.user_id = outbox_events.user_id AND earlier.dispatched_at IS NULL AND earlier.id < outbox_events.id")).
+		Order("id").Limit(limit).Find(&events).Error
+	return events, wrapError(err)
+}
+
+// Claim postpones the next attempt of a due event to until, so no other instance dispatches it concurrently
+// Returns false if the event was already claimed (or dispatched) by someone else
+func (r *gormOutboxRepository) Claim(event *model.OutboxEvent, until time.Time) (bool, error) {
+	result := r.DB.Model(&model.OutboxEvent{}).
+		Where("id = ? AND dispatched_at IS NULL AND next_attempt_at = ?", event.ID, event.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		return false, wrapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	event.NextAttemptAt = until
+	return true, nil
+}
+
+// DeleteDispatchedBefore deletes events that were dispatched before t
+func (r *gormOutboxRepository) DeleteDispatchedBefore(t time.Time) (int64, error) {
+	result := r.DB.Where("dispatched_at < ?", t).Delete(&model.OutboxEvent{})
+	return result.RowsAffected, wrapError(result.Error)
+}
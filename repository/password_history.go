@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+)
+
+// PasswordHistoryRepository stores the previous password hashes of the users
+type PasswordHistoryRepository interface {
+	Save(entry *model.PasswordHistoryEntry) error
+	FindLatestByUserID(userID uint, limit int) ([]model.PasswordHistoryEntry, error)
+	DeleteAllButLatestByUserID(userID uint, keep int) error
+	WithTx(tx Tx) PasswordHistoryRepository
+}
+
+// gormPasswordHistoryRepository implements PasswordHistoryRepository with GORM
+type gormPasswordHistoryRepository struct {
+	DB *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return &gormPasswordHistoryRepository{
+		DB: db,
+	}
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormPasswordHistoryRepository) WithTx(tx Tx) PasswordHistoryRepository {
+	return &gormPasswordHistoryRepository{
+		DB: tx.db,
+	}
+}
+
+func (r *gormPasswordHistoryRepository) Save(entry *model.PasswordHistoryEntry) error {
+	return wrapError(r.DB.Omit("User").Save(entry).Error)
+}
+
+// FindLatestByUserID returns up to limit previous passwords of a user, newest first
+func (r *gormPasswordHistoryRepository) FindLatestByUserID(userID uint, limit int) ([]model.PasswordHistoryEntry, error) {
+	var entries []model.PasswordHistoryEntry
+	err := r.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Limit(limit).Find(&entries).Error
+	return entries, wrapError(err)
+}
+
+// DeleteAllButLatestByUserID deletes all previous passwords of a user except the newest keep entries
+func (r *gormPasswordHistoryRepository) DeleteAllButLatestByUserID(userID uint, keep int) error {
+	latest := r.DB.Model(&model.PasswordHistoryEntry{}).Select("id").Where("user_id = ?", userID).Order("created_at DESC, id DESC").Limit(keep)
+	return wrapError(r.DB.Where("user_id = ? AND id NOT IN (?)", userID, latest).Delete(&model.PasswordHistoryEntry{}).Error)
+}
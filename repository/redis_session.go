@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/gofiber/storage/redis"
+)
+
+// redisSessionStorage implements SessionStorage with Redis
+type redisSessionStorage struct {
+	*redis.Storage
+}
+
+// NewRedisSessionStorage stores the sessions in Redis (shared by all instances)
+func NewRedisSessionStorage(storage *redis.Storage) SessionStorage {
+	return &redisSessionStorage{storage}
+}
+
+func (s *redisSessionStorage) Ping(ctx context.Context) error {
+	return s.Conn().Ping(ctx).Err()
+}
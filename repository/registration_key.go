@@ -6,58 +6,75 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-type RegistrationKeyRepository struct {
+// RegistrationKeyRepository stores registration keys and the users that registered with them
+type RegistrationKeyRepository interface {
+	Save(key *model.RegistrationKey) error
+	FindAll() ([]model.RegistrationKey, error)
+	FindByID(id uint) (*model.RegistrationKey, error)
+	FindByKey(key string) (*model.RegistrationKey, error)
+	ExistsByID(id uint) (bool, error)
+	ExistsByKey(key string) (bool, error)
+	Delete(key *model.RegistrationKey) error
+	DeleteByID(id uint) error
+	WithTx(tx Tx) RegistrationKeyRepository
+}
+
+// gormRegistrationKeyRepository implements RegistrationKeyRepository with GORM
+type gormRegistrationKeyRepository struct {
 	DB *gorm.DB
 }
 
 func NewRegistrationKeyRepository(db *gorm.DB) RegistrationKeyRepository {
-	return RegistrationKeyRepository{
+	return &gormRegistrationKeyRepository{
 		DB: db,
 	}
 }
 
-func (r *RegistrationKeyRepository) Save(key *model.RegistrationKey) error {
+func (r *gormRegistrationKeyRepository) Save(key *model.RegistrationKey) error {
 	return wrapError(r.DB.Save(key).Error)
 }
 
-func (r *RegistrationKeyRepository) FindAll() ([]model.RegistrationKey, error) {
+func (r *gormRegistrationKeyRepository) FindAll() ([]model.RegistrationKey, error) {
 	var keys []model.RegistrationKey
 	err := r.DB.Find(&keys).Error
 	return keys, wrapError(err)
 }
 
-func (r *RegistrationKeyRepository) FindByID(id uint) (*model.RegistrationKey, error) {
+func (r *gormRegistrationKeyRepository) FindByID(id uint) (*model.RegistrationKey, error) {
 	var key model.RegistrationKey
 	err := r.DB.Preload(clause.Associations).First(&key, id).Error
 	return &key, wrapError(err)
 }
 
-func (r *RegistrationKeyRepository) FindByKey(key string) (*model.RegistrationKey, error) {
+func (r *gormRegistrationKeyRepository) FindByKey(key string) (*model.RegistrationKey, error) {
 	var rkey model.RegistrationKey
 	err := r.DB.Preload(clause.Associations).First(&rkey, "key = ?", key).Error
 	return &rkey, wrapError(err)
 }
 
-func (r *RegistrationKeyRepository) ExistsByID(id uint) (bool, error) {
+func (r *gormRegistrationKeyRepository) ExistsByID(id uint) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.RegistrationKey{}).Select("count(1) > 0").Where("id = ?", id).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *RegistrationKeyRepository) ExistsByKey(key string) (bool, error) {
+func (r *gormRegistrationKeyRepository) ExistsByKey(key string) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.RegistrationKey{}).Select("count(1) > 0").Where("key = ?", key).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *RegistrationKeyRepository) Delete(key *model.RegistrationKey) error {
+func (r *gormRegistrationKeyRepository) Delete(key *model.RegistrationKey) error {
 	return wrapError(r.DB.Unscoped().Delete(key).Error)
 }
 
-func (r *RegistrationKeyRepository) DeleteByID(id uint) error {
+func (r *gormRegistrationKeyRepository) DeleteByID(id uint) error {
 	return wrapError(r.DB.Unscoped().Delete(&model.RegistrationKey{}, id).Error)
 }
 
-func (r *RegistrationKeyRepository) Migrate() error {
-	return r.DB.AutoMigrate(&model.RegistrationKey{})
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormRegistrationKeyRepository) WithTx(tx Tx) RegistrationKeyRepository {
+	return &gormRegistrationKeyRepository{
+		DB: tx.db,
+	}
 }
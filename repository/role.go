@@ -6,78 +6,99 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-type RoleRepository struct {
+// RoleRepository stores roles and their users
+type RoleRepository interface {
+	Save(role *model.Role) error
+	FindAll() ([]model.Role, error)
+	FindByID(id uint) (*model.Role, error)
+	FindByName(name string) (*model.Role, error)
+	FindByNames(names []string) ([]model.Role, error)
+	ExistsByID(id uint) (bool, error)
+	ExistsByName(name string) (bool, error)
+	Delete(role *model.Role) error
+	DeleteByID(id uint) error
+	GetUsersOfRole(role *model.Role) ([]model.User, error)
+	AddUserToRole(role *model.Role, user *model.User) error
+	RemoveUserFromRole(role *model.Role, user *model.User) error
+	WithTx(tx Tx) RoleRepository
+}
+
+// gormRoleRepository implements RoleRepository with GORM
+type gormRoleRepository struct {
 	DB *gorm.DB
 }
 
 func NewRoleRepository(db *gorm.DB) RoleRepository {
-	return RoleRepository{
+	return &gormRoleRepository{
 		DB: db,
 	}
 }
 
-func (r *RoleRepository) Save(role *model.Role) error {
+func (r *gormRoleRepository) Save(role *model.Role) error {
 	return wrapError(r.DB.Save(role).Error)
 }
 
-func (r *RoleRepository) FindAll() ([]model.Role, error) {
+func (r *gormRoleRepository) FindAll() ([]model.Role, error) {
 	var roles []model.Role
 	err := r.DB.Find(&roles).Order("id ASC").Error
 	return roles, wrapError(err)
 }
 
-func (r *RoleRepository) FindByID(id uint) (*model.Role, error) {
+func (r *gormRoleRepository) FindByID(id uint) (*model.Role, error) {
 	var role model.Role
 	err := r.DB.Preload(clause.Associations).First(&role, id).Error
 	return &role, wrapError(err)
 }
 
-func (r *RoleRepository) FindByName(name string) (*model.Role, error) {
+func (r *gormRoleRepository) FindByName(name string) (*model.Role, error) {
 	var role model.Role
 	err := r.DB.Preload(clause.Associations).First(&role, "name = ?", name).Error
 	return &role, wrapError(err)
 }
 
-func (r *RoleRepository) FindByNames(names []string) ([]model.Role, error) {
+func (r *gormRoleRepository) FindByNames(names []string) ([]model.Role, error) {
 	var roles []model.Role
 	err := r.DB.Preload(clause.Associations).Where("name IN ?", names).Find(&roles).Error
 	return roles, wrapError(err)
 }
 
-func (r *RoleRepository) ExistsByID(id uint) (bool, error) {
+func (r *gormRoleRepository) ExistsByID(id uint) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.Role{}).Select("count(1) > 0").Where("id = ?", id).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *RoleRepository) ExistsByName(name string) (bool, error) {
+func (r *gormRoleRepository) ExistsByName(name string) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.Role{}).Select("count(1) > 0").Where("name = ?", name).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *RoleRepository) Delete(role *model.Role) error {
+func (r *gormRoleRepository) Delete(role *model.Role) error {
 	return wrapError(r.DB.Unscoped().Select(clause.Associations).Delete(role).Error)
 }
 
-func (r *RoleRepository) DeleteByID(id uint) error {
+func (r *gormRoleRepository) DeleteByID(id uint) error {
 	return wrapError(r.DB.Unscoped().Select(clause.Associations).Delete(&model.Role{Model: model.Model{ID: id}}).Error)
 }
 
-func (r *RoleRepository) GetUsersOfRole(role *model.Role) ([]model.User, error) {
+func (r *gormRoleRepository) GetUsersOfRole(role *model.Role) ([]model.User, error) {
 	var users []model.User
 	err := r.DB.Model(role).Association("Users").Find(&users)
 	return users, wrapError(err)
 }
 
-func (r *RoleRepository) AddUserToRole(role *model.Role, user *model.User) error {
+func (r *gormRoleRepository) AddUserToRole(role *model.Role, user *model.User) error {
 	return wrapError(r.DB.Model(role).Association("Users").Append(user))
 }
 
-func (r *RoleRepository) RemoveUserFromRole(role *model.Role, user *model.User) error {
+func (r *gormRoleRepository) RemoveUserFromRole(role *model.Role, user *model.User) error {
 	return wrapError(r.DB.Model(role).Association("Users").Delete(user))
 }
 
-func (r *RoleRepository) Migrate() error {
-	return wrapError(r.DB.AutoMigrate(&model.Role{}))
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormRoleRepository) WithTx(tx Tx) RoleRepository {
+	return &gormRoleRepository{
+		DB: tx.db,
+	}
 }
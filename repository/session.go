@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionStorage stores the sessions of the users and checks the health of its backend
+type SessionStorage interface {
+	fiber.Storage
+	// Ping returns an error if the backend of the storage cannot be reached
+	Ping(ctx context.Context) error
+}
+
+// gormSessionStorage implements SessionStorage with GORM in the sessions table
+type gormSessionStorage struct {
+	DB   *gorm.DB
+	done chan struct{}
+}
+
+// NewSessionStorage stores the sessions in the SQL database and deletes the expired ones every gcInterval
+func NewSessionStorage(db *gorm.DB, gcInterval time.Duration) SessionStorage {
+	s := &gormSessionStorage{
+		DB:   db,
+		done: make(chan struct{}),
+	}
+	go s.garbageCollector(gcInterval)
+	return s
+}
+
+func (s *gormSessionStorage) Get(key string) ([]byte, error) {
+	var session model.Session
+	err := s.DB.Where("key = ? AND (expires_at IS NULL OR expires_at > ?)", key, time.Now()).Limit(1).Find(&session).Error
+	if err != nil || session.Key == "" { // nil if the session does not exist
+		return nil, wrapError(err)
+	}
+	return session.Data, nil
+}
+
+func (s *gormSessionStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	session := model.Session{Key: key, Data: val}
+	if exp > 0 {
+		expiresAt := time.Now().Add(exp)
+		session.ExpiresAt = &expiresAt
+	}
+	return wrapError(s.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&session).Error)
+}
+
+func (s *gormSessionStorage) Delete(key string) error {
+	return wrapError(s.DB.Where("key = ?", key).Delete(&model.Session{}).Error)
+}
+
+func (s *gormSessionStorage) Reset() error {
+	return wrapError(s.DB.Where("true").Delete(&model.Session{}).Error)
+}
+
+// Close stops the garbage collector, the database connection is closed by its owner
+func (s *gormSessionStorage) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *gormSessionStorage) Ping(ctx context.Context) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (s *gormSessionStorage) garbageCollector(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.DB.Where("expires_at <= ?", time.Now()).Delete(&model.Session{}).Error; err != nil {
+				log.Println("SessionStorage: could not delete expired sessions:", err)
+			}
+		}
+	}
+}
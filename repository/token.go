@@ -1,68 +1,138 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-type TokenRepository struct {
+// TokenRepository stores the API tokens of the users (one per user)
+type TokenRepository interface {
+	Save(token *model.Token) error
+	FindAll() ([]model.Token, error)
+	FindByID(id uint) (*model.Token, error)
+	FindByToken(token string) (*model.Token, error)
+	ExistsByID(id uint) (bool, error)
+	ExistsByToken(token string) (bool, error)
+	DeleteByID(id uint) error
+	DeleteAllExpiredNonPermanent() (int, error)
+	FindDueForExpiryWarning(before time.Time) ([]model.Token, error)
+	FindDueForExpiry(before time.Time) ([]model.Token, error)
+	FindNextExpiryWarning() (*model.Token, error)
+	FindNextExpiry() (*model.Token, error)
+	ClaimExpiryWarning(token *model.Token) (bool, error)
+	ClaimExpiry(token *model.Token) (bool, error)
+	WithTx(tx Tx) TokenRepository
+}
+
+// gormTokenRepository implements TokenRepository with GORM
+type gormTokenRepository struct {
 	DB *gorm.DB
 }
 
 func NewTokenRepository(db *gorm.DB) TokenRepository {
-	return TokenRepository{
+	return &gormTokenRepository{
 		DB: db,
 	}
 }
 
-func (r *TokenRepository) Save(token *model.Token) error {
+func (r *gormTokenRepository) Save(token *model.Token) error {
 	return wrapError(r.DB.Save(token).Error)
 }
 
-func (r *TokenRepository) FindAll() ([]model.Token, error) {
+func (r *gormTokenRepository) FindAll() ([]model.Token, error) {
 	var tokens []model.Token
-	err := r.DB.Preload("Users").Find(&tokens).Order("user_id ASC").Error
+	err := r.DB.Order("user_id ASC").Find(&tokens).Error
 	return tokens, wrapError(err)
 }
 
-func (r *TokenRepository) FindByID(id uint) (*model.Token, error) {
+func (r *gormTokenRepository) FindByID(id uint) (*model.Token, error) {
 	var token model.Token
 	err := r.DB.Preload(clause.Associations).First(&token, "user_id = ?", id).Error
 	return &token, wrapError(err)
 }
 
-func (r *TokenRepository) FindByToken(token string) (*model.Token, error) {
+func (r *gormTokenRepository) FindByToken(token string) (*model.Token, error) {
 	var tokenModel model.Token
 	err := r.DB.Preload(clause.Associations).First(&tokenModel, "token = ?", token).Error
 	return &tokenModel, wrapError(err)
 }
 
-func (r *TokenRepository) ExistsByID(id uint) (bool, error) {
+func (r *gormTokenRepository) ExistsByID(id uint) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.Token{}).Select("count(1) > 0").Where("user_id = ?", id).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *TokenRepository) ExistsByToken(token string) (bool, error) {
+func (r *gormTokenRepository) ExistsByToken(token string) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.Token{}).Select("count(1) > 0").Where("token = ?", token).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *TokenRepository) DeleteByID(id uint) error {
+func (r *gormTokenRepository) DeleteByID(id uint) error {
 	return wrapError(r.DB.Unscoped().Select(clause.Associations).Delete(&model.Token{UserID: id}).Error)
 }
 
-func (r *TokenRepository) DeleteAllExpiredNonPermanent() (int, error) {
-	res := r.DB.Unscoped().Where("not permanent AND expires_at < NOW()").Delete(model.Token{})
+// DeleteAllExpiredNonPermanent deletes the expired tokens whose subscribers were notified about the expiry
+func (r *gormTokenRepository) DeleteAllExpiredNonPermanent() (int, error) {
+	res := r.DB.Unscoped().Where("not permanent AND expires_at < ? AND expiry_notified", time.Now()).Delete(model.Token{})
 	return (int)(res.RowsAffected), res.Error
 }
 
-func (r *TokenRepository) Migrate() error {
-	err := r.DB.AutoMigrate(&model.Token{})
-	if err != nil {
-		return model.InternalServerError{Err: err}
+// FindDueForExpiryWarning returns the non-permanent tokens that expire before the given time and were not warned about yet
+func (r *gormTokenRepository) FindDueForExpiryWarning(before time.Time) ([]model.Token, error) {
+	var tokens []model.Token
+	err := r.DB.Where("not permanent AND NOT expiry_warned AND NOT expiry_notified AND expires_at <= ?", before).
+		Order("expires_at ASC").Find(&tokens).Error
+	return tokens, wrapError(err)
+}
+
+// FindDueForExpiry returns the non-permanent tokens that expired before the given time and were not notified about yet
+func (r *gormTokenRepository) FindDueForExpiry(before time.Time) ([]model.Token, error) {
+	var tokens []model.Token
+	err := r.DB.Where("not permanent AND NOT expiry_notified AND expires_at <= ?", before).
+		Order("expires_at ASC").Find(&tokens).Error
+	return tokens, wrapError(err)
+}
+
+// FindNextExpiryWarning returns the non-permanent token that expires next and was not warned about yet
+func (r *gormTokenRepository) FindNextExpiryWarning() (*model.Token, error) {
+	var token model.Token
+	err := r.DB.Where("not permanent AND NOT expiry_warned AND NOT expiry_notified").Order("expires_at ASC").First(&token).Error
+	return &token, wrapError(err)
+}
+
+// FindNextExpiry returns the non-permanent token that expires next and was not notified about yet
+func (r *gormTokenRepository) FindNextExpiry() (*model.Token, error) {
+	var token model.Token
+	err := r.DB.Where("not permanent AND NOT expiry_notified").Order("expires_at ASC").First(&token).Error
+	return &token, wrapError(err)
+}
+
+// ClaimExpiryWarning marks the token as warned and returns false if another instance already did
+// (or the token was regenerated in the meantime)
+func (r *gormTokenRepository) ClaimExpiryWarning(token *model.Token) (bool, error) {
+	res := r.DB.Model(&model.Token{}).
+		Where("user_id = ? AND token = ? AND NOT expiry_warned", token.UserID, token.Token).
+		Update("expiry_warned", true)
+	return res.RowsAffected == 1, wrapError(res.Error)
+}
+
+// ClaimExpiry marks the token as notified about its expiry and returns false if another instance already did
+// (or the token was regenerated in the meantime)
+func (r *gormTokenRepository) ClaimExpiry(token *model.Token) (bool, error) {
+	res := r.DB.Model(&model.Token{}).
+		Where("user_id = ? AND token = ? AND NOT expiry_notified", token.UserID, token.Token).
+		Updates(map[string]any{"expiry_warned": true, "expiry_notified": true})
+	return res.RowsAffected == 1, wrapError(res.Error)
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormTokenRepository) WithTx(tx Tx) TokenRepository {
+	return &gormTokenRepository{
+		DB: tx.db,
 	}
-	return nil
 }
@@ -0,0 +1,38 @@
+package repository
+
+import "gorm.io/gorm"
+
+// Tx is a running database transaction, repositories are bound to it with WithTx
+type Tx struct {
+	db     *gorm.DB  // transaction of the GORM repositories
+	memory *memoryTx // transaction of the in-memory repositories
+}
+
+// Transactor runs functions in transactions of the backend of the repositories
+type Transactor interface {
+	// Transaction runs fn in a database transaction that is committed if fn returns nil and rolled back otherwise
+	// Errors returned by fn are passed through unchanged.
+	Transaction(fn func(tx Tx) error) error
+}
+
+type gormTransactor struct {
+	DB *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) Transactor {
+	return &gormTransactor{
+		DB: db,
+	}
+}
+
+func (t *gormTransactor) Transaction(fn func(tx Tx) error) error {
+	var fnErr error
+	err := t.DB.Transaction(func(db *gorm.DB) error {
+		fnErr = fn(Tx{db: db})
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return wrapError(err)
+}
@@ -1,69 +1,110 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-type UserRepository struct {
+// UserRepository stores users including their roles, registration key and API token
+type UserRepository interface {
+	Save(user *model.User) error
+	FindAll() ([]model.User, error)
+	FindByID(id uint) (*model.User, error)
+	FindByName(name string) (*model.User, error)
+	ExistsByID(id uint) (bool, error)
+	ExistsByName(name string) (bool, error)
+	DeleteByID(id uint) error
+	GetRolesOfUser(user *model.User) ([]model.Role, error)
+	FindDueForDisableExpiry(before time.Time) ([]model.User, error)
+	FindNextDisableExpiry() (*model.User, error)
+	ClaimDisableExpiry(user *model.User) (bool, error)
+	WithTx(tx Tx) UserRepository
+}
+
+// gormUserRepository implements UserRepository with GORM
+type gormUserRepository struct {
 	DB *gorm.DB
 }
 
 func NewUserRepository(db *gorm.DB) UserRepository {
-	return UserRepository{
+	return &gormUserRepository{
 		DB: db,
 	}
 }
 
-func (r *UserRepository) Save(user *model.User) error {
+func (r *gormUserRepository) Save(user *model.User) error {
 	return wrapError(r.DB.Save(user).Error)
 }
 
-func (r *UserRepository) FindAll() ([]model.User, error) {
+func (r *gormUserRepository) FindAll() ([]model.User, error) {
 	var users []model.User
 	err := r.DB.Preload("Roles").Find(&users).Order("id ASC").Error
 	return users, wrapError(err)
 }
 
-func (r *UserRepository) FindByID(id uint) (*model.User, error) {
+func (r *gormUserRepository) FindByID(id uint) (*model.User, error) {
 	var user model.User
 	err := r.DB.Preload(clause.Associations).First(&user, id).Error
 	return &user, wrapError(err)
 }
 
-func (r *UserRepository) FindByName(name string) (*model.User, error) {
+func (r *gormUserRepository) FindByName(name string) (*model.User, error) {
 	var user model.User
 	err := r.DB.Preload(clause.Associations).First(&user, "username = ?", name).Error
 	return &user, wrapError(err)
 }
 
-func (r *UserRepository) ExistsByID(id uint) (bool, error) {
+func (r *gormUserRepository) ExistsByID(id uint) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.User{}).Select("count(1) > 0").Where("id = ?", id).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *UserRepository) ExistsByName(name string) (bool, error) {
+func (r *gormUserRepository) ExistsByName(name string) (bool, error) {
 	var exists bool
 	err := r.DB.Model(model.User{}).Select("count(1) > 0").Where("username = ?", name).Find(&exists).Error
 	return exists, wrapError(err)
 }
 
-func (r *UserRepository) DeleteByID(id uint) error {
+func (r *gormUserRepository) DeleteByID(id uint) error {
 	return wrapError(r.DB.Unscoped().Select(clause.Associations).Delete(&model.User{Model: model.Model{ID: id}}).Error)
 }
 
-func (r *UserRepository) GetRolesOfUser(user *model.User) ([]model.Role, error) {
+func (r *gormUserRepository) GetRolesOfUser(user *model.User) ([]model.Role, error) {
 	var roles []model.Role
 	err := r.DB.Model(user).Association("Roles").Find(&roles)
 	return roles, wrapError(err)
 }
 
-func (r *UserRepository) Migrate() error {
-	err := r.DB.AutoMigrate(&model.User{})
-	if err != nil {
-		return model.InternalServerError{Err: err}
+// FindDueForDisableExpiry returns the disabled users whose until-date passed before the given time
+func (r *gormUserRepository) FindDueForDisableExpiry(before time.Time) ([]model.User, error) {
+	var users []model.User
+	err := r.DB.Where("disabled AND disabled_until <= ?", before).Order("disabled_until ASC").Find(&users).Error
+	return users, wrapError(err)
+}
+
+// FindNextDisableExpiry returns the disabled user whose until-date passes next
+func (r *gormUserRepository) FindNextDisableExpiry() (*model.User, error) {
+	var user model.User
+	err := r.DB.Where("disabled AND disabled_until IS NOT NULL").Order("disabled_until ASC").First(&user).Error
+	return &user, wrapError(err)
+}
+
+// ClaimDisableExpiry enables the user if its until-date has passed and returns false if another instance already did
+// (or the user was enabled or disabled again in the meantime)
+func (r *gormUserRepository) ClaimDisableExpiry(user *model.User) (bool, error) {
+	res := r.DB.Model(&model.User{}).
+		Where("id = ? AND disabled AND disabled_until <= ?", user.ID, time.Now()).
+		Updates(map[string]any{"disabled": false, "disabled_reason": "", "disabled_by_id": nil, "disabled_until": nil})
+	return res.RowsAffected == 1, wrapError(res.Error)
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormUserRepository) WithTx(tx Tx) UserRepository {
+	return &gormUserRepository{
+		DB: tx.db,
 	}
-	return nil
 }
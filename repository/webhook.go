@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+)
+
+// WebhookRepository stores the webhooks
+type WebhookRepository interface {
+	Save(webhook *model.Webhook) error
+	FindAll() ([]model.Webhook, error)
+	FindAllEnabled() ([]model.Webhook, error)
+	FindByID(id uint) (*model.Webhook, error)
+	DeleteByID(id uint) error
+	WithTx(tx Tx) WebhookRepository
+}
+
+// gormWebhookRepository implements WebhookRepository with GORM
+type gormWebhookRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &gormWebhookRepository{
+		DB: db,
+	}
+}
+
+func (r *gormWebhookRepository) Save(webhook *model.Webhook) error {
+	return wrapError(r.DB.Save(webhook).Error)
+}
+
+func (r *gormWebhookRepository) FindAll() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	err := r.DB.Order("id").Find(&webhooks).Error
+	return webhooks, wrapError(err)
+}
+
+func (r *gormWebhookRepository) FindAllEnabled() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	err := r.DB.Where("enabled = ?", true).Find(&webhooks).Error
+	return webhooks, wrapError(err)
+}
+
+func (r *gormWebhookRepository) FindByID(id uint) (*model.Webhook, error) {
+	var webhook model.Webhook
+	err := r.DB.First(&webhook, id).Error
+	return &webhook, wrapError(err)
+}
+
+func (r *gormWebhookRepository) DeleteByID(id uint) error {
+	return wrapError(r.DB.Unscoped().Delete(&model.Webhook{}, id).Error)
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormWebhookRepository) WithTx(tx Tx) WebhookRepository {
+	return &gormWebhookRepository{
+		DB: tx.db,
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gorm.io/gorm"
+)
+
+// WebhookDeliveryRepository stores the deliveries of webhook events
+type WebhookDeliveryRepository interface {
+	WithTx(tx Tx) WebhookDeliveryRepository
+	Save(delivery *model.WebhookDelivery) error
+	FindByID(id uint) (*model.WebhookDelivery, error)
+	FindLatestByWebhookID(webhookID uint, limit int) ([]model.WebhookDelivery, error)
+	FindLatestByStatus(status string, limit int) ([]model.WebhookDelivery, error)
+	FindDue(now time.Time, limit int) ([]model.WebhookDelivery, error)
+	Claim(delivery *model.WebhookDelivery, until time.Time) (bool, error)
+	DeleteFinishedBefore(t time.Time) (int64, error)
+}
+
+// gormWebhookDeliveryRepository implements WebhookDeliveryRepository with GORM
+type gormWebhookDeliveryRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebhookDeliveryRepository(db *gorm.DB) WebhookDeliveryRepository {
+	return &gormWebhookDeliveryRepository{
+		DB: db,
+	}
+}
+
+// WithTx returns a copy of the repository that operates within the transaction
+func (r *gormWebhookDeliveryRepository) WithTx(tx Tx) WebhookDeliveryRepository {
+	return &gormWebhookDeliveryRepository{
+		DB: tx.db,
+	}
+}
+
+func (r *gormWebhookDeliveryRepository) Save(delivery *model.WebhookDelivery) error {
+	return wrapError(r.DB.Omit("Webhook").Save(delivery).Error)
+}
+
+func (r *gormWebhookDeliveryRepository) FindByID(id uint) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := r.DB.First(&delivery, id).Error
+	return &delivery, wrapError(err)
+}
+
+// FindLatestByWebhookID returns up to limit deliveries of a webhook, newest first
+func (r *gormWebhookDeliveryRepository) FindLatestByWebhookID(webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.DB.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, wrapError(err)
+}
+
+// FindLatestByStatus returns up to limit deliveries with the given status, newest first
+func (r *gormWebhookDeliveryRepository) FindLatestByStatus(status string, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.DB.Where("status = ?", status).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, wrapError(err)
+}
+
+// FindDue returns up to limit pending deliveries whose next attempt is due, oldest first
+func (r *gormWebhookDeliveryRepository) FindDue(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.DB.Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, now).
+		Order("next_attempt_at, id").Limit(limit).Find(&deliveries).Error
+	return deliveries, wrapError(err)
+}
+
+// Claim postpones the next attempt of a due delivery to until, so no other instance attempts it concurrently
+// Returns false if the delivery was already claimed (or changed) by someone else
+func (r *gormWebhookDeliveryRepository) Claim(delivery *model.WebhookDelivery, until time.Time) (bool, error) {
+	result := r.DB.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, model.WebhookDeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		return false, wrapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+// DeleteFinishedBefore deletes delivered and dead deliveries that were last updated before t
+func (r *gormWebhookDeliveryRepository) DeleteFinishedBefore(t time.Time) (int64, error) {
+	result := r.DB.Where("status <> ? AND updated_at < ?", model.WebhookDeliveryPending, t).Delete(&model.WebhookDelivery{})
+	return result.RowsAffected, wrapError(result.Error)
+}
@@ -2,6 +2,7 @@ package router
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"slices"
@@ -34,6 +35,10 @@ type Router struct {
 	registrationKeyHandler handler.RegistrationKeyHandler
 	roleHandler            handler.RoleHandler
 	tokenHandler           handler.TokenHandler
+	webhookHandler         handler.WebhookHandler
+	auditHandler           handler.AuditHandler
+	bootstrapHandler       handler.BootstrapHandler
+	archiveHandler         handler.ArchiveHandler
 	sessionMiddleware      middleware.SessionMiddleware
 	tokenMiddleware        middleware.TokenMiddleware
 }
@@ -43,9 +48,13 @@ func NewRouter(app *fiber.App,
 	regKeyHandler handler.RegistrationKeyHandler,
 	roleHandler handler.RoleHandler,
 	tokenHandler handler.TokenHandler,
+	webhookHandler handler.WebhookHandler,
+	auditHandler handler.AuditHandler,
+	bootstrapHandler handler.BootstrapHandler,
+	archiveHandler handler.ArchiveHandler,
 	sessionMiddleware middleware.SessionMiddleware,
 	tokenMiddleware middleware.TokenMiddleware) Router {
-	return Router{app, userHandler, regKeyHandler, roleHandler, tokenHandler, sessionMiddleware, tokenMiddleware}
+	return Router{app, userHandler, regKeyHandler, roleHandler, tokenHandler, webhookHandler, auditHandler, bootstrapHandler, archiveHandler, sessionMiddleware, tokenMiddleware}
 }
 
 /*
@@ -53,9 +62,12 @@ Permissions:
 unauthorized:
 	/register
 	/login
+	/password-check
+	/bootstrap (with the one-time setup token)
 admin: /**
 user:
 	/logout
+	/reauthenticate
 	GET /users
 	GET /users/<own-id>
 	PUT /users/<own-id>
@@ -94,10 +106,12 @@ func (r *Router) Init(sessionStore *session.Store, readynessProbe func(*fiber.Ct
 	// 	HandlerContextKey: "fiber.csrf.handler",
 	// }))
 
-	// setup CORS middleware
-	r.app.Use(cors.New(cors.Config{
-		AllowOrigins:     config.CorsAllowOrigins,
-		AllowCredentials: config.CorsAllowCredentials,
+	// setup CORS middleware (rebuilt when CORS_ALLOW_ORIGINS is reloaded)
+	r.app.Use(reloadingHandler(config.CorsAllowOrigins, func(origins string) fiber.Handler {
+		return cors.New(cors.Config{
+			AllowOrigins:     origins,
+			AllowCredentials: config.CorsAllowCredentials,
+		})
 	}))
 
 	r.app.Use(healthcheck.New(healthcheck.Config{
@@ -107,27 +121,16 @@ func (r *Router) Init(sessionStore *session.Store, readynessProbe func(*fiber.Ct
 		ReadinessEndpoint: "/ready",
 	}))
 
-	// allow login and register once every 10 seconds per client
-	unauthorizedLimiter := limiter.New(limiter.Config{
-		Max:        6,
-		Expiration: 1 * time.Minute,
-		Next: func(c *fiber.Ctx) bool {
-			return config.DisableRateLimiter
-		},
-	})
+	// allow login, register, reauthenticate and bootstrap RATE_LIMIT_UNAUTHORIZED times per minute per client (by default once every 10 seconds)
+	unauthorizedLimiter := reloadingHandler(config.UnauthorizedRateLimit, newLimiter)
 	r.app.Post("/register", unauthorizedLimiter, r.userHandler.Register)
 	r.app.Post("/login", unauthorizedLimiter, r.userHandler.Login)
+	r.app.Post("/bootstrap", unauthorizedLimiter, r.bootstrapHandler.CompleteSetup)
 
 	r.initInternalRoutes(r.app.Group("/internal")) // not rate limited and without session middleware
 
-	// allow 5 requests per second per client
-	r.app.Use(limiter.New(limiter.Config{
-		Max:        300,
-		Expiration: 1 * time.Minute,
-		Next: func(c *fiber.Ctx) bool {
-			return config.DisableRateLimiter
-		},
-	}))
+	// allow RATE_LIMIT requests per minute per client (by default 5 requests per second)
+	r.app.Use(reloadingHandler(config.RateLimit, newLimiter))
 
 	// setup and serve swagger API documentation
 	swag := swagger.New(swagger.Config{
@@ -149,19 +152,29 @@ func (r *Router) Init(sessionStore *session.Store, readynessProbe func(*fiber.Ct
 	r.app.Get("/swagger", swag)
 	r.app.Get("/swagger/*", swag)
 
+	// estimating the password strength is expensive, so it is limited separately from the other routes
+	// (RATE_LIMIT_PASSWORD_CHECK times per minute per client, without using up the login attempts)
+	r.app.Post("/password-check", reloadingHandler(config.PasswordCheckRateLimit, newLimiter), r.userHandler.CheckPassword)
+
 	// all requests to routes after this point have to be authenticated
 	r.app.Use((fiber.Handler)(r.sessionMiddleware))
 
 	// serve fiber monitor
 	r.app.Get("/metrics", r.sessionMiddleware.AllowRole(admin), monitor.New())
+	r.app.Get("/metrics/events", r.sessionMiddleware.AllowRole(admin), r.tokenHandler.GetEventStats)
 
 	// setup pprof monitoring middleware
 	r.app.Use("/debug/pprof", r.sessionMiddleware.AllowRole(admin), pprof.New())
 
 	r.app.Post("/logout", r.userHandler.Logout)
+	r.app.Post("/reauthenticate", unauthorizedLimiter, r.userHandler.Reauthenticate)
 	r.initUserRoutes(r.app.Group("/users"))
 	r.initRegistrationKeyRoutes(r.app.Group("/registration-keys", r.sessionMiddleware.AllowRole(admin)))
 	r.initRoleRoutes(r.app.Group("/roles", r.sessionMiddleware.AllowRole(admin)))
+	r.initWebhookRoutes(r.app.Group("/webhooks", r.sessionMiddleware.AllowRole(admin)))
+	r.initAuditRoutes(r.app.Group("/audit", r.sessionMiddleware.AllowRole(admin)))
+	r.app.Get("/archive", r.sessionMiddleware.AllowRole(admin), r.archiveHandler.Export)
+	r.app.Post("/archive", r.sessionMiddleware.AllowRole(admin), r.archiveHandler.Import)
 
 	// catch all requests that could not be handled and send JSON response (instead of fibers plain text)
 	r.app.All("*", func(c *fiber.Ctx) error {
@@ -170,10 +183,14 @@ func (r *Router) Init(sessionStore *session.Store, readynessProbe func(*fiber.Ct
 }
 
 func (r *Router) initInternalRoutes(internal fiber.Router) {
-	internal.Use(middleware.AllowLoopbackAndPrivateIPsAnd(config.InternalIPs))
+	internal.Use(middleware.AllowLoopbackAndPrivateIPsAnd(config.InternalIPs.Get))
 	internal.Use((fiber.Handler)(r.tokenMiddleware))
 	internal.Get("/users", r.tokenMiddleware.AllowRole(deploy), r.tokenHandler.GetUsernames)
 	internal.Get("/authenticate/:username<string>", r.tokenHandler.WatchAuthChanges)
+	internal.Get("/watch", r.tokenMiddleware.AllowRole(deploy), r.tokenHandler.WatchAllAuthChanges)
+	internal.Get("/ws/users", r.tokenMiddleware.AllowRole(deploy), r.tokenHandler.GetUsernamesWebSocket)
+	internal.Get("/ws/authenticate", r.tokenHandler.WatchAuthChangesWebSocket)
+	internal.Get("/ws/watch", r.tokenMiddleware.AllowRole(deploy), r.tokenHandler.WatchAllAuthChangesWebSocket)
 }
 
 func (r *Router) initUserRoutes(users fiber.Router) {
@@ -183,6 +200,8 @@ func (r *Router) initUserRoutes(users fiber.Router) {
 	users.Put("/:id<int>", r.sessionMiddleware.AllowRoleOrOwnUserId(admin, "id"), r.userHandler.Update)
 	users.Delete("/:id<int>", r.sessionMiddleware.AllowRoleOrOwnUserId(admin, "id"), r.userHandler.Delete)
 	users.Get("/:id<int>/roles", r.sessionMiddleware.AllowRoleOrOwnUserId(admin, "id"), r.userHandler.GetRolesOfUser)
+	users.Put("/:id<int>/disable", r.sessionMiddleware.AllowRole(admin), r.userHandler.Disable)
+	users.Delete("/:id<int>/disable", r.sessionMiddleware.AllowRole(admin), r.userHandler.Enable)
 	users.Get("/:id/api-token", r.sessionMiddleware.AllowRoleOrOwnUserId(admin, "id"), r.tokenHandler.Get)
 	users.Put("/:id/api-token", r.sessionMiddleware.AllowRole(admin), r.tokenHandler.Update)                     // set permanent
 	users.Delete("/:id/api-token", r.sessionMiddleware.AllowRoleOrOwnUserId(admin, "id"), r.tokenHandler.Delete) // invalidate and renew token
@@ -208,6 +227,56 @@ func (r *Router) initRoleRoutes(roles fiber.Router) {
 	roles.Delete("/:roleid<int>/users/:userid<int>", r.roleHandler.RemoveUserFromRole)
 }
 
+func (r *Router) initWebhookRoutes(webhooks fiber.Router) {
+	webhooks.Get("", r.webhookHandler.GetAll)
+	webhooks.Get("/dead-letters", r.webhookHandler.GetDeadLetters)
+	webhooks.Post("/deliveries/:id<int>/redeliver", r.webhookHandler.Redeliver)
+	webhooks.Get("/:id<int>", r.webhookHandler.GetByID)
+	webhooks.Post("", r.webhookHandler.Create)
+	webhooks.Put("/:id<int>", r.webhookHandler.Update)
+	webhooks.Delete("/:id<int>", r.webhookHandler.Delete)
+	webhooks.Get("/:id<int>/deliveries", r.webhookHandler.GetDeliveries)
+}
+
+func (r *Router) initAuditRoutes(audit fiber.Router) {
+	audit.Get("", r.auditHandler.Get)
+	audit.Get("/verify", r.auditHandler.Verify)
+	audit.Get("/checkpoints", r.auditHandler.GetCheckpoints)
+}
+
+// newLimiter returns a rate limiter that allows max requests per minute and client
+func newLimiter(max int) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: 1 * time.Minute,
+		Next: func(c *fiber.Ctx) bool {
+			return config.DisableRateLimiter.Get()
+		},
+	})
+}
+
+// reloadingHandler returns a middleware that is built again by build when the value of the setting is reloaded
+// (e.g. the rate limiters start counting again)
+func reloadingHandler[T comparable](setting *config.Reloadable[T], build func(T) fiber.Handler) fiber.Handler {
+	type built struct {
+		value   T
+		handler fiber.Handler
+	}
+	var current atomic.Pointer[built]
+	current.Store(&built{setting.Get(), build(setting.Get())})
+	return func(c *fiber.Ctx) error {
+		b := current.Load()
+		if value := setting.Get(); value != b.value {
+			if rebuilt := (&built{value, build(value)}); current.CompareAndSwap(b, rebuilt) {
+				b = rebuilt
+			} else {
+				b = current.Load() // rebuilt by a concurrent request
+			}
+		}
+		return b.handler(c)
+	}
+}
+
 func (r *Router) ListRoutes() map[string][]string {
 	endpoints := make(map[string][]string)
 	for _, group := range r.app.Stack() {
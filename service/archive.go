@@ -0,0 +1,494 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+)
+
+// ArchiveService exports and imports all users, roles, memberships, registration keys and API tokens
+// (e.g. to migrate to another server or for offline backups)
+type ArchiveService struct {
+	userRepository            repository.UserRepository
+	roleRepository            repository.RoleRepository
+	registrationKeyRepository repository.RegistrationKeyRepository
+	tokenRepository           repository.TokenRepository
+	outboxService             OutboxService
+	auditService              AuditService
+	tokenService              TokenService
+}
+
+func NewArchiveService(userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository,
+	regKeyRepo repository.RegistrationKeyRepository,
+	tokenRepo repository.TokenRepository,
+	outboxService OutboxService,
+	auditService AuditService,
+	tokenService TokenService) ArchiveService {
+	return ArchiveService{userRepo, roleRepo, regKeyRepo, tokenRepo, outboxService, auditService, tokenService}
+}
+
+// Export returns an archive of all data (read in a single transaction)
+func (s *ArchiveService) Export(actor model.AuditActor) (*model.Archive, error) {
+	archive := &model.Archive{
+		Version:          model.ArchiveVersion,
+		ExportedAt:       time.Now(),
+		Roles:            []model.ArchiveRole{},
+		RegistrationKeys: []model.ArchiveRegistrationKey{},
+		Users:            []model.ArchiveUser{},
+		Tokens:           []model.ArchiveToken{},
+	}
+	err := s.auditService.Transaction(func(tx repository.Tx) error {
+		roles, err := s.roleRepository.WithTx(tx).FindAll()
+		if err != nil {
+			return err
+		}
+		keys, err := s.registrationKeyRepository.WithTx(tx).FindAll()
+		if err != nil {
+			return err
+		}
+		users, err := s.userRepository.WithTx(tx).FindAll()
+		if err != nil {
+			return err
+		}
+		tokens, err := s.tokenRepository.WithTx(tx).FindAll()
+		if err != nil {
+			return err
+		}
+
+		slices.SortFunc(roles, func(a, b model.Role) int { return cmp.Compare(a.ID, b.ID) })
+		for _, role := range roles {
+			archive.Roles = append(archive.Roles, model.ArchiveRole{Name: role.Name, CreatedAt: role.CreatedAt})
+		}
+		keysByID := make(map[uint]string, len(keys))
+		slices.SortFunc(keys, func(a, b model.RegistrationKey) int { return cmp.Compare(a.ID, b.ID) })
+		for _, key := range keys {
+			keysByID[key.ID] = key.Key
+			archive.RegistrationKeys = append(archive.RegistrationKeys, model.ArchiveRegistrationKey{
+				Key:         key.Key,
+				Description: key.Description,
+				Permanent:   key.Permanent,
+				ExpiresAt:   key.ExpiresAt,
+				CreatedAt:   key.CreatedAt,
+			})
+		}
+		usernamesByID := make(map[uint]string, len(users))
+		for _, user := range users {
+			usernamesByID[user.ID] = user.Username
+		}
+		slices.SortFunc(users, func(a, b model.User) int { return cmp.Compare(a.ID, b.ID) })
+		for _, user := range users {
+			archiveUser := model.ArchiveUser{
+				Username:       user.Username,
+				PasswordHash:   user.Password,
+				Email:          user.Email,
+				LastLogin:      user.LastLogin,
+				Disabled:       user.Disabled,
+				DisabledReason: user.DisabledReason,
+				DisabledUntil:  user.DisabledUntil,
+				Roles:          []string{},
+				CreatedAt:      user.CreatedAt,
+			}
+			if user.DisabledByID != nil {
+				archiveUser.DisabledBy = usernamesByID[*user.DisabledByID] // empty if the admin was deleted
+			}
+			if user.RegistrationKeyID != nil {
+				archiveUser.RegistrationKey = keysByID[*user.RegistrationKeyID]
+			}
+			for _, role := range user.Roles {
+				archiveUser.Roles = append(archiveUser.Roles, role.Name)
+			}
+			archive.Users = append(archive.Users, archiveUser)
+		}
+		for _, token := range tokens {
+			username, ok := usernamesByID[token.UserID]
+			if !ok {
+				continue
+			}
+			archive.Tokens = append(archive.Tokens, model.ArchiveToken{
+				Username:  username,
+				Token:     token.Token,
+				Permanent: token.Permanent,
+				ExpiresAt: token.ExpiresAt,
+				CreatedAt: token.CreatedAt,
+			})
+		}
+		return s.auditService.RecordTx(tx, actor, model.AuditEntry{
+			Action:     model.AuditArchiveExported,
+			TargetType: model.AuditTargetArchive,
+			Details:    fmt.Sprintf("%d users, %d roles, %d registration keys, %d API tokens", len(archive.Users), len(archive.Roles), len(archive.RegistrationKeys), len(archive.Tokens)),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// Import imports an archive in a single transaction (nothing is changed if it fails)
+// With ArchiveMerge the entries of the archive are created or replace the existing entries with the same name
+// (including the roles and the API token of a user), other entries are kept.
+// With ArchiveReplace all users, roles, registration keys and API tokens are deleted first.
+// The changes of the users are announced to the subscribers like changes via the API.
+func (s *ArchiveService) Import(archive *model.Archive, mode string, actor model.AuditActor) (*model.ArchiveImportResult, error) {
+	if err := validateArchive(archive, mode); err != nil {
+		return nil, err
+	}
+	result := &model.ArchiveImportResult{Mode: mode}
+	err := s.outboxService.Transaction(func(tx repository.Tx) error {
+		i := archiveImport{
+			ArchiveService: s,
+			tx:             tx,
+			users:          s.userRepository.WithTx(tx),
+			roles:          s.roleRepository.WithTx(tx),
+			keys:           s.registrationKeyRepository.WithTx(tx),
+			tokens:         s.tokenRepository.WithTx(tx),
+			actor:          actor,
+			result:         result,
+		}
+		if mode == model.ArchiveReplace {
+			if err := i.deleteAll(); err != nil {
+				return err
+			}
+		}
+		if err := i.importAll(archive); err != nil {
+			return err
+		}
+		return s.auditService.RecordTx(tx, actor, model.AuditEntry{
+			Action:     model.AuditArchiveImported,
+			TargetType: model.AuditTargetArchive,
+			TargetName: mode,
+			Details: fmt.Sprintf("%d users, %d roles, %d registration keys, %d API tokens (%d users deleted), exported at %s",
+				result.Users, result.Roles, result.RegistrationKeys, result.Tokens, result.DeletedUsers, archive.ExportedAt.Format(time.RFC3339)),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.tokenService.rescheduleExpiry()
+	return result, nil
+}
+
+// validateArchive checks the version, the uniqueness of the names and the references between the entries
+// Users are validated like created users (name and email) and their password hashes must be bcrypt hashes.
+// (an archive must be self-contained, references to entries that only exist on this server are refused)
+func validateArchive(archive *model.Archive, mode string) error {
+	if mode != model.ArchiveMerge && mode != model.ArchiveReplace {
+		return model.BadRequestError{Message: fmt.Sprintf("Unknown import mode %q (merge or replace)", mode)}
+	}
+	if archive.Version < 1 || archive.Version > model.ArchiveVersion {
+		return model.BadRequestError{Message: fmt.Sprintf("Unsupported archive version %d (supported: 1 to %d)", archive.Version, model.ArchiveVersion)}
+	}
+	roles := make(map[string]bool)
+	for _, role := range archive.Roles {
+		if !isValidName(role.Name) || roles[role.Name] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: invalid or duplicate role %q", role.Name)}
+		}
+		roles[role.Name] = true
+	}
+	keys := make(map[string]bool)
+	for _, key := range archive.RegistrationKeys {
+		if key.Key == "" || keys[key.Key] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: empty or duplicate registration key %q", key.Key)}
+		}
+		keys[key.Key] = true
+	}
+	users := make(map[string]bool)
+	hasAdmin := false
+	for _, user := range archive.Users {
+		if !isValidName(user.Username) || users[user.Username] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: invalid or duplicate user %q", user.Username)}
+		}
+		if !isValidEmail(user.Email) {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: user %s has an invalid email %q", user.Username, user.Email)}
+		}
+		if !crypto.IsPasswordHash(user.PasswordHash) {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: user %s has no valid bcrypt password hash", user.Username)}
+		}
+		if user.RegistrationKey != "" && !keys[user.RegistrationKey] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: user %s references the unknown registration key %q", user.Username, user.RegistrationKey)}
+		}
+		for i, rolename := range user.Roles {
+			if !roles[rolename] {
+				return model.BadRequestError{Message: fmt.Sprintf("Archive: user %s references the unknown role %q", user.Username, rolename)}
+			}
+			if slices.Contains(user.Roles[:i], rolename) {
+				return model.BadRequestError{Message: fmt.Sprintf("Archive: user %s has the role %q more than once", user.Username, rolename)}
+			}
+		}
+		hasAdmin = hasAdmin || slices.Contains(user.Roles, config.AdminRoleName)
+		users[user.Username] = true
+	}
+	for _, user := range archive.Users {
+		if user.DisabledBy != "" && !users[user.DisabledBy] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: user %s was disabled by the unknown user %q", user.Username, user.DisabledBy)}
+		}
+	}
+	tokenOwners := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, token := range archive.Tokens {
+		if !users[token.Username] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: API token of the unknown user %q", token.Username)}
+		}
+		if token.Token == "" || tokens[token.Token] || tokenOwners[token.Username] {
+			return model.BadRequestError{Message: fmt.Sprintf("Archive: empty or duplicate API token of user %s", token.Username)}
+		}
+		tokens[token.Token] = true
+		tokenOwners[token.Username] = true
+	}
+	if mode == model.ArchiveReplace && !hasAdmin {
+		return model.BadRequestError{Message: "Archive: no user has the " + config.AdminRoleName + " role, replacing the data would lock out all admins"}
+	}
+	return nil
+}
+
+// archiveImport holds the repositories of the transaction of an import
+type archiveImport struct {
+	*ArchiveService
+	tx     repository.Tx
+	users  repository.UserRepository
+	roles  repository.RoleRepository
+	keys   repository.RegistrationKeyRepository
+	tokens repository.TokenRepository
+	actor  model.AuditActor
+	result *model.ArchiveImportResult
+	audits []importedUserAudit // recorded after all users were imported
+}
+
+// importedUserAudit holds the changes of an imported user that are recorded in the audit log
+type importedUserAudit struct {
+	user        *model.User
+	previous    *model.User // nil if the user was created
+	roleEntries []model.AuditEntry
+}
+
+// deleteAll deletes all users (with their API tokens and memberships), roles and registration keys
+func (i *archiveImport) deleteAll() error {
+	users, err := i.users.FindAll()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := i.users.DeleteByID(user.ID); err != nil {
+			return err
+		}
+		if err := i.recordUserAudit(model.AuditUserDeleted, &user, auditChanges(&user, nil)); err != nil {
+			return err
+		}
+		if err := i.outboxService.Record(i.tx, model.OutboxUserDeleted, &user); err != nil {
+			return err
+		}
+		i.result.DeletedUsers++
+	}
+	roles, err := i.roles.FindAll()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := i.roles.DeleteByID(role.ID); err != nil {
+			return err
+		}
+	}
+	keys, err := i.keys.FindAll()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := i.keys.DeleteByID(key.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *archiveImport) importAll(archive *model.Archive) error {
+	roles := make(map[string]*model.Role, len(archive.Roles))
+	for _, archiveRole := range archive.Roles {
+		role, err := i.roles.FindByName(archiveRole.Name)
+		if _, notFound := err.(model.NotFoundError); notFound {
+			role = &model.Role{Name: archiveRole.Name}
+			role.CreatedAt = archiveRole.CreatedAt
+			err = i.roles.Save(role)
+		}
+		if err != nil {
+			return err
+		}
+		roles[role.Name] = role
+		i.result.Roles++
+	}
+
+	keys := make(map[string]*model.RegistrationKey, len(archive.RegistrationKeys))
+	for _, archiveKey := range archive.RegistrationKeys {
+		key, err := i.keys.FindByKey(archiveKey.Key)
+		if _, notFound := err.(model.NotFoundError); notFound {
+			key, err = &model.RegistrationKey{Key: archiveKey.Key}, nil
+			key.CreatedAt = archiveKey.CreatedAt
+		}
+		if err != nil {
+			return err
+		}
+		key.Description = archiveKey.Description
+		key.Permanent = archiveKey.Permanent
+		key.ExpiresAt = archiveKey.ExpiresAt
+		if err := i.keys.Save(key); err != nil {
+			return err
+		}
+		keys[key.Key] = key
+		i.result.RegistrationKeys++
+	}
+
+	users := make(map[string]*model.User, len(archive.Users))
+	for _, archiveUser := range archive.Users {
+		user, err := i.importUser(archiveUser, roles, keys)
+		if err != nil {
+			return err
+		}
+		users[user.Username] = user
+		i.result.Users++
+	}
+	// the admins that disabled users are only known after all users were imported
+	for _, archiveUser := range archive.Users {
+		if archiveUser.DisabledBy == "" {
+			continue
+		}
+		user := users[archiveUser.Username]
+		user.DisabledByID = &users[archiveUser.DisabledBy].ID
+		if err := i.users.Save(user); err != nil {
+			return err
+		}
+	}
+	if err := i.recordUserAudits(); err != nil {
+		return err
+	}
+
+	tokens := make(map[string]model.ArchiveToken, len(archive.Tokens))
+	for _, token := range archive.Tokens {
+		tokens[token.Username] = token
+	}
+	for _, archiveUser := range archive.Users {
+		user := users[archiveUser.Username]
+		archiveToken, ok := tokens[user.Username]
+		if !ok {
+			// the user gets a new API token when the change is dispatched
+			if err := i.tokens.DeleteByID(user.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		token := &model.Token{
+			UserID:    user.ID,
+			Token:     archiveToken.Token,
+			Permanent: archiveToken.Permanent,
+			ExpiresAt: archiveToken.ExpiresAt,
+			CreatedAt: archiveToken.CreatedAt,
+		}
+		if err := i.tokens.Save(token); err != nil {
+			return err
+		}
+		i.result.Tokens++
+	}
+	return nil
+}
+
+// importUser creates a user of the archive or replaces the existing user with the same name
+// Every change is recorded in the audit log like changes via the API (e.g. replaced password hashes and granted roles).
+func (i *archiveImport) importUser(archiveUser model.ArchiveUser, roles map[string]*model.Role, keys map[string]*model.RegistrationKey) (*model.User, error) {
+	user, err := i.users.FindByName(archiveUser.Username)
+	_, notFound := err.(model.NotFoundError)
+	if notFound {
+		user = &model.User{Username: archiveUser.Username}
+		user.CreatedAt = archiveUser.CreatedAt
+	} else if err != nil {
+		return nil, err
+	}
+	previousUser := *user
+	previousRoles := user.Roles
+	user.Roles, user.RegistrationKey, user.ApiToken = nil, nil, nil // associations are updated separately
+	user.Password = archiveUser.PasswordHash
+	user.Email = archiveUser.Email
+	user.LastLogin = archiveUser.LastLogin
+	user.Disabled = archiveUser.Disabled
+	user.DisabledReason = archiveUser.DisabledReason
+	user.DisabledUntil = archiveUser.DisabledUntil
+	user.DisabledByID = nil
+	user.RegistrationKeyID = nil
+	if archiveUser.RegistrationKey != "" {
+		user.RegistrationKeyID = &keys[archiveUser.RegistrationKey].ID
+	}
+	if err := i.users.Save(user); err != nil {
+		return nil, err
+	}
+	audit := importedUserAudit{user: user}
+	if !notFound {
+		audit.previous = &previousUser
+	}
+
+	// the audit entries of the memberships contain the roles before each change
+	current := &model.User{Username: user.Username, Roles: slices.Clone(previousRoles)}
+	current.ID = user.ID
+	for _, role := range previousRoles {
+		if !slices.Contains(archiveUser.Roles, role.Name) {
+			if err := i.roles.RemoveUserFromRole(&role, user); err != nil {
+				return nil, err
+			}
+			audit.roleEntries = append(audit.roleEntries, newRoleAssignmentEntry(model.AuditRoleUnassigned, current, &role))
+			current.Roles = slices.DeleteFunc(current.Roles, func(r model.Role) bool { return r.ID == role.ID })
+		}
+	}
+	for _, rolename := range archiveUser.Roles {
+		if !slices.ContainsFunc(previousRoles, func(role model.Role) bool { return role.Name == rolename }) {
+			if err := i.roles.AddUserToRole(roles[rolename], user); err != nil {
+				return nil, err
+			}
+			audit.roleEntries = append(audit.roleEntries, newRoleAssignmentEntry(model.AuditRoleAssigned, current, roles[rolename]))
+			current.Roles = append(current.Roles, *roles[rolename])
+		}
+	}
+	i.audits = append(i.audits, audit)
+
+	eventType := model.OutboxCredentialsChanged // closes the connections using the previous API token
+	if notFound {
+		eventType = model.OutboxUserCreated
+	}
+	if err := i.outboxService.Record(i.tx, eventType, user); err != nil {
+		return nil, err
+	}
+	// announces the imported API token and roles
+	return user, i.outboxService.Record(i.tx, model.OutboxUserRolesChanged, user)
+}
+
+// recordUserAudits records the creations and changes of the imported users and their memberships
+func (i *archiveImport) recordUserAudits() error {
+	for _, audit := range i.audits {
+		action, changes := model.AuditUserCreated, auditChanges(nil, audit.user)
+		if audit.previous != nil {
+			action, changes = model.AuditUserUpdated, auditChanges(audit.previous, audit.user)
+			if audit.previous.Password != audit.user.Password {
+				changes["password"] = model.AuditChange{Before: auditRedacted, After: auditRedacted}
+			}
+		}
+		if len(changes) > 0 || audit.previous == nil {
+			if err := i.recordUserAudit(action, audit.user, changes); err != nil {
+				return err
+			}
+		}
+		for _, entry := range audit.roleEntries {
+			if err := i.auditService.RecordTx(i.tx, i.actor, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i *archiveImport) recordUserAudit(action string, user *model.User, changes map[string]model.AuditChange) error {
+	entry := newAuditEntry(action, model.AuditTargetUser, user.ID, user.Username)
+	entry.Changes = changes
+	return i.auditService.RecordTx(i.tx, i.actor, entry)
+}
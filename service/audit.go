@@ -0,0 +1,332 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+)
+
+// number of entries that are loaded at once when the chain is verified or hashed
+const auditChainBatchSize = 1000
+
+// value of changed fields that must not be stored in the audit log (e.g. password hashes)
+const auditRedacted = "[redacted]"
+
+// fields that are not compared for the changes of an audit entry (timestamps and associations)
+var auditIgnoredFields = map[string]bool{
+	"id":               true,
+	"created_at":       true,
+	"updated_at":       true,
+	"last_login":       true,
+	"api_token":        true,
+	"roles":            true,
+	"registration_key": true,
+}
+
+// AuditService writes the append-only audit log of administrative and security-relevant actions.
+// Entries of changes are written in the transaction of the change, so an action cannot happen without its entry.
+// Every entry contains the hash of the previous entry (hash chain), so altered, inserted or deleted entries are detected by Verify.
+// Checkpoints of the latest hash are signed periodically, so even a rewritten chain is detected.
+// Every checkpoint also signs the id of the previous checkpoint, so deleted checkpoints are detected.
+type AuditService struct {
+	transactor      repository.Transactor
+	auditRepository repository.AuditRepository
+	signingKey      ed25519.PrivateKey // signs checkpoints, nil disables them
+	trustedKeys     map[string]bool    // public keys (base64) whose checkpoints are verified: the signing key and previous signing keys
+}
+
+func NewAuditService(transactor repository.Transactor, auditRepository repository.AuditRepository, signingKey ed25519.PrivateKey, previousPublicKeys []string) AuditService {
+	trustedKeys := make(map[string]bool)
+	if signingKey != nil {
+		trustedKeys[crypto.Ed25519PublicKey(signingKey)] = true
+	}
+	for _, publicKey := range previousPublicKeys {
+		trustedKeys[publicKey] = true
+	}
+	return AuditService{transactor, auditRepository, signingKey, trustedKeys}
+}
+
+// Start starts the garbage collector and the checkpointer of the audit log (only in the server)
+func (s *AuditService) Start() {
+	go s.auditGarbageCollector()
+	if s.signingKey != nil {
+		go s.auditCheckpointer()
+	}
+}
+
+// Transaction runs fn in a database transaction (for services that record entries but have no transactions of their own)
+func (s *AuditService) Transaction(fn func(tx repository.Tx) error) error {
+	return s.transactor.Transaction(fn)
+}
+
+// RecordTx appends an entry for an action of actor to the audit log within the transaction
+// The head of the chain stays locked until the transaction ends, so concurrent entries are chained in order.
+func (s *AuditService) RecordTx(tx repository.Tx, actor model.AuditActor, entry model.AuditEntry) error {
+	entry.ActorID = actor.UserID
+	entry.ActorName = actor.Username
+	entry.IP = actor.IP
+	entry.UserAgent = strings.ToValidUTF8(actor.UserAgent, "?") // stored as text, the hash must survive storing it
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	auditRepository := s.auditRepository.WithTx(tx)
+	head, err := auditRepository.LockHead()
+	if err != nil {
+		return model.InternalServerError{Message: "Could not lock audit log", Err: err}
+	}
+	if err := auditRepository.Append(head, &entry); err != nil {
+		return model.InternalServerError{Message: "Could not write audit log", Err: err}
+	}
+	return nil
+}
+
+// Record appends an entry for an action that does not change any data (e.g. a login)
+// Errors are only logged, so they do not prevent the action.
+func (s *AuditService) Record(actor model.AuditActor, entry model.AuditEntry) {
+	err := s.Transaction(func(tx repository.Tx) error {
+		return s.RecordTx(tx, actor, entry)
+	})
+	if err != nil {
+		log.Println("AuditService: could not record", entry.Action, "of", actor.Username, ":", err)
+	}
+}
+
+// Find returns a page of the entries matching the filter, newest first
+func (s *AuditService) Find(filter model.AuditFilter, limit, offset int) (*model.AuditPage, error) {
+	entries, total, err := s.auditRepository.Find(filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuditPage{Entries: entries, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// Checkpoints returns all signed checkpoints of the audit log, oldest first
+func (s *AuditService) Checkpoints() ([]model.AuditCheckpoint, error) {
+	return s.auditRepository.FindCheckpoints()
+}
+
+// Verify checks the hash chain of all retained entries and the signatures and the order of the checkpoints.
+// It stops at the first broken link. Entries appended during the verification are not checked.
+func (s *AuditService) Verify() (*model.AuditVerification, error) {
+	result := &model.AuditVerification{Valid: true}
+	head, err := s.auditRepository.FindHead()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := s.checkpointsToVerify()
+	if err != nil {
+		return nil, err
+	}
+	checkpointEntries := make(map[uint]bool) // entries referenced by checkpoints
+	for _, checkpoint := range checkpoints {
+		checkpointEntries[checkpoint.EntryID] = true
+	}
+	checkpointHashes := make(map[uint]string) // hashes of the entries referenced by checkpoints
+
+	// entries are appended while the head is locked, so their ids increase along the chain
+	var afterID uint
+chain:
+	for afterID < head.EntryID {
+		entries, err := s.auditRepository.FindChain(afterID, auditChainBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if entry.ID > head.EntryID { // appended after the verification started
+				break chain
+			}
+			if result.FirstEntryID == 0 {
+				result.FirstEntryID = entry.ID // older entries may have been deleted after AUDIT_RETENTION
+			} else if entry.PrevHash != result.LastHash {
+				return brokenEntry(result, entry.ID, fmt.Sprintf("entry %d does not link to the previous entry %d (an entry was altered, deleted or inserted)", entry.ID, result.LastEntryID)), nil
+			}
+			hash, err := entry.ChainHash()
+			if err != nil {
+				return nil, err
+			}
+			if hash != entry.Hash {
+				return brokenEntry(result, entry.ID, fmt.Sprintf("the content of entry %d does not match its hash (the entry was altered)", entry.ID)), nil
+			}
+			if checkpointEntries[entry.ID] {
+				checkpointHashes[entry.ID] = entry.Hash
+			}
+			result.EntriesChecked++
+			result.LastEntryID = entry.ID
+			result.LastHash = entry.Hash
+			afterID = entry.ID
+		}
+	}
+	if result.LastEntryID != head.EntryID || result.LastHash != head.Hash {
+		result.Valid = false
+		result.Error = fmt.Sprintf("the chain ends at entry %d but its head points to entry %d (entries were deleted at the end)", result.LastEntryID, head.EntryID)
+		return result, nil
+	}
+
+	// checkpoints are deleted after AUDIT_RETENTION oldest first, so every other checkpoint must follow the previous one
+	var previous *model.AuditCheckpoint
+	for i := range checkpoints {
+		checkpoint := &checkpoints[i]
+		if !s.trustedKeys[checkpoint.PublicKey] {
+			return brokenCheckpoint(result, checkpoint.ID, fmt.Sprintf("checkpoint %d is signed by the untrusted key %s (neither AUDIT_SIGNING_KEY nor one of AUDIT_TRUSTED_PUBLIC_KEYS)", checkpoint.ID, checkpoint.PublicKey)), nil
+		}
+		if !crypto.VerifyEd25519(checkpoint.PublicKey, checkpoint.SignedMessage(), checkpoint.Signature) {
+			return brokenCheckpoint(result, checkpoint.ID, fmt.Sprintf("checkpoint %d has no valid signature (the checkpoint was altered)", checkpoint.ID)), nil
+		}
+		// checkpoints written before they were chained have no previous checkpoint
+		if previous != nil && checkpoint.PrevCheckpointID != previous.ID && (checkpoint.PrevCheckpointID != 0 || previous.PrevCheckpointID != 0) {
+			return brokenCheckpoint(result, checkpoint.ID, fmt.Sprintf("checkpoint %d does not follow checkpoint %d (a checkpoint was deleted)", checkpoint.ID, previous.ID)), nil
+		}
+		previous = checkpoint
+		if checkpoint.EntryID >= result.FirstEntryID { // otherwise the entry was deleted after AUDIT_RETENTION
+			if hash, ok := checkpointHashes[checkpoint.EntryID]; !ok || hash != checkpoint.Hash {
+				return brokenCheckpoint(result, checkpoint.ID, fmt.Sprintf("checkpoint %d does not match entry %d (the chain was rewritten)", checkpoint.ID, checkpoint.EntryID)), nil
+			}
+		}
+		result.CheckpointsChecked++
+	}
+	return result, nil
+}
+
+// checkpointsToVerify returns the checkpoints ordered by id (none without trusted keys)
+func (s *AuditService) checkpointsToVerify() ([]model.AuditCheckpoint, error) {
+	if len(s.trustedKeys) == 0 {
+		return nil, nil
+	}
+	return s.auditRepository.FindCheckpoints()
+}
+
+func brokenEntry(result *model.AuditVerification, id uint, reason string) *model.AuditVerification {
+	result.Valid = false
+	result.BrokenEntryID = &id
+	result.Error = reason
+	return result
+}
+
+func brokenCheckpoint(result *model.AuditVerification, id uint, reason string) *model.AuditVerification {
+	result.Valid = false
+	result.BrokenCheckpointID = &id
+	result.Error = reason
+	return result
+}
+
+// WriteCheckpoint signs the latest hash of the chain if it changed since the last checkpoint
+func (s *AuditService) WriteCheckpoint() (*model.AuditCheckpoint, error) {
+	if s.signingKey == nil {
+		return nil, model.BadRequestError{Message: "No AUDIT_SIGNING_KEY configured"}
+	}
+	var checkpoint *model.AuditCheckpoint
+	err := s.Transaction(func(tx repository.Tx) error {
+		auditRepository := s.auditRepository.WithTx(tx)
+		head, err := auditRepository.LockHead()
+		if err != nil {
+			return err
+		}
+		if head.EntryID == 0 { // nothing to sign
+			return nil
+		}
+		latest, err := auditRepository.FindLatestCheckpoint()
+		if _, notFound := err.(model.NotFoundError); err != nil && !notFound {
+			return err
+		}
+		if err == nil && latest.EntryID == head.EntryID {
+			return nil
+		}
+		checkpoint = &model.AuditCheckpoint{
+			CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+			EntryID:   head.EntryID,
+			Hash:      head.Hash,
+		}
+		if err == nil {
+			checkpoint.PrevCheckpointID = latest.ID
+		}
+		checkpoint.PublicKey = crypto.Ed25519PublicKey(s.signingKey)
+		checkpoint.Signature = crypto.SignEd25519(s.signingKey, checkpoint.SignedMessage())
+		return auditRepository.CreateCheckpoint(checkpoint)
+	})
+	return checkpoint, err
+}
+
+func (s *AuditService) auditCheckpointer() {
+	for range time.NewTicker(config.AuditCheckpointInterval).C {
+		checkpoint, err := s.WriteCheckpoint()
+		if err != nil {
+			log.Println("AuditService: could not write checkpoint:", err)
+			continue
+		}
+		if checkpoint != nil {
+			log.Println("AuditService: signed checkpoint of entry", checkpoint.EntryID)
+		}
+	}
+}
+
+func (s *AuditService) auditGarbageCollector() {
+	if config.AuditRetention <= 0 { // keep entries forever
+		return
+	}
+	for range time.NewTicker(time.Hour).C {
+		rowsAffected, err := s.auditRepository.DeleteBefore(time.Now().Add(-config.AuditRetention))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("Successfully deleted %d audit entries\n", rowsAffected)
+	}
+}
+
+// newAuditEntry creates an audit entry of an action on a target
+func newAuditEntry(action, targetType string, targetID uint, targetName string) model.AuditEntry {
+	return model.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   &targetID,
+		TargetName: targetName,
+	}
+}
+
+// auditChanges returns the fields whose JSON values differ between before and after
+// (nil before or after for created or deleted targets)
+func auditChanges(before, after any) map[string]model.AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	changes := make(map[string]model.AuditChange)
+	for field, value := range beforeFields {
+		if afterValue, ok := afterFields[field]; !ok || !reflect.DeepEqual(value, afterValue) {
+			changes[field] = model.AuditChange{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes[field] = model.AuditChange{Before: nil, After: value}
+		}
+	}
+	return changes
+}
+
+func auditFields(value any) map[string]any {
+	fields := make(map[string]any)
+	if v := reflect.ValueOf(value); !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+		return fields
+	}
+	bs, err := json.Marshal(value)
+	if err != nil {
+		log.Println("AuditService: could not encode", reflect.TypeOf(value), ":", err)
+		return fields
+	}
+	if err := json.Unmarshal(bs, &fields); err != nil {
+		log.Println("AuditService: could not decode", reflect.TypeOf(value), ":", err)
+	}
+	for field := range auditIgnoredFields {
+		delete(fields, field)
+	}
+	return fields
+}
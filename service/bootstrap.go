@@ -0,0 +1,128 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+const setupTokenLength = 32
+
+// BootstrapService makes a fresh installation administrable without deleting any data:
+// it creates the admin and deploy roles and the first admin if they do not exist yet
+type BootstrapService struct {
+	userService UserService
+	roleService RoleService
+	setupToken  *setupToken
+}
+
+// setupToken is the one-time token for creating the first admin via the API (empty if there is none)
+type setupToken struct {
+	lock  sync.Mutex
+	token string
+}
+
+func NewBootstrapService(userService UserService, roleService RoleService) BootstrapService {
+	return BootstrapService{userService, roleService, &setupToken{}}
+}
+
+// Bootstrap ensures that the admin and deploy roles exist and that there is an admin
+// If there is no admin, it is created from the BOOTSTRAP_ADMIN_* credentials if they are configured.
+// Otherwise a one-time setup token for CompleteSetup is printed to the log.
+// It is idempotent and runs on every startup.
+func (s *BootstrapService) Bootstrap() error {
+	for _, rolename := range []string{config.AdminRoleName, config.DeployRoleName} {
+		if err := s.ensureRole(rolename); err != nil {
+			return err
+		}
+	}
+	admin, err := s.findAdmin()
+	if err != nil {
+		return err
+	}
+	if admin != nil {
+		return nil
+	}
+	if config.BootstrapAdminUsername != "" {
+		if err := s.createAdmin(config.BootstrapAdminUsername, config.BootstrapAdminPassword, config.BootstrapAdminEmail, model.SystemActor); err != nil {
+			return fmt.Errorf("could not create the admin %s from BOOTSTRAP_ADMIN_USERNAME: %w", config.BootstrapAdminUsername, err)
+		}
+		log.Println("	Created the admin", config.BootstrapAdminUsername)
+		return nil
+	}
+	token, err := crypto.NewRandomAlphaNumString(setupTokenLength)
+	if err != nil {
+		return model.InternalServerError{Message: "Could not generate setup token", Err: err}
+	}
+	s.setupToken.lock.Lock()
+	s.setupToken.token = token
+	s.setupToken.lock.Unlock()
+	log.Println("	There is no admin yet, create one with POST /bootstrap and the one-time setup token", token)
+	return nil
+}
+
+// CompleteSetup creates the first admin with the one-time setup token printed by Bootstrap
+func (s *BootstrapService) CompleteSetup(token, username, password, email string, actor model.AuditActor) (*model.User, error) {
+	s.setupToken.lock.Lock()
+	defer s.setupToken.lock.Unlock()
+	if s.setupToken.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.setupToken.token)) != 1 {
+		return nil, model.UnauthorizedError{Message: "Invalid setup token"}
+	}
+	// another instance or the command line may have created an admin in the meantime
+	admin, err := s.findAdmin()
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil {
+		s.setupToken.token = ""
+		return nil, model.ConflictError{Message: "There already is an admin"}
+	}
+	if err := s.createAdmin(username, password, email, actor); err != nil {
+		return nil, err
+	}
+	s.setupToken.token = ""
+	return s.userService.GetByName(username)
+}
+
+func (s *BootstrapService) ensureRole(rolename string) error {
+	_, err := s.roleService.GetByName(rolename)
+	if _, notFound := err.(model.NotFoundError); !notFound {
+		return err
+	}
+	err = s.roleService.Create(rolename, model.SystemActor)
+	if _, conflict := err.(model.ConflictError); conflict { // created by another instance
+		return nil
+	}
+	if err == nil {
+		log.Println("	Created the role", rolename)
+	}
+	return err
+}
+
+// findAdmin returns any user with the admin role or nil if there is none
+func (s *BootstrapService) findAdmin() (*model.User, error) {
+	role, err := s.roleService.GetByName(config.AdminRoleName)
+	if err != nil {
+		return nil, err
+	}
+	admins, err := s.roleService.GetUsersOfRole(role.ID)
+	if err != nil || len(admins) == 0 {
+		return nil, err
+	}
+	return &admins[0], nil
+}
+
+// createAdmin creates a new user with the admin role in one transaction (no user without the role is left on errors)
+// Existing users are not promoted, use "heimdall user add-role" for that.
+func (s *BootstrapService) createAdmin(username, password, email string, actor model.AuditActor) error {
+	role, err := s.roleService.GetByName(config.AdminRoleName)
+	if err != nil {
+		return err
+	}
+	return s.userService.CreateWithRole(username, password, email, role, actor)
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+)
+
+const outboxBatchSize = 100
+
+// OutboxService implements a transactional outbox for change notifications.
+// Services record domain events in the outbox table within the same transaction as the change,
+// the dispatcher delivers them to the token service (SSE and webhooks) after the commit
+// and retries them until they succeed, so a crash between the change and the notification
+// cannot lose the notification (delivery is at-least-once).
+type OutboxService struct {
+	transactor       repository.Transactor
+	outboxRepository repository.OutboxRepository
+	userRepository   repository.UserRepository
+	tokenService     TokenService
+	wakeup           chan struct{} // signals the dispatcher that new events were committed
+}
+
+func NewOutboxService(transactor repository.Transactor,
+	outboxRepository repository.OutboxRepository,
+	userRepository repository.UserRepository,
+	tokenService TokenService,
+) OutboxService {
+	return OutboxService{transactor, outboxRepository, userRepository, tokenService, make(chan struct{}, 1)}
+}
+
+// Start starts the dispatcher and the garbage collector of the outbox (only in the server,
+// the events recorded by the command line interface are dispatched by the running servers)
+func (s *OutboxService) Start() {
+	go s.dispatcher()
+	go s.outboxGarbageCollector()
+}
+
+// Transaction runs fn in a database transaction and dispatches the events recorded by fn after the commit
+func (s *OutboxService) Transaction(fn func(tx repository.Tx) error) error {
+	if err := s.transactor.Transaction(fn); err != nil {
+		return err
+	}
+	select {
+	case s.wakeup <- struct{}{}:
+	default: // the dispatcher is already signaled
+	}
+	return nil
+}
+
+// Record stores an event about a user in the outbox within the transaction
+func (s *OutboxService) Record(tx repository.Tx, eventType string, user *model.User) error {
+	payload, err := json.Marshal(model.OutboxPayload{UserID: user.ID, Username: user.Username})
+	if err != nil {
+		return model.InternalServerError{Message: "Could not encode outbox event", Err: err}
+	}
+	outboxRepository := s.outboxRepository.WithTx(tx)
+	return outboxRepository.Save(&model.OutboxEvent{
+		Type:          eventType,
+		Payload:       string(payload),
+		NextAttemptAt: time.Now(),
+		UserID:        user.ID,
+	})
+}
+
+// dispatcher dispatches committed events immediately and periodically looks for events
+// that could not be dispatched before (failed or recorded by a crashed instance)
+func (s *OutboxService) dispatcher() {
+	ticker := time.NewTicker(config.OutboxPollInterval)
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wakeup:
+		}
+		s.dispatchDue()
+	}
+}
+
+// dispatchDue dispatches the due events until none of them can be dispatched anymore
+// Every round dispatches the first undispatched event of every user, so the next round may find their later events.
+func (s *OutboxService) dispatchDue() {
+	for {
+		events, err := s.outboxRepository.FindDue(time.Now(), outboxBatchSize)
+		if err != nil {
+			log.Println("OutboxService: could not query due events:", err)
+			return
+		}
+		dispatched := false
+		for i := range events {
+			event := &events[i]
+			// claimed events are retried after the retry interval if this instance crashes while dispatching
+			claimed, err := s.outboxRepository.Claim(event, time.Now().Add(config.OutboxRetryInterval))
+			if err != nil {
+				log.Println("OutboxService: could not claim event", event.ID, ":", err)
+				return
+			}
+			if !claimed {
+				continue // dispatched by another instance
+			}
+			event.Attempts++
+			if err := s.dispatch(event); err != nil {
+				log.Println("OutboxService: could not dispatch event", event.ID, "of type", event.Type, ":", err)
+				event.LastError = truncate(err.Error(), webhookMaxErrorLength)
+			} else {
+				now := time.Now()
+				event.DispatchedAt = &now
+				event.LastError = ""
+				dispatched = true
+			}
+			if err := s.outboxRepository.Save(event); err != nil {
+				log.Println("OutboxService: could not store dispatch result of event", event.ID, ":", err)
+			}
+		}
+		if !dispatched {
+			return
+		}
+	}
+}
+
+// dispatch notifies the subscribers of the internal API and the webhooks about an event in two steps
+// The completed steps are stored, so a retry only repeats the failed one. Notifications must still be idempotent
+// since a step is repeated if this instance crashes before storing it.
+func (s *OutboxService) dispatch(event *model.OutboxEvent) error {
+	var payload model.OutboxPayload
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		return err
+	}
+	if event.PublishedAt == nil {
+		if err := s.publish(event.Type, payload); err != nil {
+			return err
+		}
+		now := time.Now()
+		event.PublishedAt = &now
+		if err := s.outboxRepository.Save(event); err != nil {
+			return err
+		}
+	}
+	if event.EnqueuedAt == nil {
+		if err := s.enqueue(event.Type, payload); err != nil {
+			return err
+		}
+		now := time.Now()
+		event.EnqueuedAt = &now
+	}
+	return nil
+}
+
+// publish notifies the subscribers of the internal API (SSE and WebSocket streams) about an event
+func (s *OutboxService) publish(eventType string, payload model.OutboxPayload) error {
+	user := &model.User{Model: model.Model{ID: payload.UserID}, Username: payload.Username}
+	switch eventType {
+	case model.OutboxUserCreated, model.OutboxUserEnabled:
+		s.tokenService.PublishUserCreated(user)
+		return nil
+	case model.OutboxUserDeleted: // the API token was deleted together with the user
+		s.tokenService.PublishUserRemoved(user, false)
+		return nil
+	case model.OutboxUserDisabled:
+		s.tokenService.PublishUserRemoved(user, true)
+		return nil
+	case model.OutboxUserRolesChanged:
+		currentUser, err := s.findCurrentUser(payload.UserID)
+		if err != nil || currentUser == nil {
+			return err
+		}
+		return s.tokenService.PublishRoleUpdate(currentUser)
+	case model.OutboxCredentialsChanged:
+		// the API token was deleted in the transaction of the change, close the connections using the previous credentials
+		currentUser, err := s.findCurrentUser(payload.UserID)
+		if err != nil {
+			return err
+		}
+		return s.tokenService.PublishCredentialsChanged(payload.Username, currentUser)
+	default: // retried since it may be recorded by a newer instance that can dispatch it
+		return fmt.Errorf("unknown event type %q", eventType)
+	}
+}
+
+// webhook events of the outbox events that only contain the user of the payload
+var outboxWebhookEvents = map[string]string{
+	model.OutboxUserCreated:  model.WebhookEventUserCreated,
+	model.OutboxUserDeleted:  model.WebhookEventUserDeleted,
+	model.OutboxUserDisabled: model.WebhookEventUserDisabled,
+	model.OutboxUserEnabled:  model.WebhookEventUserEnabled,
+}
+
+// enqueue stores the deliveries of an event to the webhooks (sent by the delivery worker)
+func (s *OutboxService) enqueue(eventType string, payload model.OutboxPayload) error {
+	if webhookEvent, ok := outboxWebhookEvents[eventType]; ok {
+		user := &model.User{Model: model.Model{ID: payload.UserID}, Username: payload.Username}
+		return s.tokenService.DispatchUserEvent(webhookEvent, user, false)
+	}
+	currentUser, err := s.findCurrentUser(payload.UserID)
+	if err != nil || currentUser == nil {
+		return err
+	}
+	switch eventType {
+	case model.OutboxUserRolesChanged:
+		return s.tokenService.DispatchUserEvent(model.WebhookEventUserRolesUpdated, currentUser, true)
+	case model.OutboxCredentialsChanged:
+		return s.tokenService.DispatchApiToken(currentUser)
+	default:
+		return fmt.Errorf("unknown event type %q", eventType)
+	}
+}
+
+// findCurrentUser loads the current state of the user of an event, nil if it was deleted in the meantime
+// (announced by user.deleted)
+func (s *OutboxService) findCurrentUser(id uint) (*model.User, error) {
+	user, err := s.userRepository.FindByID(id)
+	if _, notFound := err.(model.NotFoundError); notFound {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (s *OutboxService) outboxGarbageCollector() {
+	for range time.NewTicker(time.Hour).C {
+		rowsAffected, err := s.outboxRepository.DeleteDispatchedBefore(time.Now().Add(-config.OutboxRetention))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("Successfully deleted %d dispatched outbox events\n", rowsAffected)
+	}
+}
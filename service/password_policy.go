@@ -0,0 +1,162 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/nbutton23/zxcvbn-go"
+	"github.com/nbutton23/zxcvbn-go/match"
+)
+
+// minUserInfoLength is the minimum length of a username or email part to be checked against the password
+// (prevents rejecting passwords because they contain very short usernames like "ab")
+const minUserInfoLength = 3
+
+type PasswordPolicyService struct {
+	breachedPasswords *crypto.BreachedPasswordSet // may be nil if no breached password corpus is configured
+}
+
+func NewPasswordPolicyService(breachedPasswords *crypto.BreachedPasswordSet) PasswordPolicyService {
+	return PasswordPolicyService{breachedPasswords}
+}
+
+// Check evaluates a password against the configured password policy
+// username and email are used to reject passwords containing personal information and may be empty
+func (p *PasswordPolicyService) Check(password, username, email string) model.PasswordCheckResult {
+	if len(password) > crypto.MaxPasswordLength {
+		// rejected before all other checks, the cost of zxcvbn grows steeply with the length
+		return model.PasswordCheckResult{
+			Valid:       false,
+			MinScore:    config.PasswordMinStrengthScore,
+			Violations:  []string{fmt.Sprintf("Password must be at most %d bytes long", crypto.MaxPasswordLength)},
+			Suggestions: []string{},
+		}
+	}
+	violations := []string{}
+	if strings.TrimSpace(password) == "" {
+		violations = append(violations, "Password must not be empty or only whitespace")
+	}
+	if len(password) < config.MinPasswordLength {
+		violations = append(violations, fmt.Sprintf("Password must be at least %d characters long", config.MinPasswordLength))
+	}
+	if classes := countCharacterClasses(password); classes < config.PasswordMinCharacterClasses {
+		violations = append(violations, fmt.Sprintf("Password must contain at least %d of the following: lowercase letters, uppercase letters, digits, symbols", config.PasswordMinCharacterClasses))
+	}
+	userInputs := userInfoParts(username, email)
+	if config.PasswordDisallowUserInfo && containsAnyFold(password, userInputs) {
+		violations = append(violations, "Password must not contain the username or email")
+	}
+
+	if p.breachedPasswords.Contains(password) {
+		violations = append(violations, "Password appears in a list of breached passwords and must not be used")
+	}
+
+	strength := zxcvbn.PasswordStrength(password, userInputs)
+	if strength.Score < config.PasswordMinStrengthScore {
+		violations = append(violations, fmt.Sprintf("Password is too easy to guess (strength %d of 4, at least %d required)", strength.Score, config.PasswordMinStrengthScore))
+	}
+
+	return model.PasswordCheckResult{
+		Valid:       len(violations) == 0,
+		Score:       strength.Score,
+		MinScore:    config.PasswordMinStrengthScore,
+		CrackTime:   strength.CrackTimeDisplay,
+		Violations:  violations,
+		Suggestions: suggestionsFor(strength.MatchSequence, strength.Score),
+	}
+}
+
+// Validate returns a BadRequestError listing all violated rules if the password does not satisfy the password policy
+func (p *PasswordPolicyService) Validate(password, username, email string) error {
+	result := p.Check(password, username, email)
+	if !result.Valid {
+		return model.BadRequestError{Message: "Password does not meet criteria: " + strings.Join(result.Violations, ", ")}
+	}
+	return nil
+}
+
+func countCharacterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// userInfoParts returns the username, the email and the local part of the email (if long enough)
+func userInfoParts(username, email string) []string {
+	var parts []string
+	for _, part := range []string{username, email, strings.Split(email, "@")[0]} {
+		if len(part) >= minUserInfoLength {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func containsAnyFold(s string, substrings []string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range substrings {
+		if strings.Contains(s, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestionsFor derives hints from the patterns zxcvbn found in the password
+// strong passwords (score >= 3) only get a hint if they contain the username or email
+func suggestionsFor(matches []match.Match, score int) []string {
+	suggestions := []string{}
+	seen := make(map[string]bool)
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			suggestions = append(suggestions, s)
+		}
+	}
+	for _, m := range matches {
+		if score >= 3 && m.DictionaryName != "user_inputs" {
+			continue
+		}
+		switch m.Pattern {
+		case "dictionary":
+			if m.DictionaryName == "user_inputs" {
+				add("Avoid using your username or email")
+			} else {
+				add("Avoid common words, names and passwords")
+			}
+		case "spatial":
+			add("Avoid keyboard patterns like \"qwerty\"")
+		case "repeat":
+			add("Avoid repeated characters like \"aaa\"")
+		case "sequence":
+			add("Avoid sequences like \"abc\" or \"1234\"")
+		case "date":
+			add("Avoid dates and years that are associated with you")
+		}
+	}
+	if score < 3 {
+		add("Use a longer password, e.g. a passphrase of several unrelated words")
+	}
+	return suggestions
+}
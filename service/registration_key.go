@@ -11,10 +11,11 @@ import (
 
 type RegistrationKeyService struct {
 	registrationKeyRepository repository.RegistrationKeyRepository
+	auditService              AuditService
 }
 
-func NewRegistrationKeyService(regKeyRepo repository.RegistrationKeyRepository) RegistrationKeyService {
-	return RegistrationKeyService{regKeyRepo}
+func NewRegistrationKeyService(regKeyRepo repository.RegistrationKeyRepository, auditService AuditService) RegistrationKeyService {
+	return RegistrationKeyService{regKeyRepo, auditService}
 }
 
 func (r *RegistrationKeyService) GetAll() ([]model.RegistrationKey, error) {
@@ -29,7 +30,7 @@ func (r *RegistrationKeyService) GetByKey(key string) (*model.RegistrationKey, e
 	return r.registrationKeyRepository.FindByKey(key)
 }
 
-func (r *RegistrationKeyService) Create(key, description string, permanent bool, expiresAt time.Time) error {
+func (r *RegistrationKeyService) Create(key, description string, permanent bool, expiresAt time.Time, actor model.AuditActor) error {
 	if key == "" { // special case: let the server generate the key
 		var err error
 		key, err = crypto.NewRandomAlphaNumString(config.RegistrationKeyLength)
@@ -55,21 +56,49 @@ func (r *RegistrationKeyService) Create(key, description string, permanent bool,
 		Permanent:   permanent,
 		ExpiresAt:   expiresAt,
 	}
-	return r.registrationKeyRepository.Save(&regKey)
+	return r.saveAndAudit(&regKey, actor, model.AuditRegistrationKeyCreated, auditChanges(nil, &regKey))
 }
 
-func (r *RegistrationKeyService) Update(id uint, description string, permanent bool, expiresAt time.Time) error {
+func (r *RegistrationKeyService) Update(id uint, description string, permanent bool, expiresAt time.Time, actor model.AuditActor) error {
 	// no restrictions on description, permanent and expiresAt (see Create)
 	key, err := r.registrationKeyRepository.FindByID(id)
 	if err != nil {
 		return err
 	}
+	previousKey := *key
 	key.Description = description
 	key.Permanent = permanent
 	key.ExpiresAt = expiresAt
-	return r.registrationKeyRepository.Save(key)
+	return r.saveAndAudit(key, actor, model.AuditRegistrationKeyUpdated, auditChanges(&previousKey, key))
 }
 
-func (r *RegistrationKeyService) DeleteByID(id uint) error {
-	return r.registrationKeyRepository.DeleteByID(id)
+func (r *RegistrationKeyService) DeleteByID(id uint, actor model.AuditActor) error {
+	key, err := r.registrationKeyRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return r.auditService.Transaction(func(tx repository.Tx) error {
+		registrationKeyRepository := r.registrationKeyRepository.WithTx(tx)
+		if err := registrationKeyRepository.DeleteByID(id); err != nil {
+			return err
+		}
+		return r.recordAudit(tx, actor, model.AuditRegistrationKeyDeleted, key, auditChanges(key, nil))
+	})
+}
+
+// saveAndAudit saves a registration key and records an audit entry in the same transaction
+func (r *RegistrationKeyService) saveAndAudit(key *model.RegistrationKey, actor model.AuditActor, action string, changes map[string]model.AuditChange) error {
+	return r.auditService.Transaction(func(tx repository.Tx) error {
+		registrationKeyRepository := r.registrationKeyRepository.WithTx(tx)
+		if err := registrationKeyRepository.Save(key); err != nil {
+			return err
+		}
+		return r.recordAudit(tx, actor, action, key, changes)
+	})
+}
+
+func (r *RegistrationKeyService) recordAudit(tx repository.Tx, actor model.AuditActor, action string, key *model.RegistrationKey, changes map[string]model.AuditChange) error {
+	entry := newAuditEntry(action, model.AuditTargetRegistrationKey, key.ID, key.Key)
+	entry.Changes = changes
+	return r.auditService.RecordTx(tx, actor, entry)
 }
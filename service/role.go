@@ -1,7 +1,7 @@
 package service
 
 import (
-	"log"
+	"slices"
 
 	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"github.com/ProjectLighthouseCAU/heimdall/repository"
@@ -10,13 +10,15 @@ import (
 type RoleService struct {
 	roleRepository repository.RoleRepository
 	userRepository repository.UserRepository
-	tokenService   TokenService
+	outboxService  OutboxService
+	auditService   AuditService
 }
 
 func NewRoleService(roleRepo repository.RoleRepository,
 	userRepo repository.UserRepository,
-	tokenService TokenService) RoleService {
-	return RoleService{roleRepo, userRepo, tokenService}
+	outboxService OutboxService,
+	auditService AuditService) RoleService {
+	return RoleService{roleRepo, userRepo, outboxService, auditService}
 }
 
 func (r *RoleService) GetAll() ([]model.Role, error) {
@@ -49,7 +51,7 @@ func (r *RoleService) checkIfRoleExists(rolename string) error {
 	return nil
 }
 
-func (r *RoleService) Create(rolename string) error {
+func (r *RoleService) Create(rolename string, actor model.AuditActor) error {
 	if err := validateRole(rolename); err != nil {
 		return err
 	}
@@ -59,10 +61,16 @@ func (r *RoleService) Create(rolename string) error {
 	role := model.Role{
 		Name: rolename,
 	}
-	return r.roleRepository.Save(&role)
+	return r.auditService.Transaction(func(tx repository.Tx) error {
+		roleRepository := r.roleRepository.WithTx(tx)
+		if err := roleRepository.Save(&role); err != nil {
+			return err
+		}
+		return r.recordRoleAudit(tx, actor, model.AuditRoleCreated, &role, auditChanges(nil, &role))
+	})
 }
 
-func (r *RoleService) Update(id uint, rolename string) error {
+func (r *RoleService) Update(id uint, rolename string, actor model.AuditActor) error {
 	role, err := r.roleRepository.FindByID(id)
 	if err != nil {
 		return err
@@ -74,51 +82,80 @@ func (r *RoleService) Update(id uint, rolename string) error {
 		return model.BadRequestError{Message: "Invalid name"}
 	}
 
-	// save role
+	// save role and record a role change for all users of the role
+	previousRole := *role
 	role.Name = rolename
-	err = r.roleRepository.Save(role)
+	return r.outboxService.Transaction(func(tx repository.Tx) error {
+		roleRepository := r.roleRepository.WithTx(tx)
+		if err := roleRepository.Save(role); err != nil {
+			return err
+		}
+		if err := r.recordRoleAudit(tx, actor, model.AuditRoleUpdated, &previousRole, auditChanges(&previousRole, role)); err != nil {
+			return err
+		}
+		return r.recordRolesChanged(tx, role.Users)
+	})
+}
+
+func (r *RoleService) DeleteByID(id uint, actor model.AuditActor) error {
+	role, err := r.roleRepository.FindByID(id)
 	if err != nil {
 		return err
 	}
-
-	// get users of role for token update
-	users, err := r.GetUsersOfRole(id)
+	// get users of role before deletion
+	users, err := r.roleRepository.GetUsersOfRole(role)
 	if err != nil {
 		return model.InternalServerError{Message: "Could not get users of role", Err: err}
 	}
 
-	// notify token service about update
-	for _, user := range users {
-		u, err := r.userRepository.FindByID(user.ID) // ensure roles are loaded
-		if err != nil {
-			continue
+	// delete role and record a role change for all users of the deleted role
+	return r.outboxService.Transaction(func(tx repository.Tx) error {
+		roleRepository := r.roleRepository.WithTx(tx)
+		if err := roleRepository.DeleteByID(id); err != nil {
+			return err
 		}
-		r.tokenService.NotifyRoleUpdate(u)
-	}
-	return nil
+		if err := r.recordRoleAudit(tx, actor, model.AuditRoleDeleted, role, auditChanges(role, nil)); err != nil {
+			return err
+		}
+		return r.recordRolesChanged(tx, users)
+	})
 }
 
-func (r *RoleService) DeleteByID(id uint) error {
-	// get users of role before deletion
-	users, err := r.GetUsersOfRole(id)
-	if err != nil {
-		return model.InternalServerError{Message: "Could not get users of role", Err: err}
-	}
+func (r *RoleService) recordRoleAudit(tx repository.Tx, actor model.AuditActor, action string, role *model.Role, changes map[string]model.AuditChange) error {
+	entry := newAuditEntry(action, model.AuditTargetRole, role.ID, role.Name)
+	entry.Changes = changes
+	return r.auditService.RecordTx(tx, actor, entry)
+}
 
-	// delete role
-	err = r.roleRepository.DeleteByID(id)
-	if err != nil {
-		return err
+// recordRoleAssignment records the change of the roles of a user in the audit log
+func (r *RoleService) recordRoleAssignment(tx repository.Tx, actor model.AuditActor, action string, user *model.User, role *model.Role) error {
+	return r.auditService.RecordTx(tx, actor, newRoleAssignmentEntry(action, user, role))
+}
+
+// newRoleAssignmentEntry returns the audit entry of adding a user (with its previous roles) to a role or removing it
+func newRoleAssignmentEntry(action string, user *model.User, role *model.Role) model.AuditEntry {
+	before, after := []string{}, []string{}
+	for _, userRole := range user.Roles {
+		before = append(before, userRole.Name)
+		if action == model.AuditRoleAssigned || userRole.ID != role.ID {
+			after = append(after, userRole.Name)
+		}
+	}
+	if action == model.AuditRoleAssigned && !slices.Contains(before, role.Name) {
+		after = append(after, role.Name)
 	}
+	entry := newAuditEntry(action, model.AuditTargetUser, user.ID, user.Username)
+	entry.Details = "role " + role.Name
+	entry.Changes = map[string]model.AuditChange{"roles": {Before: before, After: after}}
+	return entry
+}
 
-	// query the users of the deleted role and notify token service about update
-	for _, user := range users {
-		updatedUser, err := r.userRepository.FindByID(user.ID)
-		if err != nil {
-			log.Println(err)
-			continue
+// recordRolesChanged records a role change for each user, the subscribers are notified by the outbox
+func (r *RoleService) recordRolesChanged(tx repository.Tx, users []model.User) error {
+	for i := range users {
+		if err := r.outboxService.Record(tx, model.OutboxUserRolesChanged, &users[i]); err != nil {
+			return err
 		}
-		r.tokenService.NotifyRoleUpdate(updatedUser)
 	}
 	return nil
 }
@@ -135,7 +172,7 @@ func (r *RoleService) GetUsersOfRole(roleid uint) ([]model.User, error) {
 	return users, nil
 }
 
-func (r *RoleService) AddUserToRole(roleid, userid uint) error {
+func (r *RoleService) AddUserToRole(roleid, userid uint, actor model.AuditActor) error {
 	role, err := r.roleRepository.FindByID(roleid)
 	if err != nil {
 		return err
@@ -144,20 +181,19 @@ func (r *RoleService) AddUserToRole(roleid, userid uint) error {
 	if err != nil {
 		return err
 	}
-	err = r.roleRepository.AddUserToRole(role, user)
-	if err != nil {
-		return err
-	}
-	// query user again after update
-	user, err = r.userRepository.FindByID(userid)
-	if err != nil {
-		return err
-	}
-	// notify token service about update
-	return r.tokenService.NotifyRoleUpdate(user)
+	return r.outboxService.Transaction(func(tx repository.Tx) error {
+		roleRepository := r.roleRepository.WithTx(tx)
+		if err := roleRepository.AddUserToRole(role, user); err != nil {
+			return err
+		}
+		if err := r.recordRoleAssignment(tx, actor, model.AuditRoleAssigned, user, role); err != nil {
+			return err
+		}
+		return r.outboxService.Record(tx, model.OutboxUserRolesChanged, user)
+	})
 }
 
-func (r *RoleService) RemoveUserFromRole(roleid, userid uint) error {
+func (r *RoleService) RemoveUserFromRole(roleid, userid uint, actor model.AuditActor) error {
 	role, err := r.roleRepository.FindByID(roleid)
 	if err != nil {
 		return err
@@ -166,15 +202,14 @@ func (r *RoleService) RemoveUserFromRole(roleid, userid uint) error {
 	if err != nil {
 		return err
 	}
-	err = r.roleRepository.RemoveUserFromRole(role, user)
-	if err != nil {
-		return err
-	}
-	// query user again after update
-	user, err = r.userRepository.FindByID(userid)
-	if err != nil {
-		return err
-	}
-	// notify token service about update
-	return r.tokenService.NotifyRoleUpdate(user)
+	return r.outboxService.Transaction(func(tx repository.Tx) error {
+		roleRepository := r.roleRepository.WithTx(tx)
+		if err := roleRepository.RemoveUserFromRole(role, user); err != nil {
+			return err
+		}
+		if err := r.recordRoleAssignment(tx, actor, model.AuditRoleUnassigned, user, role); err != nil {
+			return err
+		}
+		return r.outboxService.Record(tx, model.OutboxUserRolesChanged, user)
+	})
 }
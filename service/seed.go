@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+// default expiry of seeded registration keys without expires_in
+const seedRegistrationKeyExpiry = 7 * 24 * time.Hour
+
+// SeedService applies seeds through the other services, so they are validated, audited and announced like changes via the API
+type SeedService struct {
+	userService            UserService
+	roleService            RoleService
+	registrationKeyService RegistrationKeyService
+	tokenService           TokenService
+}
+
+func NewSeedService(userService UserService,
+	roleService RoleService,
+	registrationKeyService RegistrationKeyService,
+	tokenService TokenService) SeedService {
+	return SeedService{userService, roleService, registrationKeyService, tokenService}
+}
+
+// Apply creates the missing entries of the seed and returns them
+// Existing roles, registration keys and users are not changed (e.g. the password of an existing user is kept).
+// It stops at the first error, the entries created until then are kept and created again by the next run.
+func (s *SeedService) Apply(seed *model.Seed, actor model.AuditActor) (*model.SeedResult, error) {
+	if err := validateSeed(seed); err != nil {
+		return nil, err
+	}
+	result := &model.SeedResult{
+		Roles:            []string{},
+		RegistrationKeys: []string{},
+		Users:            []string{},
+		Memberships:      []string{},
+		ApiTokens:        []string{},
+	}
+	for _, rolename := range seed.Roles {
+		created, err := s.applyRole(rolename, actor)
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.Roles = append(result.Roles, rolename)
+		}
+	}
+	for _, key := range seed.RegistrationKeys {
+		created, err := s.applyRegistrationKey(key, actor)
+		if err != nil {
+			return result, err
+		}
+		if created {
+			result.RegistrationKeys = append(result.RegistrationKeys, key.Key)
+		}
+	}
+	for _, user := range seed.Users {
+		if err := s.applyUser(user, actor, result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// validateSeed checks the seed for duplicates and missing names before anything is created
+func validateSeed(seed *model.Seed) error {
+	roles := make(map[string]bool)
+	for _, rolename := range seed.Roles {
+		if rolename == "" || roles[rolename] {
+			return model.BadRequestError{Message: fmt.Sprintf("Seed: empty or duplicate role %q", rolename)}
+		}
+		roles[rolename] = true
+	}
+	keys := make(map[string]bool)
+	for _, key := range seed.RegistrationKeys {
+		if key.Key == "" || keys[key.Key] {
+			return model.BadRequestError{Message: fmt.Sprintf("Seed: empty or duplicate registration key %q", key.Key)}
+		}
+		if key.ExpiresIn != "" {
+			if _, err := time.ParseDuration(key.ExpiresIn); err != nil {
+				return model.BadRequestError{Message: fmt.Sprintf("Seed: invalid expires_in of registration key %q", key.Key), Err: err}
+			}
+		}
+		keys[key.Key] = true
+	}
+	users := make(map[string]bool)
+	for _, user := range seed.Users {
+		if user.Username == "" || users[user.Username] {
+			return model.BadRequestError{Message: fmt.Sprintf("Seed: empty or duplicate user %q", user.Username)}
+		}
+		users[user.Username] = true
+	}
+	return nil
+}
+
+func (s *SeedService) applyRole(rolename string, actor model.AuditActor) (bool, error) {
+	_, err := s.roleService.GetByName(rolename)
+	if _, notFound := err.(model.NotFoundError); !notFound {
+		return false, err
+	}
+	if err := s.roleService.Create(rolename, actor); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SeedService) applyRegistrationKey(key model.SeedRegistrationKey, actor model.AuditActor) (bool, error) {
+	_, err := s.registrationKeyService.GetByKey(key.Key)
+	if _, notFound := err.(model.NotFoundError); !notFound {
+		return false, err
+	}
+	expiresIn := seedRegistrationKeyExpiry
+	if key.ExpiresIn != "" {
+		expiresIn, _ = time.ParseDuration(key.ExpiresIn) // validated by validateSeed
+	}
+	if err := s.registrationKeyService.Create(key.Key, key.Description, key.Permanent, time.Now().Add(expiresIn), actor); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SeedService) applyUser(seedUser model.SeedUser, actor model.AuditActor, result *model.SeedResult) error {
+	user, err := s.userService.GetByName(seedUser.Username)
+	if _, notFound := err.(model.NotFoundError); notFound {
+		if seedUser.RegistrationKey != "" {
+			_, err = s.userService.Register(seedUser.Username, seedUser.Password, seedUser.Email, seedUser.RegistrationKey, nil, actor)
+		} else {
+			err = s.userService.Create(seedUser.Username, seedUser.Password, seedUser.Email, actor)
+		}
+		if err != nil {
+			return fmt.Errorf("seed user %s: %w", seedUser.Username, err)
+		}
+		result.Users = append(result.Users, seedUser.Username)
+		user, err = s.userService.GetByName(seedUser.Username)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, rolename := range seedUser.Roles {
+		if user.HasRole(rolename) {
+			continue
+		}
+		role, err := s.roleService.GetByName(rolename)
+		if err != nil {
+			return fmt.Errorf("role %s of seed user %s: %w", rolename, seedUser.Username, err)
+		}
+		if err := s.roleService.AddUserToRole(role.ID, user.ID, actor); err != nil {
+			return err
+		}
+		result.Memberships = append(result.Memberships, seedUser.Username+":"+rolename)
+	}
+
+	if seedUser.ApiToken == nil {
+		return nil
+	}
+	user, err = s.userService.GetByID(user.ID) // with the added roles for the notification
+	if err != nil {
+		return err
+	}
+	created, err := s.tokenService.GenerateApiTokenIfNotExists(user)
+	if err != nil {
+		return err
+	}
+	if created {
+		result.ApiTokens = append(result.ApiTokens, seedUser.Username)
+		if user, err = s.userService.GetByID(user.ID); err != nil {
+			return err
+		}
+	}
+	if user.ApiToken != nil && user.ApiToken.Permanent != seedUser.ApiToken.Permanent {
+		return s.tokenService.SetPermanent(user, seedUser.ApiToken.Permanent, actor)
+	}
+	return nil
+}
@@ -1,12 +1,10 @@
 package service
 
 import (
-	"errors"
 	"log"
-	"slices"
-	"sync"
 	"time"
 
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
 	"github.com/ProjectLighthouseCAU/heimdall/config"
 	"github.com/ProjectLighthouseCAU/heimdall/crypto"
 	"github.com/ProjectLighthouseCAU/heimdall/model"
@@ -17,22 +15,42 @@ type TokenService struct {
 	tokenRepository repository.TokenRepository
 	userRepository  repository.UserRepository
 
-	openAuthConnections map[string][]chan *model.AuthUpdateMessage // username -> update channel
-	authConnectionsLock *sync.Mutex
+	authBus             broker.Bus[*model.AuthUpdateMessage] // topic: username
+	userCreateDeleteBus broker.Bus[*model.UserUpdateMessage] // single topic
 
-	userCreateDeleteEventConnections     map[chan *model.UserUpdateMessage]struct{}
-	userCreateDeleteEventConnectionsLock *sync.Mutex
+	webhookService WebhookService
+	auditService   AuditService
+
+	expiryWakeup chan struct{} // signals the expiry scheduler that the next expiry may have changed
 }
 
-func NewTokenService(tokenRepository repository.TokenRepository, userRepository repository.UserRepository) TokenService {
-	go tokenGarbageCollector(tokenRepository)
-	return TokenService{tokenRepository,
-		userRepository,
-		make(map[string][]chan *model.AuthUpdateMessage),
-		&sync.Mutex{},
-		make(map[chan *model.UserUpdateMessage]struct{}),
-		&sync.Mutex{},
-	}
+// all subscribers of user creation and deletion events share this topic
+const userCreateDeleteTopic = ""
+
+func NewTokenService(tokenRepository repository.TokenRepository,
+	userRepository repository.UserRepository,
+	authBus broker.Bus[*model.AuthUpdateMessage],
+	userCreateDeleteBus broker.Bus[*model.UserUpdateMessage],
+	webhookService WebhookService,
+	auditService AuditService,
+) TokenService {
+	return TokenService{tokenRepository, userRepository, authBus, userCreateDeleteBus, webhookService, auditService, make(chan struct{}, 1)}
+}
+
+// Start starts the garbage collector of expired tokens and the expiry scheduler (only in the server)
+func (ts *TokenService) Start() {
+	go tokenGarbageCollector(ts.tokenRepository)
+	go ts.expiryScheduler()
+}
+
+// NewAuthBroker creates the broker for auth updates (the latest auth state of a user wins)
+func NewAuthBroker() *broker.Broker[*model.AuthUpdateMessage] {
+	return broker.New(config.EventQueueSize, config.EventLogSize, func(m *model.AuthUpdateMessage) string { return m.Username })
+}
+
+// NewUserCreateDeleteBroker creates the broker for user creation and deletion events (the latest event of a user wins)
+func NewUserCreateDeleteBroker() *broker.Broker[*model.UserUpdateMessage] {
+	return broker.New(config.EventQueueSize, config.EventLogSize, func(m *model.UserUpdateMessage) string { return m.Username })
 }
 
 func tokenGarbageCollector(tokenRepository repository.TokenRepository) {
@@ -55,16 +73,26 @@ func newRandomToken() (string, error) {
 	return s, nil
 }
 
-func (ts *TokenService) SetPermanent(user *model.User, permanent bool) error {
+func (ts *TokenService) SetPermanent(user *model.User, permanent bool, actor model.AuditActor) error {
 	token, err := ts.tokenRepository.FindByID(user.ID)
 	if err != nil {
 		return err
 	}
+	changes := map[string]model.AuditChange{"permanent": {Before: token.Permanent, After: permanent}}
 	token.Permanent = permanent
-	err = ts.tokenRepository.Save(token)
+	err = ts.auditService.Transaction(func(tx repository.Tx) error {
+		tokenRepository := ts.tokenRepository.WithTx(tx)
+		if err := tokenRepository.Save(token); err != nil {
+			return err
+		}
+		entry := newAuditEntry(model.AuditTokenUpdated, model.AuditTargetToken, user.ID, user.Username)
+		entry.Changes = changes
+		return ts.auditService.RecordTx(tx, actor, entry)
+	})
 	if err != nil {
 		return err
 	}
+	ts.rescheduleExpiry()
 	user, err = ts.userRepository.FindByID(user.ID)
 	if err != nil {
 		return err
@@ -76,102 +104,139 @@ func (ts *TokenService) SetPermanent(user *model.User, permanent bool) error {
 // the given user must have its roles and api token field pre-loaded from the database before calling
 // Returns true if the token was generated
 func (ts *TokenService) GenerateApiTokenIfNotExists(user *model.User) (bool, error) {
-	token := user.ApiToken
-	if token != nil && (token.Permanent || token.ExpiresAt.After(time.Now())) {
+	if hasValidApiToken(user) {
 		return false, nil
 	}
+	token, err := ts.generateApiToken(user)
+	if err != nil {
+		return false, err
+	}
+	// notify subscribers (the token exists, so errors of the webhooks are only logged)
+	if err := ts.announceApiToken(user, token); err != nil {
+		log.Println("GenerateApiTokenIfNotExists: could not announce the API token of", user.Username, ":", err)
+	}
+	return true, nil
+}
+
+// PublishCredentialsChanged closes the connections using the previous credentials of a user, generates a new API
+// token if the user has none and publishes the current token to the subscribers even if it was not generated,
+// so a failed publication can be repeated (used by the outbox, user is nil if it was deleted in the meantime)
+func (ts *TokenService) PublishCredentialsChanged(previousUsername string, user *model.User) error {
+	ts.closeAuthConnections(previousUsername)
+	if user == nil {
+		return nil
+	}
+	token := user.ApiToken
+	if !hasValidApiToken(user) {
+		var err error
+		if token, err = ts.generateApiToken(user); err != nil {
+			return err
+		}
+		user.ApiToken = token
+	}
+	ts.authBus.Publish(user.Username, newAuthUpdateMessage(user, token))
+	return nil
+}
+
+func hasValidApiToken(user *model.User) bool {
+	token := user.ApiToken
+	return token != nil && (token.Permanent || token.ExpiresAt.After(time.Now()))
+}
+
+// generateApiToken stores a new API token of a user without announcing it
+func (ts *TokenService) generateApiToken(user *model.User) (*model.Token, error) {
 	newToken, err := newRandomToken()
 	if err != nil {
-		return false, model.InternalServerError{Message: "Could not generate token", Err: err}
+		return nil, model.InternalServerError{Message: "Could not generate token", Err: err}
 	}
-	token = &model.Token{
+	token := &model.Token{
 		Token:     newToken,
 		ExpiresAt: time.Now().Add(config.ApiTokenExpirationTime),
 		UserID:    user.ID,
 	}
-	err = ts.tokenRepository.Save(token)
-	if err != nil {
-		return false, model.InternalServerError{Message: "Error storing token", Err: err}
+	if err := ts.tokenRepository.Save(token); err != nil {
+		return nil, model.InternalServerError{Message: "Error storing token", Err: err}
 	}
+	ts.rescheduleExpiry()
+	return token, nil
+}
 
-	// notify subscribers
-	ts.authConnectionsLock.Lock()
-	defer ts.authConnectionsLock.Unlock()
+// announceApiToken publishes the API token of a user to the subscribers and the webhooks
+func (ts *TokenService) announceApiToken(user *model.User, token *model.Token) error {
+	ts.authBus.Publish(user.Username, newAuthUpdateMessage(user, token))
+	return ts.dispatchApiToken(user, token)
+}
 
-	chans := ts.openAuthConnections[user.Username]
-	if chans == nil {
-		return true, nil
+// DispatchApiToken sends the current API token of a user to the webhooks (used by the outbox after
+// PublishCredentialsChanged, the user has no token if it was deleted again by a later change)
+func (ts *TokenService) DispatchApiToken(user *model.User) error {
+	if user.ApiToken == nil {
+		return nil
 	}
+	return ts.dispatchApiToken(user, user.ApiToken)
+}
+
+func (ts *TokenService) dispatchApiToken(user *model.User, token *model.Token) error {
+	return ts.webhookService.Dispatch(model.WebhookEventTokenRegenerated, model.WebhookTokenEventData{
+		UserID:    user.ID,
+		Username:  user.Username,
+		ExpiresAt: token.ExpiresAt,
+		Permanent: token.Permanent,
+	})
+}
+
+func newAuthUpdateMessage(user *model.User, token *model.Token) *model.AuthUpdateMessage {
 	var roles []string
 	for _, role := range user.Roles {
 		roles = append(roles, role.Name)
 	}
-	for _, c := range chans {
-		c <- &model.AuthUpdateMessage{
-			Username:  user.Username,
-			Token:     token.Token,
-			ExpiresAt: token.ExpiresAt,
-			Permanent: token.Permanent,
-			Roles:     roles,
-		}
+	return &model.AuthUpdateMessage{
+		Username:  user.Username,
+		Token:     token.Token,
+		ExpiresAt: token.ExpiresAt,
+		Permanent: token.Permanent,
+		Roles:     roles,
 	}
-	return true, nil
 }
 
-func (ts *TokenService) NotifyUsernameInvalid(user *model.User) {
-	token := user.ApiToken
-	if token != nil {
-		err := ts.tokenRepository.DeleteByID(user.ID)
-		if err != nil {
-			log.Println("NotifyUsernameInvalid: could not delete token with user_id", user.ID, ":", err)
-		}
-	}
-
-	// notify subscribers
-	ts.authConnectionsLock.Lock()
-	defer ts.authConnectionsLock.Unlock()
+// DeleteApiToken deletes the API token of a user within a transaction
+// the subscribers are notified by PublishCredentialsChanged after the commit
+func (ts *TokenService) DeleteApiToken(tx repository.Tx, userID uint) error {
+	tokenRepository := ts.tokenRepository.WithTx(tx)
+	return tokenRepository.DeleteByID(userID)
+}
 
-	chans := ts.openAuthConnections[user.Username]
-	if chans == nil {
-		return
-	}
-	for _, c := range chans {
-		close(c) // closed channel (and therefore closed connection) indicates invalidated token
-	}
+// closeAuthConnections closes all subscriptions of a user
+func (ts *TokenService) closeAuthConnections(username string) {
+	ts.authBus.CloseTopic(username) // closed subscription (and therefore closed connection) indicates invalidated token
 }
 
 // Notify that the roles of a user have changed
 // the given user must have its roles and api token field pre-loaded from the database before calling
 func (ts *TokenService) NotifyRoleUpdate(user *model.User) error {
-	ts.authConnectionsLock.Lock()
-	defer ts.authConnectionsLock.Unlock()
-
-	chans := ts.openAuthConnections[user.Username]
-	if chans == nil {
-		return nil
+	if err := ts.PublishRoleUpdate(user); err != nil {
+		return err
 	}
+	return ts.DispatchUserEvent(model.WebhookEventUserRolesUpdated, user, true)
+}
+
+// PublishRoleUpdate publishes the changed roles of a user to the subscribers (without the webhooks)
+// the given user must have its roles and api token field pre-loaded from the database before calling
+func (ts *TokenService) PublishRoleUpdate(user *model.User) error {
 	token := user.ApiToken
 	if token == nil {
-		return model.InternalServerError{Message: "API token was nil while notifying a role change for user " + user.Username}
-	}
-	var roles []string
-	for _, role := range user.Roles {
-		roles = append(roles, role.Name)
-	}
-	for _, c := range chans {
-		c <- &model.AuthUpdateMessage{
-			Username:  user.Username,
-			Token:     token.Token,
-			ExpiresAt: token.ExpiresAt,
-			Permanent: token.Permanent,
-			Roles:     roles,
+		if !ts.authBus.Broker().HasSubscribers(user.Username) {
+			return nil
 		}
+		return model.InternalServerError{Message: "API token was nil while notifying a role change for user " + user.Username}
 	}
+	// always published since the subscribers may be connected to another instance
+	ts.authBus.Publish(user.Username, newAuthUpdateMessage(user, token))
 	return nil
 }
 
 // Invalidates an existing API token of a user and re-generates a new one
-func (ts *TokenService) RegenerateApiToken(user *model.User) error {
+func (ts *TokenService) RegenerateApiToken(user *model.User, actor model.AuditActor) error {
 	user.ApiToken = nil // forces re-generation
 	generated, err := ts.GenerateApiTokenIfNotExists(user)
 	if err != nil {
@@ -180,88 +245,154 @@ func (ts *TokenService) RegenerateApiToken(user *model.User) error {
 	if !generated {
 		return model.InternalServerError{Message: "API Token could not be regenerated!"}
 	}
+	// the target id of token entries is the id of the user (tokens are identified by their user)
+	ts.auditService.Record(actor, newAuditEntry(model.AuditTokenRegenerated, model.AuditTargetToken, user.ID, user.Username))
 	return nil
 }
 
-func (ts *TokenService) SubscribeToChanges(username string) chan *model.AuthUpdateMessage {
-	c := make(chan *model.AuthUpdateMessage, 1)
-
-	ts.authConnectionsLock.Lock()
-	defer ts.authConnectionsLock.Unlock()
-
-	chans := ts.openAuthConnections[username]
-	if chans == nil {
-		ts.openAuthConnections[username] = []chan *model.AuthUpdateMessage{c}
-	} else {
-		ts.openAuthConnections[username] = append(ts.openAuthConnections[username], c)
+// AuthState returns the current auth state of a user that is sent to new subscribers
+// the given user must have its roles and api token field pre-loaded from the database before calling
+func (ts *TokenService) AuthState(user *model.User) (*model.AuthUpdateMessage, error) {
+	if user.ApiToken == nil {
+		return nil, model.NotFoundError{Message: "User " + user.Username + " has no API token"}
 	}
-	return c
+	return newAuthUpdateMessage(user, user.ApiToken), nil
 }
 
-func (ts *TokenService) UnsubscribeFromChanges(username string, c chan *model.AuthUpdateMessage) error {
-	if c == nil {
-		return errors.New("cannot unsubscribe from nil channel")
+// CheckCanWatch returns a ForbiddenError if the user is not allowed to watch the auth changes of username
+// Every user can watch its own changes, users with the deploy role can watch the changes of all users.
+func (ts *TokenService) CheckCanWatch(user *model.User, username string) error {
+	if username == user.Username || user.HasRole(config.DeployRoleName) {
+		return nil
 	}
+	return model.ForbiddenError{Message: "Not allowed to watch user " + username}
+}
+
+func (ts *TokenService) SubscribeToChanges(username string) *broker.Subscription[*model.AuthUpdateMessage] {
+	return ts.authBus.Broker().Subscribe(username)
+}
+
+// ResumeChanges subscribes to changes and replays the events after lastEventID
+// Returns false if the events could not be replayed (the current state must be sent instead)
+func (ts *TokenService) ResumeChanges(username string, lastEventID uint64) (*broker.Subscription[*model.AuthUpdateMessage], bool) {
+	return ts.authBus.Broker().SubscribeFrom(username, lastEventID)
+}
 
-	ts.authConnectionsLock.Lock()
-	defer ts.authConnectionsLock.Unlock()
+func (ts *TokenService) UnsubscribeFromChanges(sub *broker.Subscription[*model.AuthUpdateMessage]) {
+	ts.authBus.Broker().Unsubscribe(sub)
+}
+
+// SubscribeToAllChanges subscribes to the changes of all users (for multiplexed watch streams)
+// Invalidated tokens are delivered as events with Closed set instead of closing the subscription.
+func (ts *TokenService) SubscribeToAllChanges() *broker.Subscription[*model.AuthUpdateMessage] {
+	return ts.authBus.Broker().SubscribeAll(config.WatchQueueSize)
+}
 
-	chans, ok := ts.openAuthConnections[username]
-	if !ok {
-		return errors.New("no subscription for user " + username)
+// ResumeAllChanges subscribes to the changes of all users and replays the events after lastEventID
+// Returns false if the events could not be replayed (the current states must be sent instead)
+func (ts *TokenService) ResumeAllChanges(lastEventID uint64) (*broker.Subscription[*model.AuthUpdateMessage], bool) {
+	return ts.authBus.Broker().SubscribeAllFrom(lastEventID, config.WatchQueueSize)
+}
+
+// AuthStates returns the current auth states of the given users (all users if usernames is nil)
+// Disabled users and users without an API token are skipped.
+func (ts *TokenService) AuthStates(usernames []string) ([]*model.AuthUpdateMessage, error) {
+	users, err := ts.userRepository.FindAll()
+	if err != nil {
+		return nil, err
 	}
-	if !slices.Contains(chans, c) {
-		return errors.New("this channel has not subscribed to " + username)
+	tokens, err := ts.tokenRepository.FindAll()
+	if err != nil {
+		return nil, err
 	}
-	// delete entire map key if this is the only subscription
-	if len(chans) <= 1 {
-		delete(ts.openAuthConnections, username)
-		return nil
+	tokensByUserID := make(map[uint]*model.Token, len(tokens))
+	for i := range tokens {
+		tokensByUserID[tokens[i].UserID] = &tokens[i]
 	}
-	// delete channel from slice otherwise
-	ts.openAuthConnections[username] = deleteElement(ts.openAuthConnections[username], c)
-	return nil
+	var wanted map[string]bool
+	if usernames != nil {
+		wanted = make(map[string]bool, len(usernames))
+		for _, username := range usernames {
+			wanted[username] = true
+		}
+	}
+	states := []*model.AuthUpdateMessage{}
+	for i := range users {
+		user := &users[i]
+		token, ok := tokensByUserID[user.ID]
+		if !ok || user.IsDisabled() || (wanted != nil && !wanted[user.Username]) {
+			continue
+		}
+		states = append(states, newAuthUpdateMessage(user, token))
+	}
+	return states, nil
 }
 
-func deleteElement[S ~[]E, E comparable](s S, e E) S {
-	return slices.DeleteFunc(s, func(_e E) bool { return _e == e })
+// User creation and deletion events
+// The subscribers of the internal API (Publish...) and the webhooks (DispatchUserEvent) are notified separately,
+// so the outbox can repeat only the failed notification.
+
+// PublishUserCreated announces a created (or enabled) user to the subscribers
+func (ts *TokenService) PublishUserCreated(user *model.User) {
+	ts.notifyUserCreateDeleteEvent(&model.UserUpdateMessage{
+		Username: user.Username,
+		Removed:  false,
+	})
 }
 
-// User creation and deletion events
+// PublishUserRemoved closes all open auth connections of a deleted (or disabled) user and announces its removal
+// to the subscribers (the API token of a disabled user is kept)
+func (ts *TokenService) PublishUserRemoved(user *model.User, disabled bool) {
+	ts.closeAuthConnections(user.Username)
+	ts.notifyUserCreateDeleteEvent(&model.UserUpdateMessage{
+		Username: user.Username,
+		Removed:  true,
+		Disabled: disabled,
+	})
+}
 
-func (ts *TokenService) NotifyUserCreated(user *model.User) {
-	ts.userCreateDeleteEventConnectionsLock.Lock()
-	defer ts.userCreateDeleteEventConnectionsLock.Unlock()
-	for c := range ts.userCreateDeleteEventConnections {
-		c <- &model.UserUpdateMessage{
-			Username: user.Username,
-			Removed:  false,
+// DispatchUserEvent sends a user event to the webhooks, the roles are only included if withRoles is set
+func (ts *TokenService) DispatchUserEvent(eventType string, user *model.User, withRoles bool) error {
+	data := model.WebhookUserEventData{
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+	if withRoles {
+		data.Roles = []string{}
+		for _, role := range user.Roles {
+			data.Roles = append(data.Roles, role.Name)
 		}
 	}
+	return ts.webhookService.Dispatch(eventType, data)
 }
 
-func (ts *TokenService) NotifyUserDeleted(user *model.User) {
-	ts.userCreateDeleteEventConnectionsLock.Lock()
-	defer ts.userCreateDeleteEventConnectionsLock.Unlock()
-	for c := range ts.userCreateDeleteEventConnections {
-		c <- &model.UserUpdateMessage{
-			Username: user.Username,
-			Removed:  true,
-		}
-	}
+func (ts *TokenService) notifyUserCreateDeleteEvent(msg *model.UserUpdateMessage) {
+	ts.userCreateDeleteBus.Publish(userCreateDeleteTopic, msg)
 }
 
-func (ts *TokenService) SubscribeToUserCreateDeleteEvents() chan *model.UserUpdateMessage {
-	c := make(chan *model.UserUpdateMessage, 1)
-	ts.userCreateDeleteEventConnectionsLock.Lock()
-	defer ts.userCreateDeleteEventConnectionsLock.Unlock()
+func (ts *TokenService) SubscribeToUserCreateDeleteEvents() *broker.Subscription[*model.UserUpdateMessage] {
+	return ts.userCreateDeleteBus.Broker().Subscribe(userCreateDeleteTopic)
+}
+
+// ResumeUserCreateDeleteEvents subscribes to user creation and deletion events and replays the events after lastEventID
+// Returns false if the events could not be replayed (the list of all users must be sent instead)
+func (ts *TokenService) ResumeUserCreateDeleteEvents(lastEventID uint64) (*broker.Subscription[*model.UserUpdateMessage], bool) {
+	return ts.userCreateDeleteBus.Broker().SubscribeFrom(userCreateDeleteTopic, lastEventID)
+}
 
-	ts.userCreateDeleteEventConnections[c] = struct{}{}
-	return c
+func (ts *TokenService) UnsubscribeFromUserCreateDeleteEvents(sub *broker.Subscription[*model.UserUpdateMessage]) {
+	ts.userCreateDeleteBus.Broker().Unsubscribe(sub)
 }
 
-func (ts *TokenService) UnsubscribeFromUserCreateDeleteEvents(c chan *model.UserUpdateMessage) {
-	ts.userCreateDeleteEventConnectionsLock.Lock()
-	defer ts.userCreateDeleteEventConnectionsLock.Unlock()
-	delete(ts.userCreateDeleteEventConnections, c)
+// @Description Metrics about the queues of the subscribers of the internal API
+type EventStats struct {
+	Auth             broker.Stats `json:"auth"`               // subscribers of /internal/authenticate and /internal/watch
+	UserCreateDelete broker.Stats `json:"user_create_delete"` // subscribers of /internal/users
+} //@name EventStats
+
+func (ts *TokenService) EventStats() EventStats {
+	return EventStats{
+		Auth:             ts.authBus.Broker().Stats(),
+		UserCreateDelete: ts.userCreateDeleteBus.Broker().Stats(),
+	}
 }
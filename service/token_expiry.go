@@ -0,0 +1,124 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+)
+
+const (
+	expirySchedulerMaxSleep = time.Minute // picks up tokens changed by other instances
+	expirySchedulerMinSleep = time.Second // avoids a busy loop if due tokens cannot be claimed (e.g. database errors)
+)
+
+// expiryScheduler announces expiring and expired API tokens to the subscribers at the time they are due.
+// Every token is announced by only one instance (claimed in the database).
+func (ts *TokenService) expiryScheduler() {
+	for {
+		ts.announceDueExpiries()
+		timer := time.NewTimer(max(time.Until(ts.nextExpiryAt()), expirySchedulerMinSleep))
+		select {
+		case <-timer.C:
+		case <-ts.expiryWakeup:
+			timer.Stop()
+		}
+	}
+}
+
+// rescheduleExpiry wakes the expiry scheduler after a token was created or changed
+func (ts *TokenService) rescheduleExpiry() {
+	select {
+	case ts.expiryWakeup <- struct{}{}:
+	default: // the scheduler is already signaled
+	}
+}
+
+// nextExpiryAt returns when the next warning or expiry is due
+func (ts *TokenService) nextExpiryAt() time.Time {
+	next := time.Now().Add(expirySchedulerMaxSleep)
+	if config.ApiTokenExpiryWarning > 0 {
+		token, err := ts.tokenRepository.FindNextExpiryWarning()
+		if err == nil && token.ExpiresAt.Add(-config.ApiTokenExpiryWarning).Before(next) {
+			next = token.ExpiresAt.Add(-config.ApiTokenExpiryWarning)
+		} else if _, notFound := err.(model.NotFoundError); err != nil && !notFound {
+			log.Println("ExpiryScheduler: could not query the next expiring token:", err)
+		}
+	}
+	token, err := ts.tokenRepository.FindNextExpiry()
+	if err == nil && token.ExpiresAt.Before(next) {
+		next = token.ExpiresAt
+	} else if _, notFound := err.(model.NotFoundError); err != nil && !notFound {
+		log.Println("ExpiryScheduler: could not query the next expired token:", err)
+	}
+	return next
+}
+
+func (ts *TokenService) announceDueExpiries() {
+	now := time.Now()
+	// expired tokens first, so they are not warned about anymore
+	expired, err := ts.tokenRepository.FindDueForExpiry(now)
+	if err != nil {
+		log.Println("ExpiryScheduler: could not query expired tokens:", err)
+		return
+	}
+	for i := range expired {
+		token := &expired[i]
+		claimed, err := ts.tokenRepository.ClaimExpiry(token)
+		if err != nil {
+			log.Println("ExpiryScheduler: could not claim expired token of user", token.UserID, ":", err)
+			return
+		}
+		if claimed {
+			ts.announceExpiry(token, model.AuthExpired, model.WebhookEventTokenExpired)
+		}
+	}
+	if config.ApiTokenExpiryWarning <= 0 {
+		return
+	}
+	expiring, err := ts.tokenRepository.FindDueForExpiryWarning(now.Add(config.ApiTokenExpiryWarning))
+	if err != nil {
+		log.Println("ExpiryScheduler: could not query expiring tokens:", err)
+		return
+	}
+	for i := range expiring {
+		token := &expiring[i]
+		claimed, err := ts.tokenRepository.ClaimExpiryWarning(token)
+		if err != nil {
+			log.Println("ExpiryScheduler: could not claim expiring token of user", token.UserID, ":", err)
+			return
+		}
+		if claimed {
+			ts.announceExpiry(token, model.AuthExpiring, model.WebhookEventTokenExpiring)
+		}
+	}
+}
+
+// announceExpiry publishes an expiry event of a token to the subscribers of its user and the webhooks
+// The subscriptions of the user are closed after an expired event.
+func (ts *TokenService) announceExpiry(token *model.Token, expiryEvent, webhookEvent string) {
+	user, err := ts.userRepository.FindByID(token.UserID)
+	if err != nil {
+		log.Println("ExpiryScheduler: could not load user", token.UserID, "of", expiryEvent, "token:", err)
+		return
+	}
+	if user.IsDisabled() { // the subscriptions were closed when the user was disabled
+		return
+	}
+	msg := newAuthUpdateMessage(user, token)
+	msg.ExpiryEvent = expiryEvent
+	ts.authBus.Publish(user.Username, msg)
+	if expiryEvent == model.AuthExpired {
+		ts.closeAuthConnections(user.Username)
+	}
+	err = ts.webhookService.Dispatch(webhookEvent, model.WebhookTokenEventData{
+		UserID:    user.ID,
+		Username:  user.Username,
+		ExpiresAt: token.ExpiresAt,
+		Permanent: token.Permanent,
+	})
+	if err != nil {
+		log.Println("ExpiryScheduler: could not dispatch", webhookEvent, "of", user.Username, ":", err)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"fmt"
 	"slices"
 	"time"
 
@@ -15,14 +16,29 @@ type UserService struct {
 	userRepository            repository.UserRepository
 	registrationKeyRepository repository.RegistrationKeyRepository
 	roleRepository            repository.RoleRepository
+	passwordHistoryRepository repository.PasswordHistoryRepository
 	tokenService              TokenService
+	passwordPolicyService     PasswordPolicyService
+	outboxService             OutboxService
+	auditService              AuditService
+
+	disableExpiryWakeup chan struct{} // signals the disable expiry scheduler that the next until-date may have changed
 }
 
 func NewUserService(userRepo repository.UserRepository,
 	regKeyRepo repository.RegistrationKeyRepository,
 	roleRepo repository.RoleRepository,
-	tokenService TokenService) UserService {
-	return UserService{userRepo, regKeyRepo, roleRepo, tokenService}
+	passwordHistoryRepo repository.PasswordHistoryRepository,
+	tokenService TokenService,
+	passwordPolicyService PasswordPolicyService,
+	outboxService OutboxService,
+	auditService AuditService) UserService {
+	return UserService{userRepo, regKeyRepo, roleRepo, passwordHistoryRepo, tokenService, passwordPolicyService, outboxService, auditService, make(chan struct{}, 1)}
+}
+
+// Start starts the scheduler that enables users whose disabled-until date passed (only in the server)
+func (s *UserService) Start() {
+	go s.disableExpiryScheduler()
 }
 
 func (s *UserService) GetAll() ([]model.User, error) {
@@ -37,7 +53,7 @@ func (s *UserService) GetByName(name string) (*model.User, error) {
 	return s.userRepository.FindByName(name)
 }
 
-func (s *UserService) Login(username, password string, session *session.Session) (*model.User, error) {
+func (s *UserService) Login(username, password string, session *session.Session, actor model.AuditActor) (*model.User, error) {
 	uid, uidOk := session.Get("userid").(uint)
 	sessionUsername, usernameOk := session.Get("username").(string)
 	sessionPassword, passwordOk := session.Get("password").(string)
@@ -45,11 +61,11 @@ func (s *UserService) Login(username, password string, session *session.Session)
 	if uidOk && usernameOk && passwordOk { // already logged in
 		user, err := s.userRepository.FindByID(uid)
 		if err == nil { // user exists
-			if sessionUsername == user.Username && sessionPassword == user.Password { // username and password weren't changed
+			if sessionUsername == user.Username && sessionPassword == user.Password && !user.IsDisabled() { // username and password weren't changed
 				return user, nil // user already logged in and still authenticated
 			}
 		}
-		// user was deleted or changed username or password
+		// user was deleted, disabled or changed username or password
 		if err := session.Destroy(); err != nil {
 			return nil, model.InternalServerError{Message: "Could not destroy session", Err: err}
 		}
@@ -59,13 +75,27 @@ func (s *UserService) Login(username, password string, session *session.Session)
 	user, err := s.userRepository.FindByName(username)
 	// don't leak if username exists -> both cases return the same response
 	if err != nil {
+		s.auditService.Record(actor, model.AuditEntry{Action: model.AuditLoginFailed, TargetType: model.AuditTargetUser, TargetName: username, Details: "unknown user"})
 		return nil, model.UnauthorizedError{Message: "Invalid credentials", Err: nil}
 	}
 	if !crypto.PasswordMatchesHash(password, user.Password) {
+		s.recordLoginFailed(actor, user, "wrong password")
 		return nil, model.UnauthorizedError{Message: "Invalid credentials", Err: nil}
 	}
+	actor.UserID = &user.ID // authenticated from here on
+	actor.Username = user.Username
+	if user.IsDisabled() {
+		s.recordLoginFailed(actor, user, "user is disabled")
+		return nil, disabledError(user)
+	}
+	if user.Disabled { // disabled until a date that has passed (not enabled by the scheduler yet)
+		if err := s.enableExpired(user); err != nil {
+			return nil, err
+		}
+	}
 	if config.RestrictLoginToAdmins {
 		if !slices.ContainsFunc(user.Roles, func(role model.Role) bool { return role.Name == config.AdminRoleName }) {
+			s.recordLoginFailed(actor, user, "login is restricted to admins")
 			return nil, model.ForbiddenError{Message: "Login is currently restricted to admins only"}
 		}
 	}
@@ -73,6 +103,7 @@ func (s *UserService) Login(username, password string, session *session.Session)
 	session.Set("userid", user.ID)
 	session.Set("username", user.Username)
 	session.Set("password", user.Password)
+	session.Set("authenticated_at", time.Now().Unix())
 	if err = session.Save(); err != nil {
 		return nil, model.InternalServerError{Message: "Could not save session", Err: err}
 	}
@@ -82,6 +113,7 @@ func (s *UserService) Login(username, password string, session *session.Session)
 	if err = s.userRepository.Save(user); err != nil {
 		return nil, model.InternalServerError{Message: "Could not save user", Err: err}
 	}
+	s.auditService.Record(actor, newAuditEntry(model.AuditLoginSucceeded, model.AuditTargetUser, user.ID, user.Username))
 	tokenWasGenerated, err := s.tokenService.GenerateApiTokenIfNotExists(user)
 	if err != nil {
 		return nil, err
@@ -96,6 +128,51 @@ func (s *UserService) Login(username, password string, session *session.Session)
 	return user, nil
 }
 
+func (s *UserService) recordLoginFailed(actor model.AuditActor, user *model.User, reason string) {
+	entry := newAuditEntry(model.AuditLoginFailed, model.AuditTargetUser, user.ID, user.Username)
+	entry.Details = reason
+	s.auditService.Record(actor, entry)
+}
+
+// Reauthenticate confirms the password of the logged in user and renews the time of authentication
+// of the session ("sudo mode") which is required for sensitive actions on other users
+func (s *UserService) Reauthenticate(user *model.User, password string, session *session.Session) error {
+	if !crypto.PasswordMatchesHash(password, user.Password) {
+		return model.UnauthorizedError{Message: "Invalid credentials"}
+	}
+	session.Set("authenticated_at", time.Now().Unix())
+	if err := session.Save(); err != nil {
+		return model.InternalServerError{Message: "Could not save session", Err: err}
+	}
+	return nil
+}
+
+// VerifySensitiveAction checks if the actor may change or delete the target user:
+// users acting on their own account must confirm their current password,
+// admins acting on other users must have (re-)authenticated recently
+func (s *UserService) VerifySensitiveAction(actor *model.User, targetID uint, currentPassword string, session *session.Session) error {
+	if actor.ID == targetID {
+		if currentPassword == "" {
+			return model.BadRequestError{Message: "Current password required"}
+		}
+		if !crypto.PasswordMatchesHash(currentPassword, actor.Password) {
+			return model.ForbiddenError{Message: "Current password is wrong"}
+		}
+		return nil
+	}
+	return s.VerifyRecentAuthentication(session)
+}
+
+// VerifyRecentAuthentication checks that the session was (re-)authenticated within RECENT_AUTHENTICATION_MAX_AGE
+// (e.g. before changing role memberships or exporting all data)
+func (s *UserService) VerifyRecentAuthentication(session *session.Session) error {
+	authenticatedAt, ok := session.Get("authenticated_at").(int64)
+	if !ok || time.Since(time.Unix(authenticatedAt, 0)) > config.RecentAuthenticationMaxAge {
+		return model.ForbiddenError{Message: "Recent authentication required, please re-authenticate"}
+	}
+	return nil
+}
+
 func (s *UserService) Logout(session *session.Session) error {
 	if err := session.Destroy(); err != nil {
 		return model.InternalServerError{Message: "Could not destroy session", Err: err}
@@ -103,17 +180,19 @@ func (s *UserService) Logout(session *session.Session) error {
 	return nil
 }
 
-func validateUser(username, password, email string) error {
+func (s *UserService) validateUser(username, password, email string) error {
 	if !isValidName(username) {
 		return model.BadRequestError{Message: "Invalid name"}
 	}
-	if !isValidPassword(password) {
-		return model.BadRequestError{Message: "Password does not meet criteria"}
-	}
 	if !isValidEmail(email) {
 		return model.BadRequestError{Message: "Invalid email"}
 	}
-	return nil
+	return s.passwordPolicyService.Validate(password, username, email)
+}
+
+// Checks a password against the password policy without changing anything
+func (s *UserService) CheckPassword(password, username, email string) model.PasswordCheckResult {
+	return s.passwordPolicyService.Check(password, username, email)
 }
 
 func (s *UserService) checkIfUserExists(username string) error {
@@ -127,8 +206,8 @@ func (s *UserService) checkIfUserExists(username string) error {
 	return nil
 }
 
-func (s *UserService) Register(username, password, email, registrationKey string, session *session.Session) (*model.User, error) {
-	if session != nil { // session is only nil when Register is called from setupTestDatabase
+func (s *UserService) Register(username, password, email, registrationKey string, session *session.Session, actor model.AuditActor) (*model.User, error) {
+	if session != nil { // session is only nil when Register is called to apply a seed
 		if _, ok := session.Get("userid").(uint); ok {
 			return nil, model.BadRequestError{Message: "You cannot register when you are logged in!"}
 		}
@@ -146,7 +225,7 @@ func (s *UserService) Register(username, password, email, registrationKey string
 		return nil, model.UnauthorizedError{Message: "registration key expired"}
 	}
 
-	if err := validateUser(username, password, email); err != nil {
+	if err := s.validateUser(username, password, email); err != nil {
 		return nil, err
 	}
 	if err := s.checkIfUserExists(username); err != nil {
@@ -164,31 +243,39 @@ func (s *UserService) Register(username, password, email, registrationKey string
 		LastLogin:       &now,
 		RegistrationKey: key,
 	}
-	if err := s.userRepository.Save(&user); err != nil {
+	if actor.UserID == nil { // registering users are not logged in
+		actor.Username = username
+	}
+	if err := s.saveAndRecord(&user, model.OutboxUserCreated, actor, model.AuditUserCreated, auditChanges(nil, &user)); err != nil {
 		return nil, err
 	}
 	savedUser, err := s.userRepository.FindByName(user.Username)
 	if err != nil {
 		return nil, err
 	}
-	if session != nil { // session is only nil when Register is called from setupTestDatabase
+	if session != nil { // session is only nil when Register is called to apply a seed
 		session.Set("userid", savedUser.ID)
 		session.Set("username", savedUser.Username)
 		session.Set("password", savedUser.Password)
+		session.Set("authenticated_at", time.Now().Unix())
 		if err := session.Save(); err != nil {
 			return nil, model.InternalServerError{Message: "could not save session", Err: err}
 		}
 	}
 
-	s.tokenService.NotifyUserCreated(savedUser)
 	if _, err := s.tokenService.GenerateApiTokenIfNotExists(savedUser); err != nil {
 		return nil, err
 	}
 	return savedUser, nil
 }
 
-func (s *UserService) Create(username, password, email string) error {
-	if err := validateUser(username, password, email); err != nil {
+func (s *UserService) Create(username, password, email string, actor model.AuditActor) error {
+	return s.CreateWithRole(username, password, email, nil, actor)
+}
+
+// CreateWithRole creates a user and adds it to the role (if not nil) in the same transaction
+func (s *UserService) CreateWithRole(username, password, email string, role *model.Role, actor model.AuditActor) error {
+	if err := s.validateUser(username, password, email); err != nil {
 		return err
 	}
 	if err := s.checkIfUserExists(username); err != nil {
@@ -204,15 +291,33 @@ func (s *UserService) Create(username, password, email string) error {
 		Email:     email,
 		LastLogin: nil,
 	}
-
-	if err = s.userRepository.Save(&user); err != nil {
-		return err
-	}
-	s.tokenService.NotifyUserCreated(&user)
-	return nil
+	changes := auditChanges(nil, &user)
+	return s.outboxService.Transaction(func(tx repository.Tx) error {
+		userRepository := s.userRepository.WithTx(tx)
+		if err := userRepository.Save(&user); err != nil {
+			return err
+		}
+		if err := s.recordUserAudit(tx, actor, model.AuditUserCreated, &user, changes); err != nil {
+			return err
+		}
+		if err := s.outboxService.Record(tx, model.OutboxUserCreated, &user); err != nil {
+			return err
+		}
+		if role == nil {
+			return nil
+		}
+		roleRepository := s.roleRepository.WithTx(tx)
+		if err := roleRepository.AddUserToRole(role, &user); err != nil {
+			return err
+		}
+		if err := s.auditService.RecordTx(tx, actor, newRoleAssignmentEntry(model.AuditRoleAssigned, &user, role)); err != nil {
+			return err
+		}
+		return s.outboxService.Record(tx, model.OutboxUserRolesChanged, &user)
+	})
 }
 
-func (s *UserService) Update(id uint, username, password, email string) error {
+func (s *UserService) Update(id uint, username, password, email string, actor model.AuditActor) error {
 	user, err := s.userRepository.FindByID(id)
 	if err != nil {
 		return err
@@ -220,12 +325,14 @@ func (s *UserService) Update(id uint, username, password, email string) error {
 	if !isValidName(username) {
 		return model.BadRequestError{Message: "Invalid name"}
 	}
-	if password != "" && !isValidPassword(password) {
-		return model.BadRequestError{Message: "Password does not meet criteria"}
-	}
 	if !isValidEmail(email) {
 		return model.BadRequestError{Message: "Invalid email"}
 	}
+	if password != "" {
+		if err := s.passwordPolicyService.Validate(password, username, email); err != nil {
+			return err
+		}
+	}
 	regenerateApiTokenAfterUpdate := false
 	previousUser := *user
 	if username != user.Username {
@@ -234,46 +341,237 @@ func (s *UserService) Update(id uint, username, password, email string) error {
 		user.Username = username
 		// TODO: maybe keep list of previous names?
 	}
+	passwordChanged := false
+	previousPasswordHash := user.Password
 	if password != "" && !crypto.PasswordMatchesHash(password, user.Password) {
+		if err := s.checkPasswordReuse(user.ID, password); err != nil {
+			return err
+		}
 		hashedPassword, err := crypto.HashPassword(password)
 		if err != nil {
 			return model.InternalServerError{Message: "could not hash password", Err: err}
 		}
 		regenerateApiTokenAfterUpdate = true
+		passwordChanged = true
 		user.Password = string(hashedPassword)
 	}
 	user.Email = email
-	if err = s.userRepository.Save(user); err != nil {
-		return err
+	changes := auditChanges(&previousUser, user)
+	if passwordChanged {
+		changes["password"] = model.AuditChange{Before: auditRedacted, After: auditRedacted}
+	}
+	err = s.outboxService.Transaction(func(tx repository.Tx) error {
+		userRepository := s.userRepository.WithTx(tx)
+		if err := userRepository.Save(user); err != nil {
+			return err
+		}
+		if err := s.recordUserAudit(tx, actor, model.AuditUserUpdated, &previousUser, changes); err != nil {
+			return err
+		}
+		if passwordChanged {
+			if err := s.addToPasswordHistory(tx, user.ID, previousPasswordHash); err != nil {
+				return err
+			}
+		}
+		if !regenerateApiTokenAfterUpdate {
+			return nil
+		}
+		// the token is regenerated and the connections using the previous credentials are closed by the outbox
+		if err := s.tokenService.DeleteApiToken(tx, user.ID); err != nil {
+			return err
+		}
+		return s.outboxService.Record(tx, model.OutboxCredentialsChanged, &previousUser)
+	})
+	// NOTE: We do not need to destroy the deleted user's sessions
+	// since the session middleware checks if the username or password was changed.
+	// The session is destroyed when it is used after the username or password was changed.
+	return err
+}
+
+// checkPasswordReuse returns an error if the password matches one of the user's previous passwords
+func (s *UserService) checkPasswordReuse(userID uint, password string) error {
+	if config.PasswordHistoryLength <= 0 {
+		return nil
+	}
+	previousPasswords, err := s.passwordHistoryRepository.FindLatestByUserID(userID, config.PasswordHistoryLength)
+	if err != nil {
+		return model.InternalServerError{Message: "could not get password history", Err: err}
+	}
+	for _, previous := range previousPasswords {
+		if crypto.PasswordMatchesHash(password, previous.Password) {
+			return model.BadRequestError{Message: fmt.Sprintf("Password must not be one of your last %d passwords", config.PasswordHistoryLength)}
+		}
+	}
+	return nil
+}
+
+// addToPasswordHistory stores a replaced password hash and removes entries exceeding the history length
+// within the transaction of the password change
+func (s *UserService) addToPasswordHistory(tx repository.Tx, userID uint, passwordHash string) error {
+	if config.PasswordHistoryLength <= 0 {
+		return nil
+	}
+	passwordHistoryRepository := s.passwordHistoryRepository.WithTx(tx)
+	if err := passwordHistoryRepository.Save(&model.PasswordHistoryEntry{UserID: userID, Password: passwordHash}); err != nil {
+		return model.InternalServerError{Message: "could not save password history", Err: err}
 	}
-	if regenerateApiTokenAfterUpdate {
-		s.tokenService.NotifyUsernameInvalid(&previousUser)
-		_, _ = s.tokenService.GenerateApiTokenIfNotExists(user)
-		// NOTE: We do not need to destroy the deleted user's sessions
-		// since the session middleware checks if the username or password was changed.
-		// The session is destroyed when it is used after the username or password was changed.
+	if err := passwordHistoryRepository.DeleteAllButLatestByUserID(userID, config.PasswordHistoryLength); err != nil {
+		return model.InternalServerError{Message: "could not prune password history", Err: err}
 	}
 	return nil
 }
 
-func (s *UserService) DeleteByID(id uint) error {
+func (s *UserService) DeleteByID(id uint, actor model.AuditActor) error {
 	// invalidate token
 	user, err := s.userRepository.FindByID(id)
 	if err != nil {
 		return model.NotFoundError{Err: err}
 	}
 
-	if err = s.userRepository.DeleteByID(id); err != nil {
+	err = s.outboxService.Transaction(func(tx repository.Tx) error {
+		userRepository := s.userRepository.WithTx(tx)
+		if err := userRepository.DeleteByID(id); err != nil {
+			return err
+		}
+		if err := s.recordUserAudit(tx, actor, model.AuditUserDeleted, user, auditChanges(user, nil)); err != nil {
+			return err
+		}
+		return s.outboxService.Record(tx, model.OutboxUserDeleted, user)
+	})
+	if err != nil {
 		return err
 	}
-	s.tokenService.NotifyUsernameInvalid(user)
-	s.tokenService.NotifyUserDeleted(user)
 	// NOTE: We do not need to destroy the deleted user's sessions
 	// since the session middleware checks if the user exists.
 	// The session is destroyed when it is used after the user was deleted.
 	return nil
 }
 
+// Disable blocks a user from logging in and using the API token without deleting any data
+// until is optional, the user is disabled indefinitely if it is nil
+func (s *UserService) Disable(id uint, reason string, until *time.Time, actor model.AuditActor) error {
+	if actor.UserID != nil && id == *actor.UserID {
+		return model.ConflictError{Message: "You cannot disable your own account"}
+	}
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if until != nil && until.Before(time.Now()) {
+		return model.BadRequestError{Message: "Disabled until must be in the future"}
+	}
+	wasDisabled := user.IsDisabled()
+	previousUser := *user
+	user.Disabled = true
+	user.DisabledReason = reason
+	user.DisabledByID = actor.UserID
+	user.DisabledUntil = until
+	changes := auditChanges(&previousUser, user)
+	if wasDisabled { // only the reason or until-date changed
+		err = s.outboxService.Transaction(func(tx repository.Tx) error {
+			userRepository := s.userRepository.WithTx(tx)
+			if err := userRepository.Save(user); err != nil {
+				return err
+			}
+			return s.recordUserAudit(tx, actor, model.AuditUserDisabled, user, changes)
+		})
+	} else {
+		err = s.saveAndRecord(user, model.OutboxUserDisabled, actor, model.AuditUserDisabled, changes)
+	}
+	if err != nil {
+		return err
+	}
+	s.rescheduleDisableExpiry()
+	// NOTE: We do not need to destroy the disabled user's sessions
+	// since the session middleware checks if the user is disabled.
+	return nil
+}
+
+// Enable re-enables a disabled user
+func (s *UserService) Enable(id uint, actor model.AuditActor) error {
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if !user.Disabled {
+		return nil
+	}
+	return s.enable(user, actor)
+}
+
+// enable clears the disabled state and announces the user again
+func (s *UserService) enable(user *model.User, actor model.AuditActor) error {
+	previousUser := *user
+	clearDisabled(user)
+	return s.saveAndRecord(user, model.OutboxUserEnabled, actor, model.AuditUserEnabled, auditChanges(&previousUser, user))
+}
+
+func clearDisabled(user *model.User) {
+	user.Disabled = false
+	user.DisabledReason = ""
+	user.DisabledByID = nil
+	user.DisabledUntil = nil
+}
+
+// RevokeApiToken deletes the API token of a user and records an outbox event that closes the connections
+// using it and announces a new API token when it is dispatched (e.g. by the running server for the command line interface)
+func (s *UserService) RevokeApiToken(id uint, actor model.AuditActor) error {
+	user, err := s.userRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.outboxService.Transaction(func(tx repository.Tx) error {
+		if err := s.tokenService.DeleteApiToken(tx, user.ID); err != nil {
+			return err
+		}
+		// the target id of token entries is the id of the user (tokens are identified by their user)
+		entry := newAuditEntry(model.AuditTokenRegenerated, model.AuditTargetToken, user.ID, user.Username)
+		if err := s.auditService.RecordTx(tx, actor, entry); err != nil {
+			return err
+		}
+		return s.outboxService.Record(tx, model.OutboxCredentialsChanged, user)
+	})
+}
+
+// saveAndRecord saves a user and records an outbox event and an audit entry in the same transaction
+func (s *UserService) saveAndRecord(user *model.User, eventType string, actor model.AuditActor, action string, changes map[string]model.AuditChange) error {
+	return s.outboxService.Transaction(func(tx repository.Tx) error {
+		userRepository := s.userRepository.WithTx(tx)
+		if err := userRepository.Save(user); err != nil {
+			return err
+		}
+		if err := s.recordUserAudit(tx, actor, action, user, changes); err != nil {
+			return err
+		}
+		return s.outboxService.Record(tx, eventType, user)
+	})
+}
+
+func (s *UserService) recordUserAudit(tx repository.Tx, actor model.AuditActor, action string, user *model.User, changes map[string]model.AuditChange) error {
+	entry := newAuditEntry(action, model.AuditTargetUser, user.ID, user.Username)
+	entry.Changes = changes
+	return s.auditService.RecordTx(tx, actor, entry)
+}
+
+func disabledError(user *model.User) error {
+	message := "Account is disabled"
+	if user.DisabledUntil != nil {
+		message += " until " + user.DisabledUntil.Format(time.RFC3339)
+	}
+	if user.DisabledReason != "" {
+		message += ": " + user.DisabledReason
+	}
+	return model.ForbiddenError{Message: message}
+}
+
+// CheckNotDisabled returns a ForbiddenError if the user is disabled
+func (s *UserService) CheckNotDisabled(user *model.User) error {
+	if user.IsDisabled() {
+		return disabledError(user)
+	}
+	return nil
+}
+
 func (s *UserService) GetRolesOfUser(userid uint) ([]model.Role, error) {
 	user, err := s.userRepository.FindByID(userid)
 	if err != nil {
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+)
+
+// disableExpiryScheduler enables the users whose until-date has passed at the time it is due.
+// Every user is enabled by only one instance (claimed in the database).
+func (s *UserService) disableExpiryScheduler() {
+	for {
+		s.enableDueUsers()
+		timer := time.NewTimer(max(time.Until(s.nextDisableExpiryAt()), expirySchedulerMinSleep))
+		select {
+		case <-timer.C:
+		case <-s.disableExpiryWakeup:
+			timer.Stop()
+		}
+	}
+}
+
+// rescheduleDisableExpiry wakes the disable expiry scheduler after a user was disabled
+func (s *UserService) rescheduleDisableExpiry() {
+	select {
+	case s.disableExpiryWakeup <- struct{}{}:
+	default: // the scheduler is already signaled
+	}
+}
+
+// nextDisableExpiryAt returns when the next until-date passes
+func (s *UserService) nextDisableExpiryAt() time.Time {
+	next := time.Now().Add(expirySchedulerMaxSleep)
+	user, err := s.userRepository.FindNextDisableExpiry()
+	if err == nil && user.DisabledUntil.Before(next) {
+		next = *user.DisabledUntil
+	} else if _, notFound := err.(model.NotFoundError); err != nil && !notFound {
+		log.Println("DisableExpiryScheduler: could not query the next disabled user:", err)
+	}
+	return next
+}
+
+func (s *UserService) enableDueUsers() {
+	users, err := s.userRepository.FindDueForDisableExpiry(time.Now())
+	if err != nil {
+		log.Println("DisableExpiryScheduler: could not query disabled users:", err)
+		return
+	}
+	for i := range users {
+		if err := s.enableExpired(&users[i]); err != nil {
+			log.Println("DisableExpiryScheduler: could not enable user", users[i].Username, ":", err)
+			return
+		}
+	}
+}
+
+// enableExpired enables a user whose until-date has passed on behalf of the system
+// and announces it like an enabled user, unless another instance already did
+func (s *UserService) enableExpired(user *model.User) error {
+	return s.outboxService.Transaction(func(tx repository.Tx) error {
+		claimed, err := s.userRepository.WithTx(tx).ClaimDisableExpiry(user)
+		if err != nil || !claimed {
+			return err
+		}
+		previousUser := *user
+		clearDisabled(user)
+		if err := s.recordUserAudit(tx, model.SystemActor, model.AuditUserEnabled, user, auditChanges(&previousUser, user)); err != nil {
+			return err
+		}
+		return s.outboxService.Record(tx, model.OutboxUserEnabled, user)
+	})
+}
@@ -16,6 +16,7 @@ func isValidEmail(str string) bool {
 	return str == "" || govalidator.IsEmail(str)
 }
 
+// basic length check, the full password policy is implemented in PasswordPolicyService
 func isValidPassword(str string) bool {
 	if strings.TrimSpace(str) == "" {
 		return false
@@ -26,7 +27,6 @@ func isValidPassword(str string) bool {
 	if len(str) > crypto.MaxPasswordLength {
 		return false
 	}
-	// TODO: more password criteria
 	return true
 }
 
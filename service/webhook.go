@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const (
+	webhookSecretLength    = 32
+	webhookMinSecretLength = 16
+	webhookMaxErrorLength  = 1000
+	webhookBatchSize       = 50
+)
+
+// WebhookService manages webhook subscriptions and delivers events to them.
+// Every event is stored as one delivery per subscribed webhook before it is sent,
+// failed deliveries are retried with exponential backoff and moved to the dead-letter list
+// after config.WebhookMaxAttempts attempts.
+type WebhookService struct {
+	webhookRepository         repository.WebhookRepository
+	webhookDeliveryRepository repository.WebhookDeliveryRepository
+	auditService              AuditService
+	client                    *http.Client
+	wakeup                    chan struct{} // signals the worker that new deliveries are due
+}
+
+func NewWebhookService(webhookRepository repository.WebhookRepository,
+	webhookDeliveryRepository repository.WebhookDeliveryRepository,
+	auditService AuditService,
+) WebhookService {
+	return WebhookService{
+		webhookRepository,
+		webhookDeliveryRepository,
+		auditService,
+		&http.Client{Timeout: config.WebhookTimeout},
+		make(chan struct{}, 1),
+	}
+}
+
+// Start starts the delivery worker and the garbage collector of deliveries (only in the server)
+func (s *WebhookService) Start() {
+	go s.deliveryWorker()
+	go s.deliveryGarbageCollector()
+}
+
+func (s *WebhookService) GetAll() ([]model.Webhook, error) {
+	return s.webhookRepository.FindAll()
+}
+
+func (s *WebhookService) GetByID(id uint) (*model.Webhook, error) {
+	return s.webhookRepository.FindByID(id)
+}
+
+// Create creates a webhook and returns it together with its secret
+// a random secret is generated if secret is empty
+func (s *WebhookService) Create(url, description string, events []string, secret string, enabled bool, actor model.AuditActor) (*model.Webhook, string, error) {
+	if secret == "" {
+		var err error
+		secret, err = crypto.NewRandomAlphaNumString(webhookSecretLength)
+		if err != nil {
+			return nil, "", model.InternalServerError{Message: "Could not generate webhook secret", Err: err}
+		}
+	}
+	webhook := model.Webhook{
+		URL:         url,
+		Description: description,
+		Events:      events,
+		Secret:      secret,
+		Enabled:     enabled,
+	}
+	if err := validateWebhook(&webhook); err != nil {
+		return nil, "", err
+	}
+	if err := s.saveAndAudit(&webhook, actor, model.AuditWebhookCreated, auditChanges(nil, &webhook)); err != nil {
+		return nil, "", err
+	}
+	return &webhook, secret, nil
+}
+
+// Update changes a webhook, the secret is only replaced if it is not empty
+func (s *WebhookService) Update(id uint, url, description string, events []string, secret string, enabled bool, actor model.AuditActor) error {
+	webhook, err := s.webhookRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	previousWebhook := *webhook
+	webhook.URL = url
+	webhook.Description = description
+	webhook.Events = events
+	webhook.Enabled = enabled
+	if secret != "" {
+		webhook.Secret = secret
+	}
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+	changes := auditChanges(&previousWebhook, webhook)
+	if webhook.Secret != previousWebhook.Secret {
+		changes["secret"] = model.AuditChange{Before: auditRedacted, After: auditRedacted}
+	}
+	return s.saveAndAudit(webhook, actor, model.AuditWebhookUpdated, changes)
+}
+
+func (s *WebhookService) DeleteByID(id uint, actor model.AuditActor) error {
+	webhook, err := s.webhookRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return s.auditService.Transaction(func(tx repository.Tx) error {
+		webhookRepository := s.webhookRepository.WithTx(tx)
+		if err := webhookRepository.DeleteByID(id); err != nil {
+			return err
+		}
+		return s.recordAudit(tx, actor, model.AuditWebhookDeleted, webhook, auditChanges(webhook, nil))
+	})
+}
+
+// saveAndAudit saves a webhook and records an audit entry in the same transaction
+func (s *WebhookService) saveAndAudit(webhook *model.Webhook, actor model.AuditActor, action string, changes map[string]model.AuditChange) error {
+	return s.auditService.Transaction(func(tx repository.Tx) error {
+		webhookRepository := s.webhookRepository.WithTx(tx)
+		if err := webhookRepository.Save(webhook); err != nil {
+			return err
+		}
+		return s.recordAudit(tx, actor, action, webhook, changes)
+	})
+}
+
+func (s *WebhookService) recordAudit(tx repository.Tx, actor model.AuditActor, action string, webhook *model.Webhook, changes map[string]model.AuditChange) error {
+	entry := newAuditEntry(action, model.AuditTargetWebhook, webhook.ID, webhook.URL)
+	entry.Changes = changes
+	return s.auditService.RecordTx(tx, actor, entry)
+}
+
+// GetDeliveries returns the latest deliveries of a webhook (delivery log), newest first
+func (s *WebhookService) GetDeliveries(webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := s.webhookRepository.FindByID(webhookID); err != nil {
+		return nil, err
+	}
+	return s.webhookDeliveryRepository.FindLatestByWebhookID(webhookID, limit)
+}
+
+// GetDeadLetters returns the latest deliveries of all webhooks that failed permanently, newest first
+func (s *WebhookService) GetDeadLetters(limit int) ([]model.WebhookDelivery, error) {
+	return s.webhookDeliveryRepository.FindLatestByStatus(model.WebhookDeliveryDead, limit)
+}
+
+// Redeliver schedules a finished (dead or delivered) delivery to be sent again immediately
+func (s *WebhookService) Redeliver(deliveryID uint) error {
+	delivery, err := s.webhookDeliveryRepository.FindByID(deliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.Status == model.WebhookDeliveryPending {
+		return model.ConflictError{Message: "Delivery is still pending"}
+	}
+	delivery.Status = model.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.DeliveredAt = nil
+	if err := s.webhookDeliveryRepository.Save(delivery); err != nil {
+		return err
+	}
+	s.wakeupWorker()
+	return nil
+}
+
+// Dispatch stores a delivery of the event for every webhook subscribed to the event type in one transaction
+// and wakes up the delivery worker. If it returns an error, no delivery was stored and the event can be dispatched again.
+func (s *WebhookService) Dispatch(eventType string, data any) error {
+	webhooks, err := s.webhookRepository.FindAllEnabled()
+	if err != nil {
+		return model.InternalServerError{Message: "Could not query webhooks for event " + eventType, Err: err}
+	}
+	event := model.WebhookEvent{
+		ID:        utils.UUIDv4(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	var deliveries []model.WebhookDelivery
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: event.CreatedAt,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return model.InternalServerError{Message: "Could not encode event " + eventType, Err: err}
+	}
+	err = s.auditService.Transaction(func(tx repository.Tx) error {
+		webhookDeliveryRepository := s.webhookDeliveryRepository.WithTx(tx)
+		for i := range deliveries {
+			deliveries[i].Payload = string(payload)
+			if err := webhookDeliveryRepository.Save(&deliveries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return model.InternalServerError{Message: "Could not store the deliveries of event " + event.ID, Err: err}
+	}
+	s.wakeupWorker()
+	return nil
+}
+
+func (s *WebhookService) wakeupWorker() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default: // the worker is already signaled
+	}
+}
+
+// deliveryWorker sends due deliveries whenever new events are dispatched and periodically for retries
+func (s *WebhookService) deliveryWorker() {
+	ticker := time.NewTicker(config.WebhookWorkerInterval)
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wakeup:
+		}
+		s.deliverDue()
+	}
+}
+
+func (s *WebhookService) deliverDue() {
+	webhooks := make(map[uint]*model.Webhook)
+	for {
+		deliveries, err := s.webhookDeliveryRepository.FindDue(time.Now(), webhookBatchSize)
+		if err != nil {
+			log.Println("WebhookService: could not query due deliveries:", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			// claimed deliveries are retried after the lease if this instance crashes during the attempt
+			claimed, err := s.webhookDeliveryRepository.Claim(delivery, time.Now().Add(2*config.WebhookTimeout))
+			if err != nil {
+				log.Println("WebhookService: could not claim delivery", delivery.ID, ":", err)
+				return
+			}
+			if !claimed {
+				continue // attempted by another instance
+			}
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				webhook, err = s.webhookRepository.FindByID(delivery.WebhookID)
+				if err != nil {
+					log.Println("WebhookService: could not find webhook", delivery.WebhookID, ":", err)
+					continue
+				}
+				webhooks[delivery.WebhookID] = webhook
+			}
+			s.attempt(webhook, delivery)
+		}
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// attempt sends a delivery once and records the result
+func (s *WebhookService) attempt(webhook *model.Webhook, delivery *model.WebhookDelivery) {
+	statusCode, err := s.send(webhook, delivery)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= config.WebhookMaxAttempts:
+		delivery.Status = model.WebhookDeliveryDead
+		delivery.LastError = truncate(err.Error(), webhookMaxErrorLength)
+		log.Println("WebhookService: delivery", delivery.ID, "to webhook", webhook.ID, "failed permanently:", err)
+	default:
+		delivery.LastError = truncate(err.Error(), webhookMaxErrorLength)
+		delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+	}
+	if err := s.webhookDeliveryRepository.Save(delivery); err != nil {
+		log.Println("WebhookService: could not store result of delivery", delivery.ID, ":", err)
+	}
+}
+
+// send posts the signed payload to the webhook and returns the status code of the response
+// The signature is the HMAC-SHA256 of "<timestamp>.<body>" to prevent replaying old requests.
+func (s *WebhookService) send(webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	if !webhook.Enabled {
+		return 0, fmt.Errorf("webhook is disabled")
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := crypto.SignHMACSHA256([]byte(webhook.Secret), []byte(timestamp+"."+delivery.Payload))
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.WebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Heimdall-Webhook")
+	req.Header.Set("X-Heimdall-Event", delivery.EventType)
+	req.Header.Set("X-Heimdall-Delivery", delivery.EventID)
+	req.Header.Set("X-Heimdall-Timestamp", timestamp)
+	req.Header.Set("X-Heimdall-Signature", "sha256="+signature)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // allows reusing the connection
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *WebhookService) deliveryGarbageCollector() {
+	for range time.NewTicker(time.Hour).C {
+		rowsAffected, err := s.webhookDeliveryRepository.DeleteFinishedBefore(time.Now().Add(-config.WebhookDeliveryRetention))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("Successfully deleted %d finished webhook deliveries\n", rowsAffected)
+	}
+}
+
+// webhookBackoff returns the delay before the next attempt after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	backoff := config.WebhookInitialBackoff
+	for i := 1; i < attempts && backoff < config.WebhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, config.WebhookMaxBackoff)
+}
+
+func validateWebhook(webhook *model.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return model.BadRequestError{Message: "Invalid webhook URL (must be an absolute http or https URL)"}
+	}
+	if len(webhook.Events) == 0 {
+		return model.BadRequestError{Message: "A webhook must subscribe to at least one event type"}
+	}
+	for _, event := range webhook.Events {
+		if !slices.Contains(model.WebhookEventTypes, event) {
+			return model.BadRequestError{Message: "Unknown event type " + event + " (valid: " + strings.Join(model.WebhookEventTypes, ", ") + ")"}
+		}
+	}
+	if len(webhook.Secret) < webhookMinSecretLength {
+		return model.BadRequestError{Message: fmt.Sprintf("Webhook secret must be at least %d characters long", webhookMinSecretLength)}
+	}
+	return nil
+}
+
+func truncate(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	return s[:maxLength]
+}
@@ -0,0 +1,237 @@
+package setup
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"golang.org/x/term"
+)
+
+// runAdminCommand runs an administrative command with the services of the server directly against its database
+// Changes are recorded like changes via the API (audit log and outbox), but the command does not connect to Redis:
+// the outbox events are dispatched to the subscribers of the internal API and the webhooks by the running server.
+func runAdminCommand(command func(s *services) (any, error)) int {
+	db, err := connectDatabase()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	repos := newGormRepositories(db)
+	if err := repos.migrate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	authBus := broker.NewLocalBus(service.NewAuthBroker())
+	userCreateDeleteBus := broker.NewLocalBus(service.NewUserCreateDeleteBroker())
+	s := newServices(repos, authBus, userCreateDeleteBus)
+	result, err := command(&s)
+	return printResult(result, true, err)
+}
+
+func userCreate(username, email string) func(s *services) (any, error) {
+	return func(s *services) (any, error) {
+		return createUser(s, username, email)
+	}
+}
+
+func createUser(s *services, username, email string) (*model.User, error) {
+	password, err := readPassword("Password")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.user.Create(username, password, email, model.CommandLineActor); err != nil {
+		return nil, err
+	}
+	return s.user.GetByName(username)
+}
+
+func userResetPassword(username string) func(s *services) (any, error) {
+	return func(s *services) (any, error) {
+		user, err := s.user.GetByName(username)
+		if err != nil {
+			return nil, err
+		}
+		password, err := readPassword("New password")
+		if err != nil {
+			return nil, err
+		}
+		// the API token is regenerated and the sessions of the user become invalid
+		if err := s.user.Update(user.ID, user.Username, password, user.Email, model.CommandLineActor); err != nil {
+			return nil, err
+		}
+		return s.user.GetByID(user.ID)
+	}
+}
+
+func userAddRole(username, rolename string) func(s *services) (any, error) {
+	return func(s *services) (any, error) {
+		user, err := s.user.GetByName(username)
+		if err != nil {
+			return nil, err
+		}
+		role, err := s.role.GetByName(rolename)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.role.AddUserToRole(role.ID, user.ID, model.CommandLineActor); err != nil {
+			return nil, err
+		}
+		return s.user.GetByID(user.ID)
+	}
+}
+
+// keyGenerate parses the options of "key generate"
+func keyGenerate(args []string) (func(s *services) (any, error), error) {
+	flags := flag.NewFlagSet("key generate", flag.ContinueOnError)
+	description := flags.String("description", "", "description of the registration key")
+	permanent := flags.Bool("permanent", false, "the key can be used for any number of registrations")
+	expires := flags.Duration("expires", 7*24*time.Hour, "time until the key expires")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return func(s *services) (any, error) {
+		key, err := crypto.NewRandomAlphaNumString(config.RegistrationKeyLength)
+		if err != nil {
+			return nil, model.InternalServerError{Message: "Could not generate new registration key", Err: err}
+		}
+		if err := s.registrationKey.Create(key, *description, *permanent, time.Now().Add(*expires), model.CommandLineActor); err != nil {
+			return nil, err
+		}
+		return s.registrationKey.GetByKey(key)
+	}, nil
+}
+
+// tokenRevoke deletes the API token of a user, the running server closes its connections and generates a new one
+func tokenRevoke(username string) func(s *services) (any, error) {
+	return func(s *services) (any, error) {
+		user, err := s.user.GetByName(username)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.user.RevokeApiToken(user.ID, model.CommandLineActor); err != nil {
+			return nil, err
+		}
+		return s.user.GetByID(user.ID)
+	}
+}
+
+// bootstrapAdmin creates the first admin (and the admin role if it does not exist yet)
+// It refuses to create another admin, use "user create" and "user add-role" for that.
+func bootstrapAdmin(username, email string) func(s *services) (any, error) {
+	return func(s *services) (any, error) {
+		role, err := s.role.GetByName(config.AdminRoleName)
+		if _, notFound := err.(model.NotFoundError); notFound {
+			if err := s.role.Create(config.AdminRoleName, model.CommandLineActor); err != nil {
+				return nil, err
+			}
+			role, err = s.role.GetByName(config.AdminRoleName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		admins, err := s.role.GetUsersOfRole(role.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(admins) > 0 {
+			return nil, model.ConflictError{Message: fmt.Sprintf("There already is an admin (%s)", admins[0].Username)}
+		}
+		password, err := readPassword("Password")
+		if err != nil {
+			return nil, err
+		}
+		if err := s.user.CreateWithRole(username, password, email, role, model.CommandLineActor); err != nil {
+			return nil, err
+		}
+		return s.user.GetByName(username)
+	}
+}
+
+// seedApply creates the missing entries of a seed file
+func seedApply(path string) func(s *services) (any, error) {
+	return func(s *services) (any, error) {
+		seed, err := loadSeed(path)
+		if err != nil {
+			return nil, err
+		}
+		return s.seed.Apply(seed, model.CommandLineActor)
+	}
+}
+
+// archiveExport prints an archive of all data
+func archiveExport(s *services) (any, error) {
+	return s.archive.Export(model.CommandLineActor)
+}
+
+// archiveImport parses the options of "import"
+func archiveImport(args []string) (func(s *services) (any, error), error) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	mode := flags.String("mode", model.ArchiveMerge, "merge or replace")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("expected the archive file (- for the standard input)")
+	}
+	path := flags.Arg(0)
+	return func(s *services) (any, error) {
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, model.BadRequestError{Message: "Could not read the archive", Err: err}
+		}
+		var archive model.Archive
+		if err := json.Unmarshal(data, &archive); err != nil {
+			return nil, model.BadRequestError{Message: "Invalid archive: " + err.Error(), Err: err}
+		}
+		return s.archive.Import(&archive, *mode, model.CommandLineActor)
+	}, nil
+}
+
+// readPassword reads a password from the terminal without echoing it (entered twice)
+// or a line from the standard input if it is not a terminal (e.g. echo "$PASSWORD" | heimdall user create ...)
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", model.BadRequestError{Message: "Could not read the password from the standard input", Err: err}
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt+": ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", model.BadRequestError{Message: "Could not read the password", Err: err}
+	}
+	fmt.Fprint(os.Stderr, "Repeat "+strings.ToLower(prompt)+": ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", model.BadRequestError{Message: "Could not read the password", Err: err}
+	}
+	if string(password) != string(repeated) {
+		return "", model.BadRequestError{Message: "The passwords do not match"}
+	}
+	return string(password), nil
+}
@@ -0,0 +1,174 @@
+package setup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+)
+
+const commandUsage = `Usage: heimdall [command]
+
+Without a command the server is started.
+
+Commands:
+  user create <username> <email>      create a user (the password is read from the terminal or the standard input)
+  user reset-password <username>      set a new password of a user
+  user add-role <username> <role>     add a user to a role
+  key generate [options]              generate a registration key
+    -description <text>               description of the key
+    -permanent                        the key can be used for any number of registrations
+    -expires <duration>               time until the key expires (default 168h)
+  token revoke <username>             delete the API token of a user (the server closes its connections and generates a new one)
+  bootstrap-admin <username> <email>  create the first admin and the admin role (fails if there is an admin)
+  seed <file>                         create the missing roles, registration keys and users of a YAML or JSON seed file
+  export                              print an archive of all users (with password hashes), roles, registration keys and API tokens
+  import [-mode merge|replace] <file> import an archive in a single transaction (- reads it from the standard input)
+                                      merge (default) replaces the entries with the same names, replace deletes all data first
+  audit verify                        verify the hash chain and the signed checkpoints of the audit log
+                                      (exit code 1 if the log was altered)
+  audit checkpoint                    sign a checkpoint of the latest audit entry (requires AUDIT_SIGNING_KEY)
+  migrate status                      list the schema migrations and whether they are applied
+  migrate up                          apply all pending schema migrations
+  migrate down                        revert the latest applied schema migration
+  migrate to <n>                      apply or revert schema migrations until the schema has version n (0 drops all tables)
+  config print                        print the effective settings with their sources (secrets are redacted)
+                                      (exit code 1 if the configuration is invalid)
+
+The commands run against the database of DB_DRIVER (postgres or sqlite) and print their results as JSON.
+The running server announces their changes to the subscribers of the internal API and the webhooks.
+`
+
+// RunCommand runs a command of the command line interface instead of the server and returns the exit code
+func RunCommand(args []string) int {
+	if len(args) == 2 && args[0] == "config" && args[1] == "print" {
+		return configPrint()
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return 2
+	}
+	switch {
+	case len(args) == 2 && args[0] == "audit" && args[1] == "verify":
+		return runAuditCommand(auditVerify)
+	case len(args) == 2 && args[0] == "audit" && args[1] == "checkpoint":
+		return runAuditCommand(auditCheckpoint)
+	case len(args) == 4 && args[0] == "user" && args[1] == "create":
+		return runAdminCommand(userCreate(args[2], args[3]))
+	case len(args) == 3 && args[0] == "user" && args[1] == "reset-password":
+		return runAdminCommand(userResetPassword(args[2]))
+	case len(args) == 4 && args[0] == "user" && args[1] == "add-role":
+		return runAdminCommand(userAddRole(args[2], args[3]))
+	case len(args) >= 2 && args[0] == "key" && args[1] == "generate":
+		command, err := keyGenerate(args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return runAdminCommand(command)
+	case len(args) == 3 && args[0] == "token" && args[1] == "revoke":
+		return runAdminCommand(tokenRevoke(args[2]))
+	case len(args) == 3 && args[0] == "bootstrap-admin":
+		return runAdminCommand(bootstrapAdmin(args[1], args[2]))
+	case len(args) == 2 && args[0] == "seed":
+		return runAdminCommand(seedApply(args[1]))
+	case len(args) == 1 && args[0] == "export":
+		return runAdminCommand(archiveExport)
+	case len(args) >= 1 && args[0] == "import":
+		command, err := archiveImport(args[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return runAdminCommand(command)
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "status":
+		return runMigrateCommand((*repository.Migrator).Status)
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "up":
+		return runMigrateCommand((*repository.Migrator).Up)
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "down":
+		return runMigrateCommand((*repository.Migrator).Down)
+	case len(args) == 3 && args[0] == "migrate" && args[1] == "to":
+		version, err := strconv.ParseUint(args[2], 10, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid version:", args[2])
+			return 2
+		}
+		return runMigrateCommand(func(migrator *repository.Migrator) ([]model.MigrationStatus, error) {
+			return migrator.To(uint(version))
+		})
+	default:
+		fmt.Fprint(os.Stderr, commandUsage)
+		return 2
+	}
+}
+
+func runAuditCommand(command func(auditService service.AuditService) (any, bool, error)) int {
+	db, err := connectDatabase()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	auditService := service.NewAuditService(repository.NewTransactor(db), repository.NewAuditRepository(db), loadAuditSigningKey(), config.AuditTrustedPublicKeys)
+	result, ok, err := command(auditService)
+	return printResult(result, ok, err)
+}
+
+// runMigrateCommand runs a command of the schema migrations and prints the migrations it returns
+func runMigrateCommand(command func(migrator *repository.Migrator) ([]model.MigrationStatus, error)) int {
+	db, err := connectDatabase()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	migrator := repository.NewMigrator(db)
+	migrations, err := command(&migrator)
+	if migrations == nil {
+		migrations = []model.MigrationStatus{}
+	}
+	return printResult(migrations, true, err)
+}
+
+// printResult prints the result of a command as JSON and returns the exit code (1 if not ok, 2 on errors)
+func printResult(result any, ok bool, err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// configPrint prints the effective settings and the errors of the configuration
+func configPrint() int {
+	err := config.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+	}
+	return printResult(config.Settings(), err == nil, nil)
+}
+
+func auditVerify(auditService service.AuditService) (any, bool, error) {
+	verification, err := auditService.Verify()
+	if err != nil {
+		return nil, false, err
+	}
+	return verification, verification.Valid, nil
+}
+
+func auditCheckpoint(auditService service.AuditService) (any, bool, error) {
+	checkpoint, err := auditService.WriteCheckpoint()
+	return checkpoint, true, err // null if there are no new entries since the last checkpoint
+}
@@ -2,15 +2,29 @@ package setup
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/ProjectLighthouseCAU/heimdall/config"
 	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// connectDatabase opens a connection to the SQL database of the configured DB_DRIVER
+func connectDatabase() (*gorm.DB, error) {
+	switch config.DatabaseDriver {
+	case "postgres":
+		return connectPostgres()
+	case "sqlite":
+		return connectSQLite()
+	default:
+		return nil, model.InternalServerError{Message: "DB_DRIVER " + config.DatabaseDriver + " has no SQL database"}
+	}
+}
+
 // connectPostgres opens a connection to the PostgreSQL database for GORM to use
 func connectPostgres() (*gorm.DB, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
@@ -41,3 +55,31 @@ func connectPostgres() (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// connectSQLite opens the SQLite database file (created if it does not exist) for GORM to use
+func connectSQLite() (*gorm.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")   // readers do not block the writer
+	params.Add("_pragma", "busy_timeout(10000)") // wait for the lock of the writer instead of failing
+	params.Set("_txlock", "immediate")           // transactions lock the database when they begin (in place of SELECT ... FOR UPDATE)
+	dsn := "file:" + config.DatabaseFile + "?" + params.Encode()
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		PrepareStmt:    true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, model.InternalServerError{Message: "Could not open sqlite database", Err: err}
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, model.InternalServerError{Message: "Failed to get underlying sql.DB", Err: err}
+	}
+	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxOpenConns(10)
+	sqlDB.SetConnMaxLifetime(time.Hour)
+
+	return db, nil
+}
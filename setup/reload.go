@@ -0,0 +1,31 @@
+package setup
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+)
+
+// ReloadConfigOnSIGHUP reloads the reloadable settings (CORS origins, rate limits, internal IPs) from CONFIG_FILE
+// and the environment whenever the process receives SIGHUP
+func ReloadConfigOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Println("Received SIGHUP, reloading the configuration")
+		restartRequired, err := config.Reload()
+		if err != nil {
+			log.Println("Could not reload the configuration, keeping the previous settings:", err)
+			continue
+		}
+		if len(restartRequired) > 0 {
+			log.Println("Reloaded the configuration, these changed settings only take effect after a restart:", strings.Join(restartRequired, ", "))
+			continue
+		}
+		log.Println("Reloaded the configuration")
+	}
+}
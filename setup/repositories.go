@@ -0,0 +1,81 @@
+package setup
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"gorm.io/gorm"
+)
+
+// repositories of the configured database backend
+type repositories struct {
+	db         *gorm.DB // nil for the in-memory backend
+	transactor repository.Transactor
+
+	user            repository.UserRepository
+	registrationKey repository.RegistrationKeyRepository
+	role            repository.RoleRepository
+	token           repository.TokenRepository
+	passwordHistory repository.PasswordHistoryRepository
+	webhook         repository.WebhookRepository
+	webhookDelivery repository.WebhookDeliveryRepository
+	outbox          repository.OutboxRepository
+	audit           repository.AuditRepository
+}
+
+func newGormRepositories(db *gorm.DB) repositories {
+	return repositories{
+		db:              db,
+		transactor:      repository.NewTransactor(db),
+		user:            repository.NewUserRepository(db),
+		registrationKey: repository.NewRegistrationKeyRepository(db),
+		role:            repository.NewRoleRepository(db),
+		token:           repository.NewTokenRepository(db),
+		passwordHistory: repository.NewPasswordHistoryRepository(db),
+		webhook:         repository.NewWebhookRepository(db),
+		webhookDelivery: repository.NewWebhookDeliveryRepository(db),
+		outbox:          repository.NewOutboxRepository(db),
+		audit:           repository.NewAuditRepository(db),
+	}
+}
+
+func newMemoryRepositories(store *repository.MemoryStore) repositories {
+	return repositories{
+		transactor:      repository.NewMemoryTransactor(store),
+		user:            repository.NewMemoryUserRepository(store),
+		registrationKey: repository.NewMemoryRegistrationKeyRepository(store),
+		role:            repository.NewMemoryRoleRepository(store),
+		token:           repository.NewMemoryTokenRepository(store),
+		passwordHistory: repository.NewMemoryPasswordHistoryRepository(store),
+		webhook:         repository.NewMemoryWebhookRepository(store),
+		webhookDelivery: repository.NewMemoryWebhookDeliveryRepository(store),
+		outbox:          repository.NewMemoryOutboxRepository(store),
+		audit:           repository.NewMemoryAuditRepository(store),
+	}
+}
+
+// migrate checks the schema of the database on startup and applies the pending migrations if DB_AUTO_MIGRATE is enabled
+// It refuses to run against a schema of a newer version of Heimdall.
+func (r *repositories) migrate() error {
+	if r.db == nil { // the in-memory backend has no schema
+		return nil
+	}
+	migrator := repository.NewMigrator(r.db)
+	pending, err := migrator.Check()
+	if err != nil {
+		return err
+	}
+	if pending == 0 {
+		return nil
+	}
+	if !config.DatabaseAutoMigrate {
+		return fmt.Errorf("the database schema has %d pending migrations, run \"heimdall migrate up\" or enable DB_AUTO_MIGRATE", pending)
+	}
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		log.Printf("	Applied migration %d (%s)\n", migration.Version, migration.Name)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"gopkg.in/yaml.v3"
+)
+
+// loadSeed reads a seed file, JSON if it ends with .json and YAML otherwise
+func loadSeed(path string) (*model.Seed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, model.BadRequestError{Message: "Could not read the seed file " + path, Err: err}
+	}
+	return parseSeed(data, strings.EqualFold(filepath.Ext(path), ".json"))
+}
+
+// parseSeed decodes a seed and rejects unknown fields (e.g. typos)
+func parseSeed(data []byte, isJSON bool) (*model.Seed, error) {
+	var seed model.Seed
+	var err error
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&seed)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&seed)
+	}
+	if err != nil {
+		return nil, model.BadRequestError{Message: fmt.Sprintf("Invalid seed: %v", err), Err: err}
+	}
+	return &seed, nil
+}
@@ -0,0 +1,87 @@
+package setup
+
+import (
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+)
+
+// services of the application (shared by the server and the command line interface)
+type services struct {
+	audit           service.AuditService
+	webhook         service.WebhookService
+	token           service.TokenService
+	outbox          service.OutboxService
+	passwordPolicy  service.PasswordPolicyService
+	user            service.UserService
+	registrationKey service.RegistrationKeyService
+	role            service.RoleService
+	bootstrap       service.BootstrapService
+	seed            service.SeedService
+	archive         service.ArchiveService
+}
+
+// newServices creates the services without starting their background tasks (see start)
+func newServices(repos repositories,
+	authBus broker.Bus[*model.AuthUpdateMessage],
+	userCreateDeleteBus broker.Bus[*model.UserUpdateMessage],
+) services {
+	auditService := service.NewAuditService(repos.transactor, repos.audit, loadAuditSigningKey(), config.AuditTrustedPublicKeys)
+	webhookService := service.NewWebhookService(repos.webhook, repos.webhookDelivery, auditService)
+	tokenService := service.NewTokenService(repos.token, repos.user, authBus, userCreateDeleteBus, webhookService, auditService)
+	outboxService := service.NewOutboxService(repos.transactor, repos.outbox, repos.user, tokenService)
+	passwordPolicyService := service.NewPasswordPolicyService(loadBreachedPasswords())
+	userService := service.NewUserService(
+		repos.user,
+		repos.registrationKey,
+		repos.role,
+		repos.passwordHistory,
+		tokenService,
+		passwordPolicyService,
+		outboxService,
+		auditService,
+	)
+	registrationKeyService := service.NewRegistrationKeyService(
+		repos.registrationKey,
+		auditService,
+	)
+	roleService := service.NewRoleService(
+		repos.role,
+		repos.user,
+		outboxService,
+		auditService,
+	)
+	return services{
+		audit:           auditService,
+		webhook:         webhookService,
+		token:           tokenService,
+		outbox:          outboxService,
+		passwordPolicy:  passwordPolicyService,
+		user:            userService,
+		registrationKey: registrationKeyService,
+		role:            roleService,
+		bootstrap:       service.NewBootstrapService(userService, roleService),
+		seed:            service.NewSeedService(userService, roleService, registrationKeyService, tokenService),
+		archive: service.NewArchiveService(
+			repos.user,
+			repos.role,
+			repos.registrationKey,
+			repos.token,
+			outboxService,
+			auditService,
+			tokenService,
+		),
+	}
+}
+
+// start starts the background tasks of the services (schedulers, workers and garbage collectors)
+// Only the server starts them, the command line interface leaves the expiry notifications, outbox events
+// and webhook deliveries to the running servers.
+func (s *services) start() {
+	s.audit.Start()
+	s.webhook.Start()
+	s.token.Start()
+	s.outbox.Start()
+	s.user.Start()
+}
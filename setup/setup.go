@@ -2,16 +2,20 @@ package setup
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"log"
 	"runtime"
 	"strings"
 	"time"
 
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
 	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
 	"github.com/ProjectLighthouseCAU/heimdall/docs"
 	"github.com/ProjectLighthouseCAU/heimdall/handler"
 	"github.com/ProjectLighthouseCAU/heimdall/middleware"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
 	"github.com/ProjectLighthouseCAU/heimdall/repository"
 	"github.com/ProjectLighthouseCAU/heimdall/router"
 	"github.com/ProjectLighthouseCAU/heimdall/service"
@@ -22,7 +26,20 @@ import (
 	"gorm.io/gorm"
 )
 
+// interval of the deletion of expired sessions in the database and in memory
+const sessionGCInterval = 10 * time.Minute
+
 func Setup() *fiber.App {
+	return newApp(false)
+}
+
+// SetupTest sets up the application with the test data of the tests in test/
+// WARNING: it deletes all data in the database first, never use it outside of tests
+func SetupTest() *fiber.App {
+	return newApp(true)
+}
+
+func newApp(testData bool) *fiber.App {
 	docs.SwaggerInfo.Host = config.ApiHost
 	docs.SwaggerInfo.BasePath = config.ApiBasePath
 
@@ -36,23 +53,33 @@ func Setup() *fiber.App {
 
 	// Dependency Injection
 
-	// database
-	log.Println("	Connecting to database")
-	db, err := connectPostgres()
-	panicOnError(err)
+	var repos repositories
+	readynessChecks := make(map[string]func(ctx context.Context) error)
+	switch config.DatabaseDriver {
+	case "postgres", "sqlite":
+		// database
+		log.Println("	Connecting to database")
+		db, err := connectDatabase()
+		panicOnError(err)
+		repos = newGormRepositories(db)
+		readynessChecks[db.Dialector.Name()] = func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}
+	case "memory":
+		log.Println("	Keeping all data in memory (nothing is persisted)")
+		repos = newMemoryRepositories(repository.NewMemoryStore())
+	default:
+		panic("Unknown DB_DRIVER: " + config.DatabaseDriver)
+	}
 
 	// session store
-	sessionStorage := redis.New(redis.Config{
-		Host:      config.RedisHost,
-		Port:      config.RedisPort,
-		Username:  config.RedisUser,
-		Password:  config.RedisPassword,
-		Database:  0,
-		Reset:     false,
-		TLSConfig: nil,
-		PoolSize:  10 * runtime.GOMAXPROCS(0),
-	})
-
+	backend := sessionStorageBackend()
+	sessionStorage, redisStorage := newSessionStorage(backend, repos.db)
+	readynessChecks["session storage ("+backend+")"] = sessionStorage.Ping
 	sessionStore := session.New(session.Config{
 		Storage:        sessionStorage,
 		Expiration:     24 * time.Hour,
@@ -63,40 +90,136 @@ func Setup() *fiber.App {
 		CookieHTTPOnly: true,
 	})
 
-	setupApplication(app, db, sessionStore)
+	// event buses
+	if eventBusBackend() == "redis" && redisStorage == nil {
+		// the sessions are stored elsewhere, the bus uses its own connection
+		redisStorage = newRedisStorage()
+		readynessChecks["event bus (redis)"] = func(ctx context.Context) error {
+			return redisStorage.Conn().Ping(ctx).Err()
+		}
+	}
+	authBus, userCreateDeleteBus := newEventBuses(redisStorage)
+
+	setupApplication(app, repos, sessionStore, authBus, userCreateDeleteBus, readynessChecks, testData)
 
 	return app
 }
 
-func setupApplication(app *fiber.App, db *gorm.DB, store *session.Store) {
-	// repositories
-	userRepository := repository.NewUserRepository(db)
-	registrationKeyRepository := repository.NewRegistrationKeyRepository(db)
-	roleRepository := repository.NewRoleRepository(db)
-	tokenRepository := repository.NewTokenRepository(db)
+// sessionStorageBackend returns the configured SESSION_STORAGE (by default Redis only with PostgreSQL)
+func sessionStorageBackend() string {
+	if config.SessionStorage != "" {
+		return config.SessionStorage
+	}
+	if config.DatabaseDriver == "postgres" {
+		return "redis"
+	}
+	return "memory"
+}
+
+// newSessionStorage creates the storage of the sessions and returns the Redis storage if the sessions are stored in Redis
+// (it is also used by the event buses)
+func newSessionStorage(backend string, db *gorm.DB) (repository.SessionStorage, *redis.Storage) {
+	switch backend {
+	case "redis":
+		log.Println("	Storing sessions in Redis")
+		redisStorage := newRedisStorage()
+		return repository.NewRedisSessionStorage(redisStorage), redisStorage
+	case "database":
+		if db == nil {
+			panic("SESSION_STORAGE=database requires DB_DRIVER=postgres or DB_DRIVER=sqlite")
+		}
+		log.Println("	Storing sessions in the", db.Dialector.Name(), "database")
+		return repository.NewSessionStorage(db, sessionGCInterval), nil
+	case "memory":
+		log.Println("	Keeping sessions in memory (lost on restart and not shared between instances)")
+		return repository.NewMemorySessionStorage(sessionGCInterval), nil
+	default:
+		panic("Unknown SESSION_STORAGE: " + backend)
+	}
+}
 
+func newRedisStorage() *redis.Storage {
+	return redis.New(redis.Config{
+		Host:      config.RedisHost,
+		Port:      config.RedisPort,
+		Username:  config.RedisUser,
+		Password:  config.RedisPassword,
+		Database:  0,
+		Reset:     false,
+		TLSConfig: nil,
+		PoolSize:  10 * runtime.GOMAXPROCS(0),
+	})
+}
+
+// eventBusBackend returns the configured EVENT_BUS (by default Redis only with PostgreSQL)
+func eventBusBackend() string {
+	if config.EventBus != "" {
+		return config.EventBus
+	}
+	if config.DatabaseDriver == "postgres" {
+		return "redis"
+	}
+	return "local"
+}
+
+// newEventBuses creates the buses that distribute the events of the internal API
+// (redisStorage is required with EVENT_BUS=redis)
+func newEventBuses(redisStorage *redis.Storage) (broker.Bus[*model.AuthUpdateMessage], broker.Bus[*model.UserUpdateMessage]) {
+	authBroker := service.NewAuthBroker()
+	userCreateDeleteBroker := service.NewUserCreateDeleteBroker()
+	switch backend := eventBusBackend(); backend {
+	case "redis":
+		if redisStorage == nil {
+			panic("EVENT_BUS=redis requires a Redis connection")
+		}
+		log.Println("	Propagating events via Redis Streams")
+		return broker.NewRedisBus(redisStorage.Conn(), "heimdall:events:auth", config.EventLogSize, authBroker),
+			broker.NewRedisBus(redisStorage.Conn(), "heimdall:events:users", config.EventLogSize, userCreateDeleteBroker)
+	case "local":
+		log.Println("	Propagating events only within this instance")
+		return broker.NewLocalBus(authBroker), broker.NewLocalBus(userCreateDeleteBroker)
+	default:
+		panic("Unknown EVENT_BUS: " + backend)
+	}
+}
+
+func setupApplication(app *fiber.App,
+	repos repositories,
+	store *session.Store,
+	authBus broker.Bus[*model.AuthUpdateMessage],
+	userCreateDeleteBus broker.Bus[*model.UserUpdateMessage],
+	readynessChecks map[string]func(ctx context.Context) error,
+	testData bool,
+) {
 	// migrate database
-	panicOnError(userRepository.Migrate())
-	panicOnError(registrationKeyRepository.Migrate())
-	panicOnError(roleRepository.Migrate())
-	panicOnError(tokenRepository.Migrate())
+	panicOnError(repos.migrate())
 
 	// services
-	tokenService := service.NewTokenService(tokenRepository, userRepository)
-	userService := service.NewUserService(
-		userRepository,
-		registrationKeyRepository,
-		roleRepository,
-		tokenService,
-	)
-	registrationKeyService := service.NewRegistrationKeyService(
-		registrationKeyRepository,
-	)
-	roleService := service.NewRoleService(
-		roleRepository,
-		userRepository,
-		tokenService,
-	)
+	services := newServices(repos, authBus, userCreateDeleteBus)
+
+	// base roles and first admin
+	if testData {
+		resetTestDatabase(repos.db, store)
+	}
+	log.Println("	Bootstrapping")
+	panicOnError(services.bootstrap.Bootstrap())
+	if testData {
+		createTestData(services)
+	}
+	if config.SeedFile != "" {
+		log.Println("	Applying seed file", config.SeedFile)
+		seed, err := loadSeed(config.SeedFile)
+		panicOnError(err)
+		result, err := services.seed.Apply(seed, model.SystemActor)
+		panicOnError(err)
+		log.Printf("	Created %d roles, %d registration keys and %d users, added %d role memberships and %d API tokens\n",
+			len(result.Roles), len(result.RegistrationKeys), len(result.Users), len(result.Memberships), len(result.ApiTokens))
+	}
+	services.start()
+	userService := services.user
+	roleService := services.role
+	registrationKeyService := services.registrationKey
+	tokenService := services.token
 
 	// handlers
 	userHandler := handler.NewUserHandler(
@@ -109,15 +232,31 @@ func setupApplication(app *fiber.App, db *gorm.DB, store *session.Store) {
 	)
 	roleHandler := handler.NewRoleHandler(
 		roleService,
+		userService,
+		store,
 	)
 	tokenHandler := handler.NewTokenHandler(
 		tokenService,
 		userService,
 	)
+	webhookHandler := handler.NewWebhookHandler(
+		services.webhook,
+	)
+	auditHandler := handler.NewAuditHandler(
+		services.audit,
+	)
+	bootstrapHandler := handler.NewBootstrapHandler(
+		services.bootstrap,
+	)
+	archiveHandler := handler.NewArchiveHandler(
+		services.archive,
+		userService,
+		store,
+	)
 
 	// middleware
 	sessionMiddleware := middleware.NewSessionMiddleware(store, userService, tokenService)
-	tokenMiddleware := middleware.NewTokenMiddleware(&userService, &tokenRepository)
+	tokenMiddleware := middleware.NewTokenMiddleware(&userService, repos.token)
 
 	// router
 	routa := router.NewRouter(
@@ -126,40 +265,55 @@ func setupApplication(app *fiber.App, db *gorm.DB, store *session.Store) {
 		registrationKeyHandler,
 		roleHandler,
 		tokenHandler,
+		webhookHandler,
+		auditHandler,
+		bootstrapHandler,
+		archiveHandler,
 		sessionMiddleware,
 		tokenMiddleware,
 	)
 
 	// readyness probe
 	readynessProbe := func(c *fiber.Ctx) bool {
-		// Ping redis
 		ctx, cancelCtx := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancelCtx()
-		err := store.Storage.(*redis.Storage).Conn().Ping(ctx).Err()
-		if err != nil {
-			log.Println("Readyness check failed for Redis:", err)
-			return false
-		}
-		// Ping postgres
-		db, err := db.DB()
-		if err != nil {
-			log.Println("Readyness check failed for PostgreSQL:", err)
-			return false
-		}
-		err = db.Ping()
-		if err != nil {
-			log.Println("Readyness check failed for PostgreSQL:", err)
-			return false
+		for name, check := range readynessChecks {
+			if err := check(ctx); err != nil {
+				log.Println("Readyness check failed for "+name+":", err)
+				return false
+			}
 		}
 		return true
 	}
 
 	routa.Init(store, readynessProbe)
 	printRoutes(routa.ListRoutes())
+}
 
-	if config.UseTestDatabase { // TODO: remove in prod - this function deletes the whole database
-		SetupTestDatabase(db, store, userService, roleService, registrationKeyService, tokenService)
+// loadBreachedPasswords loads the breached password corpus if configured
+func loadBreachedPasswords() *crypto.BreachedPasswordSet {
+	if config.BreachedPasswordsFile == "" {
+		return nil
+	}
+	log.Println("	Loading breached passwords from", config.BreachedPasswordsFile)
+	start := time.Now()
+	breachedPasswords, err := crypto.LoadBreachedPasswordSet(config.BreachedPasswordsFile, config.BreachedPasswordsMinCount)
+	panicOnError(err)
+	log.Printf("	Loaded %d breached password hashes in %v\n", breachedPasswords.Len(), time.Since(start))
+	return breachedPasswords
+}
+
+func loadAuditSigningKey() ed25519.PrivateKey {
+	if config.AuditSigningKey == "" {
+		log.Println("	No AUDIT_SIGNING_KEY configured, the audit log is not checkpointed")
+		return nil
+	}
+	key, err := crypto.ParseEd25519Seed(config.AuditSigningKey)
+	if err != nil {
+		panic("Invalid AUDIT_SIGNING_KEY: " + err.Error())
 	}
+	log.Println("	Signing audit checkpoints with public key", crypto.Ed25519PublicKey(key))
+	return key
 }
 
 func panicOnError(err error) {
@@ -1,73 +1,53 @@
 package setup
 
 import (
+	_ "embed"
 	"log"
-	"time"
 
 	"github.com/ProjectLighthouseCAU/heimdall/model"
-	"github.com/ProjectLighthouseCAU/heimdall/service"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-func SetupTestDatabase(db *gorm.DB, store *session.Store,
-	userService service.UserService,
-	roleService service.RoleService,
-	registrationKeyService service.RegistrationKeyService,
-	tokenService service.TokenService) {
-
-	log.Println("	Setting up test database")
-	log.Println("		Deleting redis")
+// resetTestDatabase deletes all data (and the sessions) for the test data of createTestData
+func resetTestDatabase(db *gorm.DB, store *session.Store) {
+	log.Println("	Resetting test database")
+	log.Println("		Deleting sessions")
 	must(store.Storage.Reset())
-	log.Println("		Deleting tables")
-
-	must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.User{}).Error)
-	must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.Role{}).Error)
-	must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.RegistrationKey{}).Error)
-	must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.Token{}).Error)
+	if db != nil { // the in-memory database starts empty
+		log.Println("		Deleting tables")
 
-	log.Println("		Resetting auto increment sequences")
-	must(db.Exec("ALTER SEQUENCE users_id_seq RESTART WITH 1").Error)
-	must(db.Exec("ALTER SEQUENCE roles_id_seq RESTART WITH 1").Error)
-	must(db.Exec("ALTER SEQUENCE registration_keys_id_seq RESTART WITH 1").Error)
+		must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.User{}).Error)
+		must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.Role{}).Error)
+		must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.RegistrationKey{}).Error)
+		must(db.Unscoped().Select(clause.Associations).Where("true").Delete(&model.Token{}).Error)
+		must(db.Unscoped().Where("true").Delete(&model.Webhook{}).Error)
+		must(db.Unscoped().Where("true").Delete(&model.OutboxEvent{}).Error)
+		must(db.Unscoped().Where("true").Delete(&model.AuditEntry{}).Error)
+		must(db.Unscoped().Where("true").Delete(&model.AuditCheckpoint{}).Error)
+		must(db.Model(&model.AuditChainHead{}).Where("true").Updates(map[string]any{"entry_id": 0, "hash": ""}).Error)
 
-	log.Println("		Creating test data")
-	must(registrationKeyService.Create("test_registration_key", "just for testing", true, time.Now().AddDate(0, 0, 3)))
-	must(userService.Create("Admin", "password1234", "admin@example.com"))
-	must(userService.Create("Live", "password1234", "live@example.com"))
-	_, err := userService.Register("User", "password1234", "user@example.com", "test_registration_key", nil)
-	must(err)
-	admin, err := userService.GetByName("Admin")
-	must(err)
-	live, err := userService.GetByName("Live")
-	must(err)
-	user, err := userService.GetByName("User")
-	must(err)
-	var created bool
-	created, err = tokenService.GenerateApiTokenIfNotExists(admin)
-	must(err)
-	if !created {
-		panic("token for Admin was not created but did not error, was it correctly deleted?")
+		log.Println("		Resetting auto increment sequences")
+		for _, table := range []string{"users", "roles", "registration_keys"} {
+			must(resetSequence(db, table))
+		}
 	}
-	created, err = tokenService.GenerateApiTokenIfNotExists(live)
-	must(err)
-	if !created {
-		panic("token for Live was not created but did not error, was it correctly deleted?")
-	}
-	_, err = tokenService.GenerateApiTokenIfNotExists(user)
-	must(err)
-	// User is created with userService.Register, which creates the token
+}
 
-	must(roleService.Create("admin"))
-	must(roleService.Create("deploy"))
+//go:embed test_seed.yaml
+var testSeed []byte
 
-	adminRole, err := roleService.GetByName("admin")
+// createTestData creates the users of the tests after the bootstrap created the admin and deploy roles
+func createTestData(s services) {
+	log.Println("		Creating test data")
+	seed, err := parseSeed(testSeed, false)
 	must(err)
-	deployRole, err := roleService.GetByName("deploy")
+	result, err := s.seed.Apply(seed, model.SystemActor)
 	must(err)
-	must(roleService.AddUserToRole(adminRole.ID, admin.ID))
-	must(roleService.AddUserToRole(deployRole.ID, live.ID))
+	if len(result.Users) != len(seed.Users) {
+		panic("not all test users were created, was the database correctly reset?")
+	}
 }
 
 func must(err error) {
@@ -75,3 +55,13 @@ func must(err error) {
 		panic(err)
 	}
 }
+
+// resetSequence restarts the ids of a table at 1
+func resetSequence(db *gorm.DB, table string) error {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return db.Exec("DELETE FROM sqlite_sequence WHERE name = ?", table).Error
+	default:
+		return db.Exec("ALTER SEQUENCE " + table + "_id_seq RESTART WITH 1").Error
+	}
+}
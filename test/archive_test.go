@@ -0,0 +1,152 @@
+package test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestArchiveExportAndImport(t *testing.T) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+
+	var archive model.Archive
+	resp := sendRequest(t, app, cookie, "GET", "/archive", nil)
+	expect2xxStatus(t, resp)
+	readBodyAsJson(t, resp, &archive)
+	if archive.Version != model.ArchiveVersion || len(archive.Users) != 3 || len(archive.Tokens) != 3 || len(archive.Roles) != 2 {
+		t.Fatalf("Expected the test data in the archive, got %+v", archive)
+	}
+	admin := archive.Users[0]
+	if admin.Username != TESTUSER || admin.PasswordHash == "" || !slices.Contains(admin.Roles, "admin") {
+		t.Fatalf("Expected the admin with password hash and roles, got %+v", admin)
+	}
+	if archive.Users[2].RegistrationKey != "test_registration_key" {
+		t.Fatalf("Expected the registration key of User, got %+v", archive.Users[2])
+	}
+
+	// merge a changed user and a new user
+	merged := archive
+	merged.Users = slices.Clone(archive.Users)
+	merged.Users[2].Email = "merged@example.com"
+	merged.Users = append(merged.Users, model.ArchiveUser{Username: "Imported", PasswordHash: admin.PasswordHash, Roles: []string{"deploy"}})
+	merged.Tokens = append(slices.Clone(archive.Tokens), model.ArchiveToken{Username: "Imported", Token: "imported-api-token", Permanent: true})
+	resp = sendRequest(t, app, cookie, "POST", "/archive?mode=merge", merged)
+	expect2xxStatus(t, resp)
+	var result model.ArchiveImportResult
+	readBodyAsJson(t, resp, &result)
+	if result.Users != 4 || result.Tokens != 4 || result.DeletedUsers != 0 {
+		t.Fatalf("Expected 4 merged users and tokens, got %+v", result)
+	}
+
+	// the changes of the merge are audited per user
+	for _, query := range []string{
+		"action=" + model.AuditUserUpdated + "&target_type=user&target_id=3",
+		"action=" + model.AuditUserCreated + "&target_type=user",
+		"action=" + model.AuditRoleAssigned + "&target_type=user",
+	} {
+		resp = sendRequest(t, app, cookie, "GET", "/audit?"+query, nil)
+		expect2xxStatus(t, resp)
+		var page model.AuditPage
+		readBodyAsJson(t, resp, &page)
+		if len(page.Entries) == 0 {
+			t.Fatalf("Expected an audit entry for %s", query)
+		}
+		if entry := page.Entries[0]; entry.ActorName != TESTUSER || (entry.TargetName != "User" && entry.TargetName != "Imported") {
+			t.Fatalf("Unexpected audit entry for %s: %+v", query, entry)
+		}
+	}
+
+	resp = sendRequest(t, app, cookie, "GET", "/archive", nil)
+	expect2xxStatus(t, resp)
+	var exported model.Archive
+	readBodyAsJson(t, resp, &exported)
+	if len(exported.Users) != 4 || exported.Users[2].Email != "merged@example.com" || exported.Users[3].Username != "Imported" || !slices.Contains(exported.Users[3].Roles, "deploy") {
+		t.Fatalf("Expected the merged users, got %+v", exported.Users)
+	}
+	if exported.Users[1].Username != "Live" || !slices.Contains(exported.Users[1].Roles, "deploy") {
+		t.Fatalf("Expected the roles of Live to be kept, got %+v", exported.Users[1])
+	}
+
+	// invalid archives are refused before anything is changed
+	invalid := archive
+	invalid.Users = []model.ArchiveUser{{Username: "Unknown", PasswordHash: admin.PasswordHash, Roles: []string{"unknown"}}}
+	invalid.Tokens = nil
+	resp = sendRequest(t, app, cookie, "POST", "/archive?mode=merge", invalid)
+	expectStatus(t, resp, fiber.StatusBadRequest)
+	invalid.Users = []model.ArchiveUser{{Username: "NoAdmin", PasswordHash: admin.PasswordHash}}
+	resp = sendRequest(t, app, cookie, "POST", "/archive?mode=replace", invalid)
+	expectStatus(t, resp, fiber.StatusBadRequest)
+	future := archive
+	future.Version = model.ArchiveVersion + 1
+	resp = sendRequest(t, app, cookie, "POST", "/archive", future)
+	expectStatus(t, resp, fiber.StatusBadRequest)
+
+	// replace restores the exported state (the session of the deleted admin becomes invalid)
+	resp = sendRequest(t, app, cookie, "POST", "/archive?mode=replace", archive)
+	expect2xxStatus(t, resp)
+	readBodyAsJson(t, resp, &result)
+	if result.Users != 3 || result.DeletedUsers != 4 {
+		t.Fatalf("Expected 4 deleted and 3 imported users, got %+v", result)
+	}
+	cookie = login(t, app)
+	resp = sendRequest(t, app, cookie, "GET", "/archive", nil)
+	expect2xxStatus(t, resp)
+	readBodyAsJson(t, resp, &exported)
+	if len(exported.Users) != 3 || exported.Users[2].Email != archive.Users[2].Email || exported.Tokens[0].Token != archive.Tokens[0].Token {
+		t.Fatalf("Expected the replaced data, got %+v", exported)
+	}
+}
+
+func TestArchiveRequiresRecentAuthentication(t *testing.T) {
+	maxAge := config.RecentAuthenticationMaxAge
+	config.RecentAuthenticationMaxAge = time.Nanosecond
+	t.Cleanup(func() { config.RecentAuthenticationMaxAge = maxAge })
+
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	expectStatus(t, sendRequest(t, app, cookie, "GET", "/archive", nil), fiber.StatusForbidden)
+	expectStatus(t, sendRequest(t, app, cookie, "POST", "/archive", model.Archive{Version: model.ArchiveVersion}), fiber.StatusForbidden)
+}
+
+// archive users are validated like created users before anything is changed
+func TestArchiveInvalidUsersRejected(t *testing.T) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	var archive model.Archive
+	resp := sendRequest(t, app, cookie, "GET", "/archive", nil)
+	expect2xxStatus(t, resp)
+	readBodyAsJson(t, resp, &archive)
+	valid := archive.Users[0]
+
+	for name, change := range map[string]func(user *model.ArchiveUser){
+		"invalid name":     func(user *model.ArchiveUser) { user.Username = "in valid" },
+		"invalid email":    func(user *model.ArchiveUser) { user.Email = "not-an-email" },
+		"duplicate role":   func(user *model.ArchiveUser) { user.Roles = []string{"deploy", "deploy"} },
+		"malformed hash":   func(user *model.ArchiveUser) { user.PasswordHash = "plaintext password" },
+		"truncated hash":   func(user *model.ArchiveUser) { user.PasswordHash = valid.PasswordHash[:20] },
+		"missing password": func(user *model.ArchiveUser) { user.PasswordHash = "" },
+	} {
+		user := model.ArchiveUser{Username: "Imported", Email: "imported@example.com", PasswordHash: valid.PasswordHash, Roles: []string{"deploy"}}
+		change(&user)
+		invalid := archive
+		invalid.Users = append(slices.Clone(archive.Users), user)
+		resp = sendRequest(t, app, cookie, "POST", "/archive?mode=merge", invalid)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Fatalf("Expected the archive with %s to be rejected, got %d", name, resp.StatusCode)
+		}
+	}
+
+	resp = sendRequest(t, app, cookie, "GET", "/archive", nil)
+	expect2xxStatus(t, resp)
+	var unchanged model.Archive
+	readBodyAsJson(t, resp, &unchanged)
+	if len(unchanged.Users) != len(archive.Users) {
+		t.Fatalf("Expected no user to be imported, got %+v", unchanged.Users)
+	}
+}
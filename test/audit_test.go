@@ -0,0 +1,226 @@
+package test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestAuditRoleCreated(t *testing.T) {
+	req1, err := http.NewRequest("POST", URL+"/roles", payloadToReader(t, handler.CreateOrUpdateRolePayload{Name: "audited"}))
+	checkError(t, err)
+	req2, err := http.NewRequest("GET", URL+"/audit?action="+model.AuditRoleCreated+"&target_type="+model.AuditTargetRole, nil)
+	checkError(t, err)
+
+	resps := RunMultiRequest(t, req1, req2)
+	expect2xxStatus(t, resps[0])
+	expect2xxStatus(t, resps[1])
+
+	var page model.AuditPage
+	readBodyAsJson(t, resps[1], &page)
+	if page.Total == 0 || len(page.Entries) == 0 {
+		t.Fatalf("Expected audit entries of created roles")
+	}
+	entry := page.Entries[0] // newest first
+	if entry.TargetName != "audited" || entry.ActorName != "Admin" || entry.Changes["name"].After != "audited" {
+		t.Fatalf("Unexpected audit entry: %+v", entry)
+	}
+}
+
+func TestAuditInvalidFilter(t *testing.T) {
+	req, err := http.NewRequest("GET", URL+"/audit?since=yesterday", nil)
+	checkError(t, err)
+	resp := RunRequest(t, req)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Bad status code: Expected %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestAuditChainHash(t *testing.T) {
+	actorID := uint(1)
+	entry := model.AuditEntry{
+		CreatedAt:  time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC),
+		ActorID:    &actorID,
+		ActorName:  "Admin",
+		Action:     model.AuditUserUpdated,
+		TargetType: model.AuditTargetUser,
+		TargetName: "User",
+		Changes:    map[string]model.AuditChange{"email": {Before: "old@example.com", After: "new@example.com"}},
+		PrevHash:   "0123",
+	}
+	hash, err := entry.ChainHash()
+	checkError(t, err)
+
+	// the hash must survive storing and loading the entry
+	bs, err := json.Marshal(entry)
+	checkError(t, err)
+	var loaded model.AuditEntry
+	checkError(t, json.Unmarshal(bs, &loaded))
+	loadedHash, err := loaded.ChainHash()
+	checkError(t, err)
+	if loadedHash != hash {
+		t.Fatalf("Expected the same hash after a round trip, got %s and %s", hash, loadedHash)
+	}
+
+	altered := entry
+	altered.Details = "altered"
+	if alteredHash, _ := altered.ChainHash(); alteredHash == hash {
+		t.Fatalf("Expected a different hash of an altered entry")
+	}
+	relinked := entry
+	relinked.PrevHash = "4567"
+	if relinkedHash, _ := relinked.ChainHash(); relinkedHash == hash {
+		t.Fatalf("Expected a different hash of an entry with another previous entry")
+	}
+}
+
+func TestAuditCheckpointSignature(t *testing.T) {
+	key, err := crypto.ParseEd25519Seed(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	checkError(t, err)
+	checkpoint := model.AuditCheckpoint{CreatedAt: time.Now(), EntryID: 42, Hash: "abcd"}
+	signature := crypto.SignEd25519(key, checkpoint.SignedMessage())
+	publicKey := crypto.Ed25519PublicKey(key)
+	if !crypto.VerifyEd25519(publicKey, checkpoint.SignedMessage(), signature) {
+		t.Fatalf("Expected signature to be valid")
+	}
+	checkpoint.EntryID = 41
+	if crypto.VerifyEd25519(publicKey, checkpoint.SignedMessage(), signature) {
+		t.Fatalf("Expected signature of modified checkpoint to be invalid")
+	}
+	if _, err := crypto.ParseEd25519Seed("dG9vIHNob3J0"); err == nil {
+		t.Fatalf("Expected an error for a seed of the wrong size")
+	}
+}
+
+func TestAuditVerify(t *testing.T) {
+	req, err := http.NewRequest("GET", URL+"/audit/verify", nil)
+	checkError(t, err)
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+
+	var verification model.AuditVerification
+	readBodyAsJson(t, resp, &verification)
+	if !verification.Valid || verification.EntriesChecked == 0 {
+		t.Fatalf("Expected a valid audit log, got %+v", verification)
+	}
+}
+
+// newTestAuditLog returns an audit log with the entries 1-5 and the signed checkpoints of the entries 2, 4 and 5
+func newTestAuditLog(t *testing.T) (*gorm.DB, service.AuditService, ed25519.PrivateKey) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "heimdall.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(db)
+	_, err = migrator.Up()
+	checkError(t, err)
+	key := testSigningKey(t, 1)
+	auditService := service.NewAuditService(repository.NewTransactor(db), repository.NewAuditRepository(db), key, nil)
+	for i := 1; i <= 5; i++ {
+		auditService.Record(model.SystemActor, model.AuditEntry{Action: model.AuditUserUpdated, TargetType: model.AuditTargetUser, TargetName: fmt.Sprint("user", i)})
+		if i == 2 || i == 4 || i == 5 {
+			_, err := auditService.WriteCheckpoint()
+			checkError(t, err)
+		}
+	}
+	expectAuditVerification(t, auditService, nil, nil)
+	return db, auditService, key
+}
+
+func testSigningKey(t *testing.T, seed byte) ed25519.PrivateKey {
+	key, err := crypto.ParseEd25519Seed(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{seed}, 32)))
+	checkError(t, err)
+	return key
+}
+
+// expectAuditVerification verifies the audit log and expects it to be broken at the entry or checkpoint (valid if both are nil)
+func expectAuditVerification(t *testing.T, auditService service.AuditService, brokenEntryID, brokenCheckpointID *uint) {
+	t.Helper()
+	verification, err := auditService.Verify()
+	checkError(t, err)
+	if verification.Valid != (brokenEntryID == nil && brokenCheckpointID == nil) ||
+		!reflect.DeepEqual(verification.BrokenEntryID, brokenEntryID) || !reflect.DeepEqual(verification.BrokenCheckpointID, brokenCheckpointID) {
+		t.Fatalf("Expected broken entry %v and broken checkpoint %v, got %+v", brokenEntryID, brokenCheckpointID, verification)
+	}
+}
+
+func TestAuditVerifyAlteredEntry(t *testing.T) {
+	db, auditService, _ := newTestAuditLog(t)
+	checkError(t, db.Model(&model.AuditEntry{}).Where("id = ?", 3).Update("target_name", "someone else").Error)
+	expectAuditVerification(t, auditService, ptr(uint(3)), nil)
+}
+
+func TestAuditVerifyDeletedEntry(t *testing.T) {
+	db, auditService, _ := newTestAuditLog(t)
+	checkError(t, db.Delete(&model.AuditEntry{}, 3).Error)
+	expectAuditVerification(t, auditService, ptr(uint(4)), nil)
+
+	// rewriting the chain after the deleted entry is detected by the checkpoint of entry 4
+	var entries []model.AuditEntry
+	checkError(t, db.Order("id ASC").Find(&entries).Error)
+	prevHash := ""
+	for _, entry := range entries {
+		entry.PrevHash = prevHash
+		hash, err := entry.ChainHash()
+		checkError(t, err)
+		checkError(t, db.Model(&entry).Updates(map[string]any{"prev_hash": prevHash, "hash": hash}).Error)
+		prevHash = hash
+	}
+	checkError(t, db.Model(&model.AuditChainHead{}).Where("id = 1").Update("hash", prevHash).Error)
+	expectAuditVerification(t, auditService, nil, ptr(uint(2)))
+}
+
+func TestAuditVerifyDeletedCheckpoint(t *testing.T) {
+	db, auditService, _ := newTestAuditLog(t)
+	checkError(t, db.Delete(&model.AuditCheckpoint{}, 2).Error)
+	expectAuditVerification(t, auditService, nil, ptr(uint(3)))
+}
+
+func TestAuditVerifyRotatedKey(t *testing.T) {
+	db, _, key := newTestAuditLog(t)
+	newKey := testSigningKey(t, 2)
+
+	// checkpoints of the previous key are only valid if it is still trusted
+	rotated := service.NewAuditService(repository.NewTransactor(db), repository.NewAuditRepository(db), newKey, nil)
+	expectAuditVerification(t, rotated, nil, ptr(uint(1)))
+	rotated = service.NewAuditService(repository.NewTransactor(db), repository.NewAuditRepository(db), newKey, []string{crypto.Ed25519PublicKey(key)})
+	rotated.Record(model.SystemActor, model.AuditEntry{Action: model.AuditUserUpdated, TargetType: model.AuditTargetUser, TargetName: "user6"})
+	checkpoint, err := rotated.WriteCheckpoint()
+	checkError(t, err)
+	if checkpoint.PublicKey != crypto.Ed25519PublicKey(newKey) || checkpoint.PrevCheckpointID != 3 {
+		t.Fatalf("Expected a checkpoint of the new key after checkpoint 3, got %+v", checkpoint)
+	}
+	expectAuditVerification(t, rotated, nil, nil)
+}
+
+func TestAuditRetentionKeepsLatestEntry(t *testing.T) {
+	db, auditService, _ := newTestAuditLog(t)
+	deleted, err := repository.NewAuditRepository(db).DeleteBefore(time.Now().Add(time.Hour))
+	checkError(t, err)
+	if deleted != 4 {
+		t.Fatalf("Expected all entries except the latest one to be deleted, got %d", deleted)
+	}
+	verification, err := auditService.Verify()
+	checkError(t, err)
+	if !verification.Valid || verification.FirstEntryID != 5 || verification.LastEntryID != 5 {
+		t.Fatalf("Expected a valid log of the latest entry, got %+v", verification)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	config.BootstrapAdminUsername = "Bootstrap"
+	config.BootstrapAdminPassword = "first-admin-password1234"
+	config.BootstrapAdminEmail = "bootstrap@example.com"
+	defer func() {
+		config.BootstrapAdminUsername, config.BootstrapAdminPassword, config.BootstrapAdminEmail = "", "", ""
+	}()
+
+	req, err := http.NewRequest("GET", URL+"/roles/1/users", nil)
+	checkError(t, err)
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+
+	var admins []model.User
+	readBodyAsJson(t, resp, &admins)
+	if len(admins) != 2 || admins[0].Username != "Bootstrap" {
+		t.Fatalf("Expected the bootstrapped admin and Admin, got %+v", admins)
+	}
+}
+
+func TestBootstrapWithInvalidSetupToken(t *testing.T) {
+	payload := handler.BootstrapPayload{
+		SetupToken: "invalid",
+		Username:   "Bootstrap",
+		Password:   "first-admin-password1234",
+		Email:      "bootstrap@example.com",
+	}
+	req, err := http.NewRequest("POST", URL+"/bootstrap", payloadToReader(t, payload))
+	checkError(t, err)
+
+	resp := RunRequest(t, req)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Bad status code: Expected %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+// newTestBootstrap returns the bootstrap service of a new database
+func newTestBootstrap(t *testing.T) (*gorm.DB, service.BootstrapService) {
+	db, userService, roleService := newTestUserService(t)
+	return db, service.NewBootstrapService(userService, roleService)
+}
+
+// newTestUserService returns the user and role services of a new database (without background tasks)
+func newTestUserService(t *testing.T) (*gorm.DB, service.UserService, service.RoleService) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "heimdall.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(db)
+	_, err = migrator.Up()
+	checkError(t, err)
+	transactor := repository.NewTransactor(db)
+	userRepository, roleRepository := repository.NewUserRepository(db), repository.NewRoleRepository(db)
+	auditService := service.NewAuditService(transactor, repository.NewAuditRepository(db), nil, nil)
+	webhookService := service.NewWebhookService(repository.NewWebhookRepository(db), repository.NewWebhookDeliveryRepository(db), auditService)
+	tokenService := service.NewTokenService(repository.NewTokenRepository(db), userRepository,
+		broker.NewLocalBus(service.NewAuthBroker()), broker.NewLocalBus(service.NewUserCreateDeleteBroker()), webhookService, auditService)
+	outboxService := service.NewOutboxService(transactor, repository.NewOutboxRepository(db), userRepository, tokenService)
+	userService := service.NewUserService(userRepository, repository.NewRegistrationKeyRepository(db), roleRepository,
+		repository.NewPasswordHistoryRepository(db), tokenService, service.NewPasswordPolicyService(nil), outboxService, auditService)
+	roleService := service.NewRoleService(roleRepository, userRepository, outboxService, auditService)
+	return db, userService, roleService
+}
+
+// the admin is created together with its role, so the bootstrap can be repeated if the role cannot be assigned
+func TestBootstrapAdminAtomic(t *testing.T) {
+	config.BootstrapAdminUsername = "Bootstrap"
+	config.BootstrapAdminPassword = "first-admin-password1234"
+	config.BootstrapAdminEmail = "bootstrap@example.com"
+	defer func() {
+		config.BootstrapAdminUsername, config.BootstrapAdminPassword, config.BootstrapAdminEmail = "", "", ""
+	}()
+	db, bootstrapService := newTestBootstrap(t)
+	count := func(value any, conditions ...any) int64 {
+		var count int64
+		query := db.Model(value)
+		if len(conditions) > 0 {
+			query = query.Where(conditions[0], conditions[1:]...)
+		}
+		checkError(t, query.Count(&count).Error)
+		return count
+	}
+
+	// the roles of users cannot be stored
+	checkError(t, db.Exec("CREATE TRIGGER user_roles_unavailable BEFORE INSERT ON user_roles BEGIN SELECT RAISE(ABORT, 'unavailable'); END").Error)
+	if err := bootstrapService.Bootstrap(); err == nil {
+		t.Fatalf("Expected the bootstrap to fail")
+	}
+	if users, entries, events := count(&model.User{}), count(&model.AuditEntry{}, "action = ?", model.AuditUserCreated), count(&model.OutboxEvent{}); users != 0 || entries != 0 || events != 0 {
+		t.Fatalf("Expected no admin without the admin role, got %d users, %d audit entries and %d outbox events", users, entries, events)
+	}
+
+	checkError(t, db.Exec("DROP TRIGGER user_roles_unavailable").Error)
+	checkError(t, bootstrapService.Bootstrap())
+	var admin model.User
+	checkError(t, db.Preload("Roles").First(&admin, "username = ?", "Bootstrap").Error)
+	if len(admin.Roles) != 1 || admin.Roles[0].Name != config.AdminRoleName {
+		t.Fatalf("Expected the admin with the admin role, got %+v", admin)
+	}
+	if events := count(&model.OutboxEvent{}); events != 2 {
+		t.Fatalf("Expected the user.created and user.roles_changed events, got %d outbox events", events)
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+)
+
+// SHA-1 hashes of "password1234" (seen 3 times) and "hunter2" (seen once)
+const breachedPasswordsFile = `E6B6AFBD6D76BB5D2041542D7D2E3FAC5BB05593:3
+F3BBBD66A63D4BF1747940578EC3D0103530E21D:1
+`
+
+func TestBreachedPasswordSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	checkError(t, os.WriteFile(path, []byte(breachedPasswordsFile), 0o600))
+
+	set, err := crypto.LoadBreachedPasswordSet(path, 1)
+	checkError(t, err)
+	if set.Len() != 2 {
+		t.Fatalf("Expected 2 hashes, got %d", set.Len())
+	}
+	if !set.Contains("password1234") || !set.Contains("hunter2") {
+		t.Fatalf("Expected breached passwords to be found")
+	}
+	if set.Contains("correct horse battery staple") {
+		t.Fatalf("Expected password that was not breached to not be found")
+	}
+}
+
+func TestBreachedPasswordSetMinCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	checkError(t, os.WriteFile(path, []byte(breachedPasswordsFile), 0o600))
+
+	set, err := crypto.LoadBreachedPasswordSet(path, 2)
+	checkError(t, err)
+	if !set.Contains("password1234") {
+		t.Fatalf("Expected password seen 3 times to be found")
+	}
+	if set.Contains("hunter2") {
+		t.Fatalf("Expected password seen once to be skipped")
+	}
+}
+
+// expectBreachedPasswordRejected expects a bad request that names the breached password as the reason
+func expectBreachedPasswordRejected(t *testing.T, resp *http.Response) {
+	expectStatus(t, resp, http.StatusBadRequest)
+	body, err := io.ReadAll(resp.Body)
+	checkError(t, err)
+	if !strings.Contains(string(body), "breached") {
+		t.Fatalf("Expected the password to be rejected as breached, got %q", body)
+	}
+}
+
+func TestBreachedPasswordRejected(t *testing.T) {
+	// SHA-1 hash of "correct horse battery staple" (which satisfies all other rules of the password policy)
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	checkError(t, os.WriteFile(path, []byte("ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42:42\n"), 0o600))
+	breachedPasswordsFile := config.BreachedPasswordsFile
+	config.BreachedPasswordsFile = path
+	t.Cleanup(func() { config.BreachedPasswordsFile = breachedPasswordsFile })
+
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	expectBreachedPasswordRejected(t, sendRequest(t, app, "", "POST", "/register", handler.RegisterPayload{
+		Username:        "Breached",
+		Password:        "correct horse battery staple",
+		Email:           "breached@example.com",
+		RegistrationKey: "test_registration_key",
+	}))
+	expectBreachedPasswordRejected(t, changeUserPassword(t, app, cookie, "correct horse battery staple"))
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "correct horse battery stable"))
+}
@@ -0,0 +1,348 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/redis/go-redis/v9"
+)
+
+type testMessage struct {
+	Key   string
+	Value int
+}
+
+func newTestBroker(queueSize int) *broker.Broker[testMessage] {
+	return broker.New(queueSize, 0, func(m testMessage) string { return m.Key })
+}
+
+// publishes in a goroutine and fails if publishing blocks
+func publishWithTimeout(t *testing.T, b *broker.Broker[testMessage], topic string, msgs ...testMessage) {
+	done := make(chan struct{})
+	go func() {
+		for _, m := range msgs {
+			b.Publish(topic, m)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Publishing blocked on a stuck subscriber")
+	}
+}
+
+func TestBrokerStuckSubscriberIsDisconnected(t *testing.T) {
+	b := newTestBroker(4)
+	stuck := b.Subscribe("topic") // never drained
+
+	var msgs []testMessage
+	for i := range 100 {
+		msgs = append(msgs, testMessage{Key: strconv.Itoa(i), Value: i})
+	}
+	publishWithTimeout(t, b, "topic", msgs...)
+
+	select {
+	case <-stuck.Done():
+	default:
+		t.Fatalf("Expected stuck subscriber to be disconnected")
+	}
+	if !errors.Is(stuck.Err(), broker.ErrSlowConsumer) {
+		t.Fatalf("Expected ErrSlowConsumer, got %v", stuck.Err())
+	}
+	if stats := b.Stats(); stats.Subscribers != 0 || stats.Disconnected != 1 {
+		t.Fatalf("Expected no subscribers and one disconnect, got %+v", stats)
+	}
+}
+
+func TestBrokerStuckSubscriberDoesNotAffectOthers(t *testing.T) {
+	b := newTestBroker(4)
+	b.Subscribe("topic") // never drained
+	healthy := b.Subscribe("topic")
+
+	received := 0
+	for i := range 20 {
+		publishWithTimeout(t, b, "topic", testMessage{Key: strconv.Itoa(i), Value: i})
+		select {
+		case <-healthy.Ready():
+			received += len(healthy.Drain())
+		case <-time.After(time.Second):
+			t.Fatalf("Healthy subscriber did not receive message %d", i)
+		}
+	}
+	if received != 20 {
+		t.Fatalf("Expected 20 messages, got %d", received)
+	}
+	if healthy.Err() != nil {
+		t.Fatalf("Expected healthy subscriber to stay connected, got %v", healthy.Err())
+	}
+}
+
+func TestBrokerCoalescesMessagesWithSameKey(t *testing.T) {
+	b := newTestBroker(2)
+	sub := b.Subscribe("user")
+
+	var msgs []testMessage
+	for i := range 50 {
+		msgs = append(msgs, testMessage{Key: "user", Value: i})
+	}
+	publishWithTimeout(t, b, "user", msgs...)
+
+	if sub.Err() != nil {
+		t.Fatalf("Expected subscriber to stay connected, got %v", sub.Err())
+	}
+	if stats := b.Stats(); stats.MaxQueueDepth != 1 || stats.Coalesced != 49 {
+		t.Fatalf("Expected queue depth 1 and 49 coalesced messages, got %+v", stats)
+	}
+	got := sub.Drain()
+	if len(got) != 1 || got[0].Message.Value != 49 {
+		t.Fatalf("Expected only the latest message, got %+v", got)
+	}
+}
+
+func TestBrokerCloseTopic(t *testing.T) {
+	b := newTestBroker(2)
+	sub1 := b.Subscribe("user")
+	sub2 := b.Subscribe("user")
+	other := b.Subscribe("other")
+
+	b.CloseTopic("user")
+
+	for _, sub := range []*broker.Subscription[testMessage]{sub1, sub2} {
+		if !errors.Is(sub.Err(), broker.ErrClosed) {
+			t.Fatalf("Expected subscription to be closed, got %v", sub.Err())
+		}
+	}
+	if other.Err() != nil {
+		t.Fatalf("Expected subscription of other topic to stay open")
+	}
+	// unsubscribing a closed subscription must not panic
+	b.Unsubscribe(sub1)
+	b.Unsubscribe(sub1)
+	if b.HasSubscribers("user") {
+		t.Fatalf("Expected no subscribers for closed topic")
+	}
+}
+
+func TestBrokerEventIDsIncrease(t *testing.T) {
+	b := newTestBroker(10)
+	sub := b.Subscribe("topic")
+	publishWithTimeout(t, b, "topic", testMessage{Key: "a"}, testMessage{Key: "b"}, testMessage{Key: "c"})
+
+	events := sub.Drain()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if events[0].ID <= sub.StartID() || events[1].ID <= events[0].ID || events[2].ID <= events[1].ID {
+		t.Fatalf("Expected increasing event ids after %d, got %+v", sub.StartID(), events)
+	}
+}
+
+func TestBrokerReplayAfterLastEventID(t *testing.T) {
+	b := broker.New(10, 100, func(m testMessage) string { return m.Key })
+	first := b.Publish("user", testMessage{Key: "a", Value: 1})
+	b.Publish("other", testMessage{Key: "b", Value: 2})
+	b.Publish("user", testMessage{Key: "c", Value: 3})
+	b.Publish("user", testMessage{Key: "d", Value: 4})
+
+	sub, replayed := b.SubscribeFrom("user", first)
+	if !replayed {
+		t.Fatalf("Expected events to be replayed")
+	}
+	events := sub.Drain()
+	if len(events) != 2 || events[0].Message.Value != 3 || events[1].Message.Value != 4 {
+		t.Fatalf("Expected the two missed events of the topic, got %+v", events)
+	}
+}
+
+func TestBrokerReplayNotPossible(t *testing.T) {
+	b := broker.New(10, 2, func(m testMessage) string { return m.Key })
+	first := b.Publish("user", testMessage{Key: "a"})
+	b.Publish("user", testMessage{Key: "b"})
+	b.Publish("user", testMessage{Key: "c"})
+	b.Publish("user", testMessage{Key: "d"})
+
+	// the events after first are no longer retained
+	if _, replayed := b.SubscribeFrom("user", first); replayed {
+		t.Fatalf("Expected replay to fail for events that are no longer retained")
+	}
+	// unknown event id from the future
+	if _, replayed := b.SubscribeFrom("user", b.LastEventID()+10); replayed {
+		t.Fatalf("Expected replay to fail for unknown event id")
+	}
+	// nothing missed
+	sub, replayed := b.SubscribeFrom("user", b.LastEventID())
+	if !replayed || sub.Len() != 0 {
+		t.Fatalf("Expected successful replay without events")
+	}
+}
+
+func TestBrokerPublishEventIgnoresOldIDs(t *testing.T) {
+	b := broker.New(10, 100, func(m testMessage) string { return m.Key })
+	sub := b.Subscribe("topic")
+	start := b.LastEventID()
+	b.PublishEvent(broker.Event[testMessage]{ID: start + 10, Topic: "topic", Message: testMessage{Key: "a", Value: 1}})
+	b.PublishEvent(broker.Event[testMessage]{ID: start + 5, Topic: "topic", Message: testMessage{Key: "b", Value: 2}}) // e.g. delivered twice by the bus
+	b.PublishEvent(broker.Event[testMessage]{ID: start + 11, Topic: "topic", Message: testMessage{Key: "c", Value: 3}})
+
+	events := sub.Drain()
+	if len(events) != 2 || events[0].ID != start+10 || events[1].ID != start+11 {
+		t.Fatalf("Expected only the events with increasing ids, got %+v", events)
+	}
+	if b.LastEventID() != start+11 {
+		t.Fatalf("Expected last event id %d, got %d", start+11, b.LastEventID())
+	}
+}
+
+func TestBrokerSubscribeAll(t *testing.T) {
+	b := broker.New(2, 100, func(m testMessage) string { return m.Key })
+	all := b.SubscribeAll(10) // larger queue than the subscriptions of single topics
+	publishWithTimeout(t, b, "user", testMessage{Key: "a", Value: 1}, testMessage{Key: "b", Value: 2}, testMessage{Key: "c", Value: 3})
+	publishWithTimeout(t, b, "other", testMessage{Key: "a", Value: 4})
+	b.CloseTopic("user")
+
+	if all.Err() != nil {
+		t.Fatalf("Expected subscription to all topics to stay open after closing a topic, got %v", all.Err())
+	}
+	events := all.Drain()
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events of all topics, got %+v", events)
+	}
+	if events[3].Topic != "other" || events[3].Message.Value != 4 {
+		t.Fatalf("Expected message with the same key of another topic not to be coalesced, got %+v", events[3])
+	}
+	if !events[4].Closed || events[4].Topic != "user" {
+		t.Fatalf("Expected close event of topic user, got %+v", events[4])
+	}
+
+	// the close event is replayed to subscriptions to all topics, but not to subscriptions of the topic
+	replayedAll, replayed := b.SubscribeAllFrom(events[2].ID, 10)
+	if !replayed || replayedAll.Len() != 2 {
+		t.Fatalf("Expected the two missed events of all topics to be replayed")
+	}
+	replayedUser, replayed := b.SubscribeFrom("user", events[2].ID)
+	if !replayed || replayedUser.Len() != 0 {
+		t.Fatalf("Expected no replayed events for the closed topic")
+	}
+}
+
+func TestEventIDFromStreamID(t *testing.T) {
+	for streamID, expected := range map[string]uint64{
+		"0-1":             1,
+		"1-0":             1 << 20,
+		"1-5":             1<<20 | 5,
+		"1700000000000-3": 1700000000000<<20 | 3,
+		"5-1048575":       5<<20 | 1048575,
+	} {
+		id, err := broker.EventIDFromStreamID(streamID)
+		checkError(t, err)
+		if id != expected {
+			t.Fatalf("Expected event id %d of stream id %s, got %d", expected, streamID, id)
+		}
+	}
+	// the event ids increase like the stream ids
+	previous, _ := broker.EventIDFromStreamID("5-1048575")
+	next, _ := broker.EventIDFromStreamID("6-0")
+	if next <= previous {
+		t.Fatalf("Expected event id %d to be greater than %d", next, previous)
+	}
+	for _, streamID := range []string{"", "1", "x-1", "1-x", "1-1048576"} {
+		if _, err := broker.EventIDFromStreamID(streamID); err == nil {
+			t.Fatalf("Expected an error for stream id %q", streamID)
+		}
+	}
+}
+
+// closeWithTimeout closes the bus and fails if closing blocks
+func closeWithTimeout(t *testing.T, bus broker.Bus[testMessage]) {
+	done := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Closing the bus blocked")
+	}
+}
+
+func TestRedisBusCloseWithoutConnection(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	bus := broker.NewRedisBus(client, "heimdall:test:unreachable", 10, newTestBroker(4))
+	time.Sleep(100 * time.Millisecond) // the reader is waiting to retry
+	closeWithTimeout(t, bus)
+}
+
+// newTestRedisClient connects to the Redis of the configuration or skips the test
+func newTestRedisClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", config.RedisHost, config.RedisPort),
+		Username: config.RedisUser,
+		Password: config.RedisPassword,
+	})
+	t.Cleanup(func() { client.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis is not available:", err)
+	}
+	return client
+}
+
+// waitForEvents waits until the subscription received the number of events
+func waitForEvents(t *testing.T, sub *broker.Subscription[testMessage], count int) []broker.Event[testMessage] {
+	var events []broker.Event[testMessage]
+	timeout := time.After(5 * time.Second)
+	for len(events) < count {
+		select {
+		case <-sub.Ready():
+			events = append(events, sub.Drain()...)
+		case <-timeout:
+			t.Fatalf("Expected %d events, got %v", count, events)
+		}
+	}
+	return events
+}
+
+func TestRedisBusDeliversToOtherInstances(t *testing.T) {
+	client := newTestRedisClient(t)
+	stream := "heimdall:test:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	t.Cleanup(func() { client.Del(context.Background(), stream) })
+	publisher := broker.NewRedisBus(client, stream, 10, newTestBroker(4))
+	receiver := broker.NewRedisBus(client, stream, 10, newTestBroker(4))
+	t.Cleanup(func() { closeWithTimeout(t, publisher); closeWithTimeout(t, receiver) })
+	time.Sleep(100 * time.Millisecond) // both instances are reading the stream
+
+	sub := receiver.Broker().Subscribe("topic")
+	local := publisher.Broker().Subscribe("topic")
+	publisher.Publish("topic", testMessage{Key: "a", Value: 1})
+	events := waitForEvents(t, sub, 1)
+	localEvents := waitForEvents(t, local, 1)
+	if events[0].Message != (testMessage{Key: "a", Value: 1}) {
+		t.Fatalf("Unexpected event %+v", events[0])
+	}
+
+	// the event ids are derived from the stream entry id and the same on all instances
+	entries, err := client.XRange(context.Background(), stream, "-", "+").Result()
+	checkError(t, err)
+	expectedID, err := broker.EventIDFromStreamID(entries[len(entries)-1].ID)
+	checkError(t, err)
+	if events[0].ID != expectedID || localEvents[0].ID != expectedID {
+		t.Fatalf("Expected event id %d on both instances, got %d and %d", expectedID, events[0].ID, localEvents[0].ID)
+	}
+
+	publisher.CloseTopic("topic")
+	select {
+	case <-sub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the subscription of the other instance to be closed")
+	}
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// useCommandDatabase runs the commands of the test against a new sqlite database and returns its file
+func useCommandDatabase(t *testing.T) string {
+	driver, file := config.DatabaseDriver, config.DatabaseFile
+	t.Cleanup(func() { config.DatabaseDriver, config.DatabaseFile = driver, file })
+	config.DatabaseDriver = "sqlite"
+	config.DatabaseFile = filepath.Join(t.TempDir(), "heimdall.db")
+	return config.DatabaseFile
+}
+
+func TestCommands(t *testing.T) {
+	useCommandDatabase(t)
+
+	seedFile := filepath.Join(t.TempDir(), "seed.json")
+	checkError(t, os.WriteFile(seedFile, []byte(`{
+		"roles": ["admin", "staging"],
+		"registration_keys": [{"key": "staging_registration_key", "expires_in": "24h"}],
+		"users": [{"username": "Staging", "password": "seeded-password1234", "email": "staging@example.com",
+			"registration_key": "staging_registration_key", "roles": ["staging"], "api_token": {"permanent": true}}]
+	}`), 0600))
+	invalidSeedFile := filepath.Join(t.TempDir(), "invalid.yaml")
+	checkError(t, os.WriteFile(invalidSeedFile, []byte("users:\n  - name: Typo\n"), 0600))
+
+	commands := []struct {
+		args     []string
+		exitCode int
+	}{
+		{[]string{"migrate", "status"}, 0},
+		{[]string{"key", "generate", "-permanent", "-description", "cli"}, 0},
+		{[]string{"key", "generate", "-expires", "never"}, 2},
+		{[]string{"user", "add-role", "unknown", "admin"}, 2},
+		{[]string{"token", "revoke", "unknown"}, 2},
+		{[]string{"seed", seedFile}, 0},
+		{[]string{"seed", seedFile}, 0}, // idempotent
+		{[]string{"user", "add-role", "Staging", "admin"}, 0},
+		{[]string{"seed", invalidSeedFile}, 2},
+		{[]string{"seed", "missing.yaml"}, 2},
+		{[]string{"export"}, 0},
+		{[]string{"import", "missing.json"}, 2},
+		{[]string{"import", "-mode", "replace"}, 2},
+		{[]string{"audit", "verify"}, 0},
+		{[]string{"unknown"}, 2},
+	}
+	for _, command := range commands {
+		if exitCode := setup.RunCommand(command.args); exitCode != command.exitCode {
+			t.Fatalf("Expected exit code %d of %v, got %d", command.exitCode, command.args, exitCode)
+		}
+	}
+}
+
+// runCommandWithInput runs a command with the input as its standard input (like echo "$PASSWORD" | heimdall ...)
+func runCommandWithInput(t *testing.T, input string, args ...string) int {
+	inputFile := filepath.Join(t.TempDir(), "stdin")
+	checkError(t, os.WriteFile(inputFile, []byte(input), 0600))
+	stdin, err := os.Open(inputFile)
+	checkError(t, err)
+	defer stdin.Close()
+	previous := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = previous }()
+	return setup.RunCommand(args)
+}
+
+func TestPasswordCommands(t *testing.T) {
+	databaseFile := useCommandDatabase(t)
+
+	commands := []struct {
+		input    string
+		args     []string
+		exitCode int
+	}{
+		{"first-admin-password-1234\n", []string{"bootstrap-admin", "Root", "root@example.com"}, 0},
+		{"second-admin-password-1234\n", []string{"bootstrap-admin", "Other", "other@example.com"}, 2}, // there already is an admin
+		{"first-user-password-1234\n", []string{"user", "create", "Alice", "alice@example.com"}, 0},
+		{"first-user-password-1234\n", []string{"user", "create", "Alice", "alice@example.com"}, 2}, // duplicate
+		{"short\n", []string{"user", "create", "Bob", "bob@example.com"}, 2},                        // password policy
+		{"", []string{"user", "create", "Bob", "bob@example.com"}, 2},                               // no password
+		{"reset-user-password-5678", []string{"user", "reset-password", "Alice"}, 0},                // without newline
+		{"first-user-password-1234\n", []string{"user", "reset-password", "Alice"}, 2},              // password history
+		{"", []string{"user", "reset-password", "Alice"}, 2},
+		{"", []string{"user", "reset-password", "unknown"}, 2},
+		{"", []string{"token", "revoke", "Alice"}, 0},
+	}
+	for _, command := range commands {
+		if exitCode := runCommandWithInput(t, command.input, command.args...); exitCode != command.exitCode {
+			t.Fatalf("Expected exit code %d of %v, got %d", command.exitCode, command.args, exitCode)
+		}
+	}
+
+	db, err := gorm.Open(sqlite.Open(databaseFile), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	var root, alice model.User
+	checkError(t, db.Preload(clause.Associations).First(&root, "username = ?", "Root").Error)
+	checkError(t, db.Preload(clause.Associations).First(&alice, "username = ?", "Alice").Error)
+	if len(root.Roles) != 1 || root.Roles[0].Name != config.AdminRoleName || !crypto.PasswordMatchesHash("first-admin-password-1234", root.Password) {
+		t.Fatalf("Expected the admin Root with the password of the standard input, got %+v", root)
+	}
+	if len(alice.Roles) != 0 || !crypto.PasswordMatchesHash("reset-user-password-5678", alice.Password) {
+		t.Fatalf("Expected the user Alice with the reset password, got %+v", alice)
+	}
+	if alice.ApiToken != nil {
+		t.Fatalf("Expected the API token of Alice to be revoked, got %+v", alice.ApiToken)
+	}
+
+	// the changes are left to the running server, the commands do not dispatch them
+	var events []model.OutboxEvent
+	checkError(t, db.Order("id").Find(&events).Error)
+	var types []string
+	for _, event := range events {
+		if event.DispatchedAt != nil || event.Attempts != 0 {
+			t.Fatalf("Expected the outbox events to be left for the server, got %+v", event)
+		}
+		types = append(types, event.Type)
+	}
+	expected := []string{model.OutboxUserCreated, model.OutboxUserRolesChanged, model.OutboxUserCreated, model.OutboxCredentialsChanged, model.OutboxCredentialsChanged}
+	if !slices.Equal(types, expected) {
+		t.Fatalf("Expected the outbox events %v, got %v", expected, types)
+	}
+}
+
+// the expiry notifications are left to the running server, the commands do not claim them
+func TestCommandsLeaveExpiryClaims(t *testing.T) {
+	databaseFile := useCommandDatabase(t)
+	seedFile := filepath.Join(t.TempDir(), "seed.yaml")
+	checkError(t, os.WriteFile(seedFile, []byte("users:\n  - username: Expired\n    password: seeded-password1234\n    email: expired@example.com\n    api_token: {}\n"), 0600))
+	if exitCode := setup.RunCommand([]string{"seed", seedFile}); exitCode != 0 {
+		t.Fatalf("Expected exit code 0 of the seed, got %d", exitCode)
+	}
+
+	db, err := gorm.Open(sqlite.Open(databaseFile), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	checkError(t, db.Model(&model.Token{}).Where("true").Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	if exitCode := setup.RunCommand([]string{"key", "generate", "-permanent"}); exitCode != 0 {
+		t.Fatalf("Expected exit code 0 of the key generation, got %d", exitCode)
+	}
+	time.Sleep(500 * time.Millisecond) // an expiry scheduler would claim the expired token right away
+
+	var token model.Token
+	checkError(t, db.First(&token).Error)
+	if token.ExpiryWarned || token.ExpiryNotified {
+		t.Fatalf("Expected the expiry of the token to be left for the server, got %+v", token)
+	}
+}
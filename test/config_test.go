@@ -0,0 +1,117 @@
+package test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+)
+
+func TestConfigReload(t *testing.T) {
+	app := setup.SetupTest()
+	configFile := filepath.Join(t.TempDir(), "heimdall.yaml")
+	config.ConfigFile = configFile
+	t.Cleanup(func() {
+		config.ConfigFile = ""
+		if _, err := config.Reload(); err != nil {
+			t.Errorf("Could not restore the configuration: %v", err)
+		}
+	})
+	writeConfig := func(content string) {
+		checkError(t, os.WriteFile(configFile, []byte(content), 0o600))
+	}
+
+	writeConfig(`
+rate_limit: 100
+cors_allow_origins:
+  - https://lighthouse.uni-kiel.de
+  - https://reloaded.example
+internal_ips: [192.0.2.1]
+db_name: other
+`)
+	restartRequired, err := config.Reload()
+	checkError(t, err)
+	if config.RateLimit.Get() != 100 || len(config.InternalIPs.Get()) != 1 {
+		t.Fatalf("Expected the reloaded settings, got RATE_LIMIT=%d INTERNAL_IPS=%v", config.RateLimit.Get(), config.InternalIPs.Get())
+	}
+	if !slices.Equal(restartRequired, []string{"DB_NAME"}) {
+		t.Fatalf("Expected DB_NAME to require a restart, got %v", restartRequired)
+	}
+	// the CORS middleware of the running app uses the reloaded origins
+	req, err := http.NewRequest("GET", URL+"/live", http.NoBody)
+	checkError(t, err)
+	req.Header.Add("Origin", "https://reloaded.example")
+	resp, err := app.Test(req)
+	checkError(t, err)
+	if allowed := resp.Header.Get("Access-Control-Allow-Origin"); allowed != "https://reloaded.example" {
+		t.Fatalf("Expected the reloaded origin to be allowed, got %q", allowed)
+	}
+
+	// invalid values and unknown settings keep all previous settings
+	for _, invalid := range []string{
+		"rate_limit: 50\ninternal_ips: not-an-ip\n",
+		"rate_limit: 50\ncors_allow_origins: https://example.com/path\n",
+		"rate_limit: many\n",
+		"rate_limit: 50\nrate_limt: 50\n",
+		"rate_limit: 0\n",
+		"rate_limit: 50\nrate_limit_unauthorized: -5\n",
+		"rate_limit: 50\nrate_limit_password_check: 0\n",
+	} {
+		writeConfig(invalid)
+		if _, err := config.Reload(); err == nil {
+			t.Fatalf("Expected an error for the config file %q", invalid)
+		}
+		if config.RateLimit.Get() != 100 || len(config.InternalIPs.Get()) != 1 {
+			t.Fatalf("Expected the previous settings after %q, got RATE_LIMIT=%d", invalid, config.RateLimit.Get())
+		}
+		for _, setting := range config.Settings() {
+			if setting.Name == "RATE_LIMIT" && setting.Value != "100" {
+				t.Fatalf("Expected the previous RATE_LIMIT to be printed after %q, got %q", invalid, setting.Value)
+			}
+		}
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Expected the configuration to stay valid, got %v", err)
+	}
+}
+
+func TestConfigSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFile, secretFile := filepath.Join(dir, "heimdall.yaml"), filepath.Join(dir, "db_pass")
+	config.ConfigFile = configFile
+	t.Cleanup(func() {
+		config.ConfigFile = ""
+		if _, err := config.Reload(); err != nil {
+			t.Errorf("Could not restore the configuration: %v", err)
+		}
+	})
+	checkError(t, os.WriteFile(configFile, []byte("db_pass_file: "+secretFile+"\n"), 0o600))
+
+	// a rotated secret is read again and requires a restart
+	checkError(t, os.WriteFile(secretFile, []byte("rotated-password\n"), 0o600))
+	restartRequired, err := config.Reload()
+	checkError(t, err)
+	if !slices.Contains(restartRequired, "DB_PASS") {
+		t.Fatalf("Expected DB_PASS to require a restart, got %v", restartRequired)
+	}
+	for _, setting := range config.Settings() {
+		if setting.Name == "DB_PASS" && setting.Value != "[REDACTED]" {
+			t.Fatalf("Expected DB_PASS to be redacted, got %q", setting.Value)
+		}
+	}
+
+	// unreadable secret files and secrets that are set twice are refused
+	checkError(t, os.Remove(secretFile))
+	if _, err := config.Reload(); err == nil {
+		t.Fatal("Expected an error for the missing DB_PASS_FILE")
+	}
+	checkError(t, os.WriteFile(secretFile, []byte("rotated-password"), 0o600))
+	t.Setenv("DB_PASS", "other-password")
+	if _, err := config.Reload(); err == nil {
+		t.Fatal("Expected an error for DB_PASS and DB_PASS_FILE")
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+	"github.com/gofiber/fiber/v2"
+)
+
+// createDisableWebhook creates a webhook that subscribes to user.disabled and user.enabled and returns its id
+func createDisableWebhook(t *testing.T, app *fiber.App, cookie string) uint {
+	payload := handler.CreateWebhookPayload{
+		URL:     "https://example.com/hooks/heimdall",
+		Events:  []string{model.WebhookEventUserDisabled, model.WebhookEventUserEnabled},
+		Enabled: true,
+	}
+	resp := sendRequest(t, app, cookie, "POST", "/webhooks", payload)
+	expect2xxStatus(t, resp)
+	var created handler.CreateWebhookResponse
+	readBodyAsJson(t, resp, &created)
+	return created.ID
+}
+
+func getUser(t *testing.T, app *fiber.App, cookie string, id uint) model.User {
+	resp := sendRequest(t, app, cookie, "GET", fmt.Sprintf("/users/%d", id), nil)
+	expect2xxStatus(t, resp)
+	var user model.User
+	readBodyAsJson(t, resp, &user)
+	return user
+}
+
+// latestUserAudit returns the newest audit entry of the action on the user
+func latestUserAudit(t *testing.T, app *fiber.App, cookie, action string, id uint) model.AuditEntry {
+	resp := sendRequest(t, app, cookie, "GET", "/audit?action="+action+"&target_type="+model.AuditTargetUser, nil)
+	expect2xxStatus(t, resp)
+	var page model.AuditPage
+	readBodyAsJson(t, resp, &page)
+	for _, entry := range page.Entries { // newest first
+		if entry.TargetID != nil && *entry.TargetID == id {
+			return entry
+		}
+	}
+	t.Fatalf("Expected a %s audit entry of user %d, got %+v", action, id, page.Entries)
+	return model.AuditEntry{}
+}
+
+// waitForDeliveries waits until the webhook has deliveries of all event types (in this order)
+func waitForDeliveries(t *testing.T, app *fiber.App, cookie string, webhookID uint, eventTypes ...string) {
+	t.Helper()
+	var received []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		resp := sendRequest(t, app, cookie, "GET", fmt.Sprintf("/webhooks/%d/deliveries", webhookID), nil)
+		expect2xxStatus(t, resp)
+		var deliveries []model.WebhookDelivery
+		readBodyAsJson(t, resp, &deliveries)
+		slices.SortFunc(deliveries, func(a, b model.WebhookDelivery) int { return int(a.ID) - int(b.ID) })
+		received = nil
+		for _, delivery := range deliveries {
+			received = append(received, delivery.EventType)
+		}
+		if slices.Equal(received, eventTypes) {
+			return
+		}
+	}
+	t.Fatalf("Expected deliveries of %v, got %v", eventTypes, received)
+}
+
+func TestDisableAndEnableUser(t *testing.T) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	webhookID := createDisableWebhook(t, app, cookie)
+
+	expect2xxStatus(t, sendRequest(t, app, cookie, "PUT", "/users/3/disable", handler.DisableUserPayload{Reason: "spam"}))
+	user := getUser(t, app, cookie, 3)
+	if !user.Disabled || user.DisabledReason != "spam" || user.DisabledUntil != nil {
+		t.Fatalf("Expected the user to be disabled indefinitely, got %+v", user)
+	}
+	expectStatus(t, sendRequest(t, app, "", "POST", "/login", handler.LoginPayload{Username: "User", Password: TESTPASSWORD}), fiber.StatusForbidden)
+	if entry := latestUserAudit(t, app, cookie, model.AuditUserDisabled, 3); entry.ActorName != TESTUSER {
+		t.Fatalf("Expected the admin to have disabled the user, got %+v", entry)
+	}
+
+	expect2xxStatus(t, sendRequest(t, app, cookie, "DELETE", "/users/3/disable", nil))
+	user = getUser(t, app, cookie, 3)
+	if user.Disabled || user.DisabledReason != "" {
+		t.Fatalf("Expected the user to be enabled, got %+v", user)
+	}
+	expect2xxStatus(t, sendRequest(t, app, "", "POST", "/login", handler.LoginPayload{Username: "User", Password: TESTPASSWORD}))
+	if entry := latestUserAudit(t, app, cookie, model.AuditUserEnabled, 3); entry.ActorName != TESTUSER {
+		t.Fatalf("Expected the admin to have enabled the user, got %+v", entry)
+	}
+	waitForDeliveries(t, app, cookie, webhookID, model.WebhookEventUserDisabled, model.WebhookEventUserEnabled)
+}
+
+func TestDisableUntilPast(t *testing.T) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	until := time.Now().Add(-time.Minute)
+	resp := sendRequest(t, app, cookie, "PUT", "/users/3/disable", handler.DisableUserPayload{Until: &until})
+	expectStatus(t, resp, fiber.StatusBadRequest)
+}
+
+// the user is enabled by the system when the until-date passes, without logging in
+func TestDisableUntilExpires(t *testing.T) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	webhookID := createDisableWebhook(t, app, cookie)
+
+	until := time.Now().Add(time.Second)
+	expect2xxStatus(t, sendRequest(t, app, cookie, "PUT", "/users/3/disable", handler.DisableUserPayload{Reason: "cool down", Until: &until}))
+	if user := getUser(t, app, cookie, 3); !user.Disabled || user.DisabledUntil == nil {
+		t.Fatalf("Expected the user to be disabled until %v, got %+v", until, user)
+	}
+
+	var user model.User
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if user = getUser(t, app, cookie, 3); !user.Disabled {
+			break
+		}
+	}
+	if user.Disabled || user.DisabledUntil != nil || user.DisabledReason != "" {
+		t.Fatalf("Expected the user to be enabled after %v, got %+v", until, user)
+	}
+	if time.Now().Before(until) {
+		t.Fatalf("Expected the user to be enabled after %v, not before", until)
+	}
+	entry := latestUserAudit(t, app, cookie, model.AuditUserEnabled, 3)
+	if entry.ActorName != model.SystemActor.Username || entry.ActorID != nil || entry.Changes["disabled"].Before != true {
+		t.Fatalf("Expected the system to have enabled the user, got %+v", entry)
+	}
+	waitForDeliveries(t, app, cookie, webhookID, model.WebhookEventUserDisabled, model.WebhookEventUserEnabled)
+}
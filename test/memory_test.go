@@ -0,0 +1,61 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+)
+
+// operations outside of a transaction must neither read its uncommitted changes nor be undone by its rollback
+func TestMemoryTransactionIsolation(t *testing.T) {
+	store := repository.NewMemoryStore()
+	roleRepository := repository.NewMemoryRoleRepository(store)
+	role := model.Role{Name: "before"}
+	checkError(t, roleRepository.Save(&role))
+
+	written := make(chan struct{})
+	read := make(chan string, 1)
+	updated := make(chan error, 1)
+	rollback := errors.New("rollback")
+	go func() {
+		<-written
+		go func() {
+			uncommitted, err := roleRepository.FindByID(role.ID)
+			if err != nil {
+				read <- err.Error()
+				return
+			}
+			read <- uncommitted.Name
+		}()
+		time.Sleep(50 * time.Millisecond) // the read waits for the transaction
+		concurrent := role
+		concurrent.Name = "concurrent"
+		updated <- roleRepository.Save(&concurrent)
+	}()
+	err := repository.NewMemoryTransactor(store).Transaction(func(tx repository.Tx) error {
+		changed := role
+		changed.Name = "uncommitted"
+		if err := roleRepository.WithTx(tx).Save(&changed); err != nil {
+			return err
+		}
+		close(written)
+		time.Sleep(200 * time.Millisecond)
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("Expected the transaction to be rolled back, got %v", err)
+	}
+
+	if name := <-read; name != "before" && name != "concurrent" {
+		t.Fatalf("Expected a committed name, got %q", name)
+	}
+	checkError(t, <-updated)
+	saved, err := roleRepository.FindByID(role.ID)
+	checkError(t, err)
+	if saved.Name != "concurrent" {
+		t.Fatalf("Expected the concurrent update to survive the rollback, got %q", saved.Name)
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "heimdall.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(db)
+
+	applied, err := migrator.Up()
+	checkError(t, err)
+	if len(applied) == 0 || applied[len(applied)-1].Version != migrator.LatestVersion() {
+		t.Fatalf("Expected all migrations to be applied, got %+v", applied)
+	}
+	if !db.Migrator().HasTable(&model.User{}) {
+		t.Fatalf("Expected the users table to exist")
+	}
+	if applied, err = migrator.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no pending migrations, got %+v (%v)", applied, err)
+	}
+
+	reverted, err := migrator.To(0)
+	checkError(t, err)
+	if len(reverted) != int(migrator.LatestVersion()) || reverted[0].Version != migrator.LatestVersion() {
+		t.Fatalf("Expected all migrations to be reverted newest first, got %+v", reverted)
+	}
+	if db.Migrator().HasTable(&model.User{}) {
+		t.Fatalf("Expected the users table to be dropped")
+	}
+	pending, err := migrator.Check()
+	checkError(t, err)
+	if pending != int(migrator.LatestVersion()) {
+		t.Fatalf("Expected %d pending migrations, got %d", migrator.LatestVersion(), pending)
+	}
+
+	// a schema of a newer version must be refused
+	checkError(t, db.Create(&model.SchemaMigration{Version: migrator.LatestVersion() + 1, Name: "future", AppliedAt: time.Now()}).Error)
+	if _, err := migrator.Check(); err == nil {
+		t.Fatalf("Expected an error for an unknown migration")
+	}
+	if _, err := migrator.Up(); err == nil {
+		t.Fatalf("Expected migrations to be refused for an unknown migration")
+	}
+}
+
+// the schema created by the migrations must match the models (changes of the models require a new migration)
+func TestMigrationsMatchModels(t *testing.T) {
+	migrated, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrated.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(migrated)
+	_, err = migrator.Up()
+	checkError(t, err)
+	models := []any{
+		&model.RegistrationKey{}, &model.Role{}, &model.User{}, &model.Token{}, &model.PasswordHistoryEntry{},
+		&model.Webhook{}, &model.WebhookDelivery{}, &model.OutboxEvent{}, &model.AuditEntry{}, &model.AuditChainHead{},
+		&model.AuditCheckpoint{}, &model.Session{},
+	}
+	expected, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "expected.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	checkError(t, expected.AutoMigrate(models...))
+
+	tables := []string{"user_roles"}
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: expected}
+		checkError(t, stmt.Parse(m))
+		tables = append(tables, stmt.Table)
+	}
+	for _, table := range tables {
+		if got, want := sqliteSchema(t, migrated, table), sqliteSchema(t, expected, table); !slices.Equal(got, want) {
+			t.Errorf("Schema of %s:\nmigrated: %v\nmodels:   %v", table, got, want)
+		}
+	}
+}
+
+// sqliteSchema returns the columns, indexes and foreign keys of a table
+func sqliteSchema(t *testing.T, db *gorm.DB, table string) []string {
+	var schema []string
+	for query, format := range map[string]string{
+		"SELECT name, type, \"notnull\", dflt_value, pk FROM pragma_table_info(?)":      "column %v %v notnull=%v default=%v pk=%v",
+		"SELECT name, \"unique\" FROM pragma_index_list(?)":                             "index %v unique=%v",
+		"SELECT \"from\", \"table\", \"to\", on_delete FROM pragma_foreign_key_list(?)": "foreign key %v -> %v.%v on delete %v",
+	} {
+		rows, err := db.Raw(query, table).Rows()
+		checkError(t, err)
+		columns, err := rows.Columns()
+		checkError(t, err)
+		for rows.Next() {
+			values := make([]any, len(columns))
+			pointers := make([]any, len(columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			checkError(t, rows.Scan(pointers...))
+			schema = append(schema, fmt.Sprintf(format, values...))
+		}
+		checkError(t, rows.Close())
+	}
+	slices.Sort(schema)
+	return schema
+}
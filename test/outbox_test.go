@@ -0,0 +1,168 @@
+package test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var outboxUser = &model.User{Model: model.Model{ID: 42}, Username: "outbox"}
+
+// newTestOutbox returns an outbox in a new database with a webhook that subscribes to user.created
+func newTestOutbox(t *testing.T) (*gorm.DB, service.OutboxService) {
+	pollInterval, retryInterval := config.OutboxPollInterval, config.OutboxRetryInterval
+	config.OutboxPollInterval, config.OutboxRetryInterval = 50*time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() { config.OutboxPollInterval, config.OutboxRetryInterval = pollInterval, retryInterval })
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "heimdall.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(db)
+	_, err = migrator.Up()
+	checkError(t, err)
+	transactor := repository.NewTransactor(db)
+	auditService := service.NewAuditService(transactor, repository.NewAuditRepository(db), nil, nil)
+	webhookService := service.NewWebhookService(repository.NewWebhookRepository(db), repository.NewWebhookDeliveryRepository(db), auditService)
+	tokenService := service.NewTokenService(repository.NewTokenRepository(db), repository.NewUserRepository(db),
+		broker.NewLocalBus(service.NewAuthBroker()), broker.NewLocalBus(service.NewUserCreateDeleteBroker()), webhookService, auditService)
+	outboxService := service.NewOutboxService(transactor, repository.NewOutboxRepository(db), repository.NewUserRepository(db), tokenService)
+	outboxService.Start()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(receiver.Close)
+	_, _, err = webhookService.Create(receiver.URL, "outbox test", []string{model.WebhookEventUserCreated}, "", true, model.SystemActor)
+	checkError(t, err)
+	return db, outboxService
+}
+
+// recordUserCreated records a user.created event in a transaction that fails with txErr (committed if nil)
+func recordUserCreated(outboxService service.OutboxService, txErr error) error {
+	return outboxService.Transaction(func(tx repository.Tx) error {
+		if err := outboxService.Record(tx, model.OutboxUserCreated, outboxUser); err != nil {
+			return err
+		}
+		return txErr
+	})
+}
+
+// waitForOutboxEvent waits until the event matches the condition
+func waitForOutboxEvent(t *testing.T, db *gorm.DB, id uint, condition func(event model.OutboxEvent) bool) model.OutboxEvent {
+	t.Helper()
+	var event model.OutboxEvent
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		checkError(t, db.First(&event, id).Error)
+		if condition(event) {
+			return event
+		}
+	}
+	t.Fatalf("Unexpected outbox event %+v", event)
+	return event
+}
+
+func countDeliveries(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	checkError(t, db.Model(&model.WebhookDelivery{}).Count(&count).Error)
+	return count
+}
+
+func TestOutboxRollback(t *testing.T) {
+	db, outboxService := newTestOutbox(t)
+	rollback := errors.New("rollback")
+	if err := recordUserCreated(outboxService, rollback); !errors.Is(err, rollback) {
+		t.Fatalf("Expected the error of the transaction, got %v", err)
+	}
+	var count int64
+	checkError(t, db.Model(&model.OutboxEvent{}).Count(&count).Error)
+	if count != 0 {
+		t.Fatalf("Expected no outbox event of a rolled back transaction, got %d", count)
+	}
+
+	checkError(t, recordUserCreated(outboxService, nil))
+	waitForOutboxEvent(t, db, 1, func(event model.OutboxEvent) bool { return event.DispatchedAt != nil })
+	if deliveries := countDeliveries(t, db); deliveries != 1 {
+		t.Fatalf("Expected one webhook delivery, got %d", deliveries)
+	}
+}
+
+func TestOutboxFailedDispatchRetried(t *testing.T) {
+	db, outboxService := newTestOutbox(t)
+	// the deliveries of the webhook cannot be stored
+	checkError(t, db.Migrator().RenameTable("webhook_deliveries", "webhook_deliveries_unavailable"))
+	checkError(t, recordUserCreated(outboxService, nil))
+	failed := waitForOutboxEvent(t, db, 1, func(event model.OutboxEvent) bool { return event.Attempts >= 1 })
+	if failed.DispatchedAt != nil || failed.LastError == "" || failed.PublishedAt == nil || failed.EnqueuedAt != nil {
+		t.Fatalf("Expected a failed dispatch after publishing the event, got %+v", failed)
+	}
+
+	checkError(t, db.Migrator().RenameTable("webhook_deliveries_unavailable", "webhook_deliveries"))
+	event := waitForOutboxEvent(t, db, 1, func(event model.OutboxEvent) bool { return event.DispatchedAt != nil })
+	if event.Attempts < 2 || event.LastError != "" {
+		t.Fatalf("Expected the event to be dispatched by a retry, got %+v", event)
+	}
+	// only the failed step is repeated
+	if event.EnqueuedAt == nil || !event.PublishedAt.Equal(*failed.PublishedAt) {
+		t.Fatalf("Expected the retry to only enqueue the deliveries, published at %v, got %+v", failed.PublishedAt, event)
+	}
+	if deliveries := countDeliveries(t, db); deliveries != 1 {
+		t.Fatalf("Expected one webhook delivery, got %d", deliveries)
+	}
+}
+
+func TestOutboxExpiredClaimDispatched(t *testing.T) {
+	db, _ := newTestOutbox(t)
+	// an event claimed by an instance that crashed while dispatching it (a claim postpones the next attempt)
+	claimedUntil := time.Now().Add(500 * time.Millisecond)
+	event := model.OutboxEvent{Type: model.OutboxUserCreated, Payload: `{"user_id":42,"username":"outbox"}`, Attempts: 1, NextAttemptAt: claimedUntil}
+	checkError(t, repository.NewOutboxRepository(db).Save(&event))
+
+	time.Sleep(200 * time.Millisecond)
+	checkError(t, db.First(&event, event.ID).Error)
+	if event.DispatchedAt != nil {
+		t.Fatalf("Expected the claimed event not to be dispatched before the claim expired, got %+v", event)
+	}
+	event = waitForOutboxEvent(t, db, event.ID, func(event model.OutboxEvent) bool { return event.DispatchedAt != nil })
+	if event.Attempts != 2 || event.DispatchedAt.Before(claimedUntil) {
+		t.Fatalf("Expected the event to be dispatched after the claim expired at %v, got %v", claimedUntil, event.DispatchedAt)
+	}
+}
+
+func TestOutboxEventsOfUserDispatchedInOrder(t *testing.T) {
+	db, _ := newTestOutbox(t)
+	outboxRepository := repository.NewOutboxRepository(db)
+	// the first event of the user cannot be dispatched (e.g. recorded by a newer instance)
+	events := []model.OutboxEvent{
+		{Type: "user.unknown", Payload: `{"user_id":42,"username":"outbox"}`, UserID: 42},
+		{Type: model.OutboxUserCreated, Payload: `{"user_id":42,"username":"outbox"}`, UserID: 42},
+		{Type: model.OutboxUserCreated, Payload: `{"user_id":43,"username":"other"}`, UserID: 43},
+	}
+	for i := range events {
+		events[i].NextAttemptAt = time.Now()
+		checkError(t, outboxRepository.Save(&events[i]))
+	}
+
+	waitForOutboxEvent(t, db, events[2].ID, func(event model.OutboxEvent) bool { return event.DispatchedAt != nil })
+	waitForOutboxEvent(t, db, events[0].ID, func(event model.OutboxEvent) bool { return event.Attempts >= 2 })
+	var blocked model.OutboxEvent
+	checkError(t, db.First(&blocked, events[1].ID).Error)
+	if blocked.Attempts != 0 || blocked.DispatchedAt != nil {
+		t.Fatalf("Expected the later event of the user to wait for the failed one, got %+v", blocked)
+	}
+
+	checkError(t, db.Model(&model.OutboxEvent{}).Where("id = ?", events[0].ID).Update("type", model.OutboxUserEnabled).Error)
+	first := waitForOutboxEvent(t, db, events[0].ID, func(event model.OutboxEvent) bool { return event.DispatchedAt != nil })
+	second := waitForOutboxEvent(t, db, events[1].ID, func(event model.OutboxEvent) bool { return event.DispatchedAt != nil })
+	if second.DispatchedAt.Before(*first.DispatchedAt) {
+		t.Fatalf("Expected the events of the user to be dispatched in order, got %v before %v", second.DispatchedAt, first.DispatchedAt)
+	}
+}
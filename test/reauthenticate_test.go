@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReauthenticate(t *testing.T) {
+	maxAge := config.RecentAuthenticationMaxAge
+	config.RecentAuthenticationMaxAge = 2 * time.Second
+	t.Cleanup(func() { config.RecentAuthenticationMaxAge = maxAge })
+
+	app := setup.SetupTest()
+	cookie := login(t, app)
+
+	// recently authenticated by the login
+	expect2xxStatus(t, sendRequest(t, app, cookie, "PUT", "/users/3/disable", handler.DisableUserPayload{Reason: "test"}))
+	expect2xxStatus(t, sendRequest(t, app, cookie, "DELETE", "/users/3/disable", nil))
+	expect2xxStatus(t, sendRequest(t, app, cookie, "PUT", "/roles/1/users/3", nil))
+	expect2xxStatus(t, sendRequest(t, app, cookie, "DELETE", "/roles/1/users/3", nil))
+
+	// stale authenticated_at (stored in seconds)
+	time.Sleep(3 * time.Second)
+	expectStatus(t, sendRequest(t, app, cookie, "PUT", "/roles/1/users/3", nil), fiber.StatusForbidden)
+	expectStatus(t, sendRequest(t, app, cookie, "DELETE", "/roles/2/users/2", nil), fiber.StatusForbidden)
+	expectStatus(t, sendRequest(t, app, cookie, "PUT", "/users/3/disable", handler.DisableUserPayload{Reason: "test"}), fiber.StatusForbidden)
+	expectStatus(t, sendRequest(t, app, cookie, "DELETE", "/users/3/disable", nil), fiber.StatusForbidden)
+
+	expectStatus(t, sendRequest(t, app, cookie, "POST", "/reauthenticate", handler.ReauthenticatePayload{Password: "wrong-password"}), fiber.StatusUnauthorized)
+	expectStatus(t, sendRequest(t, app, cookie, "PUT", "/roles/1/users/3", nil), fiber.StatusForbidden)
+	expect2xxStatus(t, sendRequest(t, app, cookie, "POST", "/reauthenticate", handler.ReauthenticatePayload{Password: TESTPASSWORD}))
+	expect2xxStatus(t, sendRequest(t, app, cookie, "PUT", "/roles/1/users/3", nil))
+}
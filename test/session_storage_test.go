@@ -0,0 +1,58 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMemorySessionStorage(t *testing.T) {
+	testSessionStorage(t, repository.NewMemorySessionStorage(time.Minute))
+}
+
+func TestDatabaseSessionStorage(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "heimdall.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(db)
+	_, err = migrator.Up()
+	checkError(t, err)
+	testSessionStorage(t, repository.NewSessionStorage(db, time.Minute))
+}
+
+func testSessionStorage(t *testing.T, storage repository.SessionStorage) {
+	defer storage.Close()
+	checkError(t, storage.Ping(context.Background()))
+
+	checkError(t, storage.Set("session", []byte("data"), time.Hour))
+	checkError(t, storage.Set("session", []byte("updated"), time.Hour))
+	checkError(t, storage.Set("expired", []byte("data"), time.Millisecond))
+	checkError(t, storage.Set("forever", []byte("data"), 0))
+	time.Sleep(10 * time.Millisecond)
+
+	expectSession(t, storage, "session", "updated")
+	expectSession(t, storage, "expired", "")
+	expectSession(t, storage, "forever", "data")
+	expectSession(t, storage, "unknown", "")
+
+	checkError(t, storage.Delete("session"))
+	expectSession(t, storage, "session", "")
+	checkError(t, storage.Reset())
+	expectSession(t, storage, "forever", "")
+}
+
+func expectSession(t *testing.T, storage repository.SessionStorage, key, expected string) {
+	data, err := storage.Get(key)
+	checkError(t, err)
+	if string(data) != expected {
+		t.Fatalf("Expected session %s to be %q, got %q", key, expected, data)
+	}
+	if expected == "" && data != nil {
+		t.Fatalf("Expected no data of missing session %s", key)
+	}
+}
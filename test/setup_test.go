@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
 
@@ -15,8 +16,8 @@ import (
 )
 
 // Prerequisites:
-// running PostgreSQL and Redis instance
-// test database as in setup/setupTestDatabase
+// running PostgreSQL and Redis instance if DB_DRIVER=postgres (the tests run in memory by default)
+// test data as in setup/createTestData (created by setup.SetupTest, which deletes all data first)
 // users: Admin(id=1,password=password1234), User(id=2,password=password1234)
 // roles: admin(id=1), test=(id=2)
 // user_roles: user Admin(id=1) has role admin(id=1)
@@ -30,6 +31,12 @@ const (
 	TESTPASSWORD = "password1234"
 )
 
+func init() {
+	if os.Getenv("DB_DRIVER") == "" {
+		config.DatabaseDriver = "memory"
+	}
+}
+
 func checkError(t *testing.T, err error) {
 	if err != nil {
 		t.Fatalf("Error: %s", err.Error())
@@ -48,6 +55,12 @@ func expect404Status(t *testing.T, resp *http.Response) {
 	}
 }
 
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	if resp.StatusCode != status {
+		t.Fatalf("Bad status code: Expected %d, got %d", status, resp.StatusCode)
+	}
+}
+
 func readBodyAsJson(t *testing.T, resp *http.Response, jsonType any) {
 	body, err := io.ReadAll(resp.Body)
 	checkError(t, err)
@@ -79,8 +92,7 @@ func login(t *testing.T, app *fiber.App) string {
 
 func RunRequest(t *testing.T, req *http.Request) *http.Response {
 	// start := time.Now()
-	config.UseTestDatabase = true
-	app := setup.Setup()
+	app := setup.SetupTest()
 	// t.Logf("Setup time: %v", time.Since(start))
 	cookie := login(t, app)
 
@@ -94,8 +106,7 @@ func RunRequest(t *testing.T, req *http.Request) *http.Response {
 }
 
 func RunMultiRequest(t *testing.T, reqs ...*http.Request) []*http.Response {
-	config.UseTestDatabase = true
-	app := setup.Setup()
+	app := setup.SetupTest()
 	cookie := login(t, app)
 	resps := make([]*http.Response, len(reqs))
 	for i, req := range reqs {
@@ -109,3 +120,18 @@ func RunMultiRequest(t *testing.T, reqs ...*http.Request) []*http.Response {
 	}
 	return resps
 }
+
+// sendRequest sends a request with the session cookie and the payload as JSON body (if not nil)
+func sendRequest(t *testing.T, app *fiber.App, cookie, method, path string, payload any) *http.Response {
+	req, err := http.NewRequest(method, URL+path, http.NoBody)
+	checkError(t, err)
+	if payload != nil {
+		req, err = http.NewRequest(method, URL+path, payloadToReader(t, payload))
+		checkError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+	}
+	req.Header.Add("Cookie", cookie)
+	resp, err := app.Test(req)
+	checkError(t, err)
+	return resp
+}
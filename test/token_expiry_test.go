@@ -0,0 +1,130 @@
+package test
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/broker"
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// waitForAuthUpdate waits for the next auth update of the subscription
+func waitForAuthUpdate(t *testing.T, sub *broker.Subscription[*model.AuthUpdateMessage]) *model.AuthUpdateMessage {
+	t.Helper()
+	select {
+	case <-sub.Ready():
+		events := sub.Drain()
+		return events[len(events)-1].Message
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected an auth update")
+		return nil
+	}
+}
+
+func TestTokenExpiryAnnounced(t *testing.T) {
+	expiryWarning := config.ApiTokenExpiryWarning
+	config.ApiTokenExpiryWarning = 2500 * time.Millisecond // the scheduler sleeps at least a second
+	t.Cleanup(func() { config.ApiTokenExpiryWarning = expiryWarning })
+
+	store := repository.NewMemoryStore()
+	userRepository := repository.NewMemoryUserRepository(store)
+	tokenRepository := repository.NewMemoryTokenRepository(store)
+	expiresAt := time.Now().Add(3 * time.Second)
+	for i, name := range []string{"expiring", "permanent"} {
+		user := model.User{Username: name}
+		checkError(t, userRepository.Save(&user))
+		checkError(t, tokenRepository.Save(&model.Token{UserID: user.ID, Token: name + "-token", Permanent: i == 1, ExpiresAt: expiresAt}))
+	}
+
+	auditService := service.NewAuditService(repository.NewMemoryTransactor(store), repository.NewMemoryAuditRepository(store), nil, nil)
+	webhookService := service.NewWebhookService(repository.NewMemoryWebhookRepository(store), repository.NewMemoryWebhookDeliveryRepository(store), auditService)
+	webhookService.Start()
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	_, _, err := webhookService.Create(server.URL, "expiry test", []string{model.WebhookEventTokenExpiring, model.WebhookEventTokenExpired}, "", true, model.SystemActor)
+	checkError(t, err)
+	authBus := broker.NewLocalBus(service.NewAuthBroker())
+	expiring := authBus.Broker().Subscribe("expiring")
+	permanent := authBus.Broker().Subscribe("permanent")
+	tokenService := service.NewTokenService(tokenRepository, userRepository, authBus, broker.NewLocalBus(service.NewUserCreateDeleteBroker()), webhookService, auditService)
+	tokenService.Start()
+
+	warning := waitForAuthUpdate(t, expiring)
+	if warning.ExpiryEvent != model.AuthExpiring || warning.Token != "expiring-token" || !time.Now().Before(expiresAt) {
+		t.Fatalf("Expected a warning before the token expires at %v, got %+v at %v", expiresAt, warning, time.Now())
+	}
+	expired := waitForAuthUpdate(t, expiring)
+	if expired.ExpiryEvent != model.AuthExpired || time.Now().Before(expiresAt) {
+		t.Fatalf("Expected the expiry after %v, got %+v at %v", expiresAt, expired, time.Now())
+	}
+	select {
+	case <-expiring.Done(): // the connections using the expired token are closed
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the subscription of the expired token to be closed")
+	}
+
+	if permanent.Len() != 0 {
+		t.Fatalf("Expected no announcements of a permanent token, got %+v", permanent.Drain())
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(receiver.eventTypes()) < 2 && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if events := receiver.eventTypes(); !slices.Equal(events, []string{model.WebhookEventTokenExpiring, model.WebhookEventTokenExpired}) {
+		t.Fatalf("Expected the webhook to receive the warning and the expiry of one token, got %v", events)
+	}
+
+	// only the token whose expiry was announced is deleted
+	deleted, err := tokenRepository.DeleteAllExpiredNonPermanent()
+	checkError(t, err)
+	if deleted != 1 {
+		t.Fatalf("Expected the expired token to be deleted, got %d deleted tokens", deleted)
+	}
+}
+
+// an expired token is only deleted after its subscribers were notified about the expiry
+func TestExpiredTokenDeletedAfterNotification(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "heimdall.db")), &gorm.Config{Logger: logger.Discard})
+	checkError(t, err)
+	migrator := repository.NewMigrator(db)
+	_, err = migrator.Up()
+	checkError(t, err)
+	store := repository.NewMemoryStore()
+	for name, repositories := range map[string]struct {
+		users  repository.UserRepository
+		tokens repository.TokenRepository
+	}{
+		"gorm":   {repository.NewUserRepository(db), repository.NewTokenRepository(db)},
+		"memory": {repository.NewMemoryUserRepository(store), repository.NewMemoryTokenRepository(store)},
+	} {
+		user := model.User{Username: "expired"}
+		checkError(t, repositories.users.Save(&user))
+		token := model.Token{UserID: user.ID, Token: "expired-token", ExpiresAt: time.Now().Add(-time.Minute)}
+		checkError(t, repositories.tokens.Save(&token))
+
+		deleted, err := repositories.tokens.DeleteAllExpiredNonPermanent()
+		checkError(t, err)
+		if deleted != 0 {
+			t.Fatalf("%s: Expected the unannounced token to be kept, got %d deleted tokens", name, deleted)
+		}
+		claimed, err := repositories.tokens.ClaimExpiry(&token)
+		checkError(t, err)
+		if !claimed {
+			t.Fatalf("%s: Expected the expiry to be claimed", name)
+		}
+		deleted, err = repositories.tokens.DeleteAllExpiredNonPermanent()
+		checkError(t, err)
+		if deleted != 1 {
+			t.Fatalf("%s: Expected the announced token to be deleted, got %d deleted tokens", name, deleted)
+		}
+	}
+}
@@ -1,5 +1,167 @@
 package test
 
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+	"github.com/gofiber/fiber/v2"
+)
+
 // TODO: implement user tests
 // TODO: implement "anti-tests": test failing paths (bad requests, not founds, unauthorized, forbidden, ...)
 // TODO: maybe implement mocking for PostgreSQL and Redis
+
+func TestCheckPassword(t *testing.T) {
+	payload := handler.CheckPasswordPayload{
+		Username: "User",
+		Email:    "user@example.com",
+		Password: "correct horse battery staple",
+	}
+	req, err := http.NewRequest("POST", URL+"/password-check", payloadToReader(t, payload))
+	checkError(t, err)
+
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+
+	var result model.PasswordCheckResult
+	readBodyAsJson(t, resp, &result)
+	if !result.Valid {
+		t.Fatalf("Expected password to be valid, got violations: %v", result.Violations)
+	}
+}
+
+// password checks have their own rate limit, so checking a password while typing it does not use up the logins
+func TestCheckPasswordRateLimitSeparate(t *testing.T) {
+	app := setup.SetupTest()
+	payload := handler.CheckPasswordPayload{Username: "User", Email: "user@example.com", Password: "correct horse battery staple"}
+	for range config.UnauthorizedRateLimit.Get() + 1 {
+		req, err := http.NewRequest("POST", URL+"/password-check", payloadToReader(t, payload))
+		checkError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		checkError(t, err)
+		expect2xxStatus(t, resp)
+	}
+	login(t, app)
+}
+
+func TestCheckPasswordContainingUsername(t *testing.T) {
+	payload := handler.CheckPasswordPayload{
+		Username: "User",
+		Email:    "user@example.com",
+		Password: "User-password-1234",
+	}
+	req, err := http.NewRequest("POST", URL+"/password-check", payloadToReader(t, payload))
+	checkError(t, err)
+
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+
+	var result model.PasswordCheckResult
+	readBodyAsJson(t, resp, &result)
+	if result.Valid {
+		t.Fatalf("Expected password containing the username to be rejected")
+	}
+}
+
+func TestCheckPasswordTooLong(t *testing.T) {
+	payload := handler.CheckPasswordPayload{
+		Username: "User",
+		Password: strings.Repeat("correct horse battery staple ", 70), // would take zxcvbn minutes
+	}
+	req, err := http.NewRequest("POST", URL+"/password-check", payloadToReader(t, payload))
+	checkError(t, err)
+
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+
+	var result model.PasswordCheckResult
+	readBodyAsJson(t, resp, &result)
+	if result.Valid || len(result.Violations) != 1 {
+		t.Fatalf("Expected only the length violation, got %v", result.Violations)
+	}
+}
+
+func setPasswordHistoryLength(t *testing.T, length int) {
+	historyLength := config.PasswordHistoryLength
+	config.PasswordHistoryLength = length
+	t.Cleanup(func() { config.PasswordHistoryLength = historyLength })
+}
+
+// changeUserPassword lets the admin change the password of the test user User (id 3)
+func changeUserPassword(t *testing.T, app *fiber.App, cookie, password string) *http.Response {
+	payload := handler.UpdateUserPayload{Username: "User", Email: "user@example.com", Password: password}
+	req, err := http.NewRequest("PUT", URL+"/users/3", payloadToReader(t, payload))
+	checkError(t, err)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cookie", cookie)
+	resp, err := app.Test(req, -1) // compares the password with every previous password hash
+	checkError(t, err)
+	return resp
+}
+
+func TestPasswordHistory(t *testing.T) {
+	setPasswordHistoryLength(t, 2)
+	app := setup.SetupTest()
+	cookie := login(t, app)
+
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "first new password"))
+	expectStatus(t, changeUserPassword(t, app, cookie, TESTPASSWORD), fiber.StatusBadRequest)
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "second new password"))
+	expectStatus(t, changeUserPassword(t, app, cookie, TESTPASSWORD), fiber.StatusBadRequest)
+	expectStatus(t, changeUserPassword(t, app, cookie, "first new password"), fiber.StatusBadRequest)
+
+	// the initial password is removed from the history by the third change
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "third new password"))
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, TESTPASSWORD))
+	expectStatus(t, changeUserPassword(t, app, cookie, "third new password"), fiber.StatusBadRequest)
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "first new password"))
+}
+
+func TestPasswordHistoryDisabled(t *testing.T) {
+	setPasswordHistoryLength(t, 0)
+	app := setup.SetupTest()
+	cookie := login(t, app)
+
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "first new password"))
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, TESTPASSWORD))
+	expect2xxStatus(t, changeUserPassword(t, app, cookie, "first new password"))
+}
+
+// the password history is written in the transaction of the password change
+func TestPasswordHistoryFailureRollsBackPasswordChange(t *testing.T) {
+	setPasswordHistoryLength(t, 2)
+	db, userService, _ := newTestUserService(t)
+	checkError(t, userService.Create("History", "first password 1234", "history@example.com", model.SystemActor))
+	user, err := userService.GetByName("History")
+	checkError(t, err)
+
+	checkError(t, db.Migrator().RenameTable("password_history_entries", "password_history_entries_unavailable"))
+	if err := userService.Update(user.ID, user.Username, "second password 1234", user.Email, model.SystemActor); err == nil {
+		t.Fatal("Expected the password change to fail without the password history")
+	}
+	unchanged, err := userService.GetByID(user.ID)
+	checkError(t, err)
+	if !crypto.PasswordMatchesHash("first password 1234", unchanged.Password) {
+		t.Fatal("Expected the password change to be rolled back")
+	}
+	var events int64
+	checkError(t, db.Model(&model.OutboxEvent{}).Where("type = ?", model.OutboxCredentialsChanged).Count(&events).Error)
+	if events != 0 {
+		t.Fatalf("Expected no credentials change to be recorded, got %d", events)
+	}
+
+	checkError(t, db.Migrator().RenameTable("password_history_entries_unavailable", "password_history_entries"))
+	checkError(t, userService.Update(user.ID, user.Username, "second password 1234", user.Email, model.SystemActor))
+	var history []model.PasswordHistoryEntry
+	checkError(t, db.Where("user_id = ?", user.ID).Find(&history).Error)
+	if len(history) != 1 || !crypto.PasswordMatchesHash("first password 1234", history[0].Password) {
+		t.Fatalf("Expected the replaced password in the history, got %+v", history)
+	}
+}
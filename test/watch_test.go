@@ -0,0 +1,130 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/setup"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// user Live(id=2) has the deploy role and watches all users
+const watcherID = "2"
+
+func TestWatchClosedWhenWatcherTokenRevoked(t *testing.T) {
+	testWatchClosed(t, "DELETE", "/users/"+watcherID+"/api-token")
+}
+
+func TestWatchClosedWhenWatcherLosesDeployRole(t *testing.T) {
+	testWatchClosed(t, "DELETE", "/roles/2/users/"+watcherID)
+}
+
+// testWatchClosed expects the multiplexed watch stream of Live to be closed after the request
+func testWatchClosed(t *testing.T, method, path string) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	resp := sendRequest(t, app, cookie, "GET", "/users/"+watcherID+"/api-token", nil)
+	expect2xxStatus(t, resp)
+	var token model.Token
+	readBodyAsJson(t, resp, &token)
+
+	body := make(chan string, 1)
+	go func() {
+		req, err := http.NewRequest("GET", URL+"/internal/watch", http.NoBody)
+		checkError(t, err)
+		req.Header.Add("Authorization", token.Token)
+		req.Header.Add("X-Real-Ip", "127.0.0.1")
+		resp, err := app.Test(req, -1) // returns when the stream is closed
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		bs, _ := io.ReadAll(resp.Body)
+		body <- string(bs)
+	}()
+	time.Sleep(200 * time.Millisecond) // connected (closed by the check after subscribing otherwise)
+
+	resp = sendRequest(t, app, cookie, method, path, nil)
+	expect2xxStatus(t, resp)
+	select {
+	case stream := <-body:
+		if !strings.Contains(stream, "event: auth") {
+			t.Fatalf("Expected the snapshot before the stream was closed, got %q", stream)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the watch stream to be closed")
+	}
+
+	// reconnecting with the old credentials fails
+	req, err := http.NewRequest("GET", URL+"/internal/watch", http.NoBody)
+	checkError(t, err)
+	req.Header.Add("Authorization", token.Token)
+	req.Header.Add("X-Real-Ip", "127.0.0.1")
+	resp, err = app.Test(req, 1000)
+	checkError(t, err)
+	if resp.StatusCode != fiber.StatusUnauthorized && resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("Expected the old credentials to be refused, got %d", resp.StatusCode)
+	}
+}
+
+// user User(id=3) subscribes to its own changes over WebSocket
+func TestWebSocketResubscribeAfterTokenRegenerationRejected(t *testing.T) {
+	app := setup.SetupTest()
+	cookie := login(t, app)
+	resp := sendRequest(t, app, cookie, "GET", "/users/3/api-token", nil)
+	expect2xxStatus(t, resp)
+	var token model.Token
+	readBodyAsJson(t, resp, &token)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	checkError(t, err)
+	go func() { _ = app.Listener(ln) }()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/internal/ws/authenticate",
+		http.Header{"Authorization": {token.Token}})
+	checkError(t, err)
+	defer conn.Close()
+	subscribe := model.WebSocketRequest{Action: model.WebSocketSubscribe, Usernames: []string{"User"}}
+	checkError(t, conn.WriteJSON(subscribe))
+	if msg := readWebSocketMessage(t, conn); msg.Type != model.WebSocketAuthMessage {
+		t.Fatalf("Expected the current state, got %+v", msg)
+	}
+
+	resp = sendRequest(t, app, cookie, "DELETE", "/users/3/api-token", nil)
+	expect2xxStatus(t, resp)
+	if msg := readWebSocketMessage(t, conn); msg.Type != model.WebSocketClosedMessage || msg.Username != "User" {
+		t.Fatalf("Expected the subscription to be closed, got %+v", msg)
+	}
+
+	// resubscribing with the regenerated token must not send the new token
+	_ = conn.WriteJSON(subscribe)
+	for {
+		var msg model.WebSocketMessage
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("Expected the connection to be closed")
+			}
+			return // closed
+		}
+		if msg.Type == model.WebSocketAuthMessage {
+			t.Fatalf("Expected the resubscription to be rejected, got %+v", msg)
+		}
+	}
+}
+
+func readWebSocketMessage(t *testing.T, conn *websocket.Conn) model.WebSocketMessage {
+	var msg model.WebSocketMessage
+	checkError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	checkError(t, conn.ReadJSON(&msg))
+	return msg
+}
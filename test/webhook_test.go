@@ -0,0 +1,197 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ProjectLighthouseCAU/heimdall/config"
+	"github.com/ProjectLighthouseCAU/heimdall/crypto"
+	"github.com/ProjectLighthouseCAU/heimdall/handler"
+	"github.com/ProjectLighthouseCAU/heimdall/model"
+	"github.com/ProjectLighthouseCAU/heimdall/repository"
+	"github.com/ProjectLighthouseCAU/heimdall/service"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	message := []byte(`1700000000.{"id":"1","type":"user.created"}`)
+	signature := crypto.SignHMACSHA256(secret, message)
+	if len(signature) != 64 {
+		t.Fatalf("Expected hex encoded SHA-256 HMAC, got %q", signature)
+	}
+	if !crypto.VerifyHMACSHA256(secret, message, signature) {
+		t.Fatalf("Expected signature to be valid")
+	}
+	if crypto.VerifyHMACSHA256([]byte("another secret!!"), message, signature) {
+		t.Fatalf("Expected signature with different secret to be invalid")
+	}
+	if crypto.VerifyHMACSHA256(secret, append(message, ' '), signature) {
+		t.Fatalf("Expected signature of modified message to be invalid")
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	payload := handler.CreateWebhookPayload{
+		URL:     "https://example.com/hooks/heimdall",
+		Events:  []string{model.WebhookEventUserCreated, model.WebhookEventTokenRegenerated},
+		Enabled: true,
+	}
+	req, err := http.NewRequest("POST", URL+"/webhooks", payloadToReader(t, payload))
+	checkError(t, err)
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+
+	var created handler.CreateWebhookResponse
+	readBodyAsJson(t, resp, &created)
+	if created.ID == 0 || created.URL != payload.URL || len(created.Events) != 2 {
+		t.Fatalf("Unexpected webhook: %+v", created)
+	}
+	if len(created.Secret) == 0 {
+		t.Fatalf("Expected a generated secret")
+	}
+}
+
+func TestCreateWebhookUnknownEvent(t *testing.T) {
+	payload := handler.CreateWebhookPayload{
+		URL:    "https://example.com/hooks/heimdall",
+		Events: []string{"user.exploded"},
+	}
+	req, err := http.NewRequest("POST", URL+"/webhooks", payloadToReader(t, payload))
+	checkError(t, err)
+	resp := RunRequest(t, req)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Bad status code: Expected %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestGetDeadLetters(t *testing.T) {
+	req, err := http.NewRequest("GET", URL+"/webhooks/dead-letters", http.NoBody)
+	checkError(t, err)
+	resp := RunRequest(t, req)
+	expect2xxStatus(t, resp)
+	var deliveries []model.WebhookDelivery
+	readBodyAsJson(t, resp, &deliveries)
+}
+
+// webhookReceiver responds with an error to the first failures requests and records the time of every request
+type webhookReceiver struct {
+	lock       sync.Mutex
+	failures   int
+	deliveries []string // X-Heimdall-Delivery of every request
+	events     []string // X-Heimdall-Event of every request
+	times      []time.Time
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.deliveries = append(r.deliveries, req.Header.Get("X-Heimdall-Delivery"))
+	r.events = append(r.events, req.Header.Get("X-Heimdall-Event"))
+	r.times = append(r.times, time.Now())
+	if len(r.deliveries) <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (r *webhookReceiver) requests() ([]string, []time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.deliveries...), append([]time.Time(nil), r.times...)
+}
+
+func (r *webhookReceiver) eventTypes() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// newTestWebhookService returns a webhook service in memory with a webhook that subscribes to user.created
+// (retried after 100ms, 200ms, 200ms, ... and dead after three attempts)
+func newTestWebhookService(t *testing.T, receiver *webhookReceiver) service.WebhookService {
+	maxAttempts, initialBackoff, maxBackoff, workerInterval := config.WebhookMaxAttempts, config.WebhookInitialBackoff, config.WebhookMaxBackoff, config.WebhookWorkerInterval
+	config.WebhookMaxAttempts, config.WebhookInitialBackoff, config.WebhookMaxBackoff, config.WebhookWorkerInterval = 3, 100*time.Millisecond, 200*time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() {
+		config.WebhookMaxAttempts, config.WebhookInitialBackoff, config.WebhookMaxBackoff, config.WebhookWorkerInterval = maxAttempts, initialBackoff, maxBackoff, workerInterval
+	})
+
+	store := repository.NewMemoryStore()
+	auditService := service.NewAuditService(repository.NewMemoryTransactor(store), repository.NewMemoryAuditRepository(store), nil, nil)
+	webhookService := service.NewWebhookService(repository.NewMemoryWebhookRepository(store), repository.NewMemoryWebhookDeliveryRepository(store), auditService)
+	webhookService.Start()
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	_, _, err := webhookService.Create(server.URL, "retry test", []string{model.WebhookEventUserCreated}, "", true, model.SystemActor)
+	checkError(t, err)
+	return webhookService
+}
+
+// waitForDelivery waits until the only delivery of the webhook is no longer pending
+func waitForDelivery(t *testing.T, webhookService service.WebhookService) model.WebhookDelivery {
+	t.Helper()
+	var deliveries []model.WebhookDelivery
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		var err error
+		deliveries, err = webhookService.GetDeliveries(1, 10)
+		checkError(t, err)
+		if len(deliveries) == 1 && deliveries[0].Status != model.WebhookDeliveryPending {
+			return deliveries[0]
+		}
+	}
+	t.Fatalf("Expected a finished delivery, got %+v", deliveries)
+	return model.WebhookDelivery{}
+}
+
+func TestWebhookRetriedWithBackoff(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2}
+	webhookService := newTestWebhookService(t, receiver)
+	checkError(t, webhookService.Dispatch(model.WebhookEventUserCreated, model.WebhookUserEventData{UserID: 42, Username: "webhook"}))
+
+	delivery := waitForDelivery(t, webhookService)
+	if delivery.Status != model.WebhookDeliveryDelivered || delivery.Attempts != 3 || delivery.LastStatusCode != http.StatusOK || delivery.LastError != "" {
+		t.Fatalf("Expected the delivery to succeed with the third attempt, got %+v", delivery)
+	}
+	deliveryIDs, times := receiver.requests()
+	if len(deliveryIDs) != 3 || deliveryIDs[0] != delivery.EventID || deliveryIDs[2] != delivery.EventID {
+		t.Fatalf("Expected three requests of event %s, got %v", delivery.EventID, deliveryIDs)
+	}
+	for i, backoff := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		if elapsed := times[i+1].Sub(times[i]); elapsed < backoff {
+			t.Fatalf("Expected retry %d after at least %v, got %v", i+1, backoff, elapsed)
+		}
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	receiver := &webhookReceiver{failures: 3}
+	webhookService := newTestWebhookService(t, receiver)
+	checkError(t, webhookService.Dispatch(model.WebhookEventUserCreated, model.WebhookUserEventData{UserID: 42, Username: "webhook"}))
+
+	delivery := waitForDelivery(t, webhookService)
+	if delivery.Status != model.WebhookDeliveryDead || delivery.Attempts != 3 || delivery.LastStatusCode != http.StatusServiceUnavailable || delivery.LastError == "" {
+		t.Fatalf("Expected the delivery to be dead after three attempts, got %+v", delivery)
+	}
+	time.Sleep(300 * time.Millisecond) // longer than the backoff
+	if deliveryIDs, _ := receiver.requests(); len(deliveryIDs) != 3 {
+		t.Fatalf("Expected no attempts of a dead delivery, got %d requests", len(deliveryIDs))
+	}
+	deadLetters, err := webhookService.GetDeadLetters(10)
+	checkError(t, err)
+	if len(deadLetters) != 1 || deadLetters[0].ID != delivery.ID {
+		t.Fatalf("Expected the delivery in the dead-letter list, got %+v", deadLetters)
+	}
+
+	// the receiver works again
+	checkError(t, webhookService.Redeliver(delivery.ID))
+	delivery = waitForDelivery(t, webhookService)
+	if delivery.Status != model.WebhookDeliveryDelivered || delivery.Attempts != 1 {
+		t.Fatalf("Expected the redelivery to succeed, got %+v", delivery)
+	}
+	deadLetters, err = webhookService.GetDeadLetters(10)
+	checkError(t, err)
+	if len(deadLetters) != 0 {
+		t.Fatalf("Expected an empty dead-letter list, got %+v", deadLetters)
+	}
+}